@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/config"
+	"github.com/atindraraut/crudgo/storage/mongodb"
+)
+
+// migrate applies pending MongoDB schema migrations, or with -status just
+// reports the current and latest versions.
+func main() {
+	statusOnly := flag.Bool("status", false, "print schema version and exit")
+	cfg := config.MustLoadConfig()
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+	if cfg.StorageDriver != "mongodb" {
+		log.Fatalf("storage_driver is %q; migrations only apply to mongodb", cfg.StorageDriver)
+	}
+
+	db, err := mongodb.Connect(cfg)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %s", err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	defer db.Close(ctx)
+
+	current, err := db.SchemaVersion(ctx)
+	if err != nil {
+		log.Fatalf("failed to read schema version: %s", err.Error())
+	}
+	fmt.Printf("schema version %d (latest %d)\n", current, mongodb.LatestSchemaVersion())
+	// Migrations don't need transactions, but accepting ownership
+	// transfers does
+	if err := db.CheckTransactions(ctx); err != nil {
+		fmt.Printf("warning: %s\n", err.Error())
+	}
+	if *statusOnly {
+		return
+	}
+	if err := db.Migrate(ctx); err != nil {
+		log.Fatalf("migration failed: %s", err.Error())
+	}
+	fmt.Printf("schema is at version %d\n", mongodb.LatestSchemaVersion())
+}
@@ -16,16 +16,34 @@ import (
 	"github.com/atindraraut/crudgo/internal/http/handlers/user"
 	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
 	"github.com/atindraraut/crudgo/internal/utils/middleware"
+	"github.com/atindraraut/crudgo/storage"
+	"github.com/atindraraut/crudgo/storage/memory"
 	"github.com/atindraraut/crudgo/storage/mongodb"
 )
 
 func main() {
 	//load config
 	cfg := config.MustLoadConfig()
-	//initialize OAuth configuration
-	auth.InitOAuthConfig(cfg.OAuthClientID, cfg.OAuthSecret, cfg.OAuthRedirectURL)
+	//token signing keys
+	if err := auth.InitSigningKeys(cfg.SECRET_KEY, cfg.JWTKeys, cfg.JWTAcceptHS256); err != nil {
+		log.Fatalf("failed to load signing keys: %s", err.Error())
+	}
+	//sign-in providers
+	if err := auth.InitIdentityProviders(cfg.OAuthProviders); err != nil {
+		log.Fatalf("failed to set up sign-in providers: %s", err.Error())
+	}
+	//links in outgoing emails point at the frontend
+	auth.InitFrontendURL(cfg.FrontendURL)
+	//passkeys are bound to the frontend's origin
+	if err := auth.InitWebAuthn(cfg.WebAuthn); err != nil {
+		log.Fatalf("failed to set up passkeys: %s", err.Error())
+	}
+	//client IPs come from X-Forwarded-For only behind these proxies
+	if err := middleware.InitTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("failed to load trusted proxies: %s", err.Error())
+	}
 	//database setup
-	storage, err := mongodb.New(cfg)
+	storage, err := newStorage(cfg)
 	if err != nil {
 		log.Fatalf("failed to connect to database: %s", err.Error())
 	}
@@ -66,3 +84,16 @@ func main() {
 		slog.Info("Server stopped gracefully")
 	}
 }
+
+// newStorage returns the storage backend selected by cfg.StorageDriver.
+func newStorage(cfg *config.Config) (storage.Storage, error) {
+	if cfg.StorageDriver == "memory" {
+		slog.Warn("Using in-memory storage; data will not survive a restart")
+		return memory.New(), nil
+	}
+	mdb, err := mongodb.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return mdb, nil
+}
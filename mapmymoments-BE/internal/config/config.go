@@ -11,15 +11,68 @@ import (
 type HTTPServer struct {
 	ADDR string `yaml:"address" env:"ADDR" env-default:"localhost:8080"`
 }
+
+// JWTKey is a token signing key. The first of Config.JWTKeys signs new
+// tokens, the others are only used to verify, so a retired key keeps
+// working until the tokens it signed have expired.
+type JWTKey struct {
+	ID             string `yaml:"id"`
+	Algorithm      string `yaml:"algorithm"` // "RS256" or "EdDSA"
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"` // enough for keys that only verify
+}
+
+// OAuthProvider configures sign-in with one identity provider. Providers
+// are keyed by name ("google", "github", "microsoft" or "apple") in
+// Config.OAuthProviders.
+type OAuthProvider struct {
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	RedirectURL  string `yaml:"redirect_url"`
+	// Microsoft only: the Azure AD tenant, "common" if empty
+	Tenant string `yaml:"tenant"`
+	// Apple only: Apple has no static client secret, we sign one with
+	// this key instead
+	TeamID         string `yaml:"team_id"`
+	KeyID          string `yaml:"key_id"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+}
+
+// WebAuthn configures passkeys. Both settings default to the frontend's
+// host and origin, which is where the browser runs the ceremonies.
+type WebAuthn struct {
+	RPID      string   `yaml:"rp_id" env:"WEBAUTHN_RP_ID"`
+	RPOrigins []string `yaml:"rp_origins"`
+}
+
 type Config struct {
 	Env              string `yaml:"env" env:"ENV" env-required:"true"` //these are called struct tags in golang
 	HTTPServer       `yaml:"http_address" env-required:"true"`
-	SECRET_KEY       string `yaml:"secret_key" env-required:"true"`
-	MongoURI         string `yaml:"mongo_uri" env-required:"true"`
-	MongoDatabase    string `yaml:"mongo_db" env-required:"true"`
+	SECRET_KEY       string `yaml:"secret_key" env:"SECRET_KEY" env-required:"true"`
+	StorageDriver    string `yaml:"storage_driver" env:"STORAGE_DRIVER" env-default:"mongodb"` // "mongodb" or "memory"
+	MongoURI         string `yaml:"mongo_uri"` // a replica set or mongos is needed for ownership transfers; see mongodb.ErrTransactionsUnsupported
+	MongoDatabase    string `yaml:"mongo_db"`
+	MongoAutoMigrate bool   `yaml:"mongo_auto_migrate" env:"MONGO_AUTO_MIGRATE" env-default:"true"`
+	// Google sign-in, used unless oauth_providers configures google
 	OAuthClientID    string `yaml:"oauth_client_id" env:"GOOGLE_CLIENT_ID"`
 	OAuthSecret      string `yaml:"oauth_client_secret" env:"GOOGLE_CLIENT_SECRET"`
 	OAuthRedirectURL string `yaml:"oauth_redirect_url" env:"GOOGLE_REDIRECT_URL"`
+	FrontendURL      string `yaml:"frontend_url" env:"FRONTEND_URL" env-default:"https://mapmymoments.in"`
+
+	// Without JWTKeys tokens are HS256-signed with SECRET_KEY. Once keys are
+	// configured HS256 tokens are refused, since anyone with the secret could
+	// mint them. Set JWTAcceptHS256 while switching over so tokens issued
+	// before the switch keep working, and turn it off once they've expired.
+	JWTKeys        []JWTKey `yaml:"jwt_keys"`
+	JWTAcceptHS256 bool     `yaml:"jwt_accept_hs256" env:"JWT_ACCEPT_HS256" env-default:"false"`
+
+	OAuthProviders map[string]OAuthProvider `yaml:"oauth_providers"`
+	WebAuthn       WebAuthn                 `yaml:"webauthn"`
+
+	// IPs or CIDR ranges of the load balancers in front of the server.
+	// X-Forwarded-For is only believed on connections from these, so the
+	// per-IP limits can't be dodged by sending the header directly.
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 
 func MustLoadConfig() *Config {
@@ -51,5 +104,35 @@ func MustLoadConfig() *Config {
 		log.Fatalf("failed to read config file: %s", err.Error())
 	}
 
+	switch cfg.StorageDriver {
+	case "memory":
+	case "mongodb":
+		if cfg.MongoURI == "" || cfg.MongoDatabase == "" {
+			log.Fatal("mongo_uri and mongo_db are required when storage_driver is mongodb")
+		}
+	default:
+		log.Fatalf("unknown storage_driver: %s", cfg.StorageDriver)
+	}
+
+	for _, key := range cfg.JWTKeys {
+		if key.ID == "" || (key.Algorithm != "RS256" && key.Algorithm != "EdDSA") {
+			log.Fatal("every jwt_keys entry needs an id and an algorithm of RS256 or EdDSA")
+		}
+	}
+	if len(cfg.JWTKeys) > 0 && cfg.JWTKeys[0].PrivateKeyFile == "" {
+		log.Fatal("the first jwt_keys entry signs tokens and needs a private_key_file")
+	}
+
+	if _, ok := cfg.OAuthProviders["google"]; !ok && cfg.OAuthClientID != "" {
+		if cfg.OAuthProviders == nil {
+			cfg.OAuthProviders = map[string]OAuthProvider{}
+		}
+		cfg.OAuthProviders["google"] = OAuthProvider{
+			ClientID:     cfg.OAuthClientID,
+			ClientSecret: cfg.OAuthSecret,
+			RedirectURL:  cfg.OAuthRedirectURL,
+		}
+	}
+
 	return &cfg
 }
@@ -2,6 +2,7 @@ package public
 
 import (
 	"net/http"
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
 	"github.com/atindraraut/crudgo/internal/utils/response"
 	"github.com/atindraraut/crudgo/storage"
 )
@@ -14,3 +15,13 @@ func Health(storage storage.Storage) http.HandlerFunc {
 		response.WriteJSON(w, http.StatusOK, responseData)
 	}
 }
+
+// JWKS publishes the public keys tokens are signed with, so other services
+// can verify them without sharing a secret
+func JWKS() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Short enough that a newly rotated key is picked up quickly
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		response.WriteJSON(w, http.StatusOK, auth.PublicKeys())
+	}
+}
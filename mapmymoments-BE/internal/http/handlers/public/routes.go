@@ -8,4 +8,5 @@ import (
 
 func RegisterRoutes(router *http.ServeMux, storage storage.Storage) {
 	router.HandleFunc("GET /health", Health(storage))
+	router.HandleFunc("GET /.well-known/jwks.json", JWKS())
 }
@@ -0,0 +1,173 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/internal/utils/middleware"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+// writeStorageError maps storage sentinel errors to HTTP status codes so
+// handlers don't have to repeat the same switch.
+func writeStorageError(w http.ResponseWriter, err error, notFoundMsg string) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New(notFoundMsg)))
+	case errors.Is(err, storage.ErrExpired), errors.Is(err, storage.ErrExhausted):
+		response.WriteJSON(w, http.StatusGone, response.GeneralError(err))
+	case errors.Is(err, storage.ErrConflict):
+		response.WriteJSON(w, http.StatusConflict, response.GeneralError(err))
+	case errors.Is(err, storage.ErrApprovalRequired):
+		response.WriteJSON(w, http.StatusForbidden, response.GeneralError(err))
+	case errors.Is(err, storage.ErrInvalidCursor):
+		response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(err))
+	case errors.Is(err, storage.ErrUnsupported):
+		response.WriteJSON(w, http.StatusNotImplemented, response.GeneralError(err))
+	case errors.Is(err, storage.ErrVersionMismatch):
+		response.WriteJSON(w, http.StatusPreconditionFailed, response.GeneralError(errors.New("route has been modified; reload and try again")))
+	default:
+		response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+	}
+}
+
+// isNotFound is for handlers whose storage parameter shadows the package.
+func isNotFound(err error) bool {
+	return errors.Is(err, storage.ErrNotFound)
+}
+
+// isConflict is isNotFound's counterpart for storage.ErrConflict.
+func isConflict(err error) bool {
+	return errors.Is(err, storage.ErrConflict)
+}
+
+// retryAt unwraps a *storage.RetryAfterError, for handlers whose storage
+// parameter shadows the package.
+func retryAt(err error) (time.Time, bool) {
+	var retry *storage.RetryAfterError
+	if errors.As(err, &retry) {
+		return retry.RetryAt, true
+	}
+	return time.Time{}, false
+}
+
+func isApprovalRequired(err error) bool {
+	return errors.Is(err, storage.ErrApprovalRequired)
+}
+
+// parseListOptions reads pagination, sorting and filter query parameters:
+// limit, cursor, sort (createdAt|updatedAt|name), order (asc|desc), creator,
+// createdAfter/createdBefore (RFC 3339 or unix millis) and hasPhotos.
+func parseListOptions(r *http.Request) (types.RouteListOptions, error) {
+	q := r.URL.Query()
+	opts := types.RouteListOptions{
+		Cursor:    q.Get("cursor"),
+		SortBy:    q.Get("sort"),
+		CreatorID: q.Get("creator"),
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return opts, errors.New("limit must be a positive integer")
+		}
+		opts.Limit = limit
+	}
+	switch opts.SortBy {
+	case "", "createdAt", "updatedAt", "name":
+	default:
+		return opts, errors.New("sort must be one of createdAt, updatedAt, name")
+	}
+	switch q.Get("order") {
+	case "", "desc":
+	case "asc":
+		opts.SortAsc = true
+	default:
+		return opts, errors.New("order must be asc or desc")
+	}
+	var err error
+	if opts.CreatedAfter, err = parseTimeParam(q.Get("createdAfter")); err != nil {
+		return opts, fmt.Errorf("createdAfter: %w", err)
+	}
+	if opts.CreatedBefore, err = parseTimeParam(q.Get("createdBefore")); err != nil {
+		return opts, fmt.Errorf("createdBefore: %w", err)
+	}
+	if v := q.Get("hasPhotos"); v != "" {
+		hasPhotos, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, errors.New("hasPhotos must be true or false")
+		}
+		opts.HasPhotos = &hasPhotos
+	}
+	return opts, nil
+}
+
+// parseTimeParam accepts either an RFC 3339 timestamp or unix milliseconds
+// and returns unix milliseconds, or 0 for an empty value.
+func parseTimeParam(v string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return ms, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, errors.New("expected RFC 3339 timestamp or unix milliseconds")
+	}
+	return t.UnixMilli(), nil
+}
+
+// routeETag renders a route version as a strong entity tag.
+func routeETag(version int64) string {
+	return fmt.Sprintf("%q", strconv.FormatInt(version, 10))
+}
+
+// parseIfMatch returns the route version the client expects from its
+// If-Match header. ok is false when the header is absent; "*" yields
+// version 0, meaning any existing version.
+func parseIfMatch(r *http.Request) (version int64, ok bool, err error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" {
+		return 0, false, nil
+	}
+	if v == "*" {
+		return 0, true, nil
+	}
+	v = strings.TrimPrefix(v, "W/")
+	unquoted, err := strconv.Unquote(v)
+	if err != nil {
+		return 0, true, errors.New("If-Match must be a quoted entity tag")
+	}
+	version, err = strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version < 1 {
+		return 0, true, errors.New("If-Match does not match any route version")
+	}
+	return version, true, nil
+}
+
+// authorizeRoute looks up the caller's role on the route and checks it
+// against the permission matrix in types. On failure it writes the response
+// and returns ok=false; on success it returns the caller and their role.
+func authorizeRoute(w http.ResponseWriter, r *http.Request, store storage.Storage, routeId string, action types.RouteAction, forbiddenMsg string) (user *middleware.AuthUser, role string, ok bool) {
+	user = middleware.GetAuthUser(r)
+	if user == nil {
+		response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("unauthorized")))
+		return nil, "", false
+	}
+	role, err := store.CheckUserRoutePermission(r.Context(), user.Email, routeId)
+	if err != nil {
+		writeStorageError(w, err, "route not found")
+		return nil, "", false
+	}
+	if !types.RoleCan(role, action) {
+		response.WriteJSON(w, http.StatusForbidden, response.GeneralError(errors.New(forbiddenMsg)))
+		return nil, "", false
+	}
+	return user, role, true
+}
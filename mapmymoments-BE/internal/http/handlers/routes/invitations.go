@@ -0,0 +1,171 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
+	"github.com/atindraraut/crudgo/internal/utils/middleware"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+	"github.com/go-playground/validator/v10"
+)
+
+const defaultInvitationTTL = 7 * 24 * time.Hour
+
+// sendInvitationEmail is a variable so tests can stub out SES.
+var sendInvitationEmail = auth.SendInvitationEmail
+
+func InviteCollaborator(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		user, role, ok := authorizeRoute(w, r, storage, id, types.ActionManageCollaborators, "you don't have permission to invite collaborators")
+		if !ok {
+			return
+		}
+
+		var req types.InvitationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid request body")))
+			return
+		}
+		if err := validator.New().Struct(&req); err != nil {
+			validatorErrors := err.(validator.ValidationErrors)
+			response.WriteJSON(w, http.StatusBadRequest, response.ValidationError(validatorErrors))
+			return
+		}
+		if req.Role == "" {
+			req.Role = types.DefaultShareRole
+		}
+		if !types.CanAssignRole(role, req.Role) {
+			response.WriteJSON(w, http.StatusForbidden, response.GeneralError(fmt.Errorf("you can't grant the %s role", req.Role)))
+			return
+		}
+
+		route, err := storage.GetRouteById(r.Context(), id)
+		if err != nil {
+			writeStorageError(w, err, "route not found")
+			return
+		}
+		email := strings.ToLower(strings.TrimSpace(req.Email))
+		if strings.EqualFold(route.CreatorID, email) {
+			response.WriteJSON(w, http.StatusConflict, response.GeneralError(errors.New("that user owns this route")))
+			return
+		}
+		for _, shared := range route.SharedWith {
+			if strings.EqualFold(shared.UserID, email) {
+				response.WriteJSON(w, http.StatusConflict, response.GeneralError(errors.New("that user is already a collaborator")))
+				return
+			}
+		}
+
+		ttl := defaultInvitationTTL
+		if req.ExpiryHours != nil {
+			ttl = time.Duration(*req.ExpiryHours) * time.Hour
+		}
+		inv, err := storage.CreateInvitation(r.Context(), types.Invitation{
+			RouteID:   id,
+			RouteName: route.Name,
+			Email:     email,
+			Role:      req.Role,
+			InvitedBy: user.Email,
+			ExpiresAt: time.Now().Add(ttl),
+		})
+		if err != nil {
+			if isConflict(err) {
+				response.WriteJSON(w, http.StatusConflict, response.GeneralError(errors.New("that address already has a pending invitation")))
+				return
+			}
+			writeStorageError(w, err, "route not found")
+			return
+		}
+
+		// The invitation stands even if the email doesn't go out; the
+		// invitee still sees it in their inbox once they sign in.
+		if err := sendInvitationEmail(inv.Email, user.Email, route.Name, inv.Role); err != nil {
+			slog.Error("failed to send invitation email", slog.String("invitationId", inv.ID), slog.String("error", err.Error()))
+		}
+		response.WriteJSON(w, http.StatusCreated, inv)
+	}
+}
+
+func ListRouteInvitations(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if _, _, ok := authorizeRoute(w, r, storage, id, types.ActionManageCollaborators, "you don't have permission to view invitations"); !ok {
+			return
+		}
+		invitations, err := storage.ListRouteInvitations(r.Context(), id)
+		if err != nil {
+			writeStorageError(w, err, "route not found")
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{"invitations": invitations})
+	}
+}
+
+func CancelInvitation(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if _, _, ok := authorizeRoute(w, r, storage, id, types.ActionManageCollaborators, "you don't have permission to cancel invitations"); !ok {
+			return
+		}
+		if err := storage.DeleteInvitation(r.Context(), id, r.PathValue("invitationId")); err != nil {
+			writeStorageError(w, err, "invitation not found")
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"message": "Invitation cancelled",
+		})
+	}
+}
+
+func GetMyInvitations(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.GetAuthUser(r)
+		if user == nil {
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("unauthorized")))
+			return
+		}
+		invitations, err := storage.ListInvitationsForEmail(r.Context(), user.Email)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{"invitations": invitations})
+	}
+}
+
+func AcceptInvitation(storage storage.Storage) http.HandlerFunc {
+	return respondToInvitation(storage, true)
+}
+
+func DeclineInvitation(storage storage.Storage) http.HandlerFunc {
+	return respondToInvitation(storage, false)
+}
+
+func respondToInvitation(store storage.Storage, accept bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.GetAuthUser(r)
+		if user == nil {
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("unauthorized")))
+			return
+		}
+		inv, err := store.RespondToInvitation(r.Context(), r.PathValue("invitationId"), user.Email, accept)
+		if err != nil {
+			if isConflict(err) {
+				response.WriteJSON(w, http.StatusConflict, response.GeneralError(errors.New("invitation has already been answered")))
+				return
+			}
+			writeStorageError(w, err, "invitation not found")
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, inv)
+	}
+}
@@ -0,0 +1,100 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/internal/utils/middleware"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+func ListJoinRequests(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if _, _, ok := authorizeRoute(w, r, storage, id, types.ActionManageCollaborators, "you don't have permission to view join requests"); !ok {
+			return
+		}
+		requests, err := storage.ListJoinRequests(r.Context(), id)
+		if err != nil {
+			writeStorageError(w, err, "route not found")
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{"requests": requests})
+	}
+}
+
+func ApproveJoinRequest(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		requestId := r.PathValue("requestId")
+		user, role, ok := authorizeRoute(w, r, storage, id, types.ActionManageCollaborators, "you don't have permission to approve join requests")
+		if !ok {
+			return
+		}
+
+		// Approving hands out the link's role, so the same rule applies as
+		// for granting it directly
+		pending, err := storage.ListJoinRequests(r.Context(), id)
+		if err != nil {
+			writeStorageError(w, err, "route not found")
+			return
+		}
+		for _, req := range pending {
+			if req.ID == requestId && !types.CanAssignRole(role, req.Role) {
+				response.WriteJSON(w, http.StatusForbidden, response.GeneralError(fmt.Errorf("you can't grant the %s role", req.Role)))
+				return
+			}
+		}
+
+		req, err := storage.DecideJoinRequest(r.Context(), id, requestId, user.Email, true)
+		if err != nil {
+			writeDecisionError(w, err)
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, req)
+	}
+}
+
+func RejectJoinRequest(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		user, _, ok := authorizeRoute(w, r, storage, id, types.ActionManageCollaborators, "you don't have permission to reject join requests")
+		if !ok {
+			return
+		}
+		req, err := storage.DecideJoinRequest(r.Context(), id, r.PathValue("requestId"), user.Email, false)
+		if err != nil {
+			writeDecisionError(w, err)
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, req)
+	}
+}
+
+// GetMyJoinRequests lets requesters follow their requests, newest first.
+func GetMyJoinRequests(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.GetAuthUser(r)
+		if user == nil {
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("unauthorized")))
+			return
+		}
+		requests, err := storage.ListJoinRequestsForUser(r.Context(), user.Email)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{"requests": requests})
+	}
+}
+
+func writeDecisionError(w http.ResponseWriter, err error) {
+	if isConflict(err) {
+		response.WriteJSON(w, http.StatusConflict, response.GeneralError(errors.New("join request has already been decided")))
+		return
+	}
+	writeStorageError(w, err, "join request not found")
+}
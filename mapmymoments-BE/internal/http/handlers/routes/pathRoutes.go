@@ -42,11 +42,18 @@ func NewRoute(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 		fmt.Println("User: ", user)
+		if route.Visibility == "" {
+			route.Visibility = types.VisibilityPrivate
+		}
+		if !types.ValidVisibility(route.Visibility) {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("visibility must be private, unlisted or public")))
+			return
+		}
 		route.CreatorID = user.Email
 		now := time.Now().UnixMilli()
 		route.CreatedAt = now
 		route.UpdatedAt = now
-		id, err := storage.CreateRoute(route)
+		id, err := storage.CreateRoute(r.Context(), route)
 		if err != nil {
 			fmt.Println("Error creating route: ", err)
 			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
@@ -67,24 +74,82 @@ func GetRouteById(storage storage.Storage) http.HandlerFunc {
 			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("id is required")))
 			return
 		}
-		route, err := storage.GetRouteById(id)
+		route, err := storage.GetRouteById(r.Context(), id)
 		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+			writeStorageError(w, err, "route not found")
+			return
+		}
+		// Collaborators get the full document; everyone else only sees
+		// public routes, and then only the redacted projection.
+		if user := middleware.GetAuthUser(r); user != nil {
+			permission, err := storage.CheckUserRoutePermission(r.Context(), user.Email, id)
+			if err != nil {
+				writeStorageError(w, err, "route not found")
+				return
+			}
+			if permission != "" {
+				w.Header().Set("ETag", routeETag(route.Version))
+				response.WriteJSON(w, http.StatusOK, route)
+				return
+			}
+		}
+		if route.Visibility != types.VisibilityPublic {
+			response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("route not found")))
 			return
 		}
-		response.WriteJSON(w, http.StatusOK, route)
+		w.Header().Set("ETag", routeETag(route.Version))
+		response.WriteJSON(w, http.StatusOK, route.Public())
 	}
 }
 
 func GetAllRoutes(storage storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		routes, err := storage.GetAllRoutes()
-		fmt.Println("Routes: ", routes)
+		opts, err := parseListOptions(r)
 		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		// This is the public catalogue: only public routes, redacted. The
+		// creator filter is dropped too, or it would reveal whose routes
+		// they are.
+		opts.Visibility = types.VisibilityPublic
+		opts.CreatorID = ""
+		page, err := storage.ListRoutes(r.Context(), opts)
+		if err != nil {
+			writeStorageError(w, err, "routes not found")
 			return
 		}
-		response.WriteJSON(w, http.StatusOK, routes)
+		publicPage := types.PublicRoutePage{Routes: make([]types.PublicRoute, 0, len(page.Routes)), NextCursor: page.NextCursor}
+		for _, route := range page.Routes {
+			publicPage.Routes = append(publicPage.Routes, route.Public())
+		}
+		response.WriteJSON(w, http.StatusOK, publicPage)
+	}
+}
+
+func SetRouteVisibility(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if _, _, ok := authorizeRoute(w, r, storage, id, types.ActionChangeVisibility, "you don't have permission to change this route's visibility"); !ok {
+			return
+		}
+		var req types.VisibilityRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid request body")))
+			return
+		}
+		if err := validator.New().Struct(&req); err != nil {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("visibility must be private, unlisted or public")))
+			return
+		}
+		if err := storage.SetRouteVisibility(r.Context(), id, req.Visibility); err != nil {
+			writeStorageError(w, err, "route not found")
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"message":    "Route visibility updated",
+			"visibility": req.Visibility,
+		})
 	}
 }
 
@@ -95,24 +160,20 @@ func UpdateRoute(storage storage.Storage) http.HandlerFunc {
 			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("id is required")))
 			return
 		}
-		user := middleware.GetAuthUser(r)
-		if user == nil {
-			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("unauthorized")))
+		if _, _, ok := authorizeRoute(w, r, storage, id, types.ActionEditRoute, "you don't have permission to edit this route"); !ok {
 			return
 		}
-		// Check user permission instead of just checking if they're the creator
-		permission, permErr := storage.CheckUserRoutePermission(user.Email, id)
-		if permErr != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(permErr))
+		expectedVersion, ok, err := parseIfMatch(r)
+		if err != nil {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(err))
 			return
 		}
-		
-		if permission != "owner" {
-			response.WriteJSON(w, http.StatusForbidden, response.GeneralError(errors.New("only the creator can edit this route")))
+		if !ok {
+			response.WriteJSON(w, http.StatusPreconditionRequired, response.GeneralError(errors.New("If-Match header is required")))
 			return
 		}
 		var route types.Route
-		err := json.NewDecoder(r.Body).Decode(&route)
+		err = json.NewDecoder(r.Body).Decode(&route)
 		if errors.Is(err, io.EOF) {
 			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("request body is empty")))
 			return
@@ -126,17 +187,18 @@ func UpdateRoute(storage storage.Storage) http.HandlerFunc {
 			response.WriteJSON(w, http.StatusBadRequest, response.ValidationError(validatorErrors))
 			return
 		}
-		// Always set creatorId and update updatedAt in backend
-		route.CreatorID = user.Email
+		// The creator is kept by storage; editors must not become owners
 		route.UpdatedAt = time.Now().UnixMilli()
-		updatedId, err := storage.UpdateRoute(id, route)
+		version, err := storage.UpdateRoute(r.Context(), id, route, expectedVersion)
 		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+			writeStorageError(w, err, "route not found")
 			return
 		}
+		w.Header().Set("ETag", routeETag(version))
 		responseData := map[string]interface{}{
 			"Message": "Route updated successfully",
-			"id":      updatedId,
+			"id":      id,
+			"version": version,
 		}
 		response.WriteJSON(w, http.StatusOK, responseData)
 	}
@@ -149,30 +211,22 @@ func DeleteRoute(storage storage.Storage) http.HandlerFunc {
 			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("id is required")))
 			return
 		}
-		user := middleware.GetAuthUser(r)
-		if user == nil {
-			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("unauthorized")))
-			return
-		}
-		// Check user permission instead of just checking if they're the creator
-		permission, permErr := storage.CheckUserRoutePermission(user.Email, id)
-		if permErr != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(permErr))
+		if _, _, ok := authorizeRoute(w, r, storage, id, types.ActionDeleteRoute, "only the creator can delete this route"); !ok {
 			return
 		}
-		
-		if permission != "owner" {
-			response.WriteJSON(w, http.StatusForbidden, response.GeneralError(errors.New("only the creator can delete this route")))
+		// If-Match is optional on delete, but honoured when sent
+		expectedVersion, _, err := parseIfMatch(r)
+		if err != nil {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(err))
 			return
 		}
-		deletedId, err := storage.DeleteRoute(id)
-		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+		if err := storage.DeleteRoute(r.Context(), id, expectedVersion); err != nil {
+			writeStorageError(w, err, "route not found")
 			return
 		}
 		responseData := map[string]interface{}{
 			"Message": "Route deleted successfully",
-			"id":      deletedId,
+			"id":      id,
 		}
 		response.WriteJSON(w, http.StatusOK, responseData)
 	}
@@ -185,24 +239,23 @@ func GetUserRoutes(storage storage.Storage) http.HandlerFunc {
 			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("unauthorized")))
 			return
 		}
-		routes, err := storage.GetAllRoutes()
+		opts, err := parseListOptions(r)
 		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(err))
 			return
 		}
-		var userRoutes []types.Route
-		for _, route := range routes {
-			r, ok := route.(types.Route)
-			if ok && r.CreatorID == user.Email {
-				userRoutes = append(userRoutes, r)
-			}
+		opts.CreatorID = user.Email
+		page, err := storage.ListRoutes(r.Context(), opts)
+		if err != nil {
+			writeStorageError(w, err, "routes not found")
+			return
 		}
-		response.WriteJSON(w, http.StatusOK, userRoutes)
+		response.WriteJSON(w, http.StatusOK, page)
 	}
 }
 
 // Route sharing handlers
-func ShareRoute(storage storage.Storage) http.HandlerFunc {
+func GetRouteShareInfo(storage storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
 		if id == "" {
@@ -210,55 +263,40 @@ func ShareRoute(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 		
-		// Check if user is the creator
-		user := middleware.GetAuthUser(r)
-		if user == nil {
-			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("unauthorized")))
+		if _, _, ok := authorizeRoute(w, r, storage, id, types.ActionManageSharing, "you don't have permission to view share info"); !ok {
 			return
 		}
 		
-		existing, err := storage.GetRouteById(id)
+		routeObj, err := storage.GetRouteById(r.Context(), id)
 		if err != nil {
-			response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("route not found")))
+			writeStorageError(w, err, "route not found")
 			return
 		}
 		
-		route := existing.(types.Route)
-		if route.CreatorID != user.Email {
-			response.WriteJSON(w, http.StatusForbidden, response.GeneralError(errors.New("only the creator can share this route")))
+		links, err := storage.ListShareLinks(r.Context(), id)
+		if err != nil {
+			writeStorageError(w, err, "route not found")
 			return
 		}
 		
-		// Parse request body for optional expiry
-		var req types.ShareRouteRequest
-		if r.Body != nil {
-			json.NewDecoder(r.Body).Decode(&req)
-		}
-		
-		// Generate share token
-		token, err := storage.GenerateRouteShareToken(id, req.ExpiryHours)
+		// Get users who have access to this route
+		users, err := storage.GetUsersByRouteId(r.Context(), id)
 		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+			writeStorageError(w, err, "route not found")
 			return
 		}
 		
-		// Calculate expiry time for response
-		var expiryTime *time.Time
-		if req.ExpiryHours != nil {
-			expiry := time.Now().Add(time.Duration(*req.ExpiryHours) * time.Hour)
-			expiryTime = &expiry
-		}
-		
-		resp := types.ShareRouteResponse{
-			ShareToken: token,
-			ExpiresAt:  expiryTime,
+		shareInfo := map[string]interface{}{
+			"shareLinks":   links,
+			"sharedWith":   routeObj.SharedWith,
+			"sharedUsers":  users,
 		}
 		
-		response.WriteJSON(w, http.StatusOK, resp)
+		response.WriteJSON(w, http.StatusOK, shareInfo)
 	}
 }
 
-func GetRouteShareInfo(storage storage.Storage) http.HandlerFunc {
+func RevokeRouteShare(storage storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
 		if id == "" {
@@ -266,85 +304,125 @@ func GetRouteShareInfo(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 		
-		// Check if user has permission to view share info
-		user := middleware.GetAuthUser(r)
-		if user == nil {
-			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("unauthorized")))
+		// Revoking evicts every collaborator, co-owners included
+		if _, _, ok := authorizeRoute(w, r, storage, id, types.ActionRevokeAllSharing, "only the creator can revoke sharing"); !ok {
 			return
 		}
 		
-		permission, err := storage.CheckUserRoutePermission(user.Email, id)
+		err := storage.RevokeRouteShare(r.Context(), id)
 		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+			writeStorageError(w, err, "route not found")
 			return
 		}
 		
-		if permission != "owner" {
-			response.WriteJSON(w, http.StatusForbidden, response.GeneralError(errors.New("only the creator can view share info")))
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"message": "Route sharing revoked successfully",
+		})
+	}
+}
+
+func UpdateCollaboratorRole(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		userId := r.PathValue("userId")
+		_, role, ok := authorizeRoute(w, r, storage, id, types.ActionManageCollaborators, "you don't have permission to manage collaborators")
+		if !ok {
 			return
 		}
 		
-		route, err := storage.GetRouteById(id)
-		if err != nil {
-			response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("route not found")))
+		var req types.CollaboratorRoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid request body")))
+			return
+		}
+		if err := validator.New().Struct(&req); err != nil {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("role must be viewer, contributor, editor or co-owner")))
 			return
 		}
 		
-		routeObj := route.(types.Route)
-		
-		// Get users who have access to this route
-		users, err := storage.GetUsersByRouteId(id)
+		current, err := storage.CheckUserRoutePermission(r.Context(), userId, id)
 		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+			writeStorageError(w, err, "route not found")
+			return
+		}
+		if current == "" || current == types.RoleOwner {
+			response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("collaborator not found")))
+			return
+		}
+		// Both the old and the new role have to be below the caller's own
+		if !types.CanAssignRole(role, current) || !types.CanAssignRole(role, req.Role) {
+			response.WriteJSON(w, http.StatusForbidden, response.GeneralError(fmt.Errorf("you can't change a %s to %s", current, req.Role)))
 			return
 		}
 		
-		shareInfo := map[string]interface{}{
-			"shareToken":   routeObj.ShareToken,
-			"expiresAt":    routeObj.ShareTokenExpiry,
-			"sharedWith":   routeObj.SharedWith,
-			"sharedUsers":  users,
+		if err := storage.UpdateCollaboratorRole(r.Context(), id, userId, req.Role); err != nil {
+			writeStorageError(w, err, "collaborator not found")
+			return
 		}
 		
-		response.WriteJSON(w, http.StatusOK, shareInfo)
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"message": "Collaborator role updated",
+			"userId":  userId,
+			"role":    req.Role,
+		})
 	}
 }
 
-func RevokeRouteShare(storage storage.Storage) http.HandlerFunc {
+func RemoveCollaborator(storage storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
-		if id == "" {
-			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("route id is required")))
+		userId := r.PathValue("userId")
+		_, role, ok := authorizeRoute(w, r, storage, id, types.ActionManageCollaborators, "you don't have permission to manage collaborators")
+		if !ok {
 			return
 		}
 		
-		// Check if user is the creator
-		user := middleware.GetAuthUser(r)
-		if user == nil {
-			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("unauthorized")))
+		current, err := storage.CheckUserRoutePermission(r.Context(), userId, id)
+		if err != nil {
+			writeStorageError(w, err, "route not found")
+			return
+		}
+		if current == "" || current == types.RoleOwner {
+			response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("collaborator not found")))
+			return
+		}
+		if !types.CanAssignRole(role, current) {
+			response.WriteJSON(w, http.StatusForbidden, response.GeneralError(fmt.Errorf("you can't remove a %s", current)))
 			return
 		}
 		
-		existing, err := storage.GetRouteById(id)
-		if err != nil {
-			response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("route not found")))
+		if err := storage.RemoveCollaborator(r.Context(), id, userId); err != nil {
+			writeStorageError(w, err, "collaborator not found")
 			return
 		}
 		
-		route := existing.(types.Route)
-		if route.CreatorID != user.Email {
-			response.WriteJSON(w, http.StatusForbidden, response.GeneralError(errors.New("only the creator can revoke sharing")))
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"message": "Collaborator removed",
+			"userId":  userId,
+		})
+	}
+}
+
+func LeaveSharedRoute(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		_, role, ok := authorizeRoute(w, r, storage, id, types.ActionViewRoute, "you are not a collaborator on this route")
+		if !ok {
+			return
+		}
+		if role == types.RoleOwner {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("the creator can't leave their own route")))
 			return
 		}
 		
-		err = storage.RevokeRouteShare(id)
-		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+		user := middleware.GetAuthUser(r)
+		if err := storage.RemoveCollaborator(r.Context(), id, user.Email); err != nil {
+			writeStorageError(w, err, "route not found")
 			return
 		}
 		
 		response.WriteJSON(w, http.StatusOK, map[string]string{
-			"message": "Route sharing revoked successfully",
+			"message": "You have left the route",
 		})
 	}
 }
@@ -357,13 +435,29 @@ func GetSharedRouteByToken(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 		
-		route, err := storage.GetRouteByShareToken(token)
+		link, err := storage.GetShareLinkByToken(r.Context(), token)
 		if err != nil {
-			response.WriteJSON(w, http.StatusNotFound, response.GeneralError(err))
+			writeStorageError(w, err, "share token not found")
+			return
+		}
+		if !requireShareGrant(w, r, link) {
 			return
 		}
 		
-		response.WriteJSON(w, http.StatusOK, route)
+		route, err := storage.GetRouteById(r.Context(), link.RouteID)
+		if err != nil {
+			writeStorageError(w, err, "share token not found")
+			return
+		}
+		// A link to a private route can still be used to join, but only
+		// members get to see the route
+		if route.Visibility == types.VisibilityPrivate {
+			response.WriteJSON(w, http.StatusForbidden, response.GeneralError(errors.New(privateRouteMsg)))
+			return
+		}
+		
+		// Anyone with the link can preview, but never sees who else is on it
+		response.WriteJSON(w, http.StatusOK, route.Public())
 	}
 }
 
@@ -382,14 +476,45 @@ func JoinSharedRoute(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 		
-		// Get route by token (this validates the token)
-		route, err := storage.GetRouteByShareToken(token)
+		// Protected links need the grant from the unlock endpoint. Expired
+		// or exhausted links are left to RedeemShareLink, which still lets
+		// existing members through.
+		link, err := storage.GetShareLinkByToken(r.Context(), token)
+		if isNotFound(err) {
+			writeStorageError(w, err, "share token not found")
+			return
+		}
+		if err == nil && !requireShareGrant(w, r, link) {
+			return
+		}
+		
+		// Redeeming validates the token, counts the join against the link's
+		// limit and adds the user with the link's role
+		link, err = storage.RedeemShareLink(r.Context(), token, user.Email, user.Email)
+		if isApprovalRequired(err) {
+			// The link only takes requests; access waits for a manager
+			joinRequest, err := storage.RequestToJoin(r.Context(), token, user.Email, user.Email)
+			if err != nil {
+				writeStorageError(w, err, "share token not found")
+				return
+			}
+			response.WriteJSON(w, http.StatusAccepted, map[string]interface{}{
+				"message": "Your request to join has been sent to the route owner",
+				"status":  joinRequest.Status,
+				"request": joinRequest,
+			})
+			return
+		}
 		if err != nil {
-			response.WriteJSON(w, http.StatusNotFound, response.GeneralError(err))
+			writeStorageError(w, err, "share token not found")
 			return
 		}
 		
-		routeObj := route.(types.Route)
+		routeObj, err := storage.GetRouteById(r.Context(), link.RouteID)
+		if err != nil {
+			writeStorageError(w, err, "route not found")
+			return
+		}
 		
 		// Check if user is already the creator
 		if routeObj.CreatorID == user.Email {
@@ -397,16 +522,17 @@ func JoinSharedRoute(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 		
-		// Add user to shared route
-		err = storage.AddUserToSharedRoute(routeObj.ID, user.Email, user.Email)
+		// Someone who already collaborated keeps the role they had
+		role, err := storage.CheckUserRoutePermission(r.Context(), user.Email, routeObj.ID)
 		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+			writeStorageError(w, err, "route not found")
 			return
 		}
 		
 		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
 			"message": "Successfully joined the shared route",
-			"route":   route,
+			"role":    role,
+			"route":   routeObj,
 		})
 	}
 }
@@ -419,12 +545,17 @@ func GetSharedRoutesForUser(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 		
-		routes, err := storage.GetSharedRoutesForUser(user.Email)
+		opts, err := parseListOptions(r)
 		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(err))
+			return
+		}
+		page, err := storage.GetSharedRoutesForUser(r.Context(), user.Email, opts)
+		if err != nil {
+			writeStorageError(w, err, "routes not found")
 			return
 		}
 		
-		response.WriteJSON(w, http.StatusOK, routes)
+		response.WriteJSON(w, http.StatusOK, page)
 	}
 }
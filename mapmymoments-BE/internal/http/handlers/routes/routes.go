@@ -8,14 +8,21 @@ import (
 )
 
 func RegisterRoutes(router *http.ServeMux, storage storage.Storage) {
-	// Public routes
+	// Public routes (a token, if sent, unlocks the full view for collaborators)
 	router.Handle("GET /api/routes", GetAllRoutes(storage))
-	router.Handle("GET /api/routes/{id}", GetRouteById(storage))
+	router.Handle("GET /api/routes/{id}", middleware.WithMiddleware(GetRouteById(storage), middleware.OptionalAuthMiddleware(storage)))
 
 	// Authenticated user routes (require AuthMiddleware)
 	router.Handle("POST /api/routes", middleware.WithMiddleware(NewRoute(storage), middleware.AuthMiddleware(storage)))
 	router.Handle("PUT /api/routes/{id}", middleware.WithMiddleware(UpdateRoute(storage), middleware.AuthMiddleware(storage)))
 	router.Handle("DELETE /api/routes/{id}", middleware.WithMiddleware(DeleteRoute(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("PUT /api/routes/{id}/visibility", middleware.WithMiddleware(SetRouteVisibility(storage), middleware.AuthMiddleware(storage)))
+
+	// Ownership transfer: the owner offers, the chosen collaborator answers
+	router.Handle("POST /api/routes/{id}/transfer", middleware.WithMiddleware(OfferOwnershipTransfer(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("DELETE /api/routes/{id}/transfer", middleware.WithMiddleware(CancelOwnershipTransfer(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("POST /api/routes/{id}/transfer/accept", middleware.WithMiddleware(AcceptOwnershipTransfer(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("POST /api/routes/{id}/transfer/decline", middleware.WithMiddleware(DeclineOwnershipTransfer(storage), middleware.AuthMiddleware(storage)))
 
 	// User's own routes (private)
 	router.Handle("GET /api/my-routes", middleware.WithMiddleware(GetUserRoutes(storage), middleware.AuthMiddleware(storage)))
@@ -27,9 +34,29 @@ func RegisterRoutes(router *http.ServeMux, storage storage.Storage) {
 	router.Handle("POST /api/routes/{id}/share", middleware.WithMiddleware(ShareRoute(storage), middleware.AuthMiddleware(storage)))
 	router.Handle("GET /api/routes/{id}/share-info", middleware.WithMiddleware(GetRouteShareInfo(storage), middleware.AuthMiddleware(storage)))
 	router.Handle("DELETE /api/routes/{id}/share", middleware.WithMiddleware(RevokeRouteShare(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("GET /api/routes/{id}/share-links", middleware.WithMiddleware(ListShareLinks(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("POST /api/routes/{id}/share-links", middleware.WithMiddleware(CreateShareLink(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("DELETE /api/routes/{id}/share-links/{linkId}", middleware.WithMiddleware(RevokeShareLink(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("POST /api/routes/{id}/share-links/{linkId}/rotate", middleware.WithMiddleware(RotateShareLink(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("PUT /api/routes/{id}/collaborators/{userId}", middleware.WithMiddleware(UpdateCollaboratorRole(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("DELETE /api/routes/{id}/collaborators/{userId}", middleware.WithMiddleware(RemoveCollaborator(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("POST /api/routes/{id}/leave", middleware.WithMiddleware(LeaveSharedRoute(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("GET /api/routes/{id}/invitations", middleware.WithMiddleware(ListRouteInvitations(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("POST /api/routes/{id}/invitations", middleware.WithMiddleware(InviteCollaborator(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("DELETE /api/routes/{id}/invitations/{invitationId}", middleware.WithMiddleware(CancelInvitation(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("GET /api/routes/{id}/join-requests", middleware.WithMiddleware(ListJoinRequests(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("POST /api/routes/{id}/join-requests/{requestId}/approve", middleware.WithMiddleware(ApproveJoinRequest(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("POST /api/routes/{id}/join-requests/{requestId}/reject", middleware.WithMiddleware(RejectJoinRequest(storage), middleware.AuthMiddleware(storage)))
+
+	// Invitations addressed to the signed-in user
+	router.Handle("GET /api/invitations", middleware.WithMiddleware(GetMyInvitations(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("POST /api/invitations/{invitationId}/accept", middleware.WithMiddleware(AcceptInvitation(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("POST /api/invitations/{invitationId}/decline", middleware.WithMiddleware(DeclineInvitation(storage), middleware.AuthMiddleware(storage)))
 	
 	// Shared routes endpoints
 	router.Handle("GET /api/shared-routes/{token}", GetSharedRouteByToken(storage)) // Public - no auth required
+	router.Handle("POST /api/shared-routes/{token}/unlock", UnlockShareLink(storage)) // Public - exchanges a passphrase for an access grant
 	router.Handle("POST /api/shared-routes/{token}/join", middleware.WithMiddleware(JoinSharedRoute(storage), middleware.AuthMiddleware(storage)))
 	router.Handle("GET /api/my-shared-routes", middleware.WithMiddleware(GetSharedRoutesForUser(storage), middleware.AuthMiddleware(storage)))
+	router.Handle("GET /api/my-join-requests", middleware.WithMiddleware(GetMyJoinRequests(storage), middleware.AuthMiddleware(storage)))
 }
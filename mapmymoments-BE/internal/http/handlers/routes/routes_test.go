@@ -0,0 +1,777 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
+	"github.com/atindraraut/crudgo/storage"
+	"github.com/atindraraut/crudgo/storage/memory"
+)
+
+func newTestServer(t *testing.T) (*http.ServeMux, *memory.Memory) {
+	t.Helper()
+	auth.SECRET_KEY = "test-secret"
+	store := memory.New()
+	for _, email := range []string{"owner@example.com", "friend@example.com", "third@example.com"} {
+		if err := store.CreateUser(context.Background(), types.UserData{Email: email, AuthType: "email"}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		session := types.Session{ID: testSessionID(email), UserID: email, ExpiresAt: time.Now().Add(time.Hour)}
+		if err := store.CreateSession(context.Background(), session); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+	}
+	router := http.NewServeMux()
+	RegisterRoutes(router, store)
+	return router, store
+}
+
+// testSessionID names the session newTestServer opens for each user.
+func testSessionID(email string) string {
+	return "session-" + email
+}
+
+func doRequest(t *testing.T, router http.Handler, method, path, email string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest(t, method, path, email, body))
+	return rec
+}
+
+func newRequest(t *testing.T, method, path, email string, body interface{}) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if email != "" {
+		token, err := auth.GenerateAccessToken(email, "", "", email, testSessionID(email))
+		if err != nil {
+			t.Fatalf("GenerateAccessToken: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestCreateAndFetchRoute(t *testing.T) {
+	router, _ := newTestServer(t)
+
+	rec := doRequest(t, router, "POST", "/api/routes", "owner@example.com", types.Route{Name: "Coastal drive"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	json.NewDecoder(rec.Body).Decode(&created)
+
+	rec = doRequest(t, router, "GET", "/api/routes/"+created.ID, "owner@example.com", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var route types.Route
+	json.NewDecoder(rec.Body).Decode(&route)
+	if route.CreatorID != "owner@example.com" || route.Name != "Coastal drive" {
+		t.Errorf("unexpected route: %+v", route)
+	}
+}
+
+func TestMissingRouteReturnsNotFound(t *testing.T) {
+	router, _ := newTestServer(t)
+
+	if rec := doRequest(t, router, "GET", "/api/routes/nope", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("get: expected 404, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/nope/share-links", "owner@example.com", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("share: expected 404, got %d", rec.Code)
+	}
+}
+
+func TestOnlyOwnerCanDelete(t *testing.T) {
+	router, store := newTestServer(t)
+	id, _ := store.CreateRoute(context.Background(), types.Route{Name: "Trip", CreatorID: "owner@example.com"})
+
+	if rec := doRequest(t, router, "DELETE", "/api/routes/"+id, "friend@example.com", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for non-owner, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "DELETE", "/api/routes/"+id, "owner@example.com", nil); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for owner, got %d", rec.Code)
+	}
+}
+
+func TestShareAndJoin(t *testing.T) {
+	router, store := newTestServer(t)
+	id, _ := store.CreateRoute(context.Background(), types.Route{Name: "Trip", CreatorID: "owner@example.com"})
+
+	rec := doRequest(t, router, "POST", "/api/routes/"+id+"/share-links", "owner@example.com", types.ShareLinkRequest{})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("share: expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	var share types.ShareLink
+	json.NewDecoder(rec.Body).Decode(&share)
+
+	rec = doRequest(t, router, "POST", "/api/shared-routes/"+share.Token+"/join", "friend@example.com", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("join: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = doRequest(t, router, "GET", "/api/my-shared-routes", "friend@example.com", nil)
+	var shared types.RoutePage
+	json.NewDecoder(rec.Body).Decode(&shared)
+	if len(shared.Routes) != 1 || shared.Routes[0].ID != id {
+		t.Errorf("expected joined route in my-shared-routes, got %+v", shared)
+	}
+
+	// The old single-link endpoint still creates a link, passphrase and all
+	rec = doRequest(t, router, "POST", "/api/routes/"+id+"/share", "owner@example.com", types.ShareLinkRequest{Passphrase: "open sesame"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("legacy share: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var legacy types.ShareRouteResponse
+	json.NewDecoder(rec.Body).Decode(&legacy)
+	link, err := store.GetShareLinkByToken(context.Background(), legacy.ShareToken)
+	if err != nil || !link.Protected {
+		t.Errorf("expected a protected link for the legacy share token, got %+v, %v", link, err)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/share", "friend@example.com", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("legacy share by a viewer: expected 403, got %d", rec.Code)
+	}
+}
+
+func TestAuthRequired(t *testing.T) {
+	router, _ := newTestServer(t)
+	if rec := doRequest(t, router, "GET", "/api/my-routes", "", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "GET", "/api/my-routes", "ghost@example.com", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for unknown user, got %d", rec.Code)
+	}
+}
+
+func TestRefreshTokenIsNotAnAccessToken(t *testing.T) {
+	router, _ := newTestServer(t)
+	refreshToken, _, err := auth.GenerateRefreshToken("owner@example.com", testSessionID("owner@example.com"))
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken: %v", err)
+	}
+	req := newRequest(t, "GET", "/api/my-routes", "", nil)
+	req.Header.Set("Authorization", "Bearer "+refreshToken)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a refresh token, got %d", rec.Code)
+	}
+}
+
+func TestListRoutesRejectsBadParams(t *testing.T) {
+	router, _ := newTestServer(t)
+	for _, q := range []string{"limit=0", "sort=size", "order=up", "hasPhotos=maybe", "cursor=!!", "createdAfter=yesterday"} {
+		if rec := doRequest(t, router, "GET", "/api/routes?"+q, "", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, rec.Code)
+		}
+	}
+}
+
+func TestConditionalUpdate(t *testing.T) {
+	router, store := newTestServer(t)
+	id, _ := store.CreateRoute(context.Background(), types.Route{Name: "Trip", CreatorID: "owner@example.com"})
+
+	rec := doRequest(t, router, "GET", "/api/routes/"+id, "owner@example.com", nil)
+	etag := rec.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("expected ETag \"1\", got %q", etag)
+	}
+
+	if rec := doRequest(t, router, "PUT", "/api/routes/"+id, "owner@example.com", types.Route{Name: "Renamed"}); rec.Code != http.StatusPreconditionRequired {
+		t.Errorf("expected 428 without If-Match, got %d", rec.Code)
+	}
+
+	req := newRequest(t, "PUT", "/api/routes/"+id, "owner@example.com", types.Route{Name: "Renamed"})
+	req.Header.Set("If-Match", etag)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected 200 with ETag \"2\", got %d %q", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	// A concurrent photo upload bumps the version, so the stale ETag fails.
+	store.AppendRoutePhotos(context.Background(), id, []types.Photo{{Filename: "a.jpg"}})
+	req = newRequest(t, "DELETE", "/api/routes/"+id, "owner@example.com", nil)
+	req.Header.Set("If-Match", `"2"`)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for stale If-Match, got %d", rec.Code)
+	}
+
+	route, _ := store.GetRouteById(context.Background(), id)
+	if route.Name != "Renamed" || len(route.Photos) != 1 || route.Version != 3 {
+		t.Errorf("unexpected route state: %+v", route)
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	router, store := newTestServer(t)
+	ctx := context.Background()
+	privateID, _ := store.CreateRoute(ctx, types.Route{Name: "Private", CreatorID: "owner@example.com"})
+	publicID, _ := store.CreateRoute(ctx, types.Route{Name: "Public", CreatorID: "owner@example.com"})
+	store.AddUserToSharedRoute(ctx, publicID, "friend@example.com", "friend@example.com", types.RoleEditor)
+	store.CreateShareLink(ctx, types.ShareLink{RouteID: publicID, Role: types.RoleViewer})
+	privateLink, _ := store.CreateShareLink(ctx, types.ShareLink{RouteID: privateID, Role: types.RoleViewer})
+
+	if rec := doRequest(t, router, "GET", "/api/routes/"+privateID, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("private route: expected 404 for anonymous caller, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "PUT", "/api/routes/"+publicID+"/visibility", "friend@example.com", types.VisibilityRequest{Visibility: "public"}); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for collaborator changing visibility, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "PUT", "/api/routes/"+publicID+"/visibility", "owner@example.com", types.VisibilityRequest{Visibility: "everyone"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown visibility, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "PUT", "/api/routes/"+publicID+"/visibility", "owner@example.com", types.VisibilityRequest{Visibility: "public"}); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for owner changing visibility, got %d", rec.Code)
+	}
+
+	rec := doRequest(t, router, "GET", "/api/routes/"+publicID, "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("public route: expected 200, got %d", rec.Code)
+	}
+	var raw map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&raw)
+	for _, leaked := range []string{"sharedWith", "shareToken", "creatorId"} {
+		if _, ok := raw[leaked]; ok {
+			t.Errorf("public projection leaked %q", leaked)
+		}
+	}
+	if raw["collaboratorCount"] != float64(1) {
+		t.Errorf("expected collaboratorCount 1, got %v", raw["collaboratorCount"])
+	}
+
+	rec = doRequest(t, router, "GET", "/api/routes", "", nil)
+	var page types.PublicRoutePage
+	json.NewDecoder(rec.Body).Decode(&page)
+	if len(page.Routes) != 1 || page.Routes[0].ID != publicID {
+		t.Errorf("expected only the public route in the catalogue, got %+v", page.Routes)
+	}
+	// The catalogue ignores the creator filter so it can't be used to find
+	// out who owns a public route
+	rec = doRequest(t, router, "GET", "/api/routes?creator=someone@example.com", "", nil)
+	page = types.PublicRoutePage{}
+	json.NewDecoder(rec.Body).Decode(&page)
+	if len(page.Routes) != 1 {
+		t.Errorf("expected the creator filter to be ignored in the catalogue, got %+v", page.Routes)
+	}
+
+	// A share link to a private route can be joined but not previewed
+	if rec := doRequest(t, router, "GET", "/api/shared-routes/"+privateLink.Token, "", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("private route preview: expected 403, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "POST", "/api/shared-routes/"+privateLink.Token+"/join", "third@example.com", nil); rec.Code != http.StatusOK {
+		t.Errorf("private route join: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCollaboratorRoles(t *testing.T) {
+	router, store := newTestServer(t)
+	ctx := context.Background()
+	id, _ := store.CreateRoute(ctx, types.Route{Name: "Trip", CreatorID: "owner@example.com"})
+
+	rec := doRequest(t, router, "POST", "/api/routes/"+id+"/share-links", "owner@example.com", types.ShareLinkRequest{Role: types.RoleViewer})
+	var share types.ShareLink
+	json.NewDecoder(rec.Body).Decode(&share)
+	if share.Role != types.RoleViewer {
+		t.Fatalf("expected viewer share link, got %q", share.Role)
+	}
+	doRequest(t, router, "POST", "/api/shared-routes/"+share.Token+"/join", "friend@example.com", nil)
+
+	update := func(email string) int {
+		route, _ := store.GetRouteById(ctx, id)
+		route.Name = "Renamed by " + email
+		req := newRequest(t, "PUT", "/api/routes/"+id, email, route)
+		req.Header.Set("If-Match", routeETag(route.Version))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := update("friend@example.com"); code != http.StatusForbidden {
+		t.Errorf("viewer edit: expected 403, got %d", code)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/generate-upload-urls", "friend@example.com", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("viewer upload: expected 403, got %d", rec.Code)
+	}
+
+	if rec := doRequest(t, router, "PUT", "/api/routes/"+id+"/collaborators/friend@example.com", "owner@example.com", types.CollaboratorRoleRequest{Role: types.RoleEditor}); rec.Code != http.StatusOK {
+		t.Fatalf("promote to editor: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if code := update("friend@example.com"); code != http.StatusOK {
+		t.Errorf("editor edit: expected 200, got %d", code)
+	}
+	if route, _ := store.GetRouteById(ctx, id); route.CreatorID != "owner@example.com" {
+		t.Errorf("editing must not change the creator, got %q", route.CreatorID)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/share-links", "friend@example.com", types.ShareLinkRequest{}); rec.Code != http.StatusForbidden {
+		t.Errorf("editor share: expected 403, got %d", rec.Code)
+	}
+
+	// Co-owners manage sharing, but only for roles below their own
+	doRequest(t, router, "PUT", "/api/routes/"+id+"/collaborators/friend@example.com", "owner@example.com", types.CollaboratorRoleRequest{Role: types.RoleCoOwner})
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/share-links", "friend@example.com", types.ShareLinkRequest{Role: types.RoleCoOwner}); rec.Code != http.StatusForbidden {
+		t.Errorf("co-owner granting co-owner: expected 403, got %d", rec.Code)
+	}
+	rec = doRequest(t, router, "POST", "/api/routes/"+id+"/share-links", "friend@example.com", types.ShareLinkRequest{Role: types.RoleEditor})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("co-owner share: expected 200, got %d", rec.Code)
+	}
+	json.NewDecoder(rec.Body).Decode(&share)
+	doRequest(t, router, "POST", "/api/shared-routes/"+share.Token+"/join", "third@example.com", nil)
+	if role, _ := store.CheckUserRoutePermission(ctx, "third@example.com", id); role != types.RoleEditor {
+		t.Errorf("expected joiner to get editor, got %q", role)
+	}
+	if rec := doRequest(t, router, "PUT", "/api/routes/"+id+"/collaborators/friend@example.com", "friend@example.com", types.CollaboratorRoleRequest{Role: types.RoleViewer}); rec.Code != http.StatusForbidden {
+		t.Errorf("co-owner changing a co-owner: expected 403, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "PUT", "/api/routes/"+id+"/collaborators/nobody@example.com", "owner@example.com", types.CollaboratorRoleRequest{Role: types.RoleViewer}); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown collaborator: expected 404, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "DELETE", "/api/routes/"+id, "friend@example.com", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("co-owner delete: expected 403, got %d", rec.Code)
+	}
+}
+
+func TestRemoveLeaveAndRotate(t *testing.T) {
+	router, store := newTestServer(t)
+	ctx := context.Background()
+	id, _ := store.CreateRoute(ctx, types.Route{Name: "Trip", CreatorID: "owner@example.com"})
+	old, _ := store.CreateShareLink(ctx, types.ShareLink{RouteID: id, Role: types.RoleContributor})
+	store.AddUserToSharedRoute(ctx, id, "friend@example.com", "friend@example.com", types.RoleContributor)
+	store.AddUserToSharedRoute(ctx, id, "third@example.com", "third@example.com", types.RoleViewer)
+
+	rec := doRequest(t, router, "POST", "/api/routes/"+id+"/share-links/"+old.ID+"/rotate", "owner@example.com", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rotate: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var rotated types.ShareLink
+	json.NewDecoder(rec.Body).Decode(&rotated)
+	if rotated.Token == old.Token || rotated.Role != types.RoleContributor {
+		t.Errorf("expected a new contributor token, got %+v", rotated)
+	}
+	if _, err := store.GetShareLinkByToken(ctx, old.Token); err == nil {
+		t.Error("old share token still works after rotation")
+	}
+
+	if rec := doRequest(t, router, "DELETE", "/api/routes/"+id+"/collaborators/third@example.com", "friend@example.com", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("contributor removing someone: expected 403, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "DELETE", "/api/routes/"+id+"/collaborators/third@example.com", "owner@example.com", nil); rec.Code != http.StatusOK {
+		t.Errorf("owner removing collaborator: expected 200, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/leave", "friend@example.com", nil); rec.Code != http.StatusOK {
+		t.Errorf("leave: expected 200, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/leave", "owner@example.com", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("owner leaving: expected 400, got %d", rec.Code)
+	}
+
+	route, _ := store.GetRouteById(ctx, id)
+	if len(route.SharedWith) != 0 {
+		t.Errorf("expected no collaborators, got %+v", route.SharedWith)
+	}
+	if _, err := store.GetShareLinkByToken(ctx, rotated.Token); err != nil {
+		t.Errorf("rotated link should survive removals: %v", err)
+	}
+}
+
+func TestShareLinkJoinLimit(t *testing.T) {
+	router, store := newTestServer(t)
+	ctx := context.Background()
+	id, _ := store.CreateRoute(ctx, types.Route{Name: "Trip", CreatorID: "owner@example.com"})
+
+	tooLong := math.MaxInt
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/share-links", "owner@example.com", types.ShareLinkRequest{ExpiryHours: &tooLong}); rec.Code != http.StatusBadRequest {
+		t.Errorf("expiry past 30 days: expected 400, got %d", rec.Code)
+	}
+
+	rec := doRequest(t, router, "POST", "/api/routes/"+id+"/share-links", "owner@example.com", types.ShareLinkRequest{Label: "Family", Role: types.RoleViewer, MaxJoins: 1})
+	var family types.ShareLink
+	json.NewDecoder(rec.Body).Decode(&family)
+	rec = doRequest(t, router, "POST", "/api/routes/"+id+"/share-links", "owner@example.com", types.ShareLinkRequest{Label: "Crew", Role: types.RoleEditor})
+	var crew types.ShareLink
+	json.NewDecoder(rec.Body).Decode(&crew)
+
+	if rec := doRequest(t, router, "POST", "/api/shared-routes/"+family.Token+"/join", "friend@example.com", nil); rec.Code != http.StatusOK {
+		t.Fatalf("first join: expected 200, got %d", rec.Code)
+	}
+	// Re-joining doesn't use up the link
+	if rec := doRequest(t, router, "POST", "/api/shared-routes/"+family.Token+"/join", "friend@example.com", nil); rec.Code != http.StatusOK {
+		t.Fatalf("re-join: expected 200, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "POST", "/api/shared-routes/"+family.Token+"/join", "third@example.com", nil); rec.Code != http.StatusGone {
+		t.Errorf("exhausted link: expected 410, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "POST", "/api/shared-routes/"+crew.Token+"/join", "third@example.com", nil); rec.Code != http.StatusOK {
+		t.Fatalf("second link: expected 200, got %d", rec.Code)
+	}
+	if role, _ := store.CheckUserRoutePermission(ctx, "third@example.com", id); role != types.RoleEditor {
+		t.Errorf("expected editor via the crew link, got %q", role)
+	}
+
+	rec = doRequest(t, router, "GET", "/api/routes/"+id+"/share-links", "owner@example.com", nil)
+	var listed struct {
+		Links []types.ShareLink `json:"links"`
+	}
+	json.NewDecoder(rec.Body).Decode(&listed)
+	if len(listed.Links) != 2 || listed.Links[0].JoinCount != 1 || listed.Links[0].LastUsedAt == nil {
+		t.Errorf("unexpected links: %+v", listed.Links)
+	}
+
+	if rec := doRequest(t, router, "DELETE", "/api/routes/"+id+"/share-links/"+crew.ID, "owner@example.com", nil); rec.Code != http.StatusOK {
+		t.Errorf("revoke: expected 200, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "GET", "/api/shared-routes/"+crew.Token, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("revoked link: expected 404, got %d", rec.Code)
+	}
+	if role, _ := store.CheckUserRoutePermission(ctx, "third@example.com", id); role != types.RoleEditor {
+		t.Errorf("revoking a link must not evict its members, got %q", role)
+	}
+}
+
+func TestPassphraseProtectedLink(t *testing.T) {
+	router, store := newTestServer(t)
+	id, _ := store.CreateRoute(context.Background(), types.Route{Name: "Family trip", CreatorID: "owner@example.com", Visibility: types.VisibilityUnlisted})
+
+	rec := doRequest(t, router, "POST", "/api/routes/"+id+"/share-links", "owner@example.com", types.ShareLinkRequest{Passphrase: "open sesame"})
+	var link types.ShareLink
+	json.NewDecoder(rec.Body).Decode(&link)
+	if !link.Protected || strings.Contains(rec.Body.String(), "passphraseHash") {
+		t.Fatalf("expected a protected link without its hash, got %s", rec.Body)
+	}
+
+	if rec := doRequest(t, router, "GET", "/api/shared-routes/"+link.Token, "", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("preview without grant: expected 403, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "POST", "/api/shared-routes/"+link.Token+"/join", "friend@example.com", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("join without grant: expected 403, got %d", rec.Code)
+	}
+
+	rec = doRequest(t, router, "POST", "/api/shared-routes/"+link.Token+"/unlock", "", types.UnlockShareLinkRequest{Passphrase: "open sesame"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unlock: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var grant types.ShareAccessGrant
+	json.NewDecoder(rec.Body).Decode(&grant)
+
+	req := newRequest(t, "GET", "/api/shared-routes/"+link.Token, "", nil)
+	req.Header.Set("X-Share-Grant", grant.Grant)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("preview with grant: expected 200, got %d", rec.Code)
+	}
+	req = newRequest(t, "POST", "/api/shared-routes/"+link.Token+"/join", "friend@example.com", nil)
+	req.Header.Set("X-Share-Grant", grant.Grant)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("join with grant: expected 200, got %d", rec.Code)
+	}
+
+	// Wrong guesses lock the link, after which even the right passphrase
+	// is refused
+	for i := 1; i < 5; i++ {
+		if rec := doRequest(t, router, "POST", "/api/shared-routes/"+link.Token+"/unlock", "", types.UnlockShareLinkRequest{Passphrase: "guess"}); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong guess %d: expected 401, got %d", i, rec.Code)
+		}
+	}
+	if rec := doRequest(t, router, "POST", "/api/shared-routes/"+link.Token+"/unlock", "", types.UnlockShareLinkRequest{Passphrase: "guess"}); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("fifth wrong guess: expected 429 with Retry-After, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "POST", "/api/shared-routes/"+link.Token+"/unlock", "", types.UnlockShareLinkRequest{Passphrase: "open sesame"}); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("unlock while locked: expected 429, got %d", rec.Code)
+	}
+}
+
+func TestInvitations(t *testing.T) {
+	router, store := newTestServer(t)
+	var sent []string
+	sendInvitationEmail = func(email, inviter, routeName, role string) error {
+		sent = append(sent, email)
+		return nil
+	}
+	t.Cleanup(func() { sendInvitationEmail = auth.SendInvitationEmail })
+	id, _ := store.CreateRoute(context.Background(), types.Route{Name: "Trip", CreatorID: "owner@example.com"})
+
+	rec := doRequest(t, router, "POST", "/api/routes/"+id+"/invitations", "owner@example.com", types.InvitationRequest{Email: "Friend@Example.com", Role: types.RoleEditor})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("invite: expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	var inv types.Invitation
+	json.NewDecoder(rec.Body).Decode(&inv)
+	if inv.Email != "friend@example.com" || len(sent) != 1 {
+		t.Fatalf("expected a lowercased invitation and one email, got %+v and %v", inv, sent)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/invitations", "owner@example.com", types.InvitationRequest{Email: "friend@example.com"}); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate invite: expected 409, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/invitations", "owner@example.com", types.InvitationRequest{Email: "owner@example.com"}); rec.Code != http.StatusConflict {
+		t.Errorf("inviting the owner: expected 409, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/invitations", "third@example.com", types.InvitationRequest{Email: "x@example.com"}); rec.Code != http.StatusForbidden {
+		t.Errorf("invite by a stranger: expected 403, got %d", rec.Code)
+	}
+
+	// Only the addressee can see and answer it
+	if rec := doRequest(t, router, "POST", "/api/invitations/"+inv.ID+"/accept", "third@example.com", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("accept by someone else: expected 404, got %d", rec.Code)
+	}
+	rec = doRequest(t, router, "GET", "/api/invitations", "friend@example.com", nil)
+	var inbox struct {
+		Invitations []types.Invitation `json:"invitations"`
+	}
+	json.NewDecoder(rec.Body).Decode(&inbox)
+	if len(inbox.Invitations) != 1 || inbox.Invitations[0].RouteName != "Trip" {
+		t.Fatalf("expected one invitation in the inbox, got %s", rec.Body)
+	}
+	if rec := doRequest(t, router, "POST", "/api/invitations/"+inv.ID+"/accept", "friend@example.com", nil); rec.Code != http.StatusOK {
+		t.Fatalf("accept: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if role, _ := store.CheckUserRoutePermission(context.Background(), "friend@example.com", id); role != types.RoleEditor {
+		t.Errorf("expected editor after accepting, got %q", role)
+	}
+	if rec := doRequest(t, router, "POST", "/api/invitations/"+inv.ID+"/decline", "friend@example.com", nil); rec.Code != http.StatusConflict {
+		t.Errorf("answering twice: expected 409, got %d", rec.Code)
+	}
+
+	// Declined and expired invitations grant nothing
+	rec = doRequest(t, router, "POST", "/api/routes/"+id+"/invitations", "owner@example.com", types.InvitationRequest{Email: "third@example.com"})
+	json.NewDecoder(rec.Body).Decode(&inv)
+	if rec := doRequest(t, router, "POST", "/api/invitations/"+inv.ID+"/decline", "third@example.com", nil); rec.Code != http.StatusOK {
+		t.Fatalf("decline: expected 200, got %d", rec.Code)
+	}
+	stale, _ := store.CreateInvitation(context.Background(), types.Invitation{
+		RouteID: id, Email: "third@example.com", Role: types.RoleViewer, ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if rec := doRequest(t, router, "POST", "/api/invitations/"+stale.ID+"/accept", "third@example.com", nil); rec.Code != http.StatusGone {
+		t.Errorf("accept expired: expected 410, got %d", rec.Code)
+	}
+	if role, _ := store.CheckUserRoutePermission(context.Background(), "third@example.com", id); role != "" {
+		t.Errorf("expected no access, got %q", role)
+	}
+}
+
+func TestJoinRequestApproval(t *testing.T) {
+	router, store := newTestServer(t)
+	id, _ := store.CreateRoute(context.Background(), types.Route{Name: "Group trip", CreatorID: "owner@example.com"})
+
+	rec := doRequest(t, router, "POST", "/api/routes/"+id+"/share-links", "owner@example.com", types.ShareLinkRequest{RequireApproval: true, Role: types.RoleEditor})
+	var link types.ShareLink
+	json.NewDecoder(rec.Body).Decode(&link)
+	if !link.RequireApproval {
+		t.Fatalf("expected an approval link, got %s", rec.Body)
+	}
+
+	// Joining files a request and grants nothing yet; asking again
+	// returns the same request
+	var joined struct {
+		Status  string            `json:"status"`
+		Request types.JoinRequest `json:"request"`
+	}
+	for _, email := range []string{"friend@example.com", "third@example.com"} {
+		rec = doRequest(t, router, "POST", "/api/shared-routes/"+link.Token+"/join", email, nil)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("join by %s: expected 202, got %d: %s", email, rec.Code, rec.Body)
+		}
+	}
+	rec = doRequest(t, router, "POST", "/api/shared-routes/"+link.Token+"/join", "friend@example.com", nil)
+	json.NewDecoder(rec.Body).Decode(&joined)
+	if joined.Status != types.JoinRequestPending {
+		t.Fatalf("expected a pending request, got %+v", joined)
+	}
+	if role, _ := store.CheckUserRoutePermission(context.Background(), "friend@example.com", id); role != "" {
+		t.Fatalf("expected no access before approval, got %q", role)
+	}
+
+	rec = doRequest(t, router, "GET", "/api/routes/"+id+"/join-requests", "owner@example.com", nil)
+	var listed struct {
+		Requests []types.JoinRequest `json:"requests"`
+	}
+	json.NewDecoder(rec.Body).Decode(&listed)
+	if len(listed.Requests) != 2 {
+		t.Fatalf("expected 2 pending requests, got %s", rec.Body)
+	}
+	if rec := doRequest(t, router, "GET", "/api/routes/"+id+"/join-requests", "friend@example.com", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("requester listing requests: expected 403, got %d", rec.Code)
+	}
+
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/join-requests/"+joined.Request.ID+"/approve", "owner@example.com", nil); rec.Code != http.StatusOK {
+		t.Fatalf("approve: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if role, _ := store.CheckUserRoutePermission(context.Background(), "friend@example.com", id); role != types.RoleEditor {
+		t.Errorf("expected editor after approval, got %q", role)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/join-requests/"+joined.Request.ID+"/reject", "owner@example.com", nil); rec.Code != http.StatusConflict {
+		t.Errorf("deciding twice: expected 409, got %d", rec.Code)
+	}
+
+	// The rejected requester can see the outcome and still has no access
+	for _, req := range listed.Requests {
+		if req.UserID == "third@example.com" {
+			if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/join-requests/"+req.ID+"/reject", "owner@example.com", nil); rec.Code != http.StatusOK {
+				t.Fatalf("reject: expected 200, got %d", rec.Code)
+			}
+		}
+	}
+	rec = doRequest(t, router, "GET", "/api/my-join-requests", "third@example.com", nil)
+	var mine struct {
+		Requests []types.JoinRequest `json:"requests"`
+	}
+	json.NewDecoder(rec.Body).Decode(&mine)
+	if len(mine.Requests) != 1 || mine.Requests[0].Status != types.JoinRequestRejected {
+		t.Errorf("expected one rejected request, got %s", rec.Body)
+	}
+	if role, _ := store.CheckUserRoutePermission(context.Background(), "third@example.com", id); role != "" {
+		t.Errorf("expected no access after rejection, got %q", role)
+	}
+
+	// Members pass straight through
+	if rec := doRequest(t, router, "POST", "/api/shared-routes/"+link.Token+"/join", "friend@example.com", nil); rec.Code != http.StatusOK {
+		t.Errorf("member re-joining: expected 200, got %d", rec.Code)
+	}
+}
+
+func TestJoinRequestNeedsUsableLink(t *testing.T) {
+	router, store := newTestServer(t)
+	ctx := context.Background()
+	id, _ := store.CreateRoute(ctx, types.Route{Name: "Group trip", CreatorID: "owner@example.com"})
+
+	// Approvals count against the link's limit
+	link, _ := store.CreateShareLink(ctx, types.ShareLink{RouteID: id, Role: types.RoleViewer, RequireApproval: true, MaxJoins: 1})
+	first, _ := store.RequestToJoin(ctx, link.Token, "friend@example.com", "friend@example.com")
+	second, _ := store.RequestToJoin(ctx, link.Token, "third@example.com", "third@example.com")
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/join-requests/"+first.ID+"/approve", "owner@example.com", nil); rec.Code != http.StatusOK {
+		t.Fatalf("approve: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/join-requests/"+second.ID+"/approve", "owner@example.com", nil); rec.Code != http.StatusGone {
+		t.Errorf("approve past maxJoins: expected 410, got %d", rec.Code)
+	}
+	if role, _ := store.CheckUserRoutePermission(ctx, "third@example.com", id); role != "" {
+		t.Errorf("expected no access past the link's limit, got %q", role)
+	}
+
+	// Revoking a link cancels the requests filed through it
+	link, _ = store.CreateShareLink(ctx, types.ShareLink{RouteID: id, Role: types.RoleEditor, RequireApproval: true})
+	pending, _ := store.RequestToJoin(ctx, link.Token, "fourth@example.com", "fourth@example.com")
+	if err := store.RevokeShareLink(ctx, id, link.ID); err != nil {
+		t.Fatalf("RevokeShareLink: %v", err)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/join-requests/"+pending.ID+"/approve", "owner@example.com", nil); rec.Code != http.StatusConflict {
+		t.Errorf("approve after revoke: expected 409, got %d", rec.Code)
+	}
+	requests, _ := store.ListJoinRequestsForUser(ctx, "fourth@example.com")
+	if len(requests) == 0 || requests[0].Status != types.JoinRequestCancelled {
+		t.Errorf("expected the request to be cancelled, got %+v", requests)
+	}
+	if role, _ := store.CheckUserRoutePermission(ctx, "fourth@example.com", id); role != "" {
+		t.Errorf("expected no access through a revoked link, got %q", role)
+	}
+}
+
+func TestOwnershipTransfer(t *testing.T) {
+	router, store := newTestServer(t)
+	ctx := context.Background()
+	id, _ := store.CreateRoute(ctx, types.Route{Name: "Trip", CreatorID: "owner@example.com"})
+	store.AddUserToSharedRoute(ctx, id, "friend@example.com", "friend@example.com", types.RoleEditor)
+	store.AddUserToSharedRoute(ctx, id, "third@example.com", "third@example.com", types.RoleCoOwner)
+
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/transfer", "third@example.com", types.TransferOwnershipRequest{UserID: "friend@example.com"}); rec.Code != http.StatusForbidden {
+		t.Errorf("offer by co-owner: expected 403, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/transfer", "owner@example.com", types.TransferOwnershipRequest{UserID: "stranger@example.com"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("offer to a non-collaborator: expected 400, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/transfer", "owner@example.com", types.TransferOwnershipRequest{UserID: "friend@example.com"}); rec.Code != http.StatusOK {
+		t.Fatalf("offer: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Nothing moves until the offer is accepted, and only by its target
+	if role, _ := store.CheckUserRoutePermission(ctx, "owner@example.com", id); role != types.RoleOwner {
+		t.Fatalf("expected the owner to keep the route while the offer is open, got %q", role)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/transfer/accept", "third@example.com", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("accept by someone else: expected 404, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/transfer/accept", "friend@example.com", nil); rec.Code != http.StatusOK {
+		t.Fatalf("accept: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	route, _ := store.GetRouteById(ctx, id)
+	if route.CreatorID != "friend@example.com" || route.PendingTransfer != nil {
+		t.Fatalf("expected friend to own the route with no pending offer, got %+v", route)
+	}
+	for email, want := range map[string]string{
+		"friend@example.com": types.RoleOwner,
+		"owner@example.com":  types.RoleCoOwner,
+		"third@example.com":  types.RoleCoOwner,
+	} {
+		if role, _ := store.CheckUserRoutePermission(ctx, email, id); role != want {
+			t.Errorf("%s: expected %q, got %q", email, want, role)
+		}
+	}
+
+	// Handing it back with keepAccess=false removes the previous owner
+	keep := false
+	doRequest(t, router, "POST", "/api/routes/"+id+"/transfer", "friend@example.com", types.TransferOwnershipRequest{UserID: "owner@example.com", KeepAccess: &keep})
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/transfer/accept", "owner@example.com", nil); rec.Code != http.StatusOK {
+		t.Fatalf("accept back: expected 200, got %d", rec.Code)
+	}
+	if role, _ := store.CheckUserRoutePermission(ctx, "friend@example.com", id); role != "" {
+		t.Errorf("expected friend to have opted out of access, got %q", role)
+	}
+
+	// Declined offers leave ownership where it was
+	doRequest(t, router, "POST", "/api/routes/"+id+"/transfer", "owner@example.com", types.TransferOwnershipRequest{UserID: "third@example.com"})
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/transfer/decline", "third@example.com", nil); rec.Code != http.StatusOK {
+		t.Fatalf("decline: expected 200, got %d", rec.Code)
+	}
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/transfer/accept", "third@example.com", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("accept after declining: expected 404, got %d", rec.Code)
+	}
+}
+
+// noTransactions is a store whose backend can't run transactions, like
+// MongoDB without a replica set
+type noTransactions struct {
+	*memory.Memory
+}
+
+func (noTransactions) AcceptOwnershipTransfer(ctx context.Context, routeId, userId string) (types.Route, error) {
+	return types.Route{}, storage.ErrUnsupported
+}
+
+func TestOwnershipTransferWithoutTransactions(t *testing.T) {
+	_, store := newTestServer(t)
+	router := http.NewServeMux()
+	RegisterRoutes(router, noTransactions{store})
+	id, _ := store.CreateRoute(context.Background(), types.Route{Name: "Trip", CreatorID: "owner@example.com"})
+
+	if rec := doRequest(t, router, "POST", "/api/routes/"+id+"/transfer/accept", "friend@example.com", nil); rec.Code != http.StatusNotImplemented {
+		t.Errorf("accept without transactions: expected 501, got %d", rec.Code)
+	}
+	// The rest of the API doesn't need them
+	if rec := doRequest(t, router, "GET", "/api/routes/"+id, "owner@example.com", nil); rec.Code != http.StatusOK {
+		t.Errorf("get route: expected 200, got %d", rec.Code)
+	}
+}
@@ -11,7 +11,6 @@ import (
 
 	"github.com/atindraraut/crudgo/internal/types"
 	"github.com/atindraraut/crudgo/internal/utils"
-	"github.com/atindraraut/crudgo/internal/utils/middleware"
 	"github.com/atindraraut/crudgo/internal/utils/response"
 	"github.com/atindraraut/crudgo/storage"
 )
@@ -35,11 +34,6 @@ const cloudfrontDomain = "https://d20v9h61x1jwiy.cloudfront.net"
 
 func GenerateS3UploadUrlsHandler(storage storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		user := middleware.GetAuthUser(r)
-		if user == nil {
-			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("unauthorized")))
-			return
-		}
 		routeId := r.PathValue("id")
 		if routeId == "" {
 			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("route id required")))
@@ -47,14 +41,7 @@ func GenerateS3UploadUrlsHandler(storage storage.Storage) http.HandlerFunc {
 		}
 		
 		// Check if user has permission to upload photos to this route
-		permission, err := storage.CheckUserRoutePermission(user.Email, routeId)
-		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
-			return
-		}
-		
-		if permission != "owner" && permission != "upload" {
-			response.WriteJSON(w, http.StatusForbidden, response.GeneralError(errors.New("you don't have permission to upload photos to this route")))
+		if _, _, ok := authorizeRoute(w, r, storage, routeId, types.ActionUploadPhotos, "you don't have permission to upload photos to this route"); !ok {
 			return
 		}
 		var req GenerateS3UrlsRequest
@@ -103,31 +90,9 @@ func GenerateS3UploadUrlsHandler(storage storage.Storage) http.HandlerFunc {
 					CloudfrontUrl: url.CloudfrontUrl,
 				}
 			}
-			// Fetch the existing route to ensure the update is applied correctly
-			existingRoute, err := storage.GetRouteById(routeId)
-			if err != nil {
-				response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
-				return
-			}
-
-			// Cast the existing route to types.Route
-			route, ok := existingRoute.(types.Route)
-			if !ok {
-				response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("invalid route type")))
-				return
-			}
-
-			// Append the new photos to the existing ones instead of replacing them
-			if route.Photos == nil {
-				route.Photos = photos
-			} else {
-				route.Photos = append(route.Photos, photos...)
-			}
-
-			// Save the updated route
-			_, updateErr := storage.UpdateRoute(routeId, route)
-			if updateErr != nil {
-				response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(updateErr))
+			// Append atomically so concurrent uploads don't drop each other's photos
+			if err := storage.AppendRoutePhotos(r.Context(), routeId, photos); err != nil {
+				writeStorageError(w, err, "route not found")
 				return
 			}
 		}
@@ -0,0 +1,248 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// Wrong passphrases allowed per link before it is locked
+	shareLinkMaxFailures = 5
+	shareLinkLockout     = 15 * time.Minute
+	shareGrantTTL        = 30 * time.Minute
+	// shareGrantHeader carries the grant returned by the unlock endpoint
+	shareGrantHeader = "X-Share-Grant"
+)
+
+func CreateShareLink(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, ok := createShareLink(w, r, storage)
+		if !ok {
+			return
+		}
+		response.WriteJSON(w, http.StatusCreated, link)
+	}
+}
+
+// ShareRoute is the single-link endpoint from before share links had
+// names. It creates a link with the defaults, or whatever the body asks
+// for, and answers with the old response shape.
+func ShareRoute(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, ok := createShareLink(w, r, storage)
+		if !ok {
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, types.ShareRouteResponse{
+			ShareToken: link.Token,
+			ExpiresAt:  link.ExpiresAt,
+		})
+	}
+}
+
+// Helper: create a share link for the route in the path from the
+// ShareLinkRequest in the body. Writes the error and returns false if that
+// fails.
+func createShareLink(w http.ResponseWriter, r *http.Request, storage storage.Storage) (types.ShareLink, bool) {
+	id := r.PathValue("id")
+	user, role, ok := authorizeRoute(w, r, storage, id, types.ActionManageSharing, "you don't have permission to share this route")
+	if !ok {
+		return types.ShareLink{}, false
+	}
+
+	// All fields are optional, so an empty body is fine
+	var req types.ShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid request body")))
+		return types.ShareLink{}, false
+	}
+	if err := validator.New().Struct(&req); err != nil {
+		validatorErrors := err.(validator.ValidationErrors)
+		response.WriteJSON(w, http.StatusBadRequest, response.ValidationError(validatorErrors))
+		return types.ShareLink{}, false
+	}
+	if req.Role == "" {
+		req.Role = types.DefaultShareRole
+	}
+	if !types.CanAssignRole(role, req.Role) {
+		response.WriteJSON(w, http.StatusForbidden, response.GeneralError(fmt.Errorf("you can't grant the %s role", req.Role)))
+		return types.ShareLink{}, false
+	}
+
+	link := types.ShareLink{
+		RouteID:         id,
+		Label:           req.Label,
+		Role:            req.Role,
+		MaxJoins:        req.MaxJoins,
+		CreatedBy:       user.Email,
+		RequireApproval: req.RequireApproval,
+	}
+	if req.ExpiryHours != nil {
+		expiry := time.Now().Add(time.Duration(*req.ExpiryHours) * time.Hour)
+		link.ExpiresAt = &expiry
+	}
+	if req.Passphrase != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Passphrase), bcrypt.DefaultCost)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+			return types.ShareLink{}, false
+		}
+		link.Protected = true
+		link.PassphraseHash = string(hash)
+	}
+	link, err := storage.CreateShareLink(r.Context(), link)
+	if err != nil {
+		writeStorageError(w, err, "route not found")
+		return types.ShareLink{}, false
+	}
+	return link, true
+}
+
+func ListShareLinks(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if _, _, ok := authorizeRoute(w, r, storage, id, types.ActionManageSharing, "you don't have permission to view share links"); !ok {
+			return
+		}
+		links, err := storage.ListShareLinks(r.Context(), id)
+		if err != nil {
+			writeStorageError(w, err, "route not found")
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{"links": links})
+	}
+}
+
+func RevokeShareLink(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if _, _, ok := authorizeRoute(w, r, storage, id, types.ActionManageSharing, "you don't have permission to revoke share links"); !ok {
+			return
+		}
+		// People who already joined through the link keep their access
+		if err := storage.RevokeShareLink(r.Context(), id, r.PathValue("linkId")); err != nil {
+			writeStorageError(w, err, "share link not found")
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"message": "Share link revoked",
+		})
+	}
+}
+
+func RotateShareLink(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if _, _, ok := authorizeRoute(w, r, storage, id, types.ActionManageSharing, "you don't have permission to share this route"); !ok {
+			return
+		}
+		link, err := storage.RotateShareLink(r.Context(), id, r.PathValue("linkId"))
+		if err != nil {
+			writeStorageError(w, err, "share link not found")
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, link)
+	}
+}
+
+// UnlockShareLink trades a protected link's passphrase for a short-lived
+// access grant, to be sent in the X-Share-Grant header when previewing or
+// joining through the link.
+func UnlockShareLink(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.PathValue("token")
+		link, err := storage.GetShareLinkByToken(r.Context(), token)
+		if err != nil {
+			writeStorageError(w, err, "share token not found")
+			return
+		}
+		if !link.Protected {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("this share link has no passphrase")))
+			return
+		}
+
+		var req types.UnlockShareLinkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid request body")))
+			return
+		}
+		if err := validator.New().Struct(&req); err != nil {
+			validatorErrors := err.(validator.ValidationErrors)
+			response.WriteJSON(w, http.StatusBadRequest, response.ValidationError(validatorErrors))
+			return
+		}
+
+		// Claim the attempt before comparing so parallel guesses can't all
+		// get in ahead of the lock
+		claimed, err := storage.ClaimShareLinkAttempt(r.Context(), link.ID, shareLinkMaxFailures, shareLinkLockout)
+		if until, ok := retryAt(err); ok {
+			writeLocked(w, until)
+			return
+		}
+		if err != nil {
+			writeStorageError(w, err, "share token not found")
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.PassphraseHash), []byte(req.Passphrase)) != nil {
+			// This guess used up the last attempt and locked the link
+			if claimed.LockedUntil != nil && claimed.LockedUntil.After(time.Now()) {
+				writeLocked(w, *claimed.LockedUntil)
+				return
+			}
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("incorrect passphrase")))
+			return
+		}
+		if err := storage.ResetShareLinkFailures(r.Context(), link.ID); err != nil {
+			writeStorageError(w, err, "share token not found")
+			return
+		}
+
+		grant, expiresAt, err := auth.GenerateShareGrant(link.Token, shareGrantTTL)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, types.ShareAccessGrant{Grant: grant, ExpiresAt: expiresAt})
+	}
+}
+
+// passphraseRequiredMsg is matched by the frontend to show the passphrase
+// prompt.
+const passphraseRequiredMsg = "this share link needs a passphrase"
+
+// privateRouteMsg is matched by the frontend to offer joining without a
+// preview.
+const privateRouteMsg = "this route is private; join it to see the details"
+
+// requireShareGrant writes a 403 and returns false if link is protected and
+// the request doesn't carry a valid grant for it.
+func requireShareGrant(w http.ResponseWriter, r *http.Request, link types.ShareLink) bool {
+	if !link.Protected {
+		return true
+	}
+	if err := auth.VerifyShareGrant(r.Header.Get(shareGrantHeader), link.Token); err != nil {
+		// 403 rather than 401: the caller may well be logged in, and clients
+		// treat 401 as "refresh your session"
+		response.WriteJSON(w, http.StatusForbidden, response.GeneralError(errors.New(passphraseRequiredMsg)))
+		return false
+	}
+	return true
+}
+
+func writeLocked(w http.ResponseWriter, until time.Time) {
+	retryAfter := int(time.Until(until).Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	response.WriteJSON(w, http.StatusTooManyRequests, response.GeneralError(errors.New("too many wrong passphrases; try again later")))
+}
@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/internal/utils/middleware"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+	"github.com/go-playground/validator/v10"
+)
+
+// transferOfferTTL is how long a collaborator has to accept ownership
+const transferOfferTTL = 7 * 24 * time.Hour
+
+func OfferOwnershipTransfer(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		user, _, ok := authorizeRoute(w, r, storage, id, types.ActionTransferOwnership, "only the owner can transfer this route")
+		if !ok {
+			return
+		}
+
+		var req types.TransferOwnershipRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid request body")))
+			return
+		}
+		if err := validator.New().Struct(&req); err != nil {
+			validatorErrors := err.(validator.ValidationErrors)
+			response.WriteJSON(w, http.StatusBadRequest, response.ValidationError(validatorErrors))
+			return
+		}
+		if req.UserID == user.Email {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("you already own this route")))
+			return
+		}
+
+		now := time.Now()
+		transfer := types.OwnershipTransfer{
+			From:       user.Email,
+			To:         req.UserID,
+			KeepAccess: req.KeepAccess == nil || *req.KeepAccess,
+			CreatedAt:  now,
+			ExpiresAt:  now.Add(transferOfferTTL),
+		}
+		if err := storage.OfferOwnershipTransfer(r.Context(), id, transfer); err != nil {
+			if isConflict(err) {
+				response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("ownership can only be offered to an existing collaborator")))
+				return
+			}
+			writeStorageError(w, err, "route not found")
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"message":  "Ownership offered; it moves once they accept",
+			"transfer": transfer,
+		})
+	}
+}
+
+func CancelOwnershipTransfer(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if _, _, ok := authorizeRoute(w, r, storage, id, types.ActionTransferOwnership, "only the owner can cancel a transfer"); !ok {
+			return
+		}
+		if err := storage.CancelOwnershipTransfer(r.Context(), id); err != nil {
+			writeStorageError(w, err, "no ownership transfer is pending")
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"message": "Ownership transfer cancelled",
+		})
+	}
+}
+
+func AcceptOwnershipTransfer(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.GetAuthUser(r)
+		if user == nil {
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("unauthorized")))
+			return
+		}
+		route, err := storage.AcceptOwnershipTransfer(r.Context(), r.PathValue("id"), user.Email)
+		if err != nil {
+			if isConflict(err) {
+				response.WriteJSON(w, http.StatusConflict, response.GeneralError(errors.New("the route changed since ownership was offered; ask the owner to offer it again")))
+				return
+			}
+			writeStorageError(w, err, "no ownership transfer is pending for you")
+			return
+		}
+		w.Header().Set("ETag", routeETag(route.Version))
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "You now own this route",
+			"route":   route,
+		})
+	}
+}
+
+func DeclineOwnershipTransfer(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.GetAuthUser(r)
+		if user == nil {
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("unauthorized")))
+			return
+		}
+		if err := storage.DeclineOwnershipTransfer(r.Context(), r.PathValue("id"), user.Email); err != nil {
+			writeStorageError(w, err, "no ownership transfer is pending for you")
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"message": "Ownership transfer declined",
+		})
+	}
+}
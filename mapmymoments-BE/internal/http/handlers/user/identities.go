@@ -0,0 +1,281 @@
+package user
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
+	"github.com/atindraraut/crudgo/internal/utils/middleware"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+// Helper: look up the provider named in the path, writing a 404 for
+// providers that aren't configured
+func identityProvider(w http.ResponseWriter, r *http.Request) (auth.IdentityProvider, bool) {
+	provider, ok := auth.GetIdentityProvider(r.PathValue("provider"))
+	if !ok {
+		response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("unknown sign-in provider")))
+	}
+	return provider, ok
+}
+
+// Helper: redeem the code from a callback for the profile of whoever
+// signed in
+func exchangeCode(w http.ResponseWriter, r *http.Request, provider auth.IdentityProvider, code string, state types.OAuthState) (*types.ProviderProfile, bool) {
+	profile, err := provider.Exchange(r.Context(), code, state.Verifier)
+	if err != nil {
+		slog.Error("OAuth code exchange failed", slog.String("provider", provider.Name()), slog.String("error", err.Error()))
+		response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("failed to exchange code for token")))
+		return nil, false
+	}
+	return profile, true
+}
+
+func linkedIdentities(user types.UserData) []types.LinkedIdentity {
+	if user.Identities == nil {
+		return []types.LinkedIdentity{}
+	}
+	return user.Identities
+}
+
+// Lists the providers people can sign in with
+func oauthProviders(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"providers": auth.IdentityProviderNames(),
+		})
+	}
+}
+
+// OAuth URL handler
+func oauthURL(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, ok := identityProvider(w, r)
+		if !ok {
+			return
+		}
+		state, err := newOAuthState(r, storage, provider.Name(), "")
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to generate state")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"auth_url": provider.AuthCodeURL(state.ID, state.Verifier),
+			"state":    state.ID,
+		})
+	}
+}
+
+// OAuth callback handler. Signs in the user the identity is linked to or
+// signs up a new user. An identity whose email already has an account is
+// never linked here: the provider must have verified the email, and the
+// caller must then prove they own the account through /user/oauth/link.
+// Signing up with an email the provider didn't verify goes through the same
+// endpoints, proving the email with an emailed code before the account is
+// created.
+func oauthCallback(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, ok := identityProvider(w, r)
+		if !ok {
+			return
+		}
+		var req types.OAuthCallbackRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		state, ok := consumeOAuthState(w, r, storage, req.State, provider.Name(), "")
+		if !ok {
+			return
+		}
+		profile, ok := exchangeCode(w, r, provider, req.Code, state)
+		if !ok {
+			return
+		}
+
+		user, err := storage.GetUserByIdentity(r.Context(), provider.Name(), profile.Subject)
+		isNewUser := false
+		switch {
+		case err == nil:
+		case !isNotFound(err):
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to look up user")))
+			return
+		case profile.Email == "":
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("the provider did not share an email address")))
+			return
+		default:
+			identity := types.NewLinkedIdentity(provider.Name(), *profile)
+			user, err = storage.GetUserByEmail(r.Context(), profile.Email)
+			switch {
+			case err == nil && !profile.EmailVerified:
+				response.WriteJSON(w, http.StatusConflict, map[string]string{
+					"status": response.StatusError,
+					"error":  "an account with this email already exists and " + provider.Name() + " has not verified the email: sign in to that account and link " + provider.Name() + " from your settings",
+					"code":   "email_not_verified",
+				})
+				return
+			case err == nil:
+				requireLinkProof(w, r, storage, user, identity, state.RedirectTo)
+				return
+			case isNotFound(err) && !profile.EmailVerified:
+				requireEmailProof(w, r, storage, *profile, identity, state.RedirectTo)
+				return
+			case isNotFound(err):
+				user = types.UserData{
+					Email:      profile.Email,
+					Password:   nil, // OAuth users don't have passwords
+					FirstName:  profile.FirstName,
+					LastName:   profile.LastName,
+					Identities: []types.LinkedIdentity{identity},
+					AuthType:   types.AuthTypeOAuth,
+				}
+				err = storage.CreateUser(r.Context(), user)
+				isNewUser = true
+			}
+			if isConflict(err) {
+				response.WriteJSON(w, http.StatusConflict, response.GeneralError(err))
+				return
+			}
+			if err != nil {
+				response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to create or update user")))
+				return
+			}
+		}
+		if isNewUser {
+			acceptPendingInvitations(r.Context(), storage, user.Email)
+		}
+
+		signIn(w, r, storage, user, http.StatusOK, state.RedirectTo)
+	}
+}
+
+// Providers that post their result (Apple with response_mode=form_post)
+// land here, and are sent on to the frontend's callback page as if they
+// had redirected there
+func oauthFormRedirect(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := identityProvider(w, r); !ok {
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid form")))
+			return
+		}
+		query := url.Values{}
+		for _, key := range []string{"code", "state", "error"} {
+			if v := r.PostForm.Get(key); v != "" {
+				query.Set(key, v)
+			}
+		}
+		http.Redirect(w, r, auth.FrontendURL()+"/oauth/callback?"+query.Encode(), http.StatusSeeOther)
+	}
+}
+
+// Lists the signed-in user's linked identities
+func listIdentities(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser := middleware.GetAuthUser(r)
+		user, err := storage.GetUserByEmail(r.Context(), authUser.Email)
+		if isNotFound(err) {
+			response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("user not found")))
+			return
+		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to look up user")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"identities": linkedIdentities(user),
+			"providers":  auth.IdentityProviderNames(),
+		})
+	}
+}
+
+// Starts linking a provider to the signed-in user's account
+func identityLinkURL(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, ok := identityProvider(w, r)
+		if !ok {
+			return
+		}
+		authUser := middleware.GetAuthUser(r)
+		state, err := newOAuthState(r, storage, provider.Name(), authUser.Email)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to generate state")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"auth_url": provider.AuthCodeURL(state.ID, state.Verifier),
+			"state":    state.ID,
+		})
+	}
+}
+
+// Finishes linking: the callback's code must come from a link started by
+// the same user
+func linkIdentity(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, ok := identityProvider(w, r)
+		if !ok {
+			return
+		}
+		var req types.OAuthCallbackRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		authUser := middleware.GetAuthUser(r)
+		state, ok := consumeOAuthState(w, r, storage, req.State, provider.Name(), authUser.Email)
+		if !ok {
+			return
+		}
+		profile, ok := exchangeCode(w, r, provider, req.Code, state)
+		if !ok {
+			return
+		}
+
+		identity := types.NewLinkedIdentity(provider.Name(), *profile)
+		err := storage.LinkIdentity(r.Context(), authUser.Email, identity)
+		if isNotFound(err) {
+			response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("user not found")))
+			return
+		}
+		if isConflict(err) {
+			response.WriteJSON(w, http.StatusConflict, response.GeneralError(err))
+			return
+		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to link account")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, identity)
+	}
+}
+
+// Unlinks a provider from the signed-in user's account
+func unlinkIdentity(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser := middleware.GetAuthUser(r)
+		provider := r.PathValue("provider")
+		err := storage.UnlinkIdentity(r.Context(), authUser.Email, provider)
+		if isNotFound(err) {
+			response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("no "+provider+" account is linked")))
+			return
+		}
+		if isConflict(err) {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("cannot unlink your only way to sign in: please set a password first")))
+			return
+		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to unlink account")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"message": "Account unlinked successfully",
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+const (
+	pendingLinkTTL    = 15 * time.Minute
+	maxLinkProofFails = 5
+)
+
+// sendLinkOTP is a variable so tests can stub out SES.
+var sendLinkOTP = auth.SendEmailOTP
+
+// Helper: save a pending link, filling in its ID and lifetime. It writes a
+// 500 and returns false on failure.
+func savePendingLink(w http.ResponseWriter, r *http.Request, store storage.Storage, link *types.PendingLink) bool {
+	id, err := auth.NewTokenID()
+	if err != nil {
+		response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to start linking")))
+		return false
+	}
+	now := time.Now()
+	link.ID = id
+	link.CreatedAt = now
+	link.ExpiresAt = now.Add(pendingLinkTTL)
+	if err := store.SavePendingLink(r.Context(), *link); err != nil {
+		response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to start linking")))
+		return false
+	}
+	return true
+}
+
+// Helper: park an identity whose email belongs to user until the caller
+// proves they own that account, and tell them how they can
+func requireLinkProof(w http.ResponseWriter, r *http.Request, store storage.Storage, user types.UserData, identity types.LinkedIdentity, redirectTo string) {
+	link := types.PendingLink{Email: user.Email, Identity: identity, RedirectTo: redirectTo}
+	if !savePendingLink(w, r, store, &link) {
+		return
+	}
+	id := link.ID
+	methods := []string{"otp"}
+	if user.Password != nil {
+		methods = []string{"password", "otp"}
+	}
+	response.WriteJSON(w, http.StatusConflict, map[string]interface{}{
+		"status":     response.StatusError,
+		"error":      "an account with this email already exists: confirm it is yours to link " + identity.Provider + " to it",
+		"code":       "link_required",
+		"link_token": id,
+		"provider":   identity.Provider,
+		"email":      user.Email,
+		"methods":    methods,
+	})
+}
+
+// Helper: park a new identity whose email the provider didn't verify.
+// Anyone can put any address on an account at some providers, so the
+// account is only created once a code sent to the email comes back.
+func requireEmailProof(w http.ResponseWriter, r *http.Request, store storage.Storage, profile types.ProviderProfile, identity types.LinkedIdentity, redirectTo string) {
+	link := types.PendingLink{
+		Email:      profile.Email,
+		Identity:   identity,
+		NewAccount: true,
+		FirstName:  profile.FirstName,
+		LastName:   profile.LastName,
+		RedirectTo: redirectTo,
+	}
+	if !savePendingLink(w, r, store, &link) {
+		return
+	}
+	response.WriteJSON(w, http.StatusConflict, map[string]interface{}{
+		"status":     response.StatusError,
+		"error":      identity.Provider + " has not verified your email: confirm it with the code we send to finish signing up",
+		"code":       "email_verification_required",
+		"link_token": link.ID,
+		"provider":   identity.Provider,
+		"email":      link.Email,
+		"methods":    []string{"otp"},
+	})
+}
+
+// Helper: look up the pending link named in a request, writing a 400 if it
+// is unknown, used up or expired
+func pendingLink(w http.ResponseWriter, r *http.Request, store storage.Storage, id string) (types.PendingLink, bool) {
+	link, err := store.GetPendingLink(r.Context(), id)
+	if isNotFound(err) || isExpired(err) {
+		response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("link request expired or not found: please sign in again")))
+		return types.PendingLink{}, false
+	}
+	if err != nil {
+		response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to look up link request")))
+		return types.PendingLink{}, false
+	}
+	return link, true
+}
+
+// Emails a code to the account a pending link would join, for people who
+// can't or don't want to enter its password. Codes go through otpPolicy per
+// email, however many pending links there are for it.
+func sendLinkCode(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.LinkTokenRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		link, ok := pendingLink(w, r, storage, req.LinkToken)
+		if !ok {
+			return
+		}
+		err := issueOTP(r.Context(), storage, types.OTPRecord{Email: link.Email, Type: types.OTPTypeLink})
+		if until, limited := retryAt(err); limited {
+			writeRateLimited(w, until, "please wait before requesting another code")
+			return
+		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to send OTP")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"message": "OTP sent to your email. Enter it to link your account.",
+		})
+	}
+}
+
+// Links a pending identity once the caller proves they own the account,
+// then signs them in as it. For a new account only the emailed code is
+// proof, and the account is created here. Wrong passwords count towards the
+// account's sign-in lockout, as they would on the login form.
+func confirmLink(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.ConfirmLinkRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		link, ok := pendingLink(w, r, storage, req.LinkToken)
+		if !ok {
+			return
+		}
+		var user types.UserData
+		if !link.NewAccount {
+			var err error
+			user, err = storage.GetUserByEmail(r.Context(), link.Email)
+			if err != nil {
+				response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to look up user")))
+				return
+			}
+		}
+
+		if req.Password != "" {
+			if !checkLoginThrottle(w, r, storage, link.Email) {
+				return
+			}
+			if user.Password == nil || !checkPasswordHash(req.Password, *user.Password) {
+				recordLoginFailure(r, storage, link.Email, user.Password != nil)
+				err := storage.RecordPendingLinkFailure(r.Context(), link.ID, maxLinkProofFails)
+				if isExpired(err) {
+					response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("too many failed attempts: please sign in again")))
+					return
+				}
+				response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("invalid password or OTP")))
+				return
+			}
+			clearLoginFailures(r, storage, user, false)
+		} else if _, ok := checkOTP(w, r, storage, link.Email, types.OTPTypeLink, req.OTP); !ok {
+			// The code's own attempt limit bounds guesses
+			return
+		}
+
+		// Claim the link so a second confirmation can't reuse it
+		if err := storage.DeletePendingLink(r.Context(), link.ID); isNotFound(err) {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("link request expired or not found: please sign in again")))
+			return
+		} else if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to link account")))
+			return
+		}
+		if link.NewAccount {
+			user = types.UserData{
+				Email:      link.Email,
+				FirstName:  link.FirstName,
+				LastName:   link.LastName,
+				Identities: []types.LinkedIdentity{link.Identity},
+				AuthType:   types.AuthTypeOAuth,
+			}
+			err := storage.CreateUser(r.Context(), user)
+			if isConflict(err) {
+				response.WriteJSON(w, http.StatusConflict, response.GeneralError(err))
+				return
+			}
+			if err != nil {
+				response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to create user")))
+				return
+			}
+			// The code proved the email, as for an email signup
+			acceptPendingInvitations(r.Context(), storage, user.Email)
+			signIn(w, r, storage, user, http.StatusCreated, link.RedirectTo)
+			return
+		}
+		err := storage.LinkIdentity(r.Context(), link.Email, link.Identity)
+		if isConflict(err) {
+			response.WriteJSON(w, http.StatusConflict, response.GeneralError(err))
+			return
+		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to link account")))
+			return
+		}
+		signIn(w, r, storage, user, http.StatusOK, link.RedirectTo)
+	}
+}
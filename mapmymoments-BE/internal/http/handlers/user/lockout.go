@@ -0,0 +1,152 @@
+package user
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
+	"github.com/atindraraut/crudgo/internal/utils/middleware"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+// Failed sign-ins lock an account after 5 in a row and a client after 20,
+// for a minute at first and doubling up to an hour
+var (
+	accountLockout = types.LockoutPolicy{
+		Threshold: 5,
+		BaseDelay: time.Minute,
+		MaxDelay:  time.Hour,
+		Window:    24 * time.Hour,
+	}
+	clientLockout = types.LockoutPolicy{
+		Threshold: 20,
+		BaseDelay: time.Minute,
+		MaxDelay:  time.Hour,
+		Window:    24 * time.Hour,
+	}
+)
+
+// Email sender, swapped out in tests
+var sendLockoutEmail = auth.SendAccountLockedEmail
+
+// dummyPasswordHash stands in when there is no password to check, so
+// sign-ins for unknown emails take as long as wrong passwords do
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := hashPassword("no account has this password")
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func clientThrottleKey(r *http.Request) string {
+	return "ip:" + middleware.ClientIP(r)
+}
+
+// Helper: tokens sent by email are stored hashed
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Helper: check sign-ins aren't locked for the account or the client,
+// writing a 429 and returning false if they are
+func checkLoginThrottle(w http.ResponseWriter, r *http.Request, store storage.Storage, email string) bool {
+	var until time.Time
+	for _, key := range []string{accountThrottleKey(email), clientThrottleKey(r)} {
+		throttle, err := store.GetLoginThrottle(r.Context(), key)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to check sign-in attempts")))
+			return false
+		}
+		if throttle.Locked(time.Now()) && throttle.LockedUntil.After(until) {
+			until = *throttle.LockedUntil
+		}
+	}
+	if !until.IsZero() {
+		writeRateLimited(w, until, "too many failed sign-ins: please try again later")
+		return false
+	}
+	return true
+}
+
+// Helper: forget the account's failed sign-ins once its owner has proven
+// themselves. With 2FA on, a password alone doesn't count: the count is
+// kept until the code checks out, so each new challenge can't reset it.
+func clearLoginFailures(r *http.Request, store storage.Storage, user types.UserData, secondFactorChecked bool) {
+	if user.TwoFactorEnabled() && !secondFactorChecked {
+		return
+	}
+	if err := store.ClearLoginThrottle(r.Context(), accountThrottleKey(user.Email)); err != nil {
+		slog.Error("failed to clear sign-in failures", slog.String("email", user.Email), slog.String("error", err.Error()))
+	}
+}
+
+// Helper: count a failed sign-in against the account and the client. The
+// owner of a real account is emailed an unlock link when it first locks;
+// that happens in the background so the response takes no longer than for
+// an unknown email.
+func recordLoginFailure(r *http.Request, store storage.Storage, email string, known bool) {
+	throttle, err := store.RecordLoginFailure(r.Context(), accountThrottleKey(email), accountLockout)
+	if err != nil {
+		slog.Error("failed to record sign-in failure", slog.String("email", email), slog.String("error", err.Error()))
+	} else if known && throttle.Failures == accountLockout.Threshold {
+		go notifyLockout(context.WithoutCancel(r.Context()), store, email, *throttle.LockedUntil)
+	}
+	if _, err := store.RecordLoginFailure(r.Context(), clientThrottleKey(r), clientLockout); err != nil {
+		slog.Error("failed to record sign-in failure", slog.String("ip", middleware.ClientIP(r)), slog.String("error", err.Error()))
+	}
+}
+
+func notifyLockout(ctx context.Context, store storage.Storage, email string, until time.Time) {
+	token, err := auth.GenerateRandomState()
+	if err == nil {
+		err = store.SetLoginUnlockToken(ctx, accountThrottleKey(email), hashToken(token))
+	}
+	if err == nil {
+		err = sendLockoutEmail(email, auth.FrontendURL()+"/unlock-account?token="+url.QueryEscape(token), until)
+	}
+	if err != nil {
+		slog.Error("failed to send account locked email", slog.String("email", email), slog.String("error", err.Error()))
+	}
+}
+
+// Lifts a lockout with the token from the lockout email
+func unlockAccount(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.UnlockAccountRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		err := storage.UnlockLogin(r.Context(), hashToken(req.Token))
+		if isNotFound(err) {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("unlock link expired or already used")))
+			return
+		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to unlock account")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"message": "Your account is unlocked. You can sign in again.",
+		})
+	}
+}
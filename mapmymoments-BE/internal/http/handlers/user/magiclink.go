@@ -0,0 +1,136 @@
+package user
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+// Email sender, swapped out in tests
+var sendMagicLinkEmail = auth.SendMagicLinkEmail
+
+// Helper: save a link for email bound to nonce and email it. Runs in the
+// background so the response takes as long for unknown emails. Links count
+// against otpPolicy like codes do, so the endpoint can't be used to flood
+// an inbox.
+func sendMagicLink(ctx context.Context, store storage.Storage, email, nonce string) {
+	id, err := auth.NewTokenID()
+	if err != nil {
+		slog.Error("failed to generate magic link", slog.String("error", err.Error()))
+		return
+	}
+	token, expiresAt, err := auth.GenerateMagicLinkToken(email, id, magicLinkTTL)
+	if err != nil {
+		slog.Error("failed to sign magic link", slog.String("error", err.Error()))
+		return
+	}
+	quota := types.OTPRecord{Email: email, Type: types.OTPTypeMagicLink, ExpiresAt: expiresAt}
+	err = store.SaveOTPRecord(ctx, quota, otpPolicy)
+	if _, limited := retryAt(err); limited {
+		// A 429 would reveal the account exists
+		slog.Warn("magic link not sent: rate limited", slog.String("email", email))
+		return
+	}
+	if err != nil {
+		slog.Error("failed to record magic link send", slog.String("email", email), slog.String("error", err.Error()))
+		return
+	}
+	link := types.MagicLink{
+		ID:        id,
+		Email:     email,
+		NonceHash: hashToken(nonce),
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if err := store.SaveMagicLink(ctx, link); err != nil {
+		slog.Error("failed to save magic link", slog.String("email", email), slog.String("error", err.Error()))
+		return
+	}
+	if err := sendMagicLinkEmail(email, auth.FrontendURL()+"/magic-link?token="+url.QueryEscape(token)); err != nil {
+		slog.Error("failed to send magic link", slog.String("email", email), slog.String("error", err.Error()))
+	}
+}
+
+// Emails a sign-in link. The response carries a nonce the browser must
+// keep and send back with the link's token, so a link read by someone
+// else can't be used from their browser.
+func requestMagicLink(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.MagicLinkRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		nonce, err := auth.NewTokenID()
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to generate nonce")))
+			return
+		}
+		user, err := storage.GetUserByEmail(r.Context(), req.Email)
+		if err != nil && !isNotFound(err) {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to look up user")))
+			return
+		}
+		// Unknown emails get the same answer, and no email
+		if err == nil {
+			go sendMagicLink(context.WithoutCancel(r.Context()), storage, user.Email, nonce)
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"message": "If your email has an account, a sign-in link has been sent.",
+			"nonce":   nonce,
+		})
+	}
+}
+
+// Signs in with the token from a magic link and the nonce the requesting
+// browser kept. Responds like login.
+func verifyMagicLink(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.MagicLinkVerifyRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		claims, err := auth.VerifyMagicLinkToken(req.Token)
+		if err != nil {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid or expired sign-in link")))
+			return
+		}
+		// Consumed before the nonce is checked, so a stolen link can't be
+		// tried against guessed nonces
+		link, err := storage.ConsumeMagicLink(r.Context(), claims.Id)
+		if isNotFound(err) || isExpired(err) {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("sign-in link expired or already used")))
+			return
+		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to use sign-in link")))
+			return
+		}
+		if link.Email != claims.Subject || subtle.ConstantTimeCompare([]byte(hashToken(req.Nonce)), []byte(link.NonceHash)) != 1 {
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("open the sign-in link in the browser you requested it from")))
+			return
+		}
+		user, err := storage.GetUserByEmail(r.Context(), link.Email)
+		if isNotFound(err) {
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("user not found")))
+			return
+		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to look up user")))
+			return
+		}
+		signIn(w, r, storage, user, http.StatusOK, "")
+	}
+}
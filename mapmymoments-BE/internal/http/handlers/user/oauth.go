@@ -0,0 +1,70 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+	"golang.org/x/oauth2"
+)
+
+// oauthStateTTL bounds how long someone can take on the provider's
+// consent screen
+const oauthStateTTL = 10 * time.Minute
+
+// Helper: start an OAuth login at provider, or linking it to linkTo's
+// account. The state is stored with a fresh PKCE verifier and the optional
+// ?redirect= target, which must be a path on the frontend so it can't be
+// used as an open redirect.
+func newOAuthState(r *http.Request, store storage.Storage, provider, linkTo string) (types.OAuthState, error) {
+	id, err := auth.GenerateRandomState()
+	if err != nil {
+		return types.OAuthState{}, err
+	}
+	now := time.Now()
+	state := types.OAuthState{
+		ID:        id,
+		Provider:  provider,
+		Verifier:  oauth2.GenerateVerifier(),
+		LinkTo:    linkTo,
+		CreatedAt: now,
+		ExpiresAt: now.Add(oauthStateTTL),
+	}
+	if redirect := r.URL.Query().Get("redirect"); isLocalPath(redirect) {
+		state.RedirectTo = redirect
+	}
+	if err := store.SaveOAuthState(r.Context(), state); err != nil {
+		return types.OAuthState{}, err
+	}
+	return state, nil
+}
+
+func isLocalPath(p string) bool {
+	return strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//") && !strings.Contains(p, `\`)
+}
+
+// Helper: use up the state named by the callback, which must have been
+// started at provider for the same purpose (linkTo is empty for logins).
+// Unknown, replayed, expired and mismatched states all fail; the response
+// has already been written then.
+func consumeOAuthState(w http.ResponseWriter, r *http.Request, store storage.Storage, id, provider, linkTo string) (types.OAuthState, bool) {
+	state, err := store.ConsumeOAuthState(r.Context(), id)
+	switch {
+	case err == nil && (state.Provider != provider || state.LinkTo != linkTo):
+		response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("OAuth state does not match this request")))
+	case err == nil:
+		return state, true
+	case isNotFound(err):
+		response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid or already used OAuth state")))
+	case isExpired(err):
+		response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("OAuth login took too long, please try again")))
+	default:
+		response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to check OAuth state")))
+	}
+	return types.OAuthState{}, false
+}
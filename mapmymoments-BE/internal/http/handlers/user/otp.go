@@ -0,0 +1,148 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+const (
+	otpTTL = 10 * time.Minute
+	// maxOTPAttempts is how many guesses a code gets before it stops
+	// working and a new one has to be sent
+	maxOTPAttempts = 5
+)
+
+// otpPolicy limits codes to one a minute and five an hour per email and type
+var otpPolicy = types.OTPPolicy{
+	Cooldown: time.Minute,
+	Window:   time.Hour,
+	MaxSends: 5,
+}
+
+// Email senders, swapped out in tests
+var (
+	sendSignupOTP = auth.SendEmailOTP
+	sendResetOTP  = auth.SendResetPasswordEmail
+)
+
+const resetSentMsg = "If your email exists, a reset code has been sent."
+
+// Helper: put a new code in record, replacing any earlier one, and email
+// it. Returns a *storage.RetryAfterError if otpPolicy says to wait.
+func issueOTP(ctx context.Context, store storage.Storage, record types.OTPRecord) error {
+	otp, err := auth.GenerateOTP()
+	if err != nil {
+		return err
+	}
+	record.OTPHash, err = hashPassword(otp)
+	if err != nil {
+		return err
+	}
+	record.ExpiresAt = time.Now().Add(otpTTL)
+	if err := store.SaveOTPRecord(ctx, record, otpPolicy); err != nil {
+		return err
+	}
+	send := sendSignupOTP
+	switch record.Type {
+	case types.OTPTypeReset:
+		send = sendResetOTP
+	case types.OTPTypeLink:
+		send = sendLinkOTP
+	}
+	return send(record.Email, otp)
+}
+
+// Helper: check a code, counting the guess against the code's attempts.
+// Writes the error and returns false if it is wrong, used up or expired.
+func checkOTP(w http.ResponseWriter, r *http.Request, store storage.Storage, email, otpType, otp string) (types.OTPRecord, bool) {
+	record, err := store.ClaimOTPAttempt(r.Context(), email, otpType, maxOTPAttempts)
+	switch {
+	case isNotFound(err):
+		response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("OTP expired or not found")))
+		return types.OTPRecord{}, false
+	case isExpired(err):
+		response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("too many wrong codes: please request a new OTP")))
+		return types.OTPRecord{}, false
+	case err != nil:
+		response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to get OTP record")))
+		return types.OTPRecord{}, false
+	}
+	if !checkPasswordHash(otp, record.OTPHash) {
+		response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("invalid OTP")))
+		return types.OTPRecord{}, false
+	}
+	// Claim the code so it can't be used twice
+	err = store.ConsumeOTPRecord(r.Context(), email, otpType)
+	if isNotFound(err) {
+		response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("OTP expired or not found")))
+		return types.OTPRecord{}, false
+	}
+	if err != nil {
+		response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to use OTP")))
+		return types.OTPRecord{}, false
+	}
+	return record, true
+}
+
+// Helper: the time to wait if err says to, for a 429
+func retryAt(err error) (time.Time, bool) {
+	var retry *storage.RetryAfterError
+	if errors.As(err, &retry) {
+		return retry.RetryAt, true
+	}
+	return time.Time{}, false
+}
+
+func writeRateLimited(w http.ResponseWriter, until time.Time, msg string) {
+	retryAfter := int(time.Until(until).Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	response.WriteJSON(w, http.StatusTooManyRequests, response.GeneralError(errors.New(msg)))
+}
+
+// Sends a new code for a signup or password reset in progress. Reset codes
+// are never refused with a 429, which would tell callers the email has an
+// account; the client knows the cooldown anyway.
+func resendOTP(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.ResendOTPRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		sentMsg := "If a code was requested for this email, a new one has been sent."
+		record, err := storage.GetOTPRecord(r.Context(), req.Email, req.Type)
+		if isNotFound(err) || (err == nil && req.Type == types.OTPTypeSignup && record.SignupReq == nil) {
+			// Nothing to resend, or the signup was already completed
+			response.WriteJSON(w, http.StatusOK, map[string]string{"message": sentMsg})
+			return
+		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to get OTP record")))
+			return
+		}
+		err = issueOTP(r.Context(), storage, record)
+		if until, limited := retryAt(err); limited {
+			if req.Type == types.OTPTypeReset {
+				slog.Warn("password reset code not resent: rate limited", slog.String("email", req.Email))
+				response.WriteJSON(w, http.StatusOK, map[string]string{"message": sentMsg})
+				return
+			}
+			writeRateLimited(w, until, "please wait before requesting another code")
+			return
+		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to send OTP")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{"message": sentMsg})
+	}
+}
@@ -0,0 +1,113 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/internal/utils/middleware"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+// recentSignIn is how long after signing in a user can set a password or
+// register a passkey without signing in again
+const recentSignIn = 5 * time.Minute
+
+// Helper: check the session signed in within recentSignIn, so a stolen
+// access token can't add a way in. Writes a 403 and returns false if not.
+func requireRecentSignIn(w http.ResponseWriter, r *http.Request, action string) bool {
+	if time.Since(middleware.GetAuthUser(r).SignedInAt) <= recentSignIn {
+		return true
+	}
+	response.WriteJSON(w, http.StatusForbidden, map[string]string{
+		"status": response.StatusError,
+		"error":  "please sign in again before " + action,
+		"code":   "reauth_required",
+	})
+	return false
+}
+
+// Changes the signed-in user's password and signs out their other
+// sessions. Wrong current passwords count towards the login lockout.
+func changePassword(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.ChangePasswordRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		user, ok := currentUser(w, r, storage)
+		if !ok {
+			return
+		}
+		if user.Password == nil {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("your account has no password yet: set one instead")))
+			return
+		}
+		if !checkLoginThrottle(w, r, storage, user.Email) {
+			return
+		}
+		if !checkPasswordHash(req.CurrentPassword, *user.Password) {
+			recordLoginFailure(r, storage, user.Email, true)
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("current password is incorrect")))
+			return
+		}
+		hashedPassword, err := hashPassword(req.NewPassword)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to hash password")))
+			return
+		}
+		if err := storage.UpdateUserPassword(r.Context(), user.Email, hashedPassword); err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to update password")))
+			return
+		}
+		authUser := middleware.GetAuthUser(r)
+		revoked, err := storage.RevokeOtherSessions(r.Context(), user.Email, authUser.SessionID)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("password changed, but failed to sign out other sessions")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Password changed",
+			"revoked": revoked,
+		})
+	}
+}
+
+// Gives a user who signs in only through providers a password. There is
+// no password to confirm, so the session must have signed in recently.
+func setPassword(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.SetPasswordRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		user, ok := currentUser(w, r, storage)
+		if !ok {
+			return
+		}
+		if user.Password != nil {
+			response.WriteJSON(w, http.StatusConflict, response.GeneralError(errors.New("your account already has a password: change it instead")))
+			return
+		}
+		if !requireRecentSignIn(w, r, "setting a password") {
+			return
+		}
+		hashedPassword, err := hashPassword(req.Password)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to hash password")))
+			return
+		}
+		if err := storage.UpdateUserPassword(r.Context(), user.Email, hashedPassword); err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to set password")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"message":   "Password set",
+			"auth_type": types.AuthTypeFor(true, len(user.Identities)),
+		})
+	}
+}
@@ -11,14 +11,46 @@ func RegisterRoutes(router *http.ServeMux, storage storage.Storage) {
 	// Registering routes for auth handlers
 	router.Handle("POST /user/signup", http.HandlerFunc(signup(storage)))
 	router.Handle("POST /user/login", http.HandlerFunc(login(storage)))
+	router.Handle("POST /user/unlock", http.HandlerFunc(unlockAccount(storage)))
+	router.Handle("POST /user/magic-link", http.HandlerFunc(requestMagicLink(storage)))
+	router.Handle("POST /user/magic-link/verify", http.HandlerFunc(verifyMagicLink(storage)))
 	router.Handle("POST /user/verify-otp", http.HandlerFunc(verifyOTP(storage)))
+	router.Handle("POST /user/resend-otp", http.HandlerFunc(resendOTP(storage)))
 	router.Handle("POST /user/refresh", http.HandlerFunc(refresh(storage)))
+	router.Handle("POST /user/logout", http.HandlerFunc(logout(storage)))
 	router.Handle("POST /user/request-reset", http.HandlerFunc(requestPasswordReset(storage)))
 	router.Handle("POST /user/reset-password", http.HandlerFunc(resetPassword(storage)))
 	// OAuth routes
-	router.Handle("GET /user/oauth/google/url", http.HandlerFunc(googleOAuthURL(storage)))
-	router.Handle("POST /user/oauth/google/callback", http.HandlerFunc(googleOAuthCallback(storage)))
+	router.Handle("GET /user/oauth/providers", http.HandlerFunc(oauthProviders(storage)))
+	router.Handle("GET /user/oauth/{provider}/url", http.HandlerFunc(oauthURL(storage)))
+	router.Handle("POST /user/oauth/{provider}/callback", http.HandlerFunc(oauthCallback(storage)))
+	router.Handle("POST /user/oauth/{provider}/redirect", http.HandlerFunc(oauthFormRedirect(storage)))
+	router.Handle("POST /user/oauth/link/send-otp", http.HandlerFunc(sendLinkCode(storage)))
+	router.Handle("POST /user/oauth/link/confirm", http.HandlerFunc(confirmLink(storage)))
+	// Passkeys
+	router.Handle("POST /user/webauthn/login/begin", http.HandlerFunc(webauthnLoginBegin(storage)))
+	router.Handle("POST /user/webauthn/login/finish", http.HandlerFunc(webauthnLoginFinish(storage)))
+	router.Handle("POST /user/webauthn/register/begin", middleware.AuthMiddleware(storage)(http.HandlerFunc(webauthnRegisterBegin(storage))))
+	router.Handle("POST /user/webauthn/register/finish", middleware.AuthMiddleware(storage)(http.HandlerFunc(webauthnRegisterFinish(storage))))
+	router.Handle("GET /user/webauthn/credentials", middleware.AuthMiddleware(storage)(http.HandlerFunc(listWebAuthnCredentials(storage))))
+	router.Handle("DELETE /user/webauthn/credentials/{id}", middleware.AuthMiddleware(storage)(http.HandlerFunc(deleteWebAuthnCredential(storage))))
+	// Two-factor authentication
+	router.Handle("POST /user/2fa/verify", http.HandlerFunc(twoFactorVerify(storage)))
+	router.Handle("POST /user/2fa/setup", middleware.AuthMiddleware(storage)(http.HandlerFunc(twoFactorSetup(storage))))
+	router.Handle("POST /user/2fa/confirm", middleware.AuthMiddleware(storage)(http.HandlerFunc(twoFactorConfirm(storage))))
+	router.Handle("POST /user/2fa/disable", middleware.AuthMiddleware(storage)(http.HandlerFunc(twoFactorDisable(storage))))
+	router.Handle("POST /user/2fa/recovery-codes", middleware.AuthMiddleware(storage)(http.HandlerFunc(twoFactorRegenerateCodes(storage))))
+	// Passwords
+	router.Handle("POST /user/change-password", middleware.AuthMiddleware(storage)(http.HandlerFunc(changePassword(storage))))
+	router.Handle("POST /user/set-password", middleware.AuthMiddleware(storage)(http.HandlerFunc(setPassword(storage))))
 	// Protected OAuth routes (require authentication)
 	router.Handle("GET /user/auth-info", middleware.AuthMiddleware(storage)(http.HandlerFunc(getUserAuthInfo(storage))))
-	router.Handle("POST /user/unlink-google", middleware.AuthMiddleware(storage)(http.HandlerFunc(unlinkGoogleAccount(storage))))
+	router.Handle("GET /user/identities", middleware.AuthMiddleware(storage)(http.HandlerFunc(listIdentities(storage))))
+	router.Handle("GET /user/identities/{provider}/url", middleware.AuthMiddleware(storage)(http.HandlerFunc(identityLinkURL(storage))))
+	router.Handle("POST /user/identities/{provider}", middleware.AuthMiddleware(storage)(http.HandlerFunc(linkIdentity(storage))))
+	router.Handle("DELETE /user/identities/{provider}", middleware.AuthMiddleware(storage)(http.HandlerFunc(unlinkIdentity(storage))))
+	// Sessions (signed-in devices)
+	router.Handle("GET /user/sessions", middleware.AuthMiddleware(storage)(http.HandlerFunc(listSessions(storage))))
+	router.Handle("DELETE /user/sessions/{id}", middleware.AuthMiddleware(storage)(http.HandlerFunc(revokeSession(storage))))
+	router.Handle("POST /user/sessions/revoke-others", middleware.AuthMiddleware(storage)(http.HandlerFunc(revokeOtherSessions(storage))))
 }
@@ -0,0 +1,122 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/atindraraut/crudgo/internal/utils/middleware"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+// deviceLabelHeader lets clients name the device they sign in from
+const deviceLabelHeader = "X-Device-Label"
+
+const maxDeviceLabel = 100
+
+// deviceLabel names the device behind r: the client's own label if it sent
+// one, otherwise a rough "Browser on OS" guess from the user agent.
+func deviceLabel(r *http.Request) string {
+	label := strings.TrimSpace(strings.ToValidUTF8(r.Header.Get(deviceLabelHeader), ""))
+	if label != "" {
+		// Cut at 100 bytes, backing up so a character isn't split
+		if len(label) > maxDeviceLabel {
+			cut := maxDeviceLabel
+			for cut > 0 && !utf8.RuneStart(label[cut]) {
+				cut--
+			}
+			label = label[:cut]
+		}
+		return label
+	}
+	ua := r.UserAgent()
+	browser := firstMatch(ua, [][2]string{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"}, {"Safari/", "Safari"},
+	})
+	platform := firstMatch(ua, [][2]string{
+		{"iPhone", "iOS"}, {"iPad", "iPadOS"}, {"Android", "Android"},
+		{"Windows", "Windows"}, {"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+	})
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	}
+	return "Unknown device"
+}
+
+// firstMatch returns the name paired with the first token found in s. Order
+// matters: Chrome's user agent also mentions Safari, Edge's mentions Chrome.
+func firstMatch(s string, pairs [][2]string) string {
+	for _, pair := range pairs {
+		if strings.Contains(s, pair[0]) {
+			return pair[1]
+		}
+	}
+	return ""
+}
+
+func listSessions(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser := middleware.GetAuthUser(r)
+		if authUser == nil {
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("user not authenticated")))
+			return
+		}
+		sessions, err := storage.ListSessions(r.Context(), authUser.Email)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to list sessions")))
+			return
+		}
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == authUser.SessionID
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{"sessions": sessions})
+	}
+}
+
+func revokeSession(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser := middleware.GetAuthUser(r)
+		if authUser == nil {
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("user not authenticated")))
+			return
+		}
+		err := storage.RevokeSession(r.Context(), authUser.Email, r.PathValue("id"))
+		if isNotFound(err) {
+			response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("session not found")))
+			return
+		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to sign out session")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{"message": "Session signed out"})
+	}
+}
+
+// revokeOtherSessions signs out everywhere except the calling session.
+func revokeOtherSessions(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser := middleware.GetAuthUser(r)
+		if authUser == nil {
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("user not authenticated")))
+			return
+		}
+		revoked, err := storage.RevokeOtherSessions(r.Context(), authUser.Email, authUser.SessionID)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to sign out other sessions")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Signed out of all other sessions",
+			"revoked": revoked,
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
+	"github.com/atindraraut/crudgo/internal/utils/middleware"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+// issueTokens signs a user in: it opens a session for the requesting
+// device and returns an access token and the session's first refresh token.
+func issueTokens(r *http.Request, store storage.Storage, user types.UserData) (accessToken, refreshToken string, err error) {
+	sessionId, err := auth.NewTokenID()
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, claims, err := auth.GenerateRefreshToken(user.Email, sessionId)
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	session := types.Session{
+		ID:          sessionId,
+		UserID:      user.Email,
+		DeviceLabel: deviceLabel(r),
+		UserAgent:   r.UserAgent(),
+		IP:          middleware.ClientIP(r),
+		CreatedAt:   now,
+		LastUsedAt:  now,
+		ExpiresAt:   time.Unix(claims.ExpiresAt, 0),
+	}
+	if err := store.CreateSession(r.Context(), session); err != nil {
+		return "", "", err
+	}
+	if err := store.CreateRefreshToken(r.Context(), refreshRecord(claims)); err != nil {
+		return "", "", err
+	}
+	accessToken, err = auth.GenerateAccessToken(user.Email, user.FirstName, user.LastName, user.Email, sessionId)
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
+// signIn issues tokens for user and writes the response every way of
+// signing in shares. redirectTo is passed on to the frontend if set. Users
+// with two-factor authentication get a challenge instead, and are signed
+// in by /user/2fa/verify.
+func signIn(w http.ResponseWriter, r *http.Request, store storage.Storage, user types.UserData, status int, redirectTo string) {
+	if user.TwoFactorEnabled() {
+		startTwoFactorChallenge(w, r, store, user, redirectTo)
+		return
+	}
+	completeSignIn(w, r, store, user, status, redirectTo)
+}
+
+// completeSignIn is signIn once every factor has been checked
+func completeSignIn(w http.ResponseWriter, r *http.Request, store storage.Storage, user types.UserData, status int, redirectTo string) {
+	accessToken, refreshToken, err := issueTokens(r, store, user)
+	if err != nil {
+		writeTokenError(w)
+		return
+	}
+	body := map[string]interface{}{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+		"email":         user.Email,
+		"first_name":    user.FirstName,
+		"last_name":     user.LastName,
+	}
+	if redirectTo != "" {
+		body["redirect_to"] = redirectTo
+	}
+	response.WriteJSON(w, status, body)
+}
+
+// refreshRecord is the stored counterpart of a freshly signed refresh token.
+func refreshRecord(claims *types.SignedDetails) types.RefreshToken {
+	return types.RefreshToken{
+		ID:        claims.Id,
+		FamilyID:  claims.FamilyID,
+		UserID:    claims.Email,
+		CreatedAt: time.Unix(claims.IssuedAt, 0),
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}
+}
+
+// writeTokenError answers a failed sign-in with a 500 without leaking why.
+func writeTokenError(w http.ResponseWriter) {
+	response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to generate tokens")))
+}
+
+func refresh(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.RefreshRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		details, msg := auth.VerifyRefreshToken(req.RefreshToken)
+		if msg != "nil" || details.Id == "" {
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("invalid refresh token")))
+			return
+		}
+		user, err := storage.GetUserByEmail(r.Context(), details.Email)
+		if err != nil {
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("invalid refresh token")))
+			return
+		}
+
+		refreshToken, claims, err := auth.GenerateRefreshToken(user.Email, details.FamilyID)
+		if err != nil {
+			writeTokenError(w)
+			return
+		}
+		err = storage.RotateRefreshToken(r.Context(), details.Id, refreshRecord(claims))
+		if isConflict(err) {
+			// A used token came back: someone else has a copy. End the
+			// whole session so neither copy works any more.
+			if err := storage.RevokeSession(r.Context(), details.Email, details.FamilyID); err != nil && !isNotFound(err) {
+				writeTokenError(w)
+				return
+			}
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("refresh token reuse detected; please log in again")))
+			return
+		}
+		if err != nil {
+			if isNotFound(err) || isExpired(err) {
+				response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("invalid refresh token")))
+				return
+			}
+			writeTokenError(w)
+			return
+		}
+
+		// Refreshing is what marks a session as in use
+		if err := storage.TouchSession(r.Context(), details.FamilyID, middleware.ClientIP(r), time.Unix(claims.ExpiresAt, 0)); err != nil {
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("session has ended")))
+			return
+		}
+
+		token, err := auth.GenerateAccessToken(user.Email, user.FirstName, user.LastName, user.Email, details.FamilyID)
+		if err != nil {
+			writeTokenError(w)
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token":  token,
+			"refresh_token": refreshToken,
+		})
+	}
+}
+
+// logout ends the session the refresh token belongs to.
+func logout(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.LogoutRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		details, msg := auth.VerifyRefreshToken(req.RefreshToken)
+		if msg != "nil" {
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("invalid refresh token")))
+			return
+		}
+		// A session that is already gone counts as logged out
+		if err := storage.RevokeSession(r.Context(), details.Email, details.FamilyID); err != nil && !isNotFound(err) {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to log out")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{"message": "Logged out"})
+	}
+}
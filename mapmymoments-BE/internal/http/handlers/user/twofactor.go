@@ -0,0 +1,316 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
+	"github.com/atindraraut/crudgo/internal/utils/middleware"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+const (
+	twoFactorChallengeTTL  = 5 * time.Minute
+	maxTwoFactorFailures   = 5
+	twoFactorRecoveryCodes = 10
+)
+
+// Helper: answer a sign in that passed its first factor with a challenge
+// token to redeem at /user/2fa/verify
+func startTwoFactorChallenge(w http.ResponseWriter, r *http.Request, store storage.Storage, user types.UserData, redirectTo string) {
+	id, err := auth.NewTokenID()
+	if err != nil {
+		writeTokenError(w)
+		return
+	}
+	now := time.Now()
+	challenge := types.TwoFactorChallenge{
+		ID:         id,
+		Email:      user.Email,
+		RedirectTo: redirectTo,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(twoFactorChallengeTTL),
+	}
+	if err := store.CreateTwoFactorChallenge(r.Context(), challenge); err != nil {
+		writeTokenError(w)
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"two_factor_required": true,
+		"challenge_token":     id,
+		"expires_at":          challenge.ExpiresAt,
+	})
+}
+
+// Helper: check a TOTP code or recovery code for user, using it up so it
+// can't be used again. A false result with a nil error is a wrong code.
+func checkSecondFactor(ctx context.Context, store storage.Storage, user types.UserData, code, recoveryCode string) (bool, error) {
+	if !user.TwoFactorEnabled() {
+		return false, nil
+	}
+	if code != "" {
+		step, ok := auth.ValidateTOTP(user.TwoFactor.Secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		err := store.UseTOTPStep(ctx, user.Email, step)
+		if isConflict(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	err := store.UseRecoveryCode(ctx, user.Email, auth.HashRecoveryCode(recoveryCode))
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Helper: load the signed-in user and check they can still pass both
+// factors, before 2FA is turned off or changed. Wrong answers count towards
+// the account's sign-in lockout, so a stolen access token can't be used to
+// guess codes.
+func reauthenticate(w http.ResponseWriter, r *http.Request, store storage.Storage) (types.UserData, bool) {
+	var req types.TwoFactorReauthRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		writeValidationError(w, err)
+		return types.UserData{}, false
+	}
+	user, ok := currentUser(w, r, store)
+	if !ok {
+		return types.UserData{}, false
+	}
+	if !user.TwoFactorEnabled() {
+		response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("two-factor authentication is not enabled")))
+		return types.UserData{}, false
+	}
+	if !checkLoginThrottle(w, r, store, user.Email) {
+		return types.UserData{}, false
+	}
+	if user.Password != nil && !checkPasswordHash(req.Password, *user.Password) {
+		recordLoginFailure(r, store, user.Email, true)
+		response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("invalid password or code")))
+		return types.UserData{}, false
+	}
+	ok, err := checkSecondFactor(r.Context(), store, user, req.Code, req.RecoveryCode)
+	if err != nil {
+		response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to check code")))
+		return types.UserData{}, false
+	}
+	if !ok {
+		recordLoginFailure(r, store, user.Email, true)
+		response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("invalid password or code")))
+		return types.UserData{}, false
+	}
+	clearLoginFailures(r, store, user, true)
+	return user, true
+}
+
+// Helper: load the signed-in user
+func currentUser(w http.ResponseWriter, r *http.Request, store storage.Storage) (types.UserData, bool) {
+	authUser := middleware.GetAuthUser(r)
+	user, err := store.GetUserByEmail(r.Context(), authUser.Email)
+	if isNotFound(err) {
+		response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("user not found")))
+		return types.UserData{}, false
+	}
+	if err != nil {
+		response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to look up user")))
+		return types.UserData{}, false
+	}
+	return user, true
+}
+
+// Helper: new recovery codes, and the hashes to store
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	codes, err = auth.GenerateRecoveryCodes(twoFactorRecoveryCodes)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, code := range codes {
+		hashes = append(hashes, auth.HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// Starts enrolling an authenticator app. Nothing changes at sign in until
+// the first code is confirmed.
+func twoFactorSetup(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r, storage)
+		if !ok {
+			return
+		}
+		if user.TwoFactorEnabled() {
+			response.WriteJSON(w, http.StatusConflict, response.GeneralError(errors.New("two-factor authentication is already enabled")))
+			return
+		}
+		secret, err := auth.GenerateTOTPSecret()
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to generate secret")))
+			return
+		}
+		if err := storage.SetTwoFactor(r.Context(), user.Email, &types.TwoFactor{Secret: secret}); err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to start setup")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"secret":      secret,
+			"otpauth_uri": auth.TOTPURI(user.Email, secret),
+		})
+	}
+}
+
+// Turns 2FA on once the app produces a valid code, and hands out the
+// recovery codes. They are only ever shown here.
+func twoFactorConfirm(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.TwoFactorCodeRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		user, ok := currentUser(w, r, storage)
+		if !ok {
+			return
+		}
+		if user.TwoFactorEnabled() {
+			response.WriteJSON(w, http.StatusConflict, response.GeneralError(errors.New("two-factor authentication is already enabled")))
+			return
+		}
+		if user.TwoFactor == nil {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("two-factor setup has not been started")))
+			return
+		}
+		step, ok := auth.ValidateTOTP(user.TwoFactor.Secret, req.Code, time.Now())
+		if !ok {
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("invalid code")))
+			return
+		}
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to generate recovery codes")))
+			return
+		}
+		now := time.Now()
+		twoFactor := &types.TwoFactor{
+			Secret:        user.TwoFactor.Secret,
+			Enabled:       true,
+			LastStep:      step,
+			RecoveryCodes: hashes,
+			EnabledAt:     &now,
+		}
+		if err := storage.SetTwoFactor(r.Context(), user.Email, twoFactor); err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to enable two-factor authentication")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// Turns 2FA off
+func twoFactorDisable(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := reauthenticate(w, r, storage)
+		if !ok {
+			return
+		}
+		if err := storage.SetTwoFactor(r.Context(), user.Email, nil); err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to disable two-factor authentication")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"message": "Two-factor authentication disabled",
+		})
+	}
+}
+
+// Replaces the recovery codes, invalidating the old ones
+func twoFactorRegenerateCodes(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := reauthenticate(w, r, storage); !ok {
+			return
+		}
+		// Reload, as checking the code moved the authenticator on
+		user, ok := currentUser(w, r, storage)
+		if !ok {
+			return
+		}
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to generate recovery codes")))
+			return
+		}
+		twoFactor := *user.TwoFactor
+		twoFactor.RecoveryCodes = hashes
+		if err := storage.SetTwoFactor(r.Context(), user.Email, &twoFactor); err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to save recovery codes")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// Finishes a sign in that was answered with a challenge
+func twoFactorVerify(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.TwoFactorVerifyRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		// The guess is counted before the code is checked, so parallel
+		// requests can't get more than maxTwoFactorFailures between them
+		challenge, err := storage.ClaimTwoFactorAttempt(r.Context(), req.ChallengeToken, maxTwoFactorFailures)
+		if isNotFound(err) || isExpired(err) {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("sign in expired: please sign in again")))
+			return
+		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to look up sign in")))
+			return
+		}
+		// Wrong codes lock the account like wrong passwords, so starting
+		// new challenges doesn't buy more guesses
+		if !checkLoginThrottle(w, r, storage, challenge.Email) {
+			return
+		}
+		user, err := storage.GetUserByEmail(r.Context(), challenge.Email)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to look up user")))
+			return
+		}
+		ok, err := checkSecondFactor(r.Context(), storage, user, req.Code, req.RecoveryCode)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to check code")))
+			return
+		}
+		if !ok {
+			recordLoginFailure(r, storage, user.Email, true)
+			if challenge.Attempts >= maxTwoFactorFailures {
+				response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("too many failed attempts: please sign in again")))
+				return
+			}
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("invalid code")))
+			return
+		}
+		// Claim the challenge so it signs in only once
+		if err := storage.DeleteTwoFactorChallenge(r.Context(), challenge.ID); isNotFound(err) {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("sign in expired: please sign in again")))
+			return
+		} else if err != nil {
+			writeTokenError(w)
+			return
+		}
+		clearLoginFailures(r, storage, user, true)
+		completeSignIn(w, r, storage, user, http.StatusOK, challenge.RedirectTo)
+	}
+}
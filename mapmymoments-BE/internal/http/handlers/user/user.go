@@ -1,15 +1,14 @@
 package user
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
-	"time"
 
 	"github.com/atindraraut/crudgo/internal/types"
-	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
 	"github.com/atindraraut/crudgo/internal/utils/middleware"
 	"github.com/atindraraut/crudgo/internal/utils/response"
 	"github.com/atindraraut/crudgo/storage"
@@ -29,23 +28,21 @@ func signup(storage storage.Storage) http.HandlerFunc {
 			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to hash password")))
 			return
 		}
-		otp := auth.GenerateOTP()
-		err = auth.SendEmailOTP(req.Email, otp)
-		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to send OTP")))
-			return
-		}
+		// Only the hash is kept while the email is verified
+		req.Password = ""
 		otpRecord := types.OTPRecord{
 			Email:     req.Email,
-			OTP:       otp,
-			ExpiresAt: time.Now().Add(10 * time.Minute),
-			Type:      "signup",
+			Type:      types.OTPTypeSignup,
 			SignupReq: &req,
 			Password:  hashedPassword,
 		}
-		err = storage.SaveOTPRecord(otpRecord)
+		err = issueOTP(r.Context(), storage, otpRecord)
+		if until, limited := retryAt(err); limited {
+			writeRateLimited(w, until, "please wait before requesting another code")
+			return
+		}
 		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to save OTP record")))
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to send OTP")))
 			return
 		}
 		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
@@ -90,21 +87,8 @@ func verifyOTP(storage storage.Storage) http.HandlerFunc {
 			writeValidationError(w, err)
 			return
 		}
-		record, err := storage.GetOTPRecordByEmail(req.Email)
-		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to get OTP record")))
-			return
-		}
-		if record.Email == "" || record.ExpiresAt.Before(time.Now()) {
-			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("OTP expired or not found")))
-			return
-		}
-		if record.Type != "signup" {
-			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid OTP type for signup verification")))
-			return
-		}
-		if record.OTP != req.OTP {
-			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("invalid OTP")))
+		record, ok := checkOTP(w, r, storage, req.Email, types.OTPTypeSignup, req.OTP)
+		if !ok {
 			return
 		}
 		if record.SignupReq == nil {
@@ -116,22 +100,18 @@ func verifyOTP(storage storage.Storage) http.HandlerFunc {
 			Password:  &record.Password,
 			FirstName: record.SignupReq.FirstName,
 			LastName:  record.SignupReq.LastName,
-			GoogleID:  nil,
-			AuthType:  "email",
+			AuthType:  types.AuthTypeEmail,
 		}
-		if _, err := storage.CreateUser(user); err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(err))
+		if err := storage.CreateUser(r.Context(), user); err != nil {
+			status := http.StatusInternalServerError
+			if isConflict(err) {
+				status = http.StatusConflict
+			}
+			response.WriteJSON(w, status, response.GeneralError(err))
 			return
 		}
-		token, refreshToken, _ := auth.GenerateAllTokens(user.Email, user.FirstName, user.LastName, user.Email)
-		_ = storage.DeleteOTPRecordByEmail(req.Email)
-		response.WriteJSON(w, http.StatusCreated, map[string]interface{}{
-			"access_token":  token,
-			"refresh_token": refreshToken,
-			"email":         user.Email,
-			"first_name":    user.FirstName,
-			"last_name":     user.LastName,
-		})
+		acceptPendingInvitations(r.Context(), storage, user.Email)
+		signIn(w, r, storage, user, http.StatusCreated, "")
 	}
 }
 
@@ -142,39 +122,23 @@ func login(storage storage.Storage) http.HandlerFunc {
 			writeValidationError(w, err)
 			return
 		}
-		user, err := storage.GetUserByEmail(req.Email)
-		if err != nil || user.Password == nil || !checkPasswordHash(req.Password, *user.Password) {
-			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("invalid credentials")))
+		if !checkLoginThrottle(w, r, storage, req.Email) {
 			return
 		}
-		token, refreshToken, _ := auth.GenerateAllTokens(user.Email, user.FirstName, user.LastName, user.Email)
-		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
-			"access_token":  token,
-			"refresh_token": refreshToken,
-			"email":         user.Email,
-			"first_name":    user.FirstName,
-			"last_name":     user.LastName,
-		})
-	}
-}
-
-func refresh(storage storage.Storage) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		var req types.RefreshRequest
-		if err := decodeAndValidate(r, &req); err != nil {
-			writeValidationError(w, err)
-			return
+		user, err := storage.GetUserByEmail(r.Context(), req.Email)
+		known := err == nil && user.Password != nil
+		hash := dummyPasswordHash()
+		if known {
+			hash = *user.Password
 		}
-		details, msg := auth.VerifyToken(req.RefreshToken)
-		if msg != "nil" {
-			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("invalid refresh token")))
+		// Always compare, so unknown emails can't be told apart by timing
+		if !checkPasswordHash(req.Password, hash) || !known {
+			recordLoginFailure(r, storage, req.Email, known)
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("invalid credentials")))
 			return
 		}
-		token, refreshToken, _ := auth.GenerateAllTokens(details.Email, details.First_name, details.Last_name, details.Uid)
-		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
-			"access_token":  token,
-			"refresh_token": refreshToken,
-		})
+		clearLoginFailures(r, storage, user, false)
+		signIn(w, r, storage, user, http.StatusOK, "")
 	}
 }
 
@@ -189,30 +153,25 @@ func requestPasswordReset(storage storage.Storage) http.HandlerFunc {
 			writeValidationError(w, err)
 			return
 		}
-		user, err := storage.GetUserByEmail(req.Email)
-		if err != nil || user.Email == "" {
+		_, err := storage.GetUserByEmail(r.Context(), req.Email)
+		if isNotFound(err) {
 			// Don't reveal if user exists
-			response.WriteJSON(w, http.StatusOK, map[string]string{"message": "If your email exists, a reset code has been sent."})
+			response.WriteJSON(w, http.StatusOK, map[string]string{"message": resetSentMsg})
 			return
 		}
-		otp := auth.GenerateOTP()
-		err = auth.SendResetPasswordEmail(req.Email, otp)
 		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to send reset code email")))
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to look up user")))
 			return
 		}
-		otpRecord := types.OTPRecord{
-			Email:     req.Email,
-			OTP:       otp,
-			ExpiresAt: time.Now().Add(10 * time.Minute),
-			Type:      "reset",
-		}
-		err = storage.SaveOTPRecord(otpRecord)
-		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to save OTP record")))
+		err = issueOTP(r.Context(), storage, types.OTPRecord{Email: req.Email, Type: types.OTPTypeReset})
+		if _, limited := retryAt(err); limited {
+			// A 429 would reveal the user exists
+			slog.Warn("password reset code not sent: rate limited", slog.String("email", req.Email))
+		} else if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to send reset code email")))
 			return
 		}
-		response.WriteJSON(w, http.StatusOK, map[string]string{"message": "If your email exists, a reset code has been sent."})
+		response.WriteJSON(w, http.StatusOK, map[string]string{"message": resetSentMsg})
 	}
 }
 
@@ -229,17 +188,7 @@ func resetPassword(storage storage.Storage) http.HandlerFunc {
 			writeValidationError(w, err)
 			return
 		}
-		record, err := storage.GetOTPRecordByEmail(req.Email)
-		if err != nil || record.Email == "" || record.ExpiresAt.Before(time.Now()) {
-			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("OTP expired or not found")))
-			return
-		}
-		if record.Type != "reset" {
-			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid OTP type for password reset")))
-			return
-		}
-		if record.OTP != req.OTP {
-			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("invalid OTP")))
+		if _, ok := checkOTP(w, r, storage, req.Email, types.OTPTypeReset, req.OTP); !ok {
 			return
 		}
 		hashedPassword, err := hashPassword(req.Password)
@@ -247,112 +196,58 @@ func resetPassword(storage storage.Storage) http.HandlerFunc {
 			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to hash password")))
 			return
 		}
-		user, err := storage.GetUserByEmail(req.Email)
-		if err != nil || user.Email == "" {
+		user, err := storage.GetUserByEmail(r.Context(), req.Email)
+		if err != nil {
 			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("user not found")))
 			return
 		}
-		user.Password = &hashedPassword
-		if err := storage.UpdateUserPassword(user.Email, hashedPassword); err != nil {
+		if err := storage.UpdateUserPassword(r.Context(), user.Email, hashedPassword); err != nil {
 			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to update password")))
 			return
 		}
-		_ = storage.DeleteOTPRecordByEmail(req.Email)
 		response.WriteJSON(w, http.StatusOK, map[string]string{"message": "Password reset successful"})
 	}
 }
 
-// Helper: hash password
-func hashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hash), err
+// Helper: storage error classification. These live at package level because
+// handler closures shadow the storage package with their parameter.
+func isNotFound(err error) bool {
+	return errors.Is(err, storage.ErrNotFound)
 }
 
-// Helper: compare password
-func checkPasswordHash(password, hash string) bool {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+func isConflict(err error) bool {
+	return errors.Is(err, storage.ErrConflict)
 }
 
-// Google OAuth URL handler
-func googleOAuthURL(storage storage.Storage) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		state, err := auth.GenerateRandomState()
-		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to generate state")))
-			return
-		}
-		
-		url := auth.GenerateGoogleOAuthURL(state)
-		// Debug logging
-		fmt.Printf("Generated OAuth URL: %s\n", url)
-		response.WriteJSON(w, http.StatusOK, map[string]string{
-			"auth_url": url,
-			"state":    state,
-		})
-	}
+func isExpired(err error) bool {
+	return errors.Is(err, storage.ErrExpired)
 }
 
-// Google OAuth callback handler
-func googleOAuthCallback(storage storage.Storage) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		var req types.GoogleOAuthRequest
-		if err := decodeAndValidate(r, &req); err != nil {
-			writeValidationError(w, err)
-			return
-		}
-
-		// Exchange authorization code for access token
-		token, err := auth.ExchangeCodeForTokens(req.Code)
-		if err != nil {
-			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("failed to exchange code for token")))
-			return
-		}
-
-		// Get user information from Google
-		userInfo, err := auth.GetGoogleUserInfo(token)
-		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to get user info")))
-			return
-		}
-
-		// Create or update user in database
-		user := types.UserData{
-			Email:     userInfo.Email,
-			Password:  nil, // OAuth users don't have passwords
-			FirstName: userInfo.GivenName,
-			LastName:  userInfo.FamilyName,
-			GoogleID:  &userInfo.ID,
-			AuthType:  "google",
-		}
-
-		// Check if user exists with email but no Google ID (account linking)
-		existingUser, err := storage.GetUserByEmail(user.Email)
-		if err == nil && existingUser.Email != "" {
-			// User exists, update auth type to "both"
-			user.AuthType = "both"
-		}
-
-		_, err = storage.CreateOrUpdateGoogleUser(user)
-		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to create or update user")))
-			return
+// Helper: accept route invitations sent before the account existed. Failures
+// are logged rather than failing signup; the invitations stay in the user's
+// inbox and can still be accepted by hand.
+func acceptPendingInvitations(ctx context.Context, store storage.Storage, email string) {
+	invitations, err := store.ListInvitationsForEmail(ctx, email)
+	if err != nil {
+		slog.Error("failed to list invitations for new user", slog.String("email", email), slog.String("error", err.Error()))
+		return
+	}
+	for _, inv := range invitations {
+		if _, err := store.RespondToInvitation(ctx, inv.ID, email, true); err != nil {
+			slog.Error("failed to accept invitation for new user", slog.String("invitationId", inv.ID), slog.String("error", err.Error()))
 		}
+	}
+}
 
-		// Generate JWT tokens
-		accessToken, refreshToken, err := auth.GenerateAllTokens(user.Email, user.FirstName, user.LastName, user.Email)
-		if err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to generate tokens")))
-			return
-		}
+// Helper: hash password
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
 
-		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
-			"access_token":  accessToken,
-			"refresh_token": refreshToken,
-			"email":         user.Email,
-			"first_name":    user.FirstName,
-			"last_name":     user.LastName,
-		})
-	}
+// Helper: compare password
+func checkPasswordHash(password, hash string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
 }
 
 // Get user auth info handler
@@ -365,53 +260,26 @@ func getUserAuthInfo(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 		
-		user, err := storage.GetUserByEmail(authUser.Email)
-		if err != nil || user.Email == "" {
+		user, err := storage.GetUserByEmail(r.Context(), authUser.Email)
+		if isNotFound(err) {
 			response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("user not found")))
 			return
 		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to look up user")))
+			return
+		}
 
+		_, hasGoogle := user.Identity("google")
 		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
 			"email":           user.Email,
 			"first_name":      user.FirstName,
 			"last_name":       user.LastName,
 			"auth_type":       user.AuthType,
 			"has_password":    user.Password != nil,
-			"has_google":      user.GoogleID != nil,
-		})
-	}
-}
-
-// Unlink Google account handler
-func unlinkGoogleAccount(storage storage.Storage) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Get user from auth middleware context
-		authUser := middleware.GetAuthUser(r)
-		if authUser == nil {
-			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("user not authenticated")))
-			return
-		}
-		
-		user, err := storage.GetUserByEmail(authUser.Email)
-		if err != nil || user.Email == "" {
-			response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("user not found")))
-			return
-		}
-
-		// Check if user has a password - cannot unlink Google if it's the only auth method
-		if user.Password == nil {
-			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("cannot unlink Google account: please set a password first")))
-			return
-		}
-
-		// Unlink Google account
-		if err := storage.UnlinkGoogleAccount(user.Email); err != nil {
-			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to unlink Google account")))
-			return
-		}
-
-		response.WriteJSON(w, http.StatusOK, map[string]string{
-			"message": "Google account unlinked successfully",
+			"has_google":      hasGoogle,
+			"identities":      linkedIdentities(user),
+			"two_factor_enabled": user.TwoFactorEnabled(),
 		})
 	}
 }
@@ -0,0 +1,1132 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/atindraraut/crudgo/internal/config"
+	"github.com/atindraraut/crudgo/internal/types"
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
+	"github.com/atindraraut/crudgo/storage"
+	"github.com/atindraraut/crudgo/storage/memory"
+	"github.com/fxamacker/cbor/v2"
+)
+
+func newTestServer(t *testing.T) (*http.ServeMux, *memory.Memory) {
+	t.Helper()
+	auth.SECRET_KEY = "test-secret"
+	store := memory.New()
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("hashPassword: %v", err)
+	}
+	if err := store.CreateUser(context.Background(), types.UserData{Email: "user@example.com", Password: &hash, AuthType: "email"}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	router := http.NewServeMux()
+	RegisterRoutes(router, store)
+	return router, store
+}
+
+func post(t *testing.T, router http.Handler, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		t.Fatalf("encode body: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", path, &buf))
+	return rec
+}
+
+type tokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// logIn signs in from a device with the given user agent.
+func logIn(t *testing.T, router http.Handler, userAgent string) tokenPair {
+	t.Helper()
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(types.LoginRequest{Email: "user@example.com", Password: "correct horse"})
+	req := httptest.NewRequest("POST", "/user/login", &buf)
+	req.Header.Set("User-Agent", userAgent)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var tokens tokenPair
+	json.NewDecoder(rec.Body).Decode(&tokens)
+	return tokens
+}
+
+func TestRefreshRotationAndReuse(t *testing.T) {
+	router, _ := newTestServer(t)
+	first := logIn(t, router, "")
+
+	// Access tokens can't be used to refresh
+	if rec := post(t, router, "/user/refresh", types.RefreshRequest{RefreshToken: first.AccessToken}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("refresh with an access token: expected 401, got %d", rec.Code)
+	}
+
+	rec := post(t, router, "/user/refresh", types.RefreshRequest{RefreshToken: first.RefreshToken})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var second tokenPair
+	json.NewDecoder(rec.Body).Decode(&second)
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("expected a new refresh token")
+	}
+
+	// Replaying the used token revokes the family, including its successor
+	if rec := post(t, router, "/user/refresh", types.RefreshRequest{RefreshToken: first.RefreshToken}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("replay: expected 401, got %d", rec.Code)
+	}
+	if rec := post(t, router, "/user/refresh", types.RefreshRequest{RefreshToken: second.RefreshToken}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("successor after replay: expected 401, got %d", rec.Code)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	router, _ := newTestServer(t)
+	tokens := logIn(t, router, "")
+	other := logIn(t, router, "")
+
+	if rec := post(t, router, "/user/logout", types.LogoutRequest{RefreshToken: tokens.RefreshToken}); rec.Code != http.StatusOK {
+		t.Fatalf("logout: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := post(t, router, "/user/refresh", types.RefreshRequest{RefreshToken: tokens.RefreshToken}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after logout: expected 401, got %d", rec.Code)
+	}
+	// Other logins are unaffected
+	if rec := post(t, router, "/user/refresh", types.RefreshRequest{RefreshToken: other.RefreshToken}); rec.Code != http.StatusOK {
+		t.Errorf("refresh on another login: expected 200, got %d", rec.Code)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	router, _ := newTestServer(t)
+	phone := logIn(t, router, "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Version/17.0 Mobile Safari/604.1")
+	laptop := logIn(t, router, "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) Chrome/120.0 Safari/537.36")
+	tablet := logIn(t, router, "")
+
+	rec := authed(t, router, "GET", "/user/sessions", laptop.AccessToken)
+	var listed struct {
+		Sessions []types.Session `json:"sessions"`
+	}
+	json.NewDecoder(rec.Body).Decode(&listed)
+	if len(listed.Sessions) != 3 {
+		t.Fatalf("expected 3 sessions, got %s", rec.Body)
+	}
+	labels := map[string]bool{}
+	var phoneSession string
+	for _, s := range listed.Sessions {
+		labels[s.DeviceLabel] = s.Current
+		if s.DeviceLabel == "Safari on iOS" {
+			phoneSession = s.ID
+		}
+	}
+	if current, ok := labels["Chrome on macOS"]; !ok || !current || phoneSession == "" {
+		t.Fatalf("unexpected sessions: %s", rec.Body)
+	}
+
+	// Killing the phone's session cuts off its access and refresh tokens
+	if rec := authed(t, router, "DELETE", "/user/sessions/"+phoneSession, laptop.AccessToken); rec.Code != http.StatusOK {
+		t.Fatalf("revoke: expected 200, got %d", rec.Code)
+	}
+	if rec := authed(t, router, "GET", "/user/sessions", phone.AccessToken); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked access token: expected 401, got %d", rec.Code)
+	}
+	if rec := post(t, router, "/user/refresh", types.RefreshRequest{RefreshToken: phone.RefreshToken}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked refresh token: expected 401, got %d", rec.Code)
+	}
+
+	// Signing out everywhere else keeps only the caller
+	if rec := authed(t, router, "POST", "/user/sessions/revoke-others", laptop.AccessToken); rec.Code != http.StatusOK {
+		t.Fatalf("revoke others: expected 200, got %d", rec.Code)
+	}
+	if rec := authed(t, router, "GET", "/user/sessions", tablet.AccessToken); rec.Code != http.StatusUnauthorized {
+		t.Errorf("other session after sign-out: expected 401, got %d", rec.Code)
+	}
+	if rec := authed(t, router, "GET", "/user/sessions", laptop.AccessToken); rec.Code != http.StatusOK {
+		t.Errorf("current session: expected 200, got %d", rec.Code)
+	}
+}
+
+func TestDeviceLabelKeepsCharactersWhole(t *testing.T) {
+	r := httptest.NewRequest("POST", "/user/login", nil)
+	r.Header.Set(deviceLabelHeader, "a"+strings.Repeat("é", 60))
+	label := deviceLabel(r)
+	if !utf8.ValidString(label) || len(label) > maxDeviceLabel {
+		t.Fatalf("expected valid UTF-8 of at most %d bytes, got %q (%d bytes)", maxDeviceLabel, label, len(label))
+	}
+	if label != "a"+strings.Repeat("é", 49) {
+		t.Errorf("expected the label cut after 49 characters, got %q", label)
+	}
+
+	r.Header.Set(deviceLabelHeader, "Pixel\xff 8")
+	if label := deviceLabel(r); label != "Pixel 8" {
+		t.Errorf("expected invalid bytes dropped, got %q", label)
+	}
+}
+
+func authed(t *testing.T, router http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOAuthStateIsSingleUse(t *testing.T) {
+	router, store := newTestServer(t)
+	err := auth.InitIdentityProviders(map[string]config.OAuthProvider{
+		"google": {ClientID: "client-id", ClientSecret: "client-secret", RedirectURL: "http://localhost/callback"},
+	})
+	if err != nil {
+		t.Fatalf("InitIdentityProviders: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/user/oauth/google/url?redirect=//evil.example", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("oauth url: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		AuthURL string `json:"auth_url"`
+		State   string `json:"state"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if !strings.Contains(body.AuthURL, "code_challenge_method=S256") {
+		t.Errorf("auth url has no PKCE challenge: %s", body.AuthURL)
+	}
+
+	state, err := store.ConsumeOAuthState(context.Background(), body.State)
+	if err != nil {
+		t.Fatalf("ConsumeOAuthState: %v", err)
+	}
+	if state.Verifier == "" || state.RedirectTo != "" {
+		t.Errorf("unexpected stored state %+v", state)
+	}
+
+	// The state is gone now, so a replayed callback is refused before the
+	// code is ever sent to Google
+	rec = post(t, router, "/user/oauth/google/callback", types.OAuthCallbackRequest{Code: "code", State: body.State})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("replayed state: expected 400, got %d", rec.Code)
+	}
+}
+
+// fakeProvider signs in whoever its codes map to, after checking the PKCE
+// verifier matches the challenge it was given
+type fakeProvider struct {
+	challenges map[string]string // state -> verifier
+	profiles   map[string]types.ProviderProfile
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) AuthCodeURL(state, verifier string) string {
+	p.challenges[state] = verifier
+	return "https://fake.example/auth?state=" + state
+}
+
+func (p *fakeProvider) Exchange(ctx context.Context, code, verifier string) (*types.ProviderProfile, error) {
+	found := false
+	for _, v := range p.challenges {
+		found = found || v == verifier
+	}
+	profile, ok := p.profiles[code]
+	if !found || !ok {
+		return nil, errors.New("bad code")
+	}
+	return &profile, nil
+}
+
+func oauthState(t *testing.T, router http.Handler, path, token string) string {
+	t.Helper()
+	rec := authed(t, router, "GET", path, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: expected 200, got %d: %s", path, rec.Code, rec.Body)
+	}
+	var body struct {
+		State string `json:"state"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	return body.State
+}
+
+func TestIdentityProviders(t *testing.T) {
+	router, store := newTestServer(t)
+	fake := &fakeProvider{challenges: map[string]string{}, profiles: map[string]types.ProviderProfile{
+		"new-user": {Subject: "f-1", Email: "new@example.com", FirstName: "New", EmailVerified: true},
+		"existing": {Subject: "f-2", Email: "someone@else.example"},
+	}}
+	auth.RegisterIdentityProvider(fake)
+
+	if rec := authed(t, router, "GET", "/user/oauth/nope/url", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown provider: expected 404, got %d", rec.Code)
+	}
+
+	// Signing in with an unknown identity signs up
+	state := oauthState(t, router, "/user/oauth/fake/url", "")
+	rec := post(t, router, "/user/oauth/fake/callback", types.OAuthCallbackRequest{Code: "new-user", State: state})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	created, err := store.GetUserByIdentity(context.Background(), "fake", "f-1")
+	if err != nil || created.Email != "new@example.com" || created.AuthType != types.AuthTypeOAuth {
+		t.Fatalf("expected an OAuth-only user, got %+v, %v", created, err)
+	}
+
+	// A signed-in user links an identity with a different email; the login
+	// state can't be used for it
+	tokens := logIn(t, router, "")
+	loginState := oauthState(t, router, "/user/oauth/fake/url", "")
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(types.OAuthCallbackRequest{Code: "existing", State: loginState})
+	req := httptest.NewRequest("POST", "/user/identities/fake", &buf)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("link with a login state: expected 400, got %d", rec.Code)
+	}
+
+	linkState := oauthState(t, router, "/user/identities/fake/url", tokens.AccessToken)
+	buf.Reset()
+	json.NewEncoder(&buf).Encode(types.OAuthCallbackRequest{Code: "existing", State: linkState})
+	req = httptest.NewRequest("POST", "/user/identities/fake", &buf)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("link: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Now it signs in as the linked user
+	state = oauthState(t, router, "/user/oauth/fake/url", "")
+	rec = post(t, router, "/user/oauth/fake/callback", types.OAuthCallbackRequest{Code: "existing", State: state})
+	var signedIn struct {
+		Email string `json:"email"`
+	}
+	json.NewDecoder(rec.Body).Decode(&signedIn)
+	if rec.Code != http.StatusOK || signedIn.Email != "user@example.com" {
+		t.Fatalf("sign in with linked identity: got %d %+v", rec.Code, signedIn)
+	}
+
+	if rec := authed(t, router, "DELETE", "/user/identities/fake", tokens.AccessToken); rec.Code != http.StatusOK {
+		t.Fatalf("unlink: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := authed(t, router, "DELETE", "/user/identities/fake", tokens.AccessToken); rec.Code != http.StatusNotFound {
+		t.Errorf("unlink twice: expected 404, got %d", rec.Code)
+	}
+}
+
+func TestOAuthLinkRequiresProof(t *testing.T) {
+	router, store := newTestServer(t)
+	fake := &fakeProvider{challenges: map[string]string{}, profiles: map[string]types.ProviderProfile{
+		"unverified": {Subject: "f-1", Email: "user@example.com"},
+		"verified":   {Subject: "f-2", Email: "user@example.com", EmailVerified: true},
+	}}
+	auth.RegisterIdentityProvider(fake)
+	var sentOTP string
+	sendLinkOTP = func(email, otp string) error {
+		sentOTP = otp
+		return nil
+	}
+	t.Cleanup(func() { sendLinkOTP = auth.SendEmailOTP })
+	sendLockoutEmail = func(email, unlockURL string, until time.Time) error { return nil }
+	t.Cleanup(func() { sendLockoutEmail = auth.SendAccountLockedEmail })
+
+	type linkResponse struct {
+		Code      string   `json:"code"`
+		LinkToken string   `json:"link_token"`
+		Methods   []string `json:"methods"`
+		Email     string   `json:"email"`
+	}
+	callback := func(code string) (*httptest.ResponseRecorder, linkResponse) {
+		state := oauthState(t, router, "/user/oauth/fake/url", "")
+		rec := post(t, router, "/user/oauth/fake/callback", types.OAuthCallbackRequest{Code: code, State: state})
+		var body linkResponse
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec, body
+	}
+
+	// An unverified email never reaches the existing account
+	rec, body := callback("unverified")
+	if rec.Code != http.StatusConflict || body.Code != "email_not_verified" || body.LinkToken != "" {
+		t.Fatalf("unverified email: expected 409 email_not_verified, got %d %s", rec.Code, rec.Body)
+	}
+
+	// A verified one has to be confirmed first
+	rec, body = callback("verified")
+	if rec.Code != http.StatusConflict || body.Code != "link_required" || body.LinkToken == "" {
+		t.Fatalf("verified email: expected 409 link_required, got %d %s", rec.Code, rec.Body)
+	}
+	if len(body.Methods) != 2 {
+		t.Errorf("expected password and otp methods, got %v", body.Methods)
+	}
+	if _, err := store.GetUserByIdentity(context.Background(), "fake", "f-2"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("identity linked before proof: %v", err)
+	}
+
+	rec = post(t, router, "/user/oauth/link/confirm", types.ConfirmLinkRequest{LinkToken: body.LinkToken, Password: "wrong"})
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: expected 401, got %d", rec.Code)
+	}
+	rec = post(t, router, "/user/oauth/link/confirm", types.ConfirmLinkRequest{LinkToken: body.LinkToken, Password: "correct horse"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("confirm with password: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if user, err := store.GetUserByIdentity(context.Background(), "fake", "f-2"); err != nil || user.Email != "user@example.com" {
+		t.Fatalf("expected the identity linked to user@example.com, got %+v, %v", user, err)
+	}
+	rec = post(t, router, "/user/oauth/link/confirm", types.ConfirmLinkRequest{LinkToken: body.LinkToken, Password: "correct horse"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("reused link token: expected 400, got %d", rec.Code)
+	}
+
+	// The emailed code works too, and repeated guesses burn the link
+	if err := store.UnlinkIdentity(context.Background(), "user@example.com", "fake"); err != nil {
+		t.Fatalf("UnlinkIdentity: %v", err)
+	}
+	_, body = callback("verified")
+	if rec := post(t, router, "/user/oauth/link/send-otp", types.LinkTokenRequest{LinkToken: body.LinkToken}); rec.Code != http.StatusOK || sentOTP == "" {
+		t.Fatalf("send-otp: expected 200 and a code, got %d: %s", rec.Code, rec.Body)
+	}
+	// Codes for an email share the OTP cooldown, even across pending links
+	_, other := callback("verified")
+	if rec := post(t, router, "/user/oauth/link/send-otp", types.LinkTokenRequest{LinkToken: other.LinkToken}); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("send-otp again: expected 429, got %d", rec.Code)
+	}
+	rec = post(t, router, "/user/oauth/link/confirm", types.ConfirmLinkRequest{LinkToken: body.LinkToken, OTP: sentOTP})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("confirm with OTP: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	store.UnlinkIdentity(context.Background(), "user@example.com", "fake")
+	_, body = callback("verified")
+	for i := 0; i < maxLinkProofFails; i++ {
+		post(t, router, "/user/oauth/link/confirm", types.ConfirmLinkRequest{LinkToken: body.LinkToken, Password: "wrong"})
+	}
+	rec = post(t, router, "/user/oauth/link/confirm", types.ConfirmLinkRequest{LinkToken: body.LinkToken, Password: "correct horse"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("after too many failures: expected 400, got %d", rec.Code)
+	}
+	// and count towards the account's sign-in lockout
+	if rec := post(t, router, "/user/login", types.LoginRequest{Email: "user@example.com", Password: "correct horse"}); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("login after wrong link passwords: expected 429, got %d", rec.Code)
+	}
+}
+
+func TestOAuthSignupWithUnverifiedEmail(t *testing.T) {
+	router, store := newTestServer(t)
+	fake := &fakeProvider{challenges: map[string]string{}, profiles: map[string]types.ProviderProfile{
+		"unverified": {Subject: "f-1", Email: "victim@example.com", FirstName: "Not", LastName: "Victim"},
+	}}
+	auth.RegisterIdentityProvider(fake)
+	var sentTo, sentOTP string
+	sendLinkOTP = func(email, otp string) error {
+		sentTo, sentOTP = email, otp
+		return nil
+	}
+	t.Cleanup(func() { sendLinkOTP = auth.SendEmailOTP })
+	id, _ := store.CreateRoute(context.Background(), types.Route{Name: "Trip", CreatorID: "user@example.com"})
+	store.CreateInvitation(context.Background(), types.Invitation{
+		RouteID: id, Email: "victim@example.com", Role: types.RoleEditor, ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	// No account, and no invitations accepted, until the email is proven
+	state := oauthState(t, router, "/user/oauth/fake/url", "")
+	rec := post(t, router, "/user/oauth/fake/callback", types.OAuthCallbackRequest{Code: "unverified", State: state})
+	var body struct {
+		Code      string   `json:"code"`
+		LinkToken string   `json:"link_token"`
+		Methods   []string `json:"methods"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != http.StatusConflict || body.Code != "email_verification_required" || body.LinkToken == "" {
+		t.Fatalf("unverified signup: expected 409 email_verification_required, got %d %s", rec.Code, rec.Body)
+	}
+	if _, err := store.GetUserByEmail(context.Background(), "victim@example.com"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("account created before the email was proven: %v", err)
+	}
+	if role, _ := store.CheckUserRoutePermission(context.Background(), "victim@example.com", id); role != "" {
+		t.Fatalf("invitation accepted before the email was proven, got %q", role)
+	}
+	if rec := post(t, router, "/user/oauth/link/confirm", types.ConfirmLinkRequest{LinkToken: body.LinkToken, Password: "anything"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("password for a new account: expected 401, got %d", rec.Code)
+	}
+
+	if rec := post(t, router, "/user/oauth/link/send-otp", types.LinkTokenRequest{LinkToken: body.LinkToken}); rec.Code != http.StatusOK || sentTo != "victim@example.com" {
+		t.Fatalf("send-otp: expected a code sent to the email, got %d to %q", rec.Code, sentTo)
+	}
+	rec = post(t, router, "/user/oauth/link/confirm", types.ConfirmLinkRequest{LinkToken: body.LinkToken, OTP: sentOTP})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("confirm with OTP: expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	user, err := store.GetUserByIdentity(context.Background(), "fake", "f-1")
+	if err != nil || user.Email != "victim@example.com" || user.AuthType != types.AuthTypeOAuth || user.FirstName != "Not" {
+		t.Fatalf("expected an OAuth-only account once proven, got %+v, %v", user, err)
+	}
+	if role, _ := store.CheckUserRoutePermission(context.Background(), "victim@example.com", id); role != types.RoleEditor {
+		t.Errorf("expected the invitation accepted once proven, got %q", role)
+	}
+}
+
+func TestOTPs(t *testing.T) {
+	router, _ := newTestServer(t)
+	sent := map[string]string{}
+	sendSignupOTP = func(email, otp string) error {
+		sent[email] = otp
+		return nil
+	}
+	sendResetOTP = sendSignupOTP
+	t.Cleanup(func() {
+		sendSignupOTP = auth.SendEmailOTP
+		sendResetOTP = auth.SendResetPasswordEmail
+	})
+	signupReq := types.SignupRequest{Email: "new@example.com", Password: "hunter22", FirstName: "New", LastName: "User"}
+	verify := func(otp string) *httptest.ResponseRecorder {
+		return post(t, router, "/user/verify-otp", map[string]string{"email": "new@example.com", "otp": otp})
+	}
+
+	if rec := post(t, router, "/user/signup", signupReq); rec.Code != http.StatusOK {
+		t.Fatalf("signup: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	code := sent["new@example.com"]
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < maxOTPAttempts; i++ {
+		if rec := verify(wrong); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: expected 401, got %d", i, rec.Code)
+		}
+	}
+	if rec := verify(code); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected the code to stop working after %d wrong guesses, got %d", maxOTPAttempts, rec.Code)
+	}
+
+	// A second code inside the cooldown is refused
+	rec := post(t, router, "/user/resend-otp", types.ResendOTPRequest{Email: "new@example.com", Type: types.OTPTypeSignup})
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("resend: expected 429 with Retry-After, got %d", rec.Code)
+	}
+	// but not for resets, which would reveal the account exists
+	post(t, router, "/user/request-reset", map[string]string{"email": "user@example.com"})
+	resetCode := sent["user@example.com"]
+	if rec := post(t, router, "/user/request-reset", map[string]string{"email": "user@example.com"}); rec.Code != http.StatusOK {
+		t.Fatalf("second reset request: expected 200, got %d", rec.Code)
+	}
+	if sent["user@example.com"] != resetCode {
+		t.Fatal("expected no new reset code inside the cooldown")
+	}
+
+	// Codes are single use
+	reset := map[string]string{"email": "user@example.com", "token": resetCode, "password": "new password"}
+	if rec := post(t, router, "/user/reset-password", reset); rec.Code != http.StatusOK {
+		t.Fatalf("reset: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := post(t, router, "/user/reset-password", reset); rec.Code != http.StatusBadRequest {
+		t.Fatalf("reusing a code: expected 400, got %d", rec.Code)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	router, _ := newTestServer(t)
+	links := make(chan string, 1)
+	sendLockoutEmail = func(email, link string, until time.Time) error {
+		links <- link
+		return nil
+	}
+	t.Cleanup(func() { sendLockoutEmail = auth.SendAccountLockedEmail })
+	login := func(email, password string) *httptest.ResponseRecorder {
+		return post(t, router, "/user/login", types.LoginRequest{Email: email, Password: password})
+	}
+
+	for i := 0; i < accountLockout.Threshold; i++ {
+		if rec := login("user@example.com", "wrong"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d: expected 401, got %d", i, rec.Code)
+		}
+	}
+	if rec := login("user@example.com", "correct horse"); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("locked account: expected 429 with Retry-After, got %d", rec.Code)
+	}
+	var link string
+	select {
+	case link = <-links:
+	case <-time.After(time.Second):
+		t.Fatal("expected a lockout email")
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("parse unlock link: %v", err)
+	}
+	unlock := func() *httptest.ResponseRecorder {
+		return post(t, router, "/user/unlock", map[string]string{"token": u.Query().Get("token")})
+	}
+	if rec := unlock(); rec.Code != http.StatusOK {
+		t.Fatalf("unlock: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := unlock(); rec.Code != http.StatusBadRequest {
+		t.Fatalf("reusing the unlock link: expected 400, got %d", rec.Code)
+	}
+	if rec := login("user@example.com", "correct horse"); rec.Code != http.StatusOK {
+		t.Fatalf("login after unlock: expected 200, got %d", rec.Code)
+	}
+
+	// Unknown emails lock the same way, without an email
+	for i := 0; i < accountLockout.Threshold; i++ {
+		login("nobody@example.com", "wrong")
+	}
+	if rec := login("nobody@example.com", "wrong"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("unknown email: expected 429, got %d", rec.Code)
+	}
+	if len(links) != 0 {
+		t.Fatal("expected no lockout email for an unknown email")
+	}
+
+	// and the client locks once it has failed often enough across accounts
+	for i := 2 * accountLockout.Threshold; i < clientLockout.Threshold; i++ {
+		login(fmt.Sprintf("guess%d@example.com", i), "wrong")
+	}
+	if rec := login("user@example.com", "correct horse"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked client: expected 429, got %d", rec.Code)
+	}
+	// X-Forwarded-For from a client that isn't a trusted proxy is ignored
+	body, _ := json.Marshal(types.LoginRequest{Email: "user@example.com", Password: "correct horse"})
+	req := httptest.NewRequest("POST", "/user/login", bytes.NewReader(body))
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("spoofed X-Forwarded-For: expected 429, got %d", rec.Code)
+	}
+}
+
+func TestMagicLink(t *testing.T) {
+	router, store := newTestServer(t)
+	links := make(chan string, 1)
+	sendMagicLinkEmail = func(email, link string) error {
+		links <- link
+		return nil
+	}
+	t.Cleanup(func() { sendMagicLinkEmail = auth.SendMagicLinkEmail })
+	request := func(email string) (token, nonce string) {
+		rec := post(t, router, "/user/magic-link", types.MagicLinkRequest{Email: email})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("magic link: expected 200, got %d", rec.Code)
+		}
+		var body struct {
+			Nonce string `json:"nonce"`
+		}
+		json.NewDecoder(rec.Body).Decode(&body)
+		select {
+		case link := <-links:
+			u, err := url.Parse(link)
+			if err != nil {
+				t.Fatalf("parse magic link: %v", err)
+			}
+			return u.Query().Get("token"), body.Nonce
+		case <-time.After(time.Second):
+			return "", body.Nonce
+		}
+	}
+	verify := func(token, nonce string) *httptest.ResponseRecorder {
+		return post(t, router, "/user/magic-link/verify", types.MagicLinkVerifyRequest{Token: token, Nonce: nonce})
+	}
+
+	if token, nonce := request("nobody@example.com"); token != "" || nonce == "" {
+		t.Fatal("expected a nonce and no email for an unknown address")
+	}
+
+	token, nonce := request("user@example.com")
+	if rec := verify(token, "someone else's nonce"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong nonce: expected 401, got %d", rec.Code)
+	}
+	if rec := verify(token, nonce); rec.Code != http.StatusBadRequest {
+		t.Fatalf("reusing a link: expected 400, got %d", rec.Code)
+	}
+
+	// Links count against the same quota as codes, and going over it
+	// looks the same as an unknown email
+	if token, nonce := request("user@example.com"); token != "" || nonce == "" {
+		t.Fatal("expected a nonce and no email within the cooldown")
+	}
+
+	if err := store.CreateUser(context.Background(), types.UserData{Email: "second@example.com", AuthType: "email"}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	token, nonce = request("second@example.com")
+	rec := verify(token, nonce)
+	var tokens tokenPair
+	json.NewDecoder(rec.Body).Decode(&tokens)
+	if rec.Code != http.StatusOK || tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatalf("verify: expected 200 with tokens, got %d", rec.Code)
+	}
+}
+
+func authedPost(t *testing.T, router http.Handler, path, token string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		t.Fatalf("encode body: %v", err)
+	}
+	req := httptest.NewRequest("POST", path, &buf)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTwoFactor(t *testing.T) {
+	router, _ := newTestServer(t)
+	tokens := logIn(t, router, "")
+
+	rec := authedPost(t, router, "/user/2fa/setup", tokens.AccessToken, struct{}{})
+	var setup struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+	json.NewDecoder(rec.Body).Decode(&setup)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(setup.OTPAuthURI, "otpauth://totp/") {
+		t.Fatalf("setup: got %d %+v", rec.Code, setup)
+	}
+	code := func(offset time.Duration) string {
+		c, err := auth.TOTPCode(setup.Secret, time.Now().Add(offset))
+		if err != nil {
+			t.Fatalf("TOTPCode: %v", err)
+		}
+		return c
+	}
+
+	if rec := authedPost(t, router, "/user/2fa/confirm", tokens.AccessToken, types.TwoFactorCodeRequest{Code: "000000"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("confirm with a wrong code: expected 401, got %d", rec.Code)
+	}
+	rec = authedPost(t, router, "/user/2fa/confirm", tokens.AccessToken, types.TwoFactorCodeRequest{Code: code(0)})
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.NewDecoder(rec.Body).Decode(&confirmed)
+	if rec.Code != http.StatusOK || len(confirmed.RecoveryCodes) != twoFactorRecoveryCodes {
+		t.Fatalf("confirm: got %d %s", rec.Code, rec.Body)
+	}
+
+	// The password alone now only gets a challenge
+	rec = post(t, router, "/user/login", types.LoginRequest{Email: "user@example.com", Password: "correct horse"})
+	var challenge struct {
+		Required       bool   `json:"two_factor_required"`
+		ChallengeToken string `json:"challenge_token"`
+		AccessToken    string `json:"access_token"`
+	}
+	json.NewDecoder(rec.Body).Decode(&challenge)
+	if rec.Code != http.StatusOK || !challenge.Required || challenge.ChallengeToken == "" || challenge.AccessToken != "" {
+		t.Fatalf("login with 2FA: got %d %+v", rec.Code, challenge)
+	}
+
+	// The code used to confirm can't be replayed; the next one signs in once
+	rec = post(t, router, "/user/2fa/verify", types.TwoFactorVerifyRequest{ChallengeToken: challenge.ChallengeToken, Code: code(0)})
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("replayed code: expected 401, got %d", rec.Code)
+	}
+	rec = post(t, router, "/user/2fa/verify", types.TwoFactorVerifyRequest{ChallengeToken: challenge.ChallengeToken, Code: code(30 * time.Second)})
+	var signedIn tokenPair
+	json.NewDecoder(rec.Body).Decode(&signedIn)
+	if rec.Code != http.StatusOK || signedIn.AccessToken == "" {
+		t.Fatalf("verify: got %d %s", rec.Code, rec.Body)
+	}
+	rec = post(t, router, "/user/2fa/verify", types.TwoFactorVerifyRequest{ChallengeToken: challenge.ChallengeToken, Code: code(30 * time.Second)})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("reused challenge: expected 400, got %d", rec.Code)
+	}
+
+	// Recovery codes work once
+	recovery := confirmed.RecoveryCodes[0]
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		rec = post(t, router, "/user/login", types.LoginRequest{Email: "user@example.com", Password: "correct horse"})
+		json.NewDecoder(rec.Body).Decode(&challenge)
+		rec = post(t, router, "/user/2fa/verify", types.TwoFactorVerifyRequest{ChallengeToken: challenge.ChallengeToken, RecoveryCode: recovery})
+		if rec.Code != want {
+			t.Errorf("recovery code use %d: expected %d, got %d", i+1, want, rec.Code)
+		}
+	}
+
+	// Turning it off needs the password as well as a code
+	disable := types.TwoFactorReauthRequest{Password: "wrong", RecoveryCode: confirmed.RecoveryCodes[1]}
+	if rec := authedPost(t, router, "/user/2fa/disable", signedIn.AccessToken, disable); rec.Code != http.StatusUnauthorized {
+		t.Errorf("disable with a wrong password: expected 401, got %d", rec.Code)
+	}
+	disable.Password = "correct horse"
+	if rec := authedPost(t, router, "/user/2fa/disable", signedIn.AccessToken, disable); rec.Code != http.StatusOK {
+		t.Fatalf("disable: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	logIn(t, router, "")
+}
+
+func TestTwoFactorReauthIsThrottled(t *testing.T) {
+	router, store := newTestServer(t)
+	sendLockoutEmail = func(email, link string, until time.Time) error { return nil }
+	t.Cleanup(func() { sendLockoutEmail = auth.SendAccountLockedEmail })
+	tokens := logIn(t, router, "")
+	rec := authedPost(t, router, "/user/2fa/setup", tokens.AccessToken, struct{}{})
+	var setup struct {
+		Secret string `json:"secret"`
+	}
+	json.NewDecoder(rec.Body).Decode(&setup)
+	code, _ := auth.TOTPCode(setup.Secret, time.Now())
+	if rec := authedPost(t, router, "/user/2fa/confirm", tokens.AccessToken, types.TwoFactorCodeRequest{Code: code}); rec.Code != http.StatusOK {
+		t.Fatalf("confirm: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Wrong codes lock the account like wrong passwords do
+	wrong := types.TwoFactorReauthRequest{Password: "correct horse", Code: "000000"}
+	for _, offset := range []time.Duration{-30 * time.Second, 0, 30 * time.Second} {
+		if valid, _ := auth.TOTPCode(setup.Secret, time.Now().Add(offset)); valid == wrong.Code {
+			wrong.Code = "111111"
+		}
+	}
+	for i := 0; i < accountLockout.Threshold; i++ {
+		if rec := authedPost(t, router, "/user/2fa/disable", tokens.AccessToken, wrong); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: expected 401, got %d", i+1, rec.Code)
+		}
+	}
+	next, _ := auth.TOTPCode(setup.Secret, time.Now().Add(30*time.Second))
+	right := types.TwoFactorReauthRequest{Password: "correct horse", Code: next}
+	if rec := authedPost(t, router, "/user/2fa/disable", tokens.AccessToken, right); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("disable while locked: expected 429, got %d", rec.Code)
+	}
+	if user, _ := store.GetUserByEmail(context.Background(), "user@example.com"); !user.TwoFactorEnabled() {
+		t.Error("2FA was turned off while locked")
+	}
+}
+
+func TestTwoFactorVerifyIsThrottled(t *testing.T) {
+	router, _ := newTestServer(t)
+	sendLockoutEmail = func(email, link string, until time.Time) error { return nil }
+	t.Cleanup(func() { sendLockoutEmail = auth.SendAccountLockedEmail })
+	tokens := logIn(t, router, "")
+	rec := authedPost(t, router, "/user/2fa/setup", tokens.AccessToken, struct{}{})
+	var setup struct {
+		Secret string `json:"secret"`
+	}
+	json.NewDecoder(rec.Body).Decode(&setup)
+	code, _ := auth.TOTPCode(setup.Secret, time.Now())
+	if rec := authedPost(t, router, "/user/2fa/confirm", tokens.AccessToken, types.TwoFactorCodeRequest{Code: code}); rec.Code != http.StatusOK {
+		t.Fatalf("confirm: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	wrong := "000000"
+	for _, offset := range []time.Duration{-30 * time.Second, 0, 30 * time.Second} {
+		if valid, _ := auth.TOTPCode(setup.Secret, time.Now().Add(offset)); valid == wrong {
+			wrong = "111111"
+		}
+	}
+	var challenge struct {
+		ChallengeToken string `json:"challenge_token"`
+	}
+	login := func() *httptest.ResponseRecorder {
+		return post(t, router, "/user/login", types.LoginRequest{Email: "user@example.com", Password: "correct horse"})
+	}
+
+	// A fresh challenge per guess doesn't reset the count: the password
+	// alone doesn't clear earlier wrong codes
+	for i := 0; i < accountLockout.Threshold; i++ {
+		rec := login()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("login %d: expected 200, got %d", i+1, rec.Code)
+		}
+		json.NewDecoder(rec.Body).Decode(&challenge)
+		rec = post(t, router, "/user/2fa/verify", types.TwoFactorVerifyRequest{ChallengeToken: challenge.ChallengeToken, Code: wrong})
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: expected 401, got %d", i+1, rec.Code)
+		}
+	}
+	if rec := login(); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("login after wrong codes: expected 429, got %d", rec.Code)
+	}
+	// nor can an open challenge keep guessing
+	next, _ := auth.TOTPCode(setup.Secret, time.Now().Add(30*time.Second))
+	rec = post(t, router, "/user/2fa/verify", types.TwoFactorVerifyRequest{ChallengeToken: challenge.ChallengeToken, Code: next})
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("verify while locked: expected 429, got %d", rec.Code)
+	}
+}
+
+// softAuthenticator is a passkey authenticator in software: a P-256 key
+// per credential, "none" attestation, and a signature counter
+type softAuthenticator struct {
+	t       *testing.T
+	origin  string
+	rpID    string
+	id      []byte
+	key     *ecdsa.PrivateKey
+	handle  []byte
+	counter uint32
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (a *softAuthenticator) clientData(ceremony, challenge string) []byte {
+	data, _ := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge, "origin": a.origin})
+	return data
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	return append(data, attested...)
+}
+
+// create answers navigator.credentials.create() options
+func (a *softAuthenticator) create(options json.RawMessage) map[string]interface{} {
+	var opts struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			User      struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	}
+	json.Unmarshal(options, &opts)
+	a.handle, _ = base64.RawURLEncoding.DecodeString(opts.PublicKey.User.ID)
+	a.key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.id = make([]byte, 16)
+	rand.Read(a.id)
+
+	coseKey, _ := cbor.Marshal(map[int]interface{}{
+		1: 2, 3: -7, -1: 1, // EC2, ES256, P-256
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.id)))
+	attested = append(append(attested, a.id...), coseKey...)
+	attestation, _ := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(0x45, attested), // UP, UV, AT
+	})
+	return map[string]interface{}{
+		"id":    b64(a.id),
+		"rawId": b64(a.id),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64(a.clientData("webauthn.create", opts.PublicKey.Challenge)),
+			"attestationObject": b64(attestation),
+			"transports":        []string{"internal"},
+		},
+	}
+}
+
+// get answers navigator.credentials.get() options
+func (a *softAuthenticator) get(options json.RawMessage) map[string]interface{} {
+	var opts struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	}
+	json.Unmarshal(options, &opts)
+	a.counter++
+	authData := a.authData(0x05, nil) // UP, UV
+	clientData := a.clientData("webauthn.get", opts.PublicKey.Challenge)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatalf("sign: %v", err)
+	}
+	return map[string]interface{}{
+		"id":    b64(a.id),
+		"rawId": b64(a.id),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64(clientData),
+			"authenticatorData": b64(authData),
+			"signature":         b64(signature),
+			"userHandle":        b64(a.handle),
+		},
+	}
+}
+
+type webauthnOptions struct {
+	SessionID string          `json:"session_id"`
+	Options   json.RawMessage `json:"options"`
+}
+
+func TestPasskeys(t *testing.T) {
+	router, store := newTestServer(t)
+	auth.InitFrontendURL("http://localhost:5173")
+	if err := auth.InitWebAuthn(config.WebAuthn{}); err != nil {
+		t.Fatalf("InitWebAuthn: %v", err)
+	}
+	authenticator := &softAuthenticator{t: t, origin: "http://localhost:5173", rpID: "localhost"}
+
+	// Passkeys skip 2FA, so adding one needs a recent sign-in
+	signedInAt := time.Now().Add(-time.Hour)
+	store.CreateSession(context.Background(), types.Session{ID: "stale", UserID: "user@example.com", CreatedAt: signedInAt, LastUsedAt: signedInAt, ExpiresAt: time.Now().Add(time.Hour)})
+	stale, _ := auth.GenerateAccessToken("user@example.com", "", "", "user@example.com", "stale")
+	if rec := authedPost(t, router, "/user/webauthn/register/begin", stale, struct{}{}); rec.Code != http.StatusForbidden {
+		t.Errorf("register with a stale session: expected 403, got %d", rec.Code)
+	}
+
+	tokens := logIn(t, router, "")
+
+	rec := authedPost(t, router, "/user/webauthn/register/begin", tokens.AccessToken, struct{}{})
+	var begin webauthnOptions
+	json.NewDecoder(rec.Body).Decode(&begin)
+	if rec.Code != http.StatusOK || begin.SessionID == "" {
+		t.Fatalf("register begin: got %d %s", rec.Code, rec.Body)
+	}
+	rec = authedPost(t, router, "/user/webauthn/register/finish", tokens.AccessToken, map[string]interface{}{
+		"session_id": begin.SessionID,
+		"nickname":   "Test key",
+		"credential": authenticator.create(begin.Options),
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register finish: expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+
+	signIn := func() *httptest.ResponseRecorder {
+		rec := post(t, router, "/user/webauthn/login/begin", struct{}{})
+		var begin webauthnOptions
+		json.NewDecoder(rec.Body).Decode(&begin)
+		return post(t, router, "/user/webauthn/login/finish", map[string]interface{}{
+			"session_id": begin.SessionID,
+			"credential": authenticator.get(begin.Options),
+		})
+	}
+	rec = signIn()
+	var signedIn struct {
+		AccessToken string `json:"access_token"`
+		Email       string `json:"email"`
+	}
+	json.NewDecoder(rec.Body).Decode(&signedIn)
+	if rec.Code != http.StatusOK || signedIn.AccessToken == "" || signedIn.Email != "user@example.com" {
+		t.Fatalf("passkey sign in: got %d %+v", rec.Code, signedIn)
+	}
+
+	// A counter that goes backwards means a cloned key
+	authenticator.counter = 0
+	if rec := signIn(); rec.Code != http.StatusUnauthorized {
+		t.Errorf("cloned authenticator: expected 401, got %d", rec.Code)
+	}
+
+	rec = authed(t, router, "GET", "/user/webauthn/credentials", tokens.AccessToken)
+	var list struct {
+		Credentials []types.WebAuthnCredential `json:"credentials"`
+	}
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list.Credentials) != 1 || list.Credentials[0].Nickname != "Test key" || list.Credentials[0].LastUsedAt == nil {
+		t.Fatalf("list: got %+v", list.Credentials)
+	}
+	if rec := authed(t, router, "DELETE", "/user/webauthn/credentials/"+list.Credentials[0].ID, tokens.AccessToken); rec.Code != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", rec.Code)
+	}
+	authenticator.counter = 10
+	if rec := signIn(); rec.Code != http.StatusUnauthorized {
+		t.Errorf("deleted passkey: expected 401, got %d", rec.Code)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	router, _ := newTestServer(t)
+	current := logIn(t, router, "laptop")
+	other := logIn(t, router, "phone")
+
+	change := func(currentPassword string) *httptest.ResponseRecorder {
+		return authedPost(t, router, "/user/change-password", current.AccessToken, types.ChangePasswordRequest{CurrentPassword: currentPassword, NewPassword: "battery staple"})
+	}
+	if rec := change("wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong current password: expected 401, got %d", rec.Code)
+	}
+	rec := change("correct horse")
+	var body struct {
+		Revoked int `json:"revoked"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusOK || body.Revoked != 1 {
+		t.Fatalf("change password: expected 200 revoking 1 session, got %d revoking %d", rec.Code, body.Revoked)
+	}
+	if rec := post(t, router, "/user/refresh", types.RefreshRequest{RefreshToken: other.RefreshToken}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("other session: expected 401 on refresh, got %d", rec.Code)
+	}
+	if rec := post(t, router, "/user/refresh", types.RefreshRequest{RefreshToken: current.RefreshToken}); rec.Code != http.StatusOK {
+		t.Errorf("current session: expected 200 on refresh, got %d", rec.Code)
+	}
+	if rec := post(t, router, "/user/login", types.LoginRequest{Email: "user@example.com", Password: "battery staple"}); rec.Code != http.StatusOK {
+		t.Errorf("login with the new password: expected 200, got %d", rec.Code)
+	}
+}
+
+func TestSetPassword(t *testing.T) {
+	router, store := newTestServer(t)
+	ctx := context.Background()
+	identity := types.LinkedIdentity{Provider: "google", Subject: "g-1", Email: "oauth@example.com"}
+	if err := store.CreateUser(ctx, types.UserData{Email: "oauth@example.com", Identities: []types.LinkedIdentity{identity}, AuthType: types.AuthTypeOAuth}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	// A session that signed in at signedInAt
+	accessToken := func(id string, signedInAt time.Time) string {
+		t.Helper()
+		err := store.CreateSession(ctx, types.Session{ID: id, UserID: "oauth@example.com", CreatedAt: signedInAt, LastUsedAt: signedInAt, ExpiresAt: time.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		token, err := auth.GenerateAccessToken("oauth@example.com", "", "", "oauth@example.com", id)
+		if err != nil {
+			t.Fatalf("GenerateAccessToken: %v", err)
+		}
+		return token
+	}
+	set := types.SetPasswordRequest{Password: "battery staple"}
+
+	rec := authedPost(t, router, "/user/set-password", accessToken("old", time.Now().Add(-time.Hour)), set)
+	var errBody struct {
+		Code string `json:"code"`
+	}
+	json.NewDecoder(rec.Body).Decode(&errBody)
+	if rec.Code != http.StatusForbidden || errBody.Code != "reauth_required" {
+		t.Fatalf("stale session: expected 403 reauth_required, got %d %q", rec.Code, errBody.Code)
+	}
+
+	token := accessToken("fresh", time.Now())
+	if rec := authedPost(t, router, "/user/set-password", token, set); rec.Code != http.StatusOK {
+		t.Fatalf("set password: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	user, err := store.GetUserByEmail(ctx, "oauth@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	if user.AuthType != types.AuthTypeBoth {
+		t.Errorf("expected auth type %q, got %q", types.AuthTypeBoth, user.AuthType)
+	}
+	if rec := authedPost(t, router, "/user/set-password", token, set); rec.Code != http.StatusConflict {
+		t.Errorf("setting a password twice: expected 409, got %d", rec.Code)
+	}
+	if rec := post(t, router, "/user/login", types.LoginRequest{Email: "oauth@example.com", Password: "battery staple"}); rec.Code != http.StatusOK {
+		t.Errorf("login with the new password: expected 200, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,366 @@
+package user
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
+	"github.com/atindraraut/crudgo/internal/utils/middleware"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/atindraraut/crudgo/storage"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const webauthnSessionTTL = 5 * time.Minute
+
+// webauthnUser adapts a user and their passkeys to the webauthn library
+type webauthnUser struct {
+	user        types.UserData
+	credentials []types.WebAuthnCredential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte {
+	return auth.WebAuthnUserHandle(u.user.Email)
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	if name := u.user.FirstName + " " + u.user.LastName; name != " " {
+		return name
+	}
+	return u.user.Email
+}
+
+func (u *webauthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		id, err := base64.RawURLEncoding.DecodeString(c.ID)
+		if err != nil {
+			continue
+		}
+		transports := make([]protocol.AuthenticatorTransport, len(c.Transports))
+		for i, t := range c.Transports {
+			transports[i] = protocol.AuthenticatorTransport(t)
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              id,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags:           webauthn.CredentialFlags{BackupEligible: c.BackupEligible},
+			Authenticator:   webauthn.Authenticator{AAGUID: c.AAGUID, SignCount: c.SignCount},
+		})
+	}
+	return credentials
+}
+
+// Helper: the passkey relying party, writing a 404 if passkeys aren't set up
+func relyingParty(w http.ResponseWriter) (*webauthn.WebAuthn, bool) {
+	wa, ok := auth.WebAuthn()
+	if !ok {
+		response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("passkeys are not available")))
+	}
+	return wa, ok
+}
+
+// Helper: store the library's session data for the second half of a
+// ceremony, returning its ID
+func saveWebAuthnSession(r *http.Request, store storage.Storage, ceremony, email string, data *webauthn.SessionData) (string, error) {
+	id, err := auth.NewTokenID()
+	if err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return id, store.SaveWebAuthnSession(r.Context(), types.WebAuthnSession{
+		ID:        id,
+		Ceremony:  ceremony,
+		Email:     email,
+		Data:      raw,
+		CreatedAt: now,
+		ExpiresAt: now.Add(webauthnSessionTTL),
+	})
+}
+
+// Helper: use up the ceremony a finish request answers, writing a 400 if
+// it is unknown, used, expired or a different ceremony
+func consumeWebAuthnSession(w http.ResponseWriter, r *http.Request, store storage.Storage, id, ceremony, email string) (webauthn.SessionData, bool) {
+	session, err := store.ConsumeWebAuthnSession(r.Context(), id)
+	if isNotFound(err) || isExpired(err) || (err == nil && (session.Ceremony != ceremony || session.Email != email)) {
+		response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("passkey request expired or not found: please try again")))
+		return webauthn.SessionData{}, false
+	}
+	var data webauthn.SessionData
+	if err == nil {
+		err = json.Unmarshal(session.Data, &data)
+	}
+	if err != nil {
+		response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to look up passkey request")))
+		return webauthn.SessionData{}, false
+	}
+	return data, true
+}
+
+// Helper: the signed-in user with their passkeys
+func currentWebAuthnUser(w http.ResponseWriter, r *http.Request, store storage.Storage) (*webauthnUser, bool) {
+	user, ok := currentUser(w, r, store)
+	if !ok {
+		return nil, false
+	}
+	credentials, err := store.ListWebAuthnCredentials(r.Context(), user.Email)
+	if err != nil {
+		response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to look up passkeys")))
+		return nil, false
+	}
+	return &webauthnUser{user: user, credentials: credentials}, true
+}
+
+// Starts registering a passkey for the signed-in user. The options go to
+// navigator.credentials.create(). Passkey sign-ins skip 2FA, so this needs
+// a recent sign-in.
+func webauthnRegisterBegin(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wa, ok := relyingParty(w)
+		if !ok {
+			return
+		}
+		if !requireRecentSignIn(w, r, "adding a passkey") {
+			return
+		}
+		user, ok := currentWebAuthnUser(w, r, storage)
+		if !ok {
+			return
+		}
+		exclude := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+		for _, c := range user.WebAuthnCredentials() {
+			exclude = append(exclude, c.Descriptor())
+		}
+		// Passkeys must be discoverable, as logins don't ask for the email
+		creation, data, err := wa.BeginRegistration(user,
+			webauthn.WithExclusions(exclude),
+			webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to start passkey registration")))
+			return
+		}
+		id, err := saveWebAuthnSession(r, storage, types.WebAuthnRegistration, user.user.Email, data)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to start passkey registration")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"session_id": id,
+			"options":    creation,
+		})
+	}
+}
+
+// Checks the authenticator's attestation and saves the new passkey
+func webauthnRegisterFinish(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wa, ok := relyingParty(w)
+		if !ok {
+			return
+		}
+		var req types.WebAuthnFinishRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		if !requireRecentSignIn(w, r, "adding a passkey") {
+			return
+		}
+		authUser := middleware.GetAuthUser(r)
+		data, ok := consumeWebAuthnSession(w, r, storage, req.SessionID, types.WebAuthnRegistration, authUser.Email)
+		if !ok {
+			return
+		}
+		user, ok := currentWebAuthnUser(w, r, storage)
+		if !ok {
+			return
+		}
+		parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(req.Credential))
+		if err != nil {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid passkey credential")))
+			return
+		}
+		credential, err := wa.CreateCredential(user, data, parsed)
+		if err != nil {
+			slog.Warn("Passkey registration failed", slog.String("error", err.Error()))
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("passkey registration failed")))
+			return
+		}
+
+		nickname := req.Nickname
+		if nickname == "" {
+			nickname = deviceLabel(r)
+		}
+		transports := make([]string, len(credential.Transport))
+		for i, t := range credential.Transport {
+			transports[i] = string(t)
+		}
+		record := types.WebAuthnCredential{
+			ID:              base64.RawURLEncoding.EncodeToString(credential.ID),
+			UserID:          user.user.Email,
+			PublicKey:       credential.PublicKey,
+			AttestationType: credential.AttestationType,
+			AAGUID:          credential.Authenticator.AAGUID,
+			SignCount:       credential.Authenticator.SignCount,
+			Transports:      transports,
+			BackupEligible:  credential.Flags.BackupEligible,
+			Nickname:        nickname,
+			CreatedAt:       time.Now(),
+		}
+		err = storage.CreateWebAuthnCredential(r.Context(), record)
+		if isConflict(err) {
+			response.WriteJSON(w, http.StatusConflict, response.GeneralError(errors.New("this passkey is already registered")))
+			return
+		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to save passkey")))
+			return
+		}
+		response.WriteJSON(w, http.StatusCreated, record)
+	}
+}
+
+// Starts a passkey sign in. No email is needed: the browser offers the
+// passkeys it has for us, and the one picked says whose it is.
+func webauthnLoginBegin(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wa, ok := relyingParty(w)
+		if !ok {
+			return
+		}
+		assertion, data, err := wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to start passkey sign in")))
+			return
+		}
+		id, err := saveWebAuthnSession(r, storage, types.WebAuthnLogin, "", data)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to start passkey sign in")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"session_id": id,
+			"options":    assertion,
+		})
+	}
+}
+
+// Checks the passkey's signature and signs its owner in. A passkey that
+// verified the user (a PIN or biometric) is two factors on its own, so
+// there is no TOTP challenge here.
+func webauthnLoginFinish(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wa, ok := relyingParty(w)
+		if !ok {
+			return
+		}
+		var req types.WebAuthnFinishRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+		data, ok := consumeWebAuthnSession(w, r, storage, req.SessionID, types.WebAuthnLogin, "")
+		if !ok {
+			return
+		}
+		parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(req.Credential))
+		if err != nil {
+			response.WriteJSON(w, http.StatusBadRequest, response.GeneralError(errors.New("invalid passkey credential")))
+			return
+		}
+
+		var owner *webauthnUser
+		findOwner := func(rawID, userHandle []byte) (webauthn.User, error) {
+			credential, err := storage.GetWebAuthnCredential(r.Context(), base64.RawURLEncoding.EncodeToString(rawID))
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(userHandle, auth.WebAuthnUserHandle(credential.UserID)) {
+				return nil, errors.New("passkey belongs to another user")
+			}
+			user, err := storage.GetUserByEmail(r.Context(), credential.UserID)
+			if err != nil {
+				return nil, err
+			}
+			credentials, err := storage.ListWebAuthnCredentials(r.Context(), user.Email)
+			if err != nil {
+				return nil, err
+			}
+			owner = &webauthnUser{user: user, credentials: credentials}
+			return owner, nil
+		}
+		credential, err := wa.ValidateDiscoverableLogin(findOwner, data, parsed)
+		if err != nil {
+			slog.Warn("Passkey sign in failed", slog.String("error", err.Error()))
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("passkey sign in failed")))
+			return
+		}
+		err = storage.UpdateWebAuthnCredentialUse(r.Context(), base64.RawURLEncoding.EncodeToString(credential.ID), credential.Authenticator.SignCount, time.Now())
+		if credential.Authenticator.CloneWarning || isConflict(err) {
+			slog.Warn("Passkey signature counter went backwards", slog.String("user", owner.user.Email))
+			response.WriteJSON(w, http.StatusUnauthorized, response.GeneralError(errors.New("passkey sign in failed")))
+			return
+		}
+		if err != nil {
+			writeTokenError(w)
+			return
+		}
+		completeSignIn(w, r, storage, owner.user, http.StatusOK, "")
+	}
+}
+
+// Lists the signed-in user's passkeys
+func listWebAuthnCredentials(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser := middleware.GetAuthUser(r)
+		credentials, err := storage.ListWebAuthnCredentials(r.Context(), authUser.Email)
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to look up passkeys")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"credentials": credentials,
+		})
+	}
+}
+
+// Removes one of the signed-in user's passkeys
+func deleteWebAuthnCredential(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser := middleware.GetAuthUser(r)
+		err := storage.DeleteWebAuthnCredential(r.Context(), authUser.Email, r.PathValue("id"))
+		if isNotFound(err) {
+			response.WriteJSON(w, http.StatusNotFound, response.GeneralError(errors.New("passkey not found")))
+			return
+		}
+		if err != nil {
+			response.WriteJSON(w, http.StatusInternalServerError, response.GeneralError(errors.New("failed to delete passkey")))
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, map[string]string{
+			"message": "Passkey deleted",
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
+	"github.com/atindraraut/crudgo/internal/utils/response"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// APIHandler is the signature of the API Gateway handlers in this package
+type APIHandler func(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+type claimsKey struct{}
+
+// Authenticate only runs next for requests with a valid access token in
+// the Authorization header. Tokens are checked against the API's published
+// key set, so lambdas never need the signing keys.
+func Authenticate(verifier *auth.JWKSVerifier, next APIHandler) APIHandler {
+	return func(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		header := event.Headers["Authorization"]
+		if header == "" {
+			header = event.Headers["authorization"]
+		}
+		tokenStr, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || tokenStr == "" {
+			return unauthorized("Missing or invalid authorization header"), nil
+		}
+		claims, err := verifier.VerifyAccessToken(tokenStr)
+		if err != nil {
+			return unauthorized("Invalid or expired token"), nil
+		}
+		return next(context.WithValue(ctx, claimsKey{}, claims), event)
+	}
+}
+
+// ClaimsFromContext returns the token claims Authenticate verified
+func ClaimsFromContext(ctx context.Context) (*types.SignedDetails, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*types.SignedDetails)
+	return claims, ok
+}
+
+func unauthorized(message string) events.APIGatewayProxyResponse {
+	body, _ := json.Marshal(response.GeneralError(errors.New(message)))
+	return events.APIGatewayProxyResponse{
+		StatusCode: 401,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
+	}
+}
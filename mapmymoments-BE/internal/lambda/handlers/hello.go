@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"context"
+	"os"
+
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+
+	auth "github.com/atindraraut/crudgo/internal/utils/helpers"
 )
 
 // HelloHandler responds with a simple Hello World message.
@@ -14,7 +18,12 @@ func HelloHandler(ctx context.Context, event events.APIGatewayProxyRequest) (eve
 	}, nil
 }
 
-// Entrypoint for AWS Lambda
+// Entrypoint for AWS Lambda. With JWKS_URL set, only signed-in users get
+// a hello.
 func HelloMain() {
-	lambda.Start(HelloHandler)
+	handler := APIHandler(HelloHandler)
+	if url := os.Getenv("JWKS_URL"); url != "" {
+		handler = Authenticate(auth.NewJWKSVerifier(url), handler)
+	}
+	lambda.Start(handler)
 }
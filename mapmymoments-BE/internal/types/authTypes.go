@@ -1,6 +1,7 @@
 package types
 
 import (
+	"encoding/json"
 	"time"
 	jwt "github.com/dgrijalva/jwt-go"
 )
@@ -16,15 +17,144 @@ type SignedDetails struct {
 	First_name string
 	Last_name  string
 	Uid        string
+	// TokenType is TokenTypeAccess or TokenTypeRefresh. Tokens issued
+	// before it existed have none and are rejected everywhere.
+	TokenType string `json:"typ"`
+	// FamilyID ties a refresh token to the chain of tokens rotated from the
+	// same login, so the whole chain can be revoked at once.
+	FamilyID string `json:"fam,omitempty"`
 	jwt.StandardClaims
 }
+
+// Token types carried in SignedDetails.TokenType
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// RefreshToken is the server-side record of an issued refresh token, keyed
+// by the token's jti. Each refresh uses the token up and issues its
+// successor in the same family; presenting a used token again means it
+// leaked, and the whole family is revoked.
+type RefreshToken struct {
+	ID         string     `bson:"_id" json:"id"`
+	FamilyID   string     `bson:"familyId" json:"familyId"`
+	UserID     string     `bson:"userId" json:"userId"`
+	CreatedAt  time.Time  `bson:"createdAt" json:"createdAt"`
+	ExpiresAt  time.Time  `bson:"expiresAt" json:"expiresAt"`
+	UsedAt     *time.Time `bson:"usedAt,omitempty" json:"usedAt,omitempty"`
+	RevokedAt  *time.Time `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	ReplacedBy string     `bson:"replacedBy,omitempty" json:"replacedBy,omitempty"`
+}
 type OTPRecord struct {
 	Email     string         `bson:"email" json:"email"`
-	OTP       string         `bson:"otp" json:"otp"`
+	OTPHash   string         `bson:"otp_hash" json:"-"` // bcrypt hash of the code
 	ExpiresAt time.Time      `bson:"expires_at" json:"expires_at"`
-	Type      string         `bson:"type" json:"type"` // "signup" or "reset"
-	SignupReq *SignupRequest `bson:"signup_req,omitempty" json:"signup_req,omitempty"` // Only for signup
-	Password  string         `bson:"password,omitempty" json:"password,omitempty"` // Only for signup
+	Type      string         `bson:"type" json:"type"` // one of the OTPType* constants
+	SignupReq *SignupRequest `bson:"signup_req,omitempty" json:"signup_req,omitempty"` // Only for signup, without the password
+	Password  string         `bson:"password,omitempty" json:"password,omitempty"` // Only for signup, hashed
+	// Attempts counts guesses at the current code
+	Attempts int `bson:"attempts" json:"-"`
+	// Sends counts the codes sent since WindowStart, for the send quota.
+	// Storage fills these in.
+	LastSentAt  time.Time `bson:"last_sent_at" json:"-"`
+	WindowStart time.Time `bson:"window_start" json:"-"`
+	Sends       int       `bson:"sends" json:"-"`
+	// PurgeAt is when the record can go: once the code has expired and
+	// the quota window is over
+	PurgeAt time.Time `bson:"purge_at" json:"-"`
+}
+
+// OTP types recorded in OTPRecord.Type
+const (
+	OTPTypeSignup = "signup"
+	OTPTypeReset  = "reset"
+	// OTPTypeLink codes prove the email of a pending link
+	OTPTypeLink = "link"
+	// OTPTypeMagicLink records hold no code; they only count sign-in
+	// link emails against the send quota
+	OTPTypeMagicLink = "magic_link"
+)
+
+// OTPPolicy limits how often codes are sent to an email: one per Cooldown,
+// and at most MaxSends per Window
+type OTPPolicy struct {
+	Cooldown time.Duration
+	Window   time.Duration
+	MaxSends int
+}
+
+// NextSend fills in record's send counters for a send at now following
+// prev, the record it replaces, if any. It returns false and when to try
+// again if the policy doesn't allow the send.
+func (p OTPPolicy) NextSend(record *OTPRecord, prev *OTPRecord, now time.Time) (time.Time, bool) {
+	record.LastSentAt = now
+	record.WindowStart = now
+	record.Sends = 1
+	if prev != nil && prev.PurgeAt.After(now) {
+		retryAt := prev.LastSentAt.Add(p.Cooldown)
+		windowEnd := prev.WindowStart.Add(p.Window)
+		if windowEnd.After(now) {
+			if prev.Sends >= p.MaxSends && windowEnd.After(retryAt) {
+				retryAt = windowEnd
+			}
+			record.WindowStart = prev.WindowStart
+			record.Sends = prev.Sends + 1
+		}
+		if retryAt.After(now) {
+			return retryAt, false
+		}
+	}
+	record.Attempts = 0
+	record.PurgeAt = record.ExpiresAt
+	if end := record.WindowStart.Add(p.Window); end.After(record.PurgeAt) {
+		record.PurgeAt = end
+	}
+	return time.Time{}, true
+}
+
+// LoginThrottle counts recent failed sign-ins for one key: an account
+// ("account:" and the email) or a client ("ip:" and its address)
+type LoginThrottle struct {
+	Key           string     `bson:"_id" json:"-"`
+	Failures      int        `bson:"failures" json:"-"`
+	LastFailureAt time.Time  `bson:"lastFailureAt" json:"-"`
+	LockedUntil   *time.Time `bson:"lockedUntil,omitempty" json:"-"`
+	// UnlockTokenHash is the SHA-256 of the token in the lockout email
+	UnlockTokenHash string    `bson:"unlockTokenHash,omitempty" json:"-"`
+	ExpiresAt       time.Time `bson:"expiresAt" json:"-"`
+}
+
+// Locked says whether sign-ins for the key are refused at now
+func (t LoginThrottle) Locked(now time.Time) bool {
+	return t.LockedUntil != nil && t.LockedUntil.After(now)
+}
+
+// LockoutPolicy locks a key once Threshold sign-ins in a row have failed,
+// for BaseDelay, doubling with each further failure up to MaxDelay. The
+// count starts over after Window without failures, which should be longer
+// than MaxDelay.
+type LockoutPolicy struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Window    time.Duration
+}
+
+// Delay is how long to lock a key for after failures failures, or 0 if it
+// shouldn't be locked yet
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.Threshold; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
 }
 
 type UserData struct {
@@ -32,8 +162,146 @@ type UserData struct {
 	Password  *string // Optional - nil for OAuth-only users
 	FirstName string
 	LastName  string
-	GoogleID  *string // Optional - for Google OAuth users
-	AuthType  string  // "email", "google", or "both"
+	// Identities are the provider accounts (Google, GitHub, ...) that can
+	// sign in as this user, at most one per provider
+	Identities []LinkedIdentity
+	AuthType   string // one of the AuthType* constants
+	// TwoFactor is set once TOTP enrolment starts, and only asked for at
+	// sign in once it is enabled
+	TwoFactor *TwoFactor
+}
+
+// TwoFactorEnabled reports whether signing in needs a second factor
+func (u UserData) TwoFactorEnabled() bool {
+	return u.TwoFactor != nil && u.TwoFactor.Enabled
+}
+
+// TwoFactor is a user's TOTP authenticator
+type TwoFactor struct {
+	Secret  string `bson:"secret"`
+	Enabled bool   `bson:"enabled"`
+	// LastStep is the time step of the last code accepted, so a code
+	// can't be replayed within its window
+	LastStep int64 `bson:"lastStep"`
+	// RecoveryCodes are hashes of the unused recovery codes
+	RecoveryCodes []string   `bson:"recoveryCodes"`
+	EnabledAt     *time.Time `bson:"enabledAt,omitempty"`
+}
+
+// TwoFactorChallenge is a sign in that got past the first factor and is
+// waiting for a TOTP or recovery code. Its ID is the challenge token.
+type TwoFactorChallenge struct {
+	ID         string `bson:"_id"`
+	Email      string `bson:"email"`
+	RedirectTo string `bson:"redirectTo,omitempty"`
+	// Attempts counts codes tried against the challenge
+	Attempts  int       `bson:"attempts"`
+	CreatedAt time.Time `bson:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// WebAuthnCredential is a passkey registered to a user. ID is the
+// credential ID, base64url encoded.
+type WebAuthnCredential struct {
+	ID              string `bson:"_id" json:"id"`
+	UserID          string `bson:"userId" json:"-"` // email
+	PublicKey       []byte `bson:"publicKey" json:"-"`
+	AttestationType string `bson:"attestationType" json:"-"`
+	AAGUID          []byte `bson:"aaguid" json:"-"`
+	// SignCount is the authenticator's signature counter. Synced passkeys
+	// always report 0; for others it only goes up.
+	SignCount  uint32   `bson:"signCount" json:"-"`
+	Transports []string `bson:"transports" json:"transports"`
+	// BackupEligible is set for passkeys that sync between devices
+	BackupEligible bool       `bson:"backupEligible" json:"synced"`
+	Nickname       string     `bson:"nickname" json:"nickname"`
+	CreatedAt      time.Time  `bson:"createdAt" json:"createdAt"`
+	LastUsedAt     *time.Time `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+}
+
+// Passkey ceremonies recorded in WebAuthnSession.Ceremony
+const (
+	WebAuthnRegistration = "registration"
+	WebAuthnLogin        = "login"
+)
+
+// WebAuthnSession is a passkey ceremony in progress: the challenge sent to
+// the browser, waiting for the authenticator's answer
+type WebAuthnSession struct {
+	ID       string `bson:"_id"`
+	Ceremony string `bson:"ceremony"`
+	// Email is who is registering a passkey; logins don't know yet
+	Email string `bson:"email,omitempty"`
+	// Data is the library's session data, JSON encoded
+	Data      []byte    `bson:"data"`
+	CreatedAt time.Time `bson:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// Auth types recorded in UserData.AuthType
+const (
+	AuthTypeEmail = "email" // password only
+	AuthTypeOAuth = "oauth" // identity providers only
+	AuthTypeBoth  = "both"
+)
+
+// AuthTypeFor derives UserData.AuthType from the ways a user can sign in
+func AuthTypeFor(hasPassword bool, identities int) string {
+	switch {
+	case identities == 0:
+		return AuthTypeEmail
+	case !hasPassword:
+		return AuthTypeOAuth
+	default:
+		return AuthTypeBoth
+	}
+}
+
+// Identity returns the user's identity at provider, if linked
+func (u UserData) Identity(provider string) (LinkedIdentity, bool) {
+	for _, identity := range u.Identities {
+		if identity.Provider == provider {
+			return identity, true
+		}
+	}
+	return LinkedIdentity{}, false
+}
+
+// LinkedIdentity is an account at an identity provider. Subject is the
+// provider's stable ID for it; the email may change on their side.
+type LinkedIdentity struct {
+	// Key is IdentityKey(Provider, Subject), unique across all users
+	Key      string    `bson:"key" json:"-"`
+	Provider string    `bson:"provider" json:"provider"`
+	Subject  string    `bson:"subject" json:"-"`
+	Email    string    `bson:"email" json:"email"`
+	LinkedAt time.Time `bson:"linkedAt" json:"linkedAt"`
+}
+
+// IdentityKey names the account subject at provider
+func IdentityKey(provider, subject string) string {
+	return provider + ":" + subject
+}
+
+// NewLinkedIdentity links profile, as signed in at provider
+func NewLinkedIdentity(provider string, profile ProviderProfile) LinkedIdentity {
+	return LinkedIdentity{
+		Key:      IdentityKey(provider, profile.Subject),
+		Provider: provider,
+		Subject:  profile.Subject,
+		Email:    profile.Email,
+		LinkedAt: time.Now(),
+	}
+}
+
+// ProviderProfile is what an identity provider tells us about whoever
+// just signed in with it
+type ProviderProfile struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
 }
 
 type SignupRequest struct {
@@ -43,6 +311,24 @@ type SignupRequest struct {
 	LastName  string `json:"last_name" validate:"required"`
 }
 
+type ResendOTPRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Type  string `json:"type" validate:"required,oneof=signup reset"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=6"`
+}
+
+type SetPasswordRequest struct {
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+type UnlockAccountRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
@@ -52,11 +338,127 @@ type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
-type GoogleOAuthRequest struct {
+// Session is one signed-in device. Its ID doubles as the family ID of the
+// refresh tokens issued to it, so revoking a session ends its token family.
+type Session struct {
+	ID          string     `bson:"_id" json:"id"`
+	UserID      string     `bson:"userId" json:"-"`
+	DeviceLabel string     `bson:"deviceLabel" json:"deviceLabel"`
+	UserAgent   string     `bson:"userAgent" json:"userAgent"`
+	IP          string     `bson:"ip" json:"ip"`
+	CreatedAt   time.Time  `bson:"createdAt" json:"createdAt"`
+	LastUsedAt  time.Time  `bson:"lastUsedAt" json:"lastUsedAt"`
+	ExpiresAt   time.Time  `bson:"expiresAt" json:"expiresAt"`
+	RevokedAt   *time.Time `bson:"revokedAt,omitempty" json:"-"`
+	// Current marks the session making the request in listings
+	Current bool `bson:"-" json:"current"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// OAuthState is kept server-side between handing out a provider's login
+// URL and the callback, keyed by the state parameter. It carries the PKCE
+// verifier, so the code can only be redeemed by whoever started the login,
+// and is deleted the first time it is used.
+type OAuthState struct {
+	ID         string `bson:"_id" json:"-"`
+	Provider   string `bson:"provider" json:"provider"`
+	Verifier   string `bson:"verifier" json:"-"`
+	RedirectTo string `bson:"redirectTo,omitempty" json:"redirectTo,omitempty"`
+	// LinkTo is set when a signed-in user is linking the provider to their
+	// account rather than signing in with it
+	LinkTo    string    `bson:"linkTo,omitempty" json:"-"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
+}
+
+type OAuthCallbackRequest struct {
 	Code  string `json:"code" validate:"required"`
 	State string `json:"state" validate:"required"`
 }
 
+// PendingLink holds a provider identity whose email belongs to an existing
+// account. Nothing is linked until whoever signed in proves they own that
+// account too, with its password or an OTPTypeLink code emailed to it. With NewAccount
+// set there is no account yet: the provider didn't verify the email, so one
+// is only created once the emailed code proves it.
+type PendingLink struct {
+	ID           string         `bson:"_id" json:"-"`
+	Email        string         `bson:"email" json:"email"`
+	Identity     LinkedIdentity `bson:"identity" json:"identity"`
+	NewAccount   bool           `bson:"newAccount,omitempty" json:"newAccount,omitempty"`
+	FirstName    string         `bson:"firstName,omitempty" json:"-"`
+	LastName     string         `bson:"lastName,omitempty" json:"-"`
+	RedirectTo   string         `bson:"redirectTo,omitempty" json:"-"`
+	Failures     int            `bson:"failures" json:"-"`
+	CreatedAt    time.Time      `bson:"createdAt" json:"createdAt"`
+	ExpiresAt    time.Time      `bson:"expiresAt" json:"expiresAt"`
+}
+
+type LinkTokenRequest struct {
+	LinkToken string `json:"link_token" validate:"required"`
+}
+
+// WebAuthnFinishRequest answers a passkey ceremony. Credential is the
+// browser's PublicKeyCredential, JSON encoded.
+type WebAuthnFinishRequest struct {
+	SessionID  string          `json:"session_id" validate:"required"`
+	Credential json.RawMessage `json:"credential" validate:"required"`
+	// Nickname names a new passkey
+	Nickname string `json:"nickname,omitempty" validate:"max=64"`
+}
+
+// TwoFactorCodeRequest carries a code from the user's authenticator app
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// TwoFactorVerifyRequest finishes a sign in with a TOTP code or one of the
+// recovery codes
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code,omitempty" validate:"required_without=RecoveryCode"`
+	RecoveryCode   string `json:"recovery_code,omitempty" validate:"required_without=Code"`
+}
+
+// TwoFactorReauthRequest re-authenticates before 2FA is turned off or its
+// recovery codes replaced: the password, if the account has one, and a
+// TOTP or recovery code
+type TwoFactorReauthRequest struct {
+	Password     string `json:"password,omitempty"`
+	Code         string `json:"code,omitempty" validate:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code,omitempty" validate:"required_without=Code"`
+}
+
+// ConfirmLinkRequest proves ownership of the existing account with either
+// its password or the emailed code
+type ConfirmLinkRequest struct {
+	LinkToken string `json:"link_token" validate:"required"`
+	Password  string `json:"password,omitempty" validate:"required_without=OTP"`
+	OTP       string `json:"otp,omitempty" validate:"required_without=Password"`
+}
+
+// MagicLink is the server-side half of an emailed sign-in link, keyed by
+// the link token's ID. NonceHash binds it to the browser that asked for it.
+type MagicLink struct {
+	ID        string    `bson:"_id" json:"-"`
+	Email     string    `bson:"email" json:"-"`
+	NonceHash string    `bson:"nonceHash" json:"-"`
+	CreatedAt time.Time `bson:"createdAt" json:"-"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"-"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type MagicLinkVerifyRequest struct {
+	Token string `json:"token" validate:"required"`
+	Nonce string `json:"nonce" validate:"required"`
+}
+
 type GoogleUserInfo struct {
 	ID            string `json:"id"`
 	Email         string `json:"email"`
@@ -65,4 +467,22 @@ type GoogleUserInfo struct {
 	GivenName     string `json:"given_name"`
 	FamilyName    string `json:"family_name"`
 	Picture       string `json:"picture"`
-}
\ No newline at end of file
+}
+
+// JWK is a public signing key in JSON Web Key form (RFC 7517). RSA keys
+// carry N and E, Ed25519 keys Crv and X.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
@@ -0,0 +1,112 @@
+package types
+
+// Roles a user can hold on a route. The creator is always RoleOwner; every
+// other role is granted through sharing and stored on SharedUser.Permission.
+const (
+	RoleOwner       = "owner"
+	RoleCoOwner     = "co-owner"
+	RoleEditor      = "editor"
+	RoleContributor = "contributor"
+	RoleViewer      = "viewer"
+
+	// legacyRoleUpload is what collaborators were given before roles
+	// existed. It is read as RoleContributor.
+	legacyRoleUpload = "upload"
+)
+
+// DefaultShareRole is granted by share links that don't name a role.
+const DefaultShareRole = RoleContributor
+
+// RouteAction is something a user may try to do to a route.
+type RouteAction string
+
+const (
+	ActionViewRoute           RouteAction = "view"
+	ActionUploadPhotos        RouteAction = "upload-photos"
+	ActionEditRoute           RouteAction = "edit"
+	ActionChangeVisibility    RouteAction = "change-visibility"
+	ActionManageSharing       RouteAction = "manage-sharing"
+	ActionManageCollaborators RouteAction = "manage-collaborators"
+	ActionRevokeAllSharing    RouteAction = "revoke-all-sharing"
+	ActionTransferOwnership   RouteAction = "transfer-ownership"
+	ActionDeleteRoute         RouteAction = "delete"
+)
+
+// routePermissions is the single source of truth for what each role may do.
+var routePermissions = map[string]map[RouteAction]bool{
+	RoleViewer: {
+		ActionViewRoute: true,
+	},
+	RoleContributor: {
+		ActionViewRoute:    true,
+		ActionUploadPhotos: true,
+	},
+	RoleEditor: {
+		ActionViewRoute:    true,
+		ActionUploadPhotos: true,
+		ActionEditRoute:    true,
+	},
+	RoleCoOwner: {
+		ActionViewRoute:           true,
+		ActionUploadPhotos:        true,
+		ActionEditRoute:           true,
+		ActionChangeVisibility:    true,
+		ActionManageSharing:       true,
+		ActionManageCollaborators: true,
+	},
+	RoleOwner: {
+		ActionViewRoute:           true,
+		ActionUploadPhotos:        true,
+		ActionEditRoute:           true,
+		ActionChangeVisibility:    true,
+		ActionManageSharing:       true,
+		ActionManageCollaborators: true,
+		ActionRevokeAllSharing:    true,
+		ActionTransferOwnership:   true,
+		ActionDeleteRoute:         true,
+	},
+}
+
+// roleRank orders roles so managers can only hand out or change roles
+// strictly below their own.
+var roleRank = map[string]int{
+	RoleViewer:      1,
+	RoleContributor: 2,
+	RoleEditor:      3,
+	RoleCoOwner:     4,
+	RoleOwner:       5,
+}
+
+// NormalizeRole maps legacy permission strings onto the current roles.
+func NormalizeRole(role string) string {
+	if role == legacyRoleUpload {
+		return RoleContributor
+	}
+	return role
+}
+
+// ValidCollaboratorRole reports whether role can be granted to a
+// collaborator. RoleOwner can't; ownership only moves by transfer.
+func ValidCollaboratorRole(role string) bool {
+	switch role {
+	case RoleViewer, RoleContributor, RoleEditor, RoleCoOwner:
+		return true
+	}
+	return false
+}
+
+// RoleCan reports whether role is allowed to perform action.
+func RoleCan(role string, action RouteAction) bool {
+	return routePermissions[NormalizeRole(role)][action]
+}
+
+// CanAssignRole reports whether a user holding actor may grant target, either
+// through a share link or by changing a collaborator's role. The same check
+// applies to the collaborator's current role when changing it, so a co-owner
+// can't demote another co-owner.
+func CanAssignRole(actor, target string) bool {
+	if !RoleCan(actor, ActionManageCollaborators) || !ValidCollaboratorRole(NormalizeRole(target)) {
+		return false
+	}
+	return roleRank[NormalizeRole(target)] < roleRank[NormalizeRole(actor)]
+}
@@ -12,10 +12,67 @@ type Route struct {
 	Photos                []Photo      `json:"photos" bson:"photos"`
 	CreatedAt             int64        `json:"createdAt" bson:"createdAt"`
 	UpdatedAt             int64        `json:"updatedAt" bson:"updatedAt"`
-	IsPublic              bool         `json:"isPublic" bson:"isPublic"`
+	Visibility            string       `json:"visibility" bson:"visibility"` // see Visibility* constants
 	SharedWith            []SharedUser `json:"sharedWith" bson:"sharedWith"`
-	ShareToken            string       `json:"shareToken,omitempty" bson:"shareToken,omitempty"`
-	ShareTokenExpiry      *time.Time   `json:"shareTokenExpiry,omitempty" bson:"shareTokenExpiry,omitempty"`
+	// PendingTransfer is set while ownership is on offer to a collaborator.
+	PendingTransfer *OwnershipTransfer `json:"pendingTransfer,omitempty" bson:"pendingTransfer,omitempty"`
+	// Version is bumped by every write so clients can make conditional
+	// updates via ETag / If-Match.
+	Version int64 `json:"version" bson:"version"`
+}
+
+// Route visibility levels. Private routes are visible to the owner and
+// collaborators only, unlisted routes additionally to anyone holding a share
+// link, and public routes to everyone.
+const (
+	VisibilityPrivate  = "private"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPublic   = "public"
+)
+
+// ValidVisibility reports whether v is one of the Visibility* constants.
+func ValidVisibility(v string) bool {
+	return v == VisibilityPrivate || v == VisibilityUnlisted || v == VisibilityPublic
+}
+
+// PublicRoute is the redacted projection of a Route shown to people who
+// aren't collaborators. It deliberately omits the creator and collaborator
+// emails.
+type PublicRoute struct {
+	ID                    string     `json:"_id"`
+	Name                  string     `json:"name"`
+	Origin                Waypoint   `json:"origin"`
+	Destination           Waypoint   `json:"destination"`
+	IntermediateWaypoints []Waypoint `json:"intermediateWaypoints"`
+	Photos                []Photo    `json:"photos"`
+	CreatedAt             int64      `json:"createdAt"`
+	UpdatedAt             int64      `json:"updatedAt"`
+	Visibility            string     `json:"visibility"`
+	CollaboratorCount     int        `json:"collaboratorCount"`
+	Version               int64      `json:"version"`
+}
+
+// Public returns the redacted projection of r.
+func (r Route) Public() PublicRoute {
+	return PublicRoute{
+		ID:                    r.ID,
+		Name:                  r.Name,
+		Origin:                r.Origin,
+		Destination:           r.Destination,
+		IntermediateWaypoints: r.IntermediateWaypoints,
+		Photos:                r.Photos,
+		CreatedAt:             r.CreatedAt,
+		UpdatedAt:             r.UpdatedAt,
+		Visibility:            r.Visibility,
+		CollaboratorCount:     len(r.SharedWith),
+		Version:               r.Version,
+	}
+}
+
+// PublicRoutePage is a page of redacted routes.
+type PublicRoutePage struct {
+	Routes     []PublicRoute `json:"routes"`
+	NextCursor string        `json:"nextCursor,omitempty"`
 }
 
 type Waypoint struct {
@@ -34,10 +91,26 @@ type Photo struct {
 type SharedUser struct {
 	UserID     string    `json:"userId" bson:"userId"`
 	Email      string    `json:"email" bson:"email"`
-	Permission string    `json:"permission" bson:"permission"` // "upload" for now
+	Permission string    `json:"permission" bson:"permission"` // one of the Role* constants
 	SharedAt   time.Time `json:"sharedAt" bson:"sharedAt"`
 }
 
+// OwnershipTransfer offers a route to one of its collaborators. Nothing
+// changes until they accept; the previous owner then stays on as a co-owner
+// if KeepAccess is set.
+type OwnershipTransfer struct {
+	From       string    `json:"from" bson:"from"`
+	To         string    `json:"to" bson:"to"`
+	KeepAccess bool      `json:"keepAccess" bson:"keepAccess"`
+	CreatedAt  time.Time `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+type TransferOwnershipRequest struct {
+	UserID     string `json:"userId" validate:"required"`
+	KeepAccess *bool  `json:"keepAccess,omitempty"` // defaults to true
+}
+
 type RouteShare struct {
 	UserID     string    `json:"userId" bson:"userId"`
 	RouteID    string    `json:"routeId" bson:"routeId"`
@@ -45,11 +118,139 @@ type RouteShare struct {
 	SharedAt   time.Time `json:"sharedAt" bson:"sharedAt"`
 }
 
-type ShareRouteRequest struct {
-	ExpiryHours *int `json:"expiryHours,omitempty"` // Optional expiry in hours
+type VisibilityRequest struct {
+	Visibility string `json:"visibility" validate:"required,oneof=private unlisted public"`
 }
 
+// ShareLink is one of possibly several invite links for a route. Each link
+// grants its own role and can be limited in time and number of joins.
+type ShareLink struct {
+	ID         string     `json:"id" bson:"_id"`
+	RouteID    string     `json:"routeId" bson:"routeId"`
+	Token      string     `json:"token" bson:"token"`
+	Label      string     `json:"label,omitempty" bson:"label,omitempty"`
+	Role       string     `json:"role" bson:"role"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty" bson:"expiresAt"`
+	MaxJoins   int        `json:"maxJoins,omitempty" bson:"maxJoins"` // 0 means unlimited
+	JoinCount  int        `json:"joinCount" bson:"joinCount"`
+	CreatedBy  string     `json:"createdBy" bson:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt" bson:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+	// Protected links need their passphrase (bcrypt-hashed) before they can
+	// be previewed or joined. Wrong guesses are counted per link and lock it
+	// for a while once they pile up.
+	Protected      bool       `json:"protected" bson:"protected"`
+	PassphraseHash string     `json:"-" bson:"passphraseHash,omitempty"`
+	FailedAttempts int        `json:"-" bson:"failedAttempts"`
+	LockedUntil    *time.Time `json:"-" bson:"lockedUntil,omitempty"`
+	// RequireApproval turns joining into a request the route's managers
+	// approve or reject. Only approved joins count towards MaxJoins.
+	RequireApproval bool `json:"requireApproval" bson:"requireApproval"`
+}
+
+type ShareLinkRequest struct {
+	Label       string `json:"label,omitempty" validate:"max=100"`
+	Role        string `json:"role,omitempty" validate:"omitempty,oneof=viewer contributor editor co-owner"`
+	ExpiryHours *int   `json:"expiryHours,omitempty" validate:"omitempty,min=1,max=720"` // Optional expiry in hours, up to 30 days
+	MaxJoins    int    `json:"maxJoins,omitempty" validate:"min=0"`
+	Passphrase  string `json:"passphrase,omitempty" validate:"omitempty,min=4,max=72"`
+	// RequireApproval makes people who open the link ask to join
+	RequireApproval bool `json:"requireApproval,omitempty"`
+}
+
+// ShareRouteResponse is what POST /api/routes/{id}/share returns
 type ShareRouteResponse struct {
 	ShareToken string     `json:"shareToken"`
 	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
 }
+
+type UnlockShareLinkRequest struct {
+	Passphrase string `json:"passphrase" validate:"required"`
+}
+
+type ShareAccessGrant struct {
+	Grant     string    `json:"grant"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type CollaboratorRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=viewer contributor editor co-owner"`
+}
+
+// RouteListOptions controls filtering, sorting and cursor pagination for
+// route listings. Zero values mean "no filter" / defaults.
+type RouteListOptions struct {
+	Limit         int
+	Cursor        string
+	SortBy        string // "createdAt" (default), "updatedAt" or "name"
+	SortAsc       bool   // newest/Z first unless set
+	CreatorID     string
+	Visibility    string
+	CreatedAfter  int64 // unix millis, inclusive
+	CreatedBefore int64 // unix millis, exclusive
+	HasPhotos     *bool
+}
+
+// RoutePage is one page of a route listing. NextCursor is empty on the last
+// page.
+type RoutePage struct {
+	Routes     []Route `json:"routes"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+// Invitation statuses. Expired invitations keep the pending status in
+// storage; ExpiresAt decides whether they can still be answered.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+)
+
+// Invitation asks a specific email address to collaborate on a route with
+// a given role. Addresses without an account can be invited too; the
+// invitation is picked up when they sign up.
+type Invitation struct {
+	ID          string     `json:"id" bson:"_id"`
+	RouteID     string     `json:"routeId" bson:"routeId"`
+	RouteName   string     `json:"routeName" bson:"routeName"`
+	Email       string     `json:"email" bson:"email"`
+	Role        string     `json:"role" bson:"role"`
+	InvitedBy   string     `json:"invitedBy" bson:"invitedBy"`
+	Status      string     `json:"status" bson:"status"`
+	CreatedAt   time.Time  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt   time.Time  `json:"expiresAt" bson:"expiresAt"`
+	RespondedAt *time.Time `json:"respondedAt,omitempty" bson:"respondedAt,omitempty"`
+}
+
+// Join request statuses
+const (
+	JoinRequestPending  = "pending"
+	JoinRequestApproved = "approved"
+	JoinRequestRejected = "rejected"
+	// JoinRequestCancelled is set when the link the request came through is
+	// revoked or rotated before anyone decided on it.
+	JoinRequestCancelled = "cancelled"
+)
+
+// JoinRequest is created when someone opens a share link that requires
+// approval. It grants nothing until a manager approves it, at which point
+// the requester is added with the link's role.
+type JoinRequest struct {
+	ID        string     `json:"id" bson:"_id"`
+	RouteID   string     `json:"routeId" bson:"routeId"`
+	RouteName string     `json:"routeName" bson:"routeName"`
+	LinkID    string     `json:"linkId" bson:"linkId"`
+	UserID    string     `json:"userId" bson:"userId"`
+	Email     string     `json:"email" bson:"email"`
+	Role      string     `json:"role" bson:"role"`
+	Status    string     `json:"status" bson:"status"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt"`
+	DecidedAt *time.Time `json:"decidedAt,omitempty" bson:"decidedAt,omitempty"`
+	DecidedBy string     `json:"decidedBy,omitempty" bson:"decidedBy,omitempty"`
+}
+
+type InvitationRequest struct {
+	Email       string `json:"email" validate:"required,email"`
+	Role        string `json:"role,omitempty" validate:"omitempty,oneof=viewer contributor editor co-owner"`
+	ExpiryHours *int   `json:"expiryHours,omitempty" validate:"omitempty,min=1,max=720"`
+}
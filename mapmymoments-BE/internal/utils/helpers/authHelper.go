@@ -1,65 +1,82 @@
 package auth
 
 import (
-	"context"
 	cryptoRand "crypto/rand"
 	"encoding/base64"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"log/slog"
-	"math/rand"
-	"net/http"
-	"os"
+	"math/big"
 	"time"
 
 	"github.com/atindraraut/crudgo/internal/types"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ses"
 	"github.com/dgrijalva/jwt-go"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 )
 
-var SECRET_KEY string = os.Getenv("SECRET_KEY")
+// SECRET_KEY is the shared secret from config. It signs tokens only when
+// no asymmetric keys are configured; see InitSigningKeys.
+var SECRET_KEY string
 
-func GenerateAllTokens(email, first_name, last_name, uid string) (string, string, error) {
+const (
+	accessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long a refresh token, and so a login, lasts
+	// without being used
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// GenerateAccessToken issues a short-lived access token. familyId names the
+// login it belongs to.
+func GenerateAccessToken(email, first_name, last_name, uid, familyId string) (string, error) {
 	claims := &types.SignedDetails{
 		Email:      email,
 		First_name: first_name,
 		Last_name:  last_name,
 		Uid:        uid,
+		TokenType:  types.TokenTypeAccess,
+		FamilyID:   familyId,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Minute * 15).Unix(),
+			ExpiresAt: time.Now().Add(accessTokenTTL).Unix(),
 		},
 	}
-	refreshClaims := &types.SignedDetails{
-		Email:      email,
-		First_name: first_name,
-		Last_name:  last_name,
-		Uid:        uid,
+	return signingKeys().Sign(claims)
+}
+
+// GenerateRefreshToken issues a refresh token in the given family. The
+// caller must store a RefreshToken record under the returned claims' Id,
+// otherwise the token is refused when used.
+func GenerateRefreshToken(email, familyId string) (string, *types.SignedDetails, error) {
+	jti, err := NewTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	claims := &types.SignedDetails{
+		Email:     email,
+		Uid:       email,
+		TokenType: types.TokenTypeRefresh,
+		FamilyID:  familyId,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 24 * 7).Unix(),
+			Id:        jti,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(RefreshTokenTTL).Unix(),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	signedToken, err := token.SignedString([]byte(SECRET_KEY))
+	signed, err := signingKeys().Sign(claims)
 	if err != nil {
-		return "", "", err
+		return "", nil, err
 	}
-	signedRefreshToken, err := refreshToken.SignedString([]byte(SECRET_KEY))
-	if err != nil {
-		return "", "", err
+	return signed, claims, nil
+}
+
+// NewTokenID returns a random identifier for token IDs and token families
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := cryptoRand.Read(b); err != nil {
+		return "", err
 	}
-	return signedToken, signedRefreshToken, nil
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
 func VerifyToken(tokenStr string) (details *types.SignedDetails, msg string) {
-	token, err := jwt.ParseWithClaims(tokenStr, &types.SignedDetails{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(SECRET_KEY), nil
-	})
+	token, err := signingKeys().Parse(tokenStr, &types.SignedDetails{})
 	if err != nil {
 		return nil, err.Error()
 	}
@@ -70,18 +87,30 @@ func VerifyToken(tokenStr string) (details *types.SignedDetails, msg string) {
 	return claims, "nil"
 }
 
-// SendEmailOTP sends a beautiful HTML email with a copyable OTP for your travel app
-func SendEmailOTP(email, otp string) error {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("us-east-1"), // Replace with your AWS region
-	})
-	if err != nil {
-		slog.Error("Failed to create AWS session", "error", err.Error())
-		return err
-	}
+// VerifyAccessToken is VerifyToken restricted to access tokens, so a
+// refresh token can't be used to call the API
+func VerifyAccessToken(tokenStr string) (details *types.SignedDetails, msg string) {
+	return verifyTokenType(tokenStr, types.TokenTypeAccess)
+}
 
-	svc := ses.New(sess)
+// VerifyRefreshToken is VerifyToken restricted to refresh tokens
+func VerifyRefreshToken(tokenStr string) (details *types.SignedDetails, msg string) {
+	return verifyTokenType(tokenStr, types.TokenTypeRefresh)
+}
+
+func verifyTokenType(tokenStr, tokenType string) (*types.SignedDetails, string) {
+	details, msg := VerifyToken(tokenStr)
+	if msg != "nil" {
+		return nil, msg
+	}
+	if details.TokenType != tokenType {
+		return nil, "wrong token type"
+	}
+	return details, "nil"
+}
 
+// SendEmailOTP sends a beautiful HTML email with a copyable OTP for your travel app
+func SendEmailOTP(email, otp string) error {
 	subject := "Your MapMyMoments OTP Code"
 	htmlBody := `
 <!DOCTYPE html>
@@ -118,49 +147,11 @@ func SendEmailOTP(email, otp string) error {
 </html>
 `
 
-	input := &ses.SendEmailInput{
-		Destination: &ses.Destination{
-			ToAddresses: []*string{
-				aws.String(email),
-			},
-		},
-		Message: &ses.Message{
-			Body: &ses.Body{
-				Html: &ses.Content{
-					Charset: aws.String("UTF-8"),
-					Data:    aws.String(htmlBody),
-				},
-			},
-			Subject: &ses.Content{
-				Charset: aws.String("UTF-8"),
-				Data:    aws.String(subject),
-			},
-		},
-		Source: aws.String("hello@mapmymoments.in"), // Replace with your verified SES email
-	}
-
-	_, err = svc.SendEmail(input)
-	if err != nil {
-		slog.Error("Failed to send email", "error", err.Error())
-		return err
-	}
-
-	slog.Info("Email sent successfully")
-	return nil
+	return sendEmail(email, subject, htmlBody)
 }
 
 // SendResetPasswordEmail sends a reset password OTP email with a distinct template
 func SendResetPasswordEmail(email, otp string) error {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("us-east-1"),
-	})
-	if err != nil {
-		slog.Error("Failed to create AWS session", "error", err.Error())
-		return err
-	}
-
-	svc := ses.New(sess)
-
 	subject := "Reset your MapMyMoments password"
 	htmlBody := `
 <!DOCTYPE html>
@@ -197,60 +188,18 @@ func SendResetPasswordEmail(email, otp string) error {
 </html>
 `
 
-	input := &ses.SendEmailInput{
-		Destination: &ses.Destination{
-			ToAddresses: []*string{
-				aws.String(email),
-			},
-		},
-		Message: &ses.Message{
-			Body: &ses.Body{
-				Html: &ses.Content{
-					Charset: aws.String("UTF-8"),
-					Data:    aws.String(htmlBody),
-				},
-			},
-			Subject: &ses.Content{
-				Charset: aws.String("UTF-8"),
-				Data:    aws.String(subject),
-			},
-		},
-		Source: aws.String("hello@mapmymoments.in"),
-	}
-
-	_, err = svc.SendEmail(input)
-	if err != nil {
-		slog.Error("Failed to send reset password email", "error", err.Error())
-		return err
-	}
-
-	slog.Info("Reset password email sent successfully")
-	return nil
-}
-
-func GenerateOTP() string {
-	return fmt.Sprintf("%06d", rand.Intn(1000000))
+	return sendEmail(email, subject, htmlBody)
 }
 
-
-// OAuth configuration - will be initialized with config values
-var googleOAuthConfig *oauth2.Config
-
-// InitOAuthConfig initializes OAuth configuration with config values
-func InitOAuthConfig(clientID, clientSecret, redirectURL string) {
-	googleOAuthConfig = &oauth2.Config{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		RedirectURL:  redirectURL,
-		Scopes:       []string{"email", "profile"},
-		Endpoint:     google.Endpoint,
+// GenerateOTP returns a random six-digit code
+func GenerateOTP() (string, error) {
+	n, err := cryptoRand.Int(cryptoRand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
 	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
 }
 
-// GenerateGoogleOAuthURL generates Google OAuth authorization URL
-func GenerateGoogleOAuthURL(state string) string {
-	return googleOAuthConfig.AuthCodeURL(state)
-}
 
 // GenerateRandomState generates a random state for OAuth flow
 func GenerateRandomState() (string, error) {
@@ -261,30 +210,3 @@ func GenerateRandomState() (string, error) {
 	}
 	return base64.URLEncoding.EncodeToString(b), nil
 }
-
-// ExchangeCodeForTokens exchanges authorization code for access token
-func ExchangeCodeForTokens(code string) (*oauth2.Token, error) {
-	return googleOAuthConfig.Exchange(context.Background(), code)
-}
-
-// GetGoogleUserInfo retrieves user info from Google API
-func GetGoogleUserInfo(token *oauth2.Token) (*types.GoogleUserInfo, error) {
-	client := googleOAuthConfig.Client(context.Background(), token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v1/userinfo")
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("failed to get user info from Google")
-	}
-
-	var userInfo types.GoogleUserInfo
-	err = json.NewDecoder(resp.Body).Decode(&userInfo)
-	if err != nil {
-		return nil, err
-	}
-
-	return &userInfo, nil
-}
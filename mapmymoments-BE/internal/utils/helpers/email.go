@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ses"
+)
+
+// emailSender is the verified SES address emails are sent from
+const emailSender = "hello@mapmymoments.in"
+
+// sendEmail sends an HTML email through SES
+func sendEmail(to, subject, html string) error {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+	if err != nil {
+		slog.Error("Failed to create AWS session", "error", err.Error())
+		return err
+	}
+
+	input := &ses.SendEmailInput{
+		Destination: &ses.Destination{
+			ToAddresses: []*string{
+				aws.String(to),
+			},
+		},
+		Message: &ses.Message{
+			Body: &ses.Body{
+				Html: &ses.Content{
+					Charset: aws.String("UTF-8"),
+					Data:    aws.String(html),
+				},
+			},
+			Subject: &ses.Content{
+				Charset: aws.String("UTF-8"),
+				Data:    aws.String(subject),
+			},
+		},
+		Source: aws.String(emailSender),
+	}
+
+	if _, err := ses.New(sess).SendEmail(input); err != nil {
+		slog.Error("Failed to send email", "subject", subject, "error", err.Error())
+		return err
+	}
+
+	slog.Info("Email sent successfully", "subject", subject)
+	return nil
+}
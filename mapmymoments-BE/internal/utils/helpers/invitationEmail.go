@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// frontendURL is where links in outgoing emails point.
+var frontendURL = "https://mapmymoments.in"
+
+// InitFrontendURL sets the base URL used for links in outgoing emails
+func InitFrontendURL(url string) {
+	if url != "" {
+		frontendURL = strings.TrimRight(url, "/")
+	}
+}
+
+// FrontendURL is the frontend's base URL, without a trailing slash
+func FrontendURL() string {
+	return frontendURL
+}
+
+// SendInvitationEmail tells email that inviter has invited them to a route
+func SendInvitationEmail(email, inviter, routeName, role string) error {
+	link := frontendURL + "/invitations"
+	subject := "You've been invited to a MapMyMoments route"
+	htmlBody := `
+<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="UTF-8">
+  <title>Route Invitation</title>
+  <style>
+    body { background: #f8fafc; font-family: 'Segoe UI', Arial, sans-serif; margin: 0; padding: 0; }
+    .container { max-width: 420px; margin: 48px auto; background: #fff; border-radius: 10px; box-shadow: 0 2px 12px #0001; padding: 32px 28px; border: 1px solid #e5e7eb; }
+    .logo { text-align: center; margin-bottom: 18px; }
+    .logo img { width: 40px; }
+    .title { color: #1e293b; font-size: 1.35rem; font-weight: 600; text-align: center; margin-bottom: 6px; letter-spacing: 0.01em; }
+    .subtitle { color: #475569; text-align: center; margin-bottom: 22px; font-size: 1rem; font-weight: 400; }
+    .button { display: block; width: fit-content; margin: 0 auto 12px; background: #0f172a; color: #fff !important; text-decoration: none; border-radius: 6px; padding: 12px 24px; font-weight: 600; }
+    .footer { color: #64748b; font-size: 0.95rem; text-align: center; margin-top: 28px; border-top: 1px solid #e5e7eb; padding-top: 18px; }
+  </style>
+</head>
+<body>
+  <div class="container">
+    <div class="logo">
+      <img src="https://i.imgur.com/2yaf2wb.png" alt="MapMyMoments Logo" />
+    </div>
+    <div class="title">Join ` + html.EscapeString(routeName) + `</div>
+    <div class="subtitle">` + html.EscapeString(inviter) + ` invited you to collaborate as ` + html.EscapeString(role) + `.</div>
+    <a class="button" href="` + link + `">View invitation</a>
+    <div class="footer">
+      Sign in or create an account with this email address to accept.<br>
+      If you weren't expecting this, you can safely ignore this email.<br><br>
+      &copy; ` + fmt.Sprint(time.Now().Year()) + ` MapMyMoments
+    </div>
+  </div>
+</body>
+</html>
+`
+
+	return sendEmail(email, subject, htmlBody)
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	jwksCacheTTL = time.Hour
+	// jwksMinRefresh stops tokens with made-up kids from making us fetch the
+	// key set on every request
+	jwksMinRefresh = time.Minute
+)
+
+// JWKSVerifier verifies tokens against a published key set: ours at
+// /.well-known/jwks.json, for services that don't hold any of our keys, or
+// an identity provider's. Keys are cached and refetched hourly, or sooner
+// when a token names a key we haven't seen, which is how a rotation
+// reaches it.
+type JWKSVerifier struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*signingKey
+	fetchedAt time.Time
+}
+
+// NewJWKSVerifier returns a verifier for the key set at url
+func NewJWKSVerifier(url string) *JWKSVerifier {
+	return &JWKSVerifier{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// VerifyAccessToken checks tokenStr's signature and expiry and that it is
+// an access token
+func (v *JWKSVerifier) VerifyAccessToken(tokenStr string) (*types.SignedDetails, error) {
+	claims := &types.SignedDetails{}
+	if err := v.Verify(tokenStr, claims); err != nil {
+		return nil, err
+	}
+	if claims.TokenType != types.TokenTypeAccess {
+		return nil, errors.New("wrong token type")
+	}
+	return claims, nil
+}
+
+// Verify checks tokenStr's signature and standard claims and decodes it
+// into claims
+func (v *JWKSVerifier) Verify(tokenStr string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenStr, claims, v.keyFunc)
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+func (v *JWKSVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no key id")
+	}
+	key, err := v.key(kid)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.public, nil
+}
+
+func (v *JWKSVerifier) key(kid string) (*signingKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	age := time.Since(v.fetchedAt)
+	key, ok := v.keys[kid]
+	if (!ok && age > jwksMinRefresh) || age > jwksCacheTTL {
+		if err := v.refreshLocked(); err != nil {
+			// Keep using what we have if the key set can't be reached
+			if !ok {
+				return nil, err
+			}
+			return key, nil
+		}
+		key, ok = v.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (v *JWKSVerifier) refreshLocked() error {
+	// Count failed fetches too, so an outage isn't hammered
+	v.fetchedAt = time.Now()
+	resp, err := v.client.Get(v.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: %s", v.url, resp.Status)
+	}
+
+	var set types.JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+	keys := map[string]*signingKey{}
+	for _, jwk := range set.Keys {
+		key, err := fromJWK(jwk)
+		if err != nil {
+			// Skip keys we can't use rather than failing the whole set
+			continue
+		}
+		keys[key.id] = key
+	}
+	v.keys = keys
+	return nil
+}
@@ -0,0 +1,315 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+
+	"github.com/atindraraut/crudgo/internal/config"
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// SigningMethodEdDSA signs tokens with Ed25519 keys. jwt-go v3 predates
+// EdDSA, so it is registered here under the "EdDSA" alg name.
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+type signingMethodEdDSA struct{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey // nil for keys that only verify
+	public  crypto.PublicKey
+}
+
+// KeyManager signs tokens with the current key and verifies them against
+// every configured key, picked by the token's kid header. Keys are rotated
+// by putting a new key first in the config and keeping the old one after
+// it until the tokens it signed have expired.
+//
+// Without asymmetric keys it falls back to HS256 with the shared secret,
+// which is also how tokens from before the switch are verified.
+type KeyManager struct {
+	current *signingKey
+	keys    map[string]*signingKey
+	order   []string
+	secret  []byte // HS256 secret, nil once HS256 tokens are refused
+}
+
+// NewKeyManager loads keys from their PEM files. The first key signs; an
+// empty keys list means HS256 with secret.
+func NewKeyManager(secret string, keys []config.JWTKey, acceptHS256 bool) (*KeyManager, error) {
+	km := &KeyManager{keys: map[string]*signingKey{}}
+	if len(keys) == 0 || acceptHS256 {
+		if secret == "" {
+			return nil, errors.New("a secret key is needed to sign or verify HS256 tokens")
+		}
+		km.secret = []byte(secret)
+	}
+	for i, cfg := range keys {
+		key, err := loadSigningKey(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", cfg.ID, err)
+		}
+		if _, dup := km.keys[key.id]; dup {
+			return nil, fmt.Errorf("jwt key %q is configured twice", key.id)
+		}
+		if i == 0 {
+			if key.private == nil {
+				return nil, fmt.Errorf("jwt key %q signs tokens and needs a private key", key.id)
+			}
+			km.current = key
+		}
+		km.keys[key.id] = key
+		km.order = append(km.order, key.id)
+	}
+	return km, nil
+}
+
+func loadSigningKey(cfg config.JWTKey) (*signingKey, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("missing id")
+	}
+	key := &signingKey{id: cfg.ID}
+	switch cfg.Algorithm {
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+	case "EdDSA":
+		key.method = SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", cfg.Algorithm)
+	}
+
+	switch {
+	case cfg.PrivateKeyFile != "":
+		block, err := readPEM(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		private, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		key.private = private
+		key.public = private.(crypto.Signer).Public()
+	case cfg.PublicKeyFile != "":
+		block, err := readPEM(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		public, err := parsePublicKey(block)
+		if err != nil {
+			return nil, err
+		}
+		key.public = public
+	default:
+		return nil, errors.New("needs a private_key_file or public_key_file")
+	}
+
+	switch key.public.(type) {
+	case *rsa.PublicKey:
+		if key.method != jwt.SigningMethodRS256 {
+			return nil, errors.New("RSA key configured for " + cfg.Algorithm)
+		}
+	case ed25519.PublicKey:
+		if key.method != SigningMethodEdDSA {
+			return nil, errors.New("Ed25519 key configured for " + cfg.Algorithm)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key.public)
+	}
+	return key, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM encoded", path)
+	}
+	return block, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("private key must be PKCS#8 or PKCS#1")
+}
+
+func parsePublicKey(block *pem.Block) (crypto.PublicKey, error) {
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("public key must be PKIX or PKCS#1")
+}
+
+// Sign signs claims with the current key and names it in the kid header
+func (km *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	if km.current == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(km.secret)
+	}
+	token := jwt.NewWithClaims(km.current.method, claims)
+	token.Header["kid"] = km.current.id
+	return token.SignedString(km.current.private)
+}
+
+// Parse verifies tokenStr and decodes it into claims
+func (km *KeyManager) Parse(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenStr, claims, km.keyFunc)
+}
+
+func (km *KeyManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		// HS256 tokens have no kid. Checking the method matters: otherwise
+		// a token "signed" with a public key as HMAC secret would pass.
+		if km.secret == nil || token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("token has no key id")
+		}
+		return km.secret, nil
+	}
+	key, ok := km.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.public, nil
+}
+
+// JWKS returns the public halves of all asymmetric keys, current first
+func (km *KeyManager) JWKS() types.JWKSet {
+	set := types.JWKSet{Keys: []types.JWK{}}
+	for _, id := range km.order {
+		set.Keys = append(set.Keys, toJWK(km.keys[id]))
+	}
+	return set
+}
+
+func toJWK(key *signingKey) types.JWK {
+	jwk := types.JWK{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+// fromJWK is the inverse of toJWK, for verifiers reading a published set
+func fromJWK(jwk types.JWK) (*signingKey, error) {
+	key := &signingKey{id: jwk.Kid}
+	switch {
+	case jwk.Kty == "RSA" && jwk.Alg == "RS256":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		key.method = jwt.SigningMethodRS256
+		key.public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case jwk.Kty == "OKP" && jwk.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("bad Ed25519 key size")
+		}
+		key.method = SigningMethodEdDSA
+		key.public = ed25519.PublicKey(x)
+	default:
+		return nil, fmt.Errorf("unsupported key type %s/%s", jwk.Kty, jwk.Alg)
+	}
+	return key, nil
+}
+
+var keyManager *KeyManager
+
+// InitSigningKeys sets up token signing from config. Until it is called
+// tokens are HS256-signed with SECRET_KEY.
+func InitSigningKeys(secret string, keys []config.JWTKey, acceptHS256 bool) error {
+	km, err := NewKeyManager(secret, keys, acceptHS256)
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 && acceptHS256 {
+		slog.Warn("HS256 tokens are still accepted alongside jwt_keys; anyone with the secret key can sign in as any user. Turn off jwt_accept_hs256 once tokens from before the switch have expired")
+	}
+	SECRET_KEY = secret
+	keyManager = km
+	return nil
+}
+
+func signingKeys() *KeyManager {
+	if keyManager != nil {
+		return keyManager
+	}
+	return &KeyManager{keys: map[string]*signingKey{}, secret: []byte(SECRET_KEY)}
+}
+
+// PublicKeys is the key set other services verify our tokens with
+func PublicKeys() types.JWKSet {
+	return signingKeys().JWKS()
+}
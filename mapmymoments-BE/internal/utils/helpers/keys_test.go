@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/config"
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func writeKey(t *testing.T, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testKeys(t *testing.T) (rsaKey, edKey config.JWTKey) {
+	t.Helper()
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config.JWTKey{ID: "rsa-1", Algorithm: "RS256", PrivateKeyFile: writeKey(t, rsaPrivate)},
+		config.JWTKey{ID: "ed-1", Algorithm: "EdDSA", PrivateKeyFile: writeKey(t, edPrivate)}
+}
+
+func accessClaims() *types.SignedDetails {
+	return &types.SignedDetails{
+		Email:     "user@example.com",
+		Uid:       "user@example.com",
+		TokenType: types.TokenTypeAccess,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		},
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	rsaKey, edKey := testKeys(t)
+
+	before, err := NewKeyManager("secret", []config.JWTKey{rsaKey}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaToken, err := before.Sign(accessClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims()).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate: the Ed25519 key signs, the RSA key only verifies
+	after, err := NewKeyManager("secret", []config.JWTKey{edKey, rsaKey}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edToken, err := after.Sign(accessClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tokenStr := range map[string]string{"current": edToken, "previous": rsaToken} {
+		if _, err := after.Parse(tokenStr, &types.SignedDetails{}); err != nil {
+			t.Errorf("%s key: %v", name, err)
+		}
+	}
+	if _, err := after.Parse(legacyToken, &types.SignedDetails{}); err == nil {
+		t.Error("HS256 token accepted after HS256 was turned off")
+	}
+	if _, err := before.Parse(legacyToken, &types.SignedDetails{}); err != nil {
+		t.Errorf("HS256 token during migration: %v", err)
+	}
+
+	// Once the RSA key is dropped its tokens stop working
+	dropped, err := NewKeyManager("", []config.JWTKey{edKey}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dropped.Parse(rsaToken, &types.SignedDetails{}); err == nil {
+		t.Error("token signed with a removed key accepted")
+	}
+
+	set := after.JWKS()
+	if len(set.Keys) != 2 || set.Keys[0].Kid != "ed-1" || set.Keys[0].Kty != "OKP" || set.Keys[1].Kty != "RSA" {
+		t.Errorf("unexpected key set %+v", set)
+	}
+}
+
+func TestKeyManagerRejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, _ := testKeys(t)
+	km, err := NewKeyManager("secret", []config.JWTKey{rsaKey}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(km.current.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An HMAC token keyed with the published RSA key, naming that key
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims())
+	forged.Header["kid"] = rsaKey.ID
+	tokenStr, err := forged.SignedString(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := km.Parse(tokenStr, &types.SignedDetails{}); err == nil {
+		t.Fatal("HS256 token accepted for an RS256 key")
+	}
+}
+
+func TestJWKSVerifier(t *testing.T) {
+	rsaKey, edKey := testKeys(t)
+	km, err := NewKeyManager("", []config.JWTKey{rsaKey}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(km.JWKS())
+	}))
+	defer server.Close()
+
+	verifier := NewJWKSVerifier(server.URL)
+	tokenStr, _ := km.Sign(accessClaims())
+	claims, err := verifier.VerifyAccessToken(tokenStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Email != "user@example.com" {
+		t.Errorf("got email %q", claims.Email)
+	}
+
+	refresh := accessClaims()
+	refresh.TokenType = types.TokenTypeRefresh
+	refreshStr, _ := km.Sign(refresh)
+	if _, err := verifier.VerifyAccessToken(refreshStr); err == nil {
+		t.Error("refresh token accepted as an access token")
+	}
+
+	// A rotated-in key is fetched on first sight
+	km, err = NewKeyManager("", []config.JWTKey{edKey, rsaKey}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier.fetchedAt = time.Now().Add(-2 * jwksMinRefresh)
+	tokenStr, _ = km.Sign(accessClaims())
+	if _, err := verifier.VerifyAccessToken(tokenStr); err != nil {
+		t.Fatalf("token from rotated key: %v", err)
+	}
+	if fetches != 2 {
+		t.Errorf("fetched the key set %d times, want 2", fetches)
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"fmt"
+	"html"
+	"time"
+)
+
+// SendAccountLockedEmail tells email that sign-ins to their account are
+// paused until until, with a link that lifts the lock
+func SendAccountLockedEmail(email, unlockLink string, until time.Time) error {
+	subject := "Sign-ins to your MapMyMoments account are paused"
+	htmlBody := `
+<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="UTF-8">
+  <title>Account Locked</title>
+  <style>
+    body { background: #f8fafc; font-family: 'Segoe UI', Arial, sans-serif; margin: 0; padding: 0; }
+    .container { max-width: 420px; margin: 48px auto; background: #fff; border-radius: 10px; box-shadow: 0 2px 12px #0001; padding: 32px 28px; border: 1px solid #e5e7eb; }
+    .logo { text-align: center; margin-bottom: 18px; }
+    .logo img { width: 40px; }
+    .title { color: #1e293b; font-size: 1.35rem; font-weight: 600; text-align: center; margin-bottom: 6px; letter-spacing: 0.01em; }
+    .subtitle { color: #475569; text-align: center; margin-bottom: 22px; font-size: 1rem; font-weight: 400; }
+    .button { display: block; width: fit-content; margin: 0 auto 12px; background: #0f172a; color: #fff !important; text-decoration: none; border-radius: 6px; padding: 12px 24px; font-weight: 600; }
+    .footer { color: #64748b; font-size: 0.95rem; text-align: center; margin-top: 28px; border-top: 1px solid #e5e7eb; padding-top: 18px; }
+  </style>
+</head>
+<body>
+  <div class="container">
+    <div class="logo">
+      <img src="https://i.imgur.com/2yaf2wb.png" alt="MapMyMoments Logo" />
+    </div>
+    <div class="title">Too many failed sign-ins</div>
+    <div class="subtitle">Someone entered the wrong password for your account several times, so sign-ins are paused until ` + html.EscapeString(until.UTC().Format("15:04 MST, Jan 2")) + `.</div>
+    <a class="button" href="` + html.EscapeString(unlockLink) + `">It was me, unlock my account</a>
+    <div class="footer">
+      If it wasn't you, your password is still safe, but consider changing it.<br><br>
+      &copy; ` + fmt.Sprint(time.Now().Year()) + ` MapMyMoments
+    </div>
+  </div>
+</body>
+</html>
+`
+
+	return sendEmail(email, subject, htmlBody)
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Magic link tokens are signed with their own key derived from SECRET_KEY,
+// like share grants, so they can't be used as any other kind of token.
+// Each names the server-side record that makes it single use.
+func magicLinkKey() []byte {
+	return []byte("magic-link:" + SECRET_KEY)
+}
+
+// GenerateMagicLinkToken issues a token signing email in, backed by the
+// record id, that is valid for ttl
+func GenerateMagicLinkToken(email, id string, ttl time.Duration) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ttl)
+	claims := jwt.StandardClaims{
+		Id:        id,
+		Subject:   email,
+		ExpiresAt: expiresAt.Unix(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(magicLinkKey())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// VerifyMagicLinkToken checks token's signature and expiry and returns its
+// claims
+func VerifyMagicLinkToken(tokenStr string) (*jwt.StandardClaims, error) {
+	claims := &jwt.StandardClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return magicLinkKey(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.Id == "" || claims.Subject == "" {
+		return nil, errors.New("invalid magic link")
+	}
+	return claims, nil
+}
+
+// SendMagicLinkEmail emails a sign-in link
+func SendMagicLinkEmail(email, link string) error {
+	subject := "Your MapMyMoments sign-in link"
+	htmlBody := `
+<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="UTF-8">
+  <title>Sign In</title>
+  <style>
+    body { background: #f8fafc; font-family: 'Segoe UI', Arial, sans-serif; margin: 0; padding: 0; }
+    .container { max-width: 420px; margin: 48px auto; background: #fff; border-radius: 10px; box-shadow: 0 2px 12px #0001; padding: 32px 28px; border: 1px solid #e5e7eb; }
+    .logo { text-align: center; margin-bottom: 18px; }
+    .logo img { width: 40px; }
+    .title { color: #1e293b; font-size: 1.35rem; font-weight: 600; text-align: center; margin-bottom: 6px; letter-spacing: 0.01em; }
+    .subtitle { color: #475569; text-align: center; margin-bottom: 22px; font-size: 1rem; font-weight: 400; }
+    .button { display: block; width: fit-content; margin: 0 auto 12px; background: #0f172a; color: #fff !important; text-decoration: none; border-radius: 6px; padding: 12px 24px; font-weight: 600; }
+    .footer { color: #64748b; font-size: 0.95rem; text-align: center; margin-top: 28px; border-top: 1px solid #e5e7eb; padding-top: 18px; }
+  </style>
+</head>
+<body>
+  <div class="container">
+    <div class="logo">
+      <img src="https://i.imgur.com/2yaf2wb.png" alt="MapMyMoments Logo" />
+    </div>
+    <div class="title">Sign in to MapMyMoments</div>
+    <div class="subtitle">Open this link in the same browser you asked for it from. It works once, for the next 15 minutes.</div>
+    <a class="button" href="` + html.EscapeString(link) + `">Sign in</a>
+    <div class="footer">
+      If you didn't ask to sign in, you can safely ignore this email.<br><br>
+      &copy; ` + fmt.Sprint(time.Now().Year()) + ` MapMyMoments
+    </div>
+  </div>
+</body>
+</html>
+`
+
+	return sendEmail(email, subject, htmlBody)
+}
@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/config"
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+	"golang.org/x/oauth2/github"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/microsoft"
+)
+
+// IdentityProvider is an OAuth provider people can sign in with. Logins
+// always use PKCE: the verifier passed to Exchange must be the one whose
+// challenge went into AuthCodeURL.
+type IdentityProvider interface {
+	Name() string
+	AuthCodeURL(state, verifier string) string
+	// Exchange redeems an authorization code and returns who signed in
+	Exchange(ctx context.Context, code, verifier string) (*types.ProviderProfile, error)
+}
+
+var identityProviders = map[string]IdentityProvider{}
+
+// RegisterIdentityProvider makes p available under p.Name(), replacing any
+// provider of that name
+func RegisterIdentityProvider(p IdentityProvider) {
+	identityProviders[p.Name()] = p
+}
+
+// GetIdentityProvider returns the configured provider called name
+func GetIdentityProvider(name string) (IdentityProvider, bool) {
+	p, ok := identityProviders[name]
+	return p, ok
+}
+
+// IdentityProviderNames lists the configured providers, sorted
+func IdentityProviderNames() []string {
+	names := make([]string, 0, len(identityProviders))
+	for name := range identityProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// InitIdentityProviders sets up the providers in cfg. Unknown names are an
+// error so a typo doesn't silently disable a login button.
+func InitIdentityProviders(cfg map[string]config.OAuthProvider) error {
+	for name, pc := range cfg {
+		var (
+			p   IdentityProvider
+			err error
+		)
+		switch name {
+		case "google":
+			p = newGoogleProvider(pc)
+		case "github":
+			p = newGitHubProvider(pc)
+		case "microsoft":
+			p = newMicrosoftProvider(pc)
+		case "apple":
+			p, err = newAppleProvider(pc)
+		default:
+			err = errors.New("unknown provider")
+		}
+		if err != nil {
+			return fmt.Errorf("oauth provider %s: %w", name, err)
+		}
+		RegisterIdentityProvider(p)
+	}
+	return nil
+}
+
+// oauthProvider is the part every provider shares: the OAuth2 dance with
+// PKCE. Providers differ in where they keep the profile.
+type oauthProvider struct {
+	name    string
+	config  *oauth2.Config
+	options []oauth2.AuthCodeOption
+	profile func(ctx context.Context, client *http.Client, token *oauth2.Token) (*types.ProviderProfile, error)
+}
+
+func (p *oauthProvider) Name() string {
+	return p.name
+}
+
+func (p *oauthProvider) AuthCodeURL(state, verifier string) string {
+	opts := append([]oauth2.AuthCodeOption{oauth2.S256ChallengeOption(verifier)}, p.options...)
+	return p.config.AuthCodeURL(state, opts...)
+}
+
+func (p *oauthProvider) Exchange(ctx context.Context, code, verifier string) (*types.ProviderProfile, error) {
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+	profile, err := p.profile(ctx, p.config.Client(ctx, token), token)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Subject == "" {
+		return nil, fmt.Errorf("%s did not say who signed in", p.name)
+	}
+	return profile, nil
+}
+
+// getJSON fetches url with the provider's authenticated client
+func getJSON(client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func newGoogleProvider(pc config.OAuthProvider) IdentityProvider {
+	return &oauthProvider{
+		name: "google",
+		config: &oauth2.Config{
+			ClientID:     pc.ClientID,
+			ClientSecret: pc.ClientSecret,
+			RedirectURL:  pc.RedirectURL,
+			Scopes:       []string{"email", "profile"},
+			Endpoint:     google.Endpoint,
+		},
+		profile: func(ctx context.Context, client *http.Client, token *oauth2.Token) (*types.ProviderProfile, error) {
+			var info types.GoogleUserInfo
+			if err := getJSON(client, "https://www.googleapis.com/oauth2/v1/userinfo", &info); err != nil {
+				return nil, err
+			}
+			return &types.ProviderProfile{
+				Subject:       info.ID,
+				Email:         info.Email,
+				EmailVerified: info.VerifiedEmail,
+				FirstName:     info.GivenName,
+				LastName:      info.FamilyName,
+			}, nil
+		},
+	}
+}
+
+func newGitHubProvider(pc config.OAuthProvider) IdentityProvider {
+	return &oauthProvider{
+		name: "github",
+		config: &oauth2.Config{
+			ClientID:     pc.ClientID,
+			ClientSecret: pc.ClientSecret,
+			RedirectURL:  pc.RedirectURL,
+			Scopes:       []string{"read:user", "user:email"},
+			Endpoint:     github.Endpoint,
+		},
+		profile: func(ctx context.Context, client *http.Client, token *oauth2.Token) (*types.ProviderProfile, error) {
+			var user struct {
+				ID    int64  `json:"id"`
+				Login string `json:"login"`
+				Name  string `json:"name"`
+			}
+			if err := getJSON(client, "https://api.github.com/user", &user); err != nil {
+				return nil, err
+			}
+			// The profile email is optional and unverified; the primary
+			// address from the emails API is neither
+			var emails []struct {
+				Email    string `json:"email"`
+				Primary  bool   `json:"primary"`
+				Verified bool   `json:"verified"`
+			}
+			if err := getJSON(client, "https://api.github.com/user/emails", &emails); err != nil {
+				return nil, err
+			}
+			profile := &types.ProviderProfile{Subject: fmt.Sprint(user.ID)}
+			for _, e := range emails {
+				if e.Primary {
+					profile.Email = e.Email
+					profile.EmailVerified = e.Verified
+				}
+			}
+			name := user.Name
+			if name == "" {
+				name = user.Login
+			}
+			profile.FirstName, profile.LastName, _ = strings.Cut(name, " ")
+			return profile, nil
+		},
+	}
+}
+
+func newMicrosoftProvider(pc config.OAuthProvider) IdentityProvider {
+	tenant := pc.Tenant
+	if tenant == "" {
+		tenant = "common"
+	}
+	return &oauthProvider{
+		name: "microsoft",
+		config: &oauth2.Config{
+			ClientID:     pc.ClientID,
+			ClientSecret: pc.ClientSecret,
+			RedirectURL:  pc.RedirectURL,
+			Scopes:       []string{"openid", "email", "profile"},
+			Endpoint:     microsoft.AzureADEndpoint(tenant),
+		},
+		profile: func(ctx context.Context, client *http.Client, token *oauth2.Token) (*types.ProviderProfile, error) {
+			var info struct {
+				Sub        string `json:"sub"`
+				Email      string `json:"email"`
+				GivenName  string `json:"given_name"`
+				FamilyName string `json:"family_name"`
+			}
+			if err := getJSON(client, "https://graph.microsoft.com/oidc/userinfo", &info); err != nil {
+				return nil, err
+			}
+			// Azure AD lets tenants put any address in the email claim, so
+			// it is never treated as verified
+			return &types.ProviderProfile{
+				Subject:   info.Sub,
+				Email:     info.Email,
+				FirstName: info.GivenName,
+				LastName:  info.FamilyName,
+			}, nil
+		},
+	}
+}
+
+const appleIssuer = "https://appleid.apple.com"
+
+// appleProvider signs in with Apple. Apple has no userinfo endpoint; who
+// signed in is in the ID token that comes with the access token, which we
+// check against Apple's published keys.
+type appleProvider struct {
+	oauthProvider
+	clientID   string
+	teamID     string
+	keyID      string
+	privateKey *ecdsa.PrivateKey
+	keys       *JWKSVerifier
+}
+
+type appleClaims struct {
+	Email string `json:"email"`
+	// Apple sends this as a bool or as the string "true"
+	EmailVerified interface{} `json:"email_verified"`
+	jwt.StandardClaims
+}
+
+func newAppleProvider(pc config.OAuthProvider) (IdentityProvider, error) {
+	if pc.TeamID == "" || pc.KeyID == "" || pc.PrivateKeyFile == "" {
+		return nil, errors.New("team_id, key_id and private_key_file are required")
+	}
+	block, err := readPEM(pc.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key must be an EC key")
+	}
+
+	endpoint := endpoints.Apple
+	endpoint.AuthStyle = oauth2.AuthStyleInParams
+	p := &appleProvider{
+		clientID:   pc.ClientID,
+		teamID:     pc.TeamID,
+		keyID:      pc.KeyID,
+		privateKey: ecKey,
+		keys:       NewJWKSVerifier(appleIssuer + "/auth/keys"),
+	}
+	p.oauthProvider = oauthProvider{
+		name: "apple",
+		config: &oauth2.Config{
+			ClientID:    pc.ClientID,
+			RedirectURL: pc.RedirectURL,
+			Scopes:      []string{"name", "email"},
+			Endpoint:    endpoint,
+		},
+		// Apple insists on posting the result when asked for the email;
+		// /user/oauth/apple/redirect turns it back into a normal redirect
+		options: []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("response_mode", "form_post")},
+		profile: p.idTokenProfile,
+	}
+	return p, nil
+}
+
+func (p *appleProvider) Exchange(ctx context.Context, code, verifier string) (*types.ProviderProfile, error) {
+	secret, err := p.clientSecret()
+	if err != nil {
+		return nil, err
+	}
+	// The client secret is short-lived, so each exchange uses a fresh copy
+	// of the config with a new one
+	cfg := *p.config
+	cfg.ClientSecret = secret
+	provider := p.oauthProvider
+	provider.config = &cfg
+	return provider.Exchange(ctx, code, verifier)
+}
+
+// clientSecret is the ES256 JWT Apple accepts in place of a client secret
+func (p *appleProvider) clientSecret() (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.StandardClaims{
+		Issuer:    p.teamID,
+		Subject:   p.clientID,
+		Audience:  appleIssuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(5 * time.Minute).Unix(),
+	})
+	token.Header["kid"] = p.keyID
+	return token.SignedString(p.privateKey)
+}
+
+func (p *appleProvider) idTokenProfile(ctx context.Context, client *http.Client, token *oauth2.Token) (*types.ProviderProfile, error) {
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		return nil, errors.New("apple sent no ID token")
+	}
+	claims := &appleClaims{}
+	if err := p.keys.Verify(idToken, claims); err != nil {
+		return nil, err
+	}
+	if !claims.VerifyIssuer(appleIssuer, true) || !claims.VerifyAudience(p.clientID, true) {
+		return nil, errors.New("apple ID token is not for us")
+	}
+	verified := claims.EmailVerified == true || claims.EmailVerified == "true"
+	return &types.ProviderProfile{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: verified,
+	}, nil
+}
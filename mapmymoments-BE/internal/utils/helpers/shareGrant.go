@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Share access grants prove that the holder typed a protected link's
+// passphrase. They are signed with a key derived from SECRET_KEY so they can
+// never be mistaken for (or used as) login tokens, and they name the link
+// token they unlock, so rotating the link invalidates them.
+func shareGrantKey() []byte {
+	return []byte("share-grant:" + SECRET_KEY)
+}
+
+// GenerateShareGrant issues a grant for shareToken that is valid for ttl.
+func GenerateShareGrant(shareToken string, ttl time.Duration) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ttl)
+	claims := jwt.StandardClaims{
+		Subject:   shareToken,
+		ExpiresAt: expiresAt.Unix(),
+	}
+	grant, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(shareGrantKey())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return grant, expiresAt, nil
+}
+
+// VerifyShareGrant checks that grant is a valid, unexpired grant for
+// shareToken.
+func VerifyShareGrant(grant, shareToken string) error {
+	claims := &jwt.StandardClaims{}
+	token, err := jwt.ParseWithClaims(grant, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return shareGrantKey(), nil
+	})
+	if err != nil {
+		return err
+	}
+	if !token.Valid || claims.Subject != shareToken {
+		return errors.New("grant is not valid for this link")
+	}
+	return nil
+}
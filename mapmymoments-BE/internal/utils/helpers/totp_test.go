@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B, SHA1, truncated to our six digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		got, err := TOTPCode(secret, time.Unix(unix, 0))
+		if err != nil || got != want {
+			t.Errorf("TOTPCode at %d: got %q, %v, want %q", unix, got, err, want)
+		}
+	}
+
+	now := time.Unix(1111111109, 0)
+	if step, ok := ValidateTOTP(secret, "081804", now.Add(30*time.Second)); !ok || step != 1111111109/30 {
+		t.Errorf("previous step's code: got %d, %v", step, ok)
+	}
+	if _, ok := ValidateTOTP(secret, "081804", now.Add(2*time.Minute)); ok {
+		t.Error("stale code accepted")
+	}
+	if _, ok := ValidateTOTP(secret, "81804", now); ok {
+		t.Error("short code accepted")
+	}
+}
+
+func TestRecoveryCodeHash(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil || len(codes) != 10 {
+		t.Fatalf("GenerateRecoveryCodes: %v, %v", codes, err)
+	}
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+codes[0][:5]+codes[0][6:]+" ") {
+		t.Error("formatting changed the hash")
+	}
+	if HashRecoveryCode(codes[0]) == HashRecoveryCode(codes[1]) {
+		t.Error("different codes hash the same")
+	}
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/url"
+
+	"github.com/atindraraut/crudgo/internal/config"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var webAuthn *webauthn.WebAuthn
+
+// InitWebAuthn sets up passkeys. Call it after InitFrontendURL, whose URL
+// fills in whatever cfg leaves out.
+func InitWebAuthn(cfg config.WebAuthn) error {
+	origins := cfg.RPOrigins
+	if len(origins) == 0 {
+		origins = []string{FrontendURL()}
+	}
+	rpID := cfg.RPID
+	if rpID == "" {
+		u, err := url.Parse(FrontendURL())
+		if err != nil || u.Hostname() == "" {
+			return errors.New("rp_id is required when the frontend URL has no host")
+		}
+		rpID = u.Hostname()
+	}
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: "MapMyMoments",
+		RPOrigins:     origins,
+	})
+	if err != nil {
+		return err
+	}
+	webAuthn = w
+	return nil
+}
+
+// WebAuthn returns the passkey relying party, if InitWebAuthn has run
+func WebAuthn() (*webauthn.WebAuthn, bool) {
+	return webAuthn, webAuthn != nil
+}
+
+// WebAuthnUserHandle is the opaque user ID passkeys are stored under. It
+// is derived from the email so the email itself never reaches the
+// authenticator as an ID.
+func WebAuthnUserHandle(email string) []byte {
+	sum := sha256.Sum256([]byte("webauthn:" + email))
+	return sum[:]
+}
@@ -2,7 +2,9 @@ package middleware
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
@@ -27,7 +29,8 @@ func CorsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, X-Share-Grant, X-Device-Label")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -70,15 +73,7 @@ func RateLimiter(next http.Handler) http.Handler {
 	}()
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get client IP
-		ip := r.RemoteAddr
-		if fwdIP := r.Header.Get("X-Forwarded-For"); fwdIP != "" {
-			// Use the first IP in X-Forwarded-For if available
-			ip = strings.Split(fwdIP, ",")[0]
-		} else {
-			// Remove port from IP if present
-			ip = strings.Split(ip, ":")[0]
-		}
+		ip := ClientIP(r)
 
 		mu.Lock()
 		if clients[ip] == nil {
@@ -111,6 +106,73 @@ func RateLimiter(next http.Handler) http.Handler {
 	})
 }
 
+var trustedProxies []*net.IPNet
+
+// InitTrustedProxies sets the proxies (IPs or CIDR ranges) whose
+// X-Forwarded-For headers ClientIP believes. With none, the header is ignored.
+func InitTrustedProxies(proxies []string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy %q", p)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+			p = fmt.Sprintf("%s/%d", p, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q", p)
+		}
+		nets = append(nets, ipNet)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the caller's IP. X-Forwarded-For is only read when the
+// connection comes from a trusted proxy, and then from the right, skipping
+// trusted hops, since anything left of them is whatever the client sent.
+func ClientIP(r *http.Request) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			// Not something a proxy we trust would have added
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
+
 // TimeTracker logs the duration and status code of each request
 func TimeTracker(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -130,6 +192,11 @@ type AuthUser struct {
 	FirstName string
 	LastName  string
 	Uid       string
+	// SessionID is the session the access token was issued to
+	SessionID string
+	// SignedInAt is when that session signed in, for actions that need a
+	// recent sign-in
+	SignedInAt time.Time
 }
 
 // AuthMiddleware validates JWT, fetches user from DB, and populates user data in request context
@@ -141,23 +208,37 @@ func AuthMiddleware(storage storage.Storage) Middleware {
 				http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
 				return
 			}
-			tokenStr := strings.TrimPrefix(header, "Bearer ")
-			details, msg := auth.VerifyToken(tokenStr)
-			if msg != "nil" {
-				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			user, msg := authenticate(r, storage, strings.TrimPrefix(header, "Bearer "))
+			if user == nil {
+				http.Error(w, msg, http.StatusUnauthorized)
 				return
 			}
-			// Fetch user from DB using storage interface
-			userData, err := storage.GetUserByEmail(details.Email)
-			if err != nil {
-				http.Error(w, "User not found", http.StatusUnauthorized)
+			ctx := context.WithValue(r.Context(), UserContextKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// OptionalAuthMiddleware populates the user like AuthMiddleware when a bearer
+// token is sent, but lets anonymous requests through with no user in the
+// context. A token that is present but invalid is still rejected so clients
+// know to refresh it.
+func OptionalAuthMiddleware(storage storage.Storage) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
 				return
 			}
-			user := &AuthUser{
-				Email:     userData.Email,
-				FirstName: userData.FirstName,
-				LastName:  userData.LastName,
-				Uid:       userData.Email, // Use Email as UID since UserData has no Uid field
+			if !strings.HasPrefix(header, "Bearer ") {
+				http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
+				return
+			}
+			user, msg := authenticate(r, storage, strings.TrimPrefix(header, "Bearer "))
+			if user == nil {
+				http.Error(w, msg, http.StatusUnauthorized)
+				return
 			}
 			ctx := context.WithValue(r.Context(), UserContextKey, user)
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -165,6 +246,34 @@ func AuthMiddleware(storage storage.Storage) Middleware {
 	}
 }
 
+// authenticate verifies tokenStr and loads the user it names. On failure it
+// returns nil and a message suitable for the 401 response.
+func authenticate(r *http.Request, storage storage.Storage, tokenStr string) (*AuthUser, string) {
+	details, msg := auth.VerifyAccessToken(tokenStr)
+	if msg != "nil" {
+		return nil, "Invalid or expired token"
+	}
+	// Signing out a session cuts off its access tokens straight away
+	// rather than when they expire
+	session, err := storage.GetSession(r.Context(), details.FamilyID)
+	if err != nil || session.UserID != details.Email {
+		return nil, "Session has ended"
+	}
+	// Fetch user from DB using storage interface
+	userData, err := storage.GetUserByEmail(r.Context(), details.Email)
+	if err != nil {
+		return nil, "User not found"
+	}
+	return &AuthUser{
+		Email:      userData.Email,
+		FirstName:  userData.FirstName,
+		LastName:   userData.LastName,
+		Uid:        userData.Email, // Use Email as UID since UserData has no Uid field
+		SessionID:  session.ID,
+		SignedInAt: session.CreatedAt,
+	}, ""
+}
+
 // GetAuthUser extracts user data from request context
 func GetAuthUser(r *http.Request) *AuthUser {
 	user, _ := r.Context().Value(UserContextKey).(*AuthUser)
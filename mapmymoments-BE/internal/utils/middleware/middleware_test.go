@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	if err := InitTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"}); err != nil {
+		t.Fatalf("InitTrustedProxies: %v", err)
+	}
+	t.Cleanup(func() { InitTrustedProxies(nil) })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "203.0.113.5:1234", nil, "203.0.113.5"},
+		{"untrusted peer", "203.0.113.5:1234", []string{"198.51.100.7"}, "203.0.113.5"},
+		{"trusted proxy", "192.0.2.1:1234", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"spoofed entry", "192.0.2.1:1234", []string{"1.2.3.4, 198.51.100.7"}, "198.51.100.7"},
+		{"proxy chain", "10.0.0.2:1234", []string{"198.51.100.7, 10.0.0.1"}, "198.51.100.7"},
+		{"repeated header", "10.0.0.2:1234", []string{"1.2.3.4", "198.51.100.7"}, "198.51.100.7"},
+		{"garbage", "192.0.2.1:1234", []string{"not-an-ip"}, "192.0.2.1"},
+		{"no header", "192.0.2.1:1234", nil, "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for _, v := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := ClientIP(r); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if err := InitTrustedProxies([]string{"nope"}); err == nil {
+		t.Error("expected an error for an invalid proxy")
+	}
+}
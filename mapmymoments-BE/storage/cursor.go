@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/atindraraut/crudgo/internal/types"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor can't be decoded or
+// was issued for a different sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// RouteCursor is the decoded form of the opaque cursor handed to clients. It
+// records the sort key of the last route on a page plus its ID as a
+// tie-breaker.
+type RouteCursor struct {
+	SortBy  string `json:"s"`
+	SortAsc bool   `json:"a,omitempty"`
+	Num     int64  `json:"n,omitempty"`
+	Str     string `json:"v,omitempty"`
+	ID      string `json:"id"`
+}
+
+// NormalizeListOptions applies defaults and clamps the page size.
+func NormalizeListOptions(opts types.RouteListOptions) types.RouteListOptions {
+	if opts.SortBy == "" {
+		opts.SortBy = "createdAt"
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultPageSize
+	}
+	if opts.Limit > MaxPageSize {
+		opts.Limit = MaxPageSize
+	}
+	return opts
+}
+
+// EncodeRouteCursor builds the cursor pointing just past route.
+func EncodeRouteCursor(opts types.RouteListOptions, route types.Route) string {
+	c := RouteCursor{SortBy: opts.SortBy, SortAsc: opts.SortAsc, ID: route.ID}
+	switch opts.SortBy {
+	case "updatedAt":
+		c.Num = route.UpdatedAt
+	case "name":
+		c.Str = route.Name
+	default:
+		c.Num = route.CreatedAt
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeRouteCursor parses opts.Cursor. It returns nil when no cursor was
+// supplied.
+func DecodeRouteCursor(opts types.RouteListOptions) (*RouteCursor, error) {
+	if opts.Cursor == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c RouteCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	if c.SortBy != opts.SortBy || c.SortAsc != opts.SortAsc {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (m *Memory) CreateInvitation(ctx context.Context, inv types.Invitation) (types.Invitation, error) {
+	if err := ctx.Err(); err != nil {
+		return types.Invitation{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.routes[inv.RouteID]; !ok {
+		return types.Invitation{}, storage.ErrNotFound
+	}
+	inv.Email = strings.ToLower(inv.Email)
+	now := m.now()
+	for _, existing := range m.invitations {
+		if existing.RouteID == inv.RouteID && existing.Email == inv.Email &&
+			existing.Status == types.InvitationPending && existing.ExpiresAt.After(now) {
+			return types.Invitation{}, storage.ErrConflict
+		}
+	}
+	inv.ID = primitive.NewObjectID().Hex()
+	inv.Status = types.InvitationPending
+	inv.CreatedAt = now
+	inv.RespondedAt = nil
+	m.invitations[inv.ID] = inv
+	return inv, nil
+}
+
+func (m *Memory) ListRouteInvitations(ctx context.Context, routeId string) ([]types.Invitation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.routes[routeId]; !ok {
+		return nil, storage.ErrNotFound
+	}
+	return m.pendingInvitationsLocked(func(inv types.Invitation) bool { return inv.RouteID == routeId }), nil
+}
+
+func (m *Memory) ListInvitationsForEmail(ctx context.Context, email string) ([]types.Invitation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	email = strings.ToLower(email)
+	return m.pendingInvitationsLocked(func(inv types.Invitation) bool { return inv.Email == email }), nil
+}
+
+func (m *Memory) DeleteInvitation(ctx context.Context, routeId, invitationId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inv, ok := m.invitations[invitationId]
+	if !ok || inv.RouteID != routeId {
+		return storage.ErrNotFound
+	}
+	delete(m.invitations, invitationId)
+	return nil
+}
+
+func (m *Memory) RespondToInvitation(ctx context.Context, invitationId, email string, accept bool) (types.Invitation, error) {
+	if err := ctx.Err(); err != nil {
+		return types.Invitation{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inv, ok := m.invitations[invitationId]
+	if !ok || inv.Email != strings.ToLower(email) {
+		return types.Invitation{}, storage.ErrNotFound
+	}
+	if inv.Status != types.InvitationPending {
+		return types.Invitation{}, storage.ErrConflict
+	}
+	now := m.now()
+	if !inv.ExpiresAt.After(now) {
+		return types.Invitation{}, storage.ErrExpired
+	}
+	if accept {
+		route, ok := m.routes[inv.RouteID]
+		if !ok {
+			return types.Invitation{}, storage.ErrNotFound
+		}
+		if route.CreatorID != email && !hasCollaborator(route, email) {
+			m.addCollaboratorLocked(route, email, email, inv.Role)
+		}
+		inv.Status = types.InvitationAccepted
+	} else {
+		inv.Status = types.InvitationDeclined
+	}
+	inv.RespondedAt = &now
+	m.invitations[invitationId] = inv
+	return inv, nil
+}
+
+// pendingInvitationsLocked returns unexpired pending invitations matching
+// keep, oldest first. Callers must hold m.mu.
+func (m *Memory) pendingInvitationsLocked(keep func(types.Invitation) bool) []types.Invitation {
+	now := m.now()
+	invitations := []types.Invitation{}
+	for _, inv := range m.invitations {
+		if inv.Status == types.InvitationPending && inv.ExpiresAt.After(now) && keep(inv) {
+			invitations = append(invitations, inv)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool {
+		if !invitations[i].CreatedAt.Equal(invitations[j].CreatedAt) {
+			return invitations[i].CreatedAt.Before(invitations[j].CreatedAt)
+		}
+		return invitations[i].ID < invitations[j].ID
+	})
+	return invitations
+}
+
+// deleteInvitationsLocked drops every invitation to a route. Callers must
+// hold m.mu for writing.
+func (m *Memory) deleteInvitationsLocked(routeId string) {
+	for id, inv := range m.invitations {
+		if inv.RouteID == routeId {
+			delete(m.invitations, id)
+		}
+	}
+}
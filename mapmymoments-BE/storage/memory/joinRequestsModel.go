@@ -0,0 +1,160 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (m *Memory) RequestToJoin(ctx context.Context, token, userId, email string) (types.JoinRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return types.JoinRequest{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link, ok := m.shareLinkByTokenLocked(token)
+	if !ok {
+		return types.JoinRequest{}, storage.ErrNotFound
+	}
+	route, ok := m.routes[link.RouteID]
+	if !ok {
+		return types.JoinRequest{}, storage.ErrNotFound
+	}
+	now := m.now()
+	if err := storage.CheckShareLink(link, now); err != nil {
+		return types.JoinRequest{}, err
+	}
+	for _, req := range m.joinRequests {
+		if req.RouteID == route.ID && req.UserID == userId && req.Status == types.JoinRequestPending {
+			return req, nil
+		}
+	}
+	req := types.JoinRequest{
+		ID:        primitive.NewObjectID().Hex(),
+		RouteID:   route.ID,
+		RouteName: route.Name,
+		LinkID:    link.ID,
+		UserID:    userId,
+		Email:     email,
+		Role:      link.Role,
+		Status:    types.JoinRequestPending,
+		CreatedAt: now,
+	}
+	m.joinRequests[req.ID] = req
+	return req, nil
+}
+
+func (m *Memory) ListJoinRequests(ctx context.Context, routeId string) ([]types.JoinRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.routes[routeId]; !ok {
+		return nil, storage.ErrNotFound
+	}
+	requests := m.joinRequestsLocked(func(req types.JoinRequest) bool {
+		return req.RouteID == routeId && req.Status == types.JoinRequestPending
+	})
+	return requests, nil
+}
+
+func (m *Memory) ListJoinRequestsForUser(ctx context.Context, userId string) ([]types.JoinRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	requests := m.joinRequestsLocked(func(req types.JoinRequest) bool { return req.UserID == userId })
+	// Newest first, so the latest answer for a route comes before older ones
+	for i, j := 0, len(requests)-1; i < j; i, j = i+1, j-1 {
+		requests[i], requests[j] = requests[j], requests[i]
+	}
+	return requests, nil
+}
+
+func (m *Memory) DecideJoinRequest(ctx context.Context, routeId, requestId, decidedBy string, approve bool) (types.JoinRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return types.JoinRequest{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	req, ok := m.joinRequests[requestId]
+	if !ok || req.RouteID != routeId {
+		return types.JoinRequest{}, storage.ErrNotFound
+	}
+	if req.Status != types.JoinRequestPending {
+		return types.JoinRequest{}, storage.ErrConflict
+	}
+	route, ok := m.routes[routeId]
+	if !ok {
+		return types.JoinRequest{}, storage.ErrNotFound
+	}
+	now := m.now()
+	req.Status = types.JoinRequestRejected
+	if approve {
+		req.Status = types.JoinRequestApproved
+		if route.CreatorID != req.UserID && !hasCollaborator(route, req.UserID) {
+			// The link must still be usable, as when redeeming it directly
+			link, ok := m.shareLinks[req.LinkID]
+			if !ok {
+				return types.JoinRequest{}, storage.ErrExpired
+			}
+			if err := storage.CheckShareLink(link, now); err != nil {
+				return types.JoinRequest{}, err
+			}
+			m.addCollaboratorLocked(route, req.UserID, req.Email, req.Role)
+			link.JoinCount++
+			link.LastUsedAt = &now
+			m.shareLinks[link.ID] = link
+		}
+	}
+	req.DecidedAt = &now
+	req.DecidedBy = decidedBy
+	m.joinRequests[requestId] = req
+	return req, nil
+}
+
+// joinRequestsLocked returns the join requests matching keep, oldest first.
+// Callers must hold m.mu.
+func (m *Memory) joinRequestsLocked(keep func(types.JoinRequest) bool) []types.JoinRequest {
+	requests := []types.JoinRequest{}
+	for _, req := range m.joinRequests {
+		if keep(req) {
+			requests = append(requests, req)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if !requests[i].CreatedAt.Equal(requests[j].CreatedAt) {
+			return requests[i].CreatedAt.Before(requests[j].CreatedAt)
+		}
+		return requests[i].ID < requests[j].ID
+	})
+	return requests
+}
+
+// cancelJoinRequestsLocked cancels the pending requests filed through a
+// link. Callers must hold m.mu for writing.
+func (m *Memory) cancelJoinRequestsLocked(linkId string) {
+	now := m.now()
+	for id, req := range m.joinRequests {
+		if req.LinkID == linkId && req.Status == types.JoinRequestPending {
+			req.Status = types.JoinRequestCancelled
+			req.DecidedAt = &now
+			m.joinRequests[id] = req
+		}
+	}
+}
+
+// deleteJoinRequestsLocked drops every join request for a route. Callers
+// must hold m.mu for writing.
+func (m *Memory) deleteJoinRequestsLocked(routeId string) {
+	for id, req := range m.joinRequests {
+		if req.RouteID == routeId {
+			delete(m.joinRequests, id)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+func (m *Memory) RecordLoginFailure(ctx context.Context, key string, policy types.LockoutPolicy) (types.LoginThrottle, error) {
+	if err := ctx.Err(); err != nil {
+		return types.LoginThrottle{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	throttle, ok := m.loginThrottles[key]
+	if !ok || !throttle.ExpiresAt.After(now) || now.Sub(throttle.LastFailureAt) > policy.Window {
+		throttle = types.LoginThrottle{Key: key}
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = now
+	throttle.ExpiresAt = now.Add(policy.Window)
+	if delay := policy.Delay(throttle.Failures); delay > 0 {
+		until := now.Add(delay)
+		if throttle.LockedUntil == nil || until.After(*throttle.LockedUntil) {
+			throttle.LockedUntil = &until
+		}
+	}
+	m.loginThrottles[key] = throttle
+	return cloneLoginThrottle(throttle), nil
+}
+
+func (m *Memory) GetLoginThrottle(ctx context.Context, key string) (types.LoginThrottle, error) {
+	if err := ctx.Err(); err != nil {
+		return types.LoginThrottle{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	throttle, ok := m.loginThrottles[key]
+	if !ok || !throttle.ExpiresAt.After(m.now()) {
+		return types.LoginThrottle{}, storage.ErrNotFound
+	}
+	return cloneLoginThrottle(throttle), nil
+}
+
+func (m *Memory) ClearLoginThrottle(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.loginThrottles, key)
+	return nil
+}
+
+func (m *Memory) SetLoginUnlockToken(ctx context.Context, key, tokenHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	throttle, ok := m.loginThrottles[key]
+	if !ok || !throttle.ExpiresAt.After(m.now()) {
+		return storage.ErrNotFound
+	}
+	throttle.UnlockTokenHash = tokenHash
+	m.loginThrottles[key] = throttle
+	return nil
+}
+
+func (m *Memory) UnlockLogin(ctx context.Context, tokenHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	for key, throttle := range m.loginThrottles {
+		if tokenHash != "" && throttle.UnlockTokenHash == tokenHash && throttle.ExpiresAt.After(now) {
+			delete(m.loginThrottles, key)
+			return nil
+		}
+	}
+	return storage.ErrNotFound
+}
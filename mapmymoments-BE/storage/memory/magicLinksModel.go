@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+func (m *Memory) SaveMagicLink(ctx context.Context, link types.MagicLink) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.magicLinks[link.ID]; exists {
+		return storage.ErrConflict
+	}
+	m.magicLinks[link.ID] = link
+	return nil
+}
+
+func (m *Memory) ConsumeMagicLink(ctx context.Context, id string) (types.MagicLink, error) {
+	if err := ctx.Err(); err != nil {
+		return types.MagicLink{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link, ok := m.magicLinks[id]
+	if !ok {
+		return types.MagicLink{}, storage.ErrNotFound
+	}
+	delete(m.magicLinks, id)
+	if !link.ExpiresAt.After(m.now()) {
+		return types.MagicLink{}, storage.ErrExpired
+	}
+	return link, nil
+}
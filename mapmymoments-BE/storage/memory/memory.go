@@ -0,0 +1,143 @@
+// Package memory provides a concurrency-safe, in-process implementation of
+// storage.Storage. It is intended for tests and local development where a
+// MongoDB instance is not available; nothing is persisted across restarts.
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+type Memory struct {
+	mu           sync.RWMutex
+	users        map[string]types.UserData  // keyed by email
+	otpRecords   map[string]types.OTPRecord // keyed by email and type
+	routes       map[string]types.Route
+	routeShares  []types.RouteShare
+	shareLinks   map[string]types.ShareLink // keyed by ID
+	invitations  map[string]types.Invitation
+	joinRequests map[string]types.JoinRequest
+	// refreshTokens is keyed by token ID (the jti claim)
+	refreshTokens map[string]types.RefreshToken
+	sessions      map[string]types.Session
+	oauthStates   map[string]types.OAuthState
+	magicLinks    map[string]types.MagicLink
+	pendingLinks  map[string]types.PendingLink
+	// twoFactorChallenges is keyed by challenge token
+	twoFactorChallenges map[string]types.TwoFactorChallenge
+	webauthnSessions    map[string]types.WebAuthnSession
+	// webauthnCredentials is keyed by credential ID
+	webauthnCredentials map[string]types.WebAuthnCredential
+	// loginThrottles is keyed by account or client
+	loginThrottles map[string]types.LoginThrottle
+	now            func() time.Time
+}
+
+func New() *Memory {
+	return &Memory{
+		users:               make(map[string]types.UserData),
+		otpRecords:          make(map[string]types.OTPRecord),
+		routes:              make(map[string]types.Route),
+		shareLinks:          make(map[string]types.ShareLink),
+		invitations:         make(map[string]types.Invitation),
+		joinRequests:        make(map[string]types.JoinRequest),
+		refreshTokens:       make(map[string]types.RefreshToken),
+		sessions:            make(map[string]types.Session),
+		oauthStates:         make(map[string]types.OAuthState),
+		magicLinks:          make(map[string]types.MagicLink),
+		pendingLinks:        make(map[string]types.PendingLink),
+		twoFactorChallenges: make(map[string]types.TwoFactorChallenge),
+		webauthnSessions:    make(map[string]types.WebAuthnSession),
+		webauthnCredentials: make(map[string]types.WebAuthnCredential),
+		loginThrottles:      make(map[string]types.LoginThrottle),
+		now:                 time.Now,
+	}
+}
+
+// cloneRoute returns a deep copy so callers can't mutate stored state through
+// shared slices or pointers.
+func cloneRoute(r types.Route) types.Route {
+	c := r
+	c.IntermediateWaypoints = append([]types.Waypoint(nil), r.IntermediateWaypoints...)
+	c.Photos = append([]types.Photo(nil), r.Photos...)
+	c.SharedWith = append([]types.SharedUser{}, r.SharedWith...)
+	if r.PendingTransfer != nil {
+		t := *r.PendingTransfer
+		c.PendingTransfer = &t
+	}
+	return c
+}
+
+func cloneShareLink(l types.ShareLink) types.ShareLink {
+	c := l
+	if l.ExpiresAt != nil {
+		t := *l.ExpiresAt
+		c.ExpiresAt = &t
+	}
+	if l.LastUsedAt != nil {
+		t := *l.LastUsedAt
+		c.LastUsedAt = &t
+	}
+	if l.LockedUntil != nil {
+		t := *l.LockedUntil
+		c.LockedUntil = &t
+	}
+	return c
+}
+
+func cloneUser(u types.UserData) types.UserData {
+	c := u
+	if u.Password != nil {
+		p := *u.Password
+		c.Password = &p
+	}
+	c.Identities = append([]types.LinkedIdentity(nil), u.Identities...)
+	c.TwoFactor = cloneTwoFactor(u.TwoFactor)
+	return c
+}
+
+func cloneTwoFactor(t *types.TwoFactor) *types.TwoFactor {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	c.RecoveryCodes = append([]string(nil), t.RecoveryCodes...)
+	if t.EnabledAt != nil {
+		at := *t.EnabledAt
+		c.EnabledAt = &at
+	}
+	return &c
+}
+
+func cloneOTPRecord(r types.OTPRecord) types.OTPRecord {
+	c := r
+	if r.SignupReq != nil {
+		req := *r.SignupReq
+		c.SignupReq = &req
+	}
+	return c
+}
+
+func cloneLoginThrottle(t types.LoginThrottle) types.LoginThrottle {
+	c := t
+	if t.LockedUntil != nil {
+		until := *t.LockedUntil
+		c.LockedUntil = &until
+	}
+	return c
+}
+
+func cloneWebAuthnCredential(c types.WebAuthnCredential) types.WebAuthnCredential {
+	clone := c
+	clone.Transports = append([]string(nil), c.Transports...)
+	if c.LastUsedAt != nil {
+		t := *c.LastUsedAt
+		clone.LastUsedAt = &t
+	}
+	return clone
+}
+
+var _ storage.Storage = (*Memory)(nil)
@@ -0,0 +1,415 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+func TestUserLifecycle(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+
+	if _, err := m.GetUserByEmail(ctx, "a@example.com"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	pw := "hash"
+	if err := m.CreateUser(ctx, types.UserData{Email: "a@example.com", Password: &pw, AuthType: "email"}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := m.CreateUser(ctx, types.UserData{Email: "a@example.com"}); !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+
+	identity := types.NewLinkedIdentity("google", types.ProviderProfile{Subject: "g-123", Email: "a@example.com"})
+	if err := m.LinkIdentity(ctx, "a@example.com", identity); err != nil {
+		t.Fatalf("LinkIdentity: %v", err)
+	}
+	user, err := m.GetUserByIdentity(ctx, "google", "g-123")
+	if err != nil {
+		t.Fatalf("GetUserByIdentity: %v", err)
+	}
+	if user.AuthType != "both" || user.Password == nil {
+		t.Errorf("expected linked account to keep password and become 'both', got %+v", user)
+	}
+
+	// The identity can't be linked to anyone else, or replaced by another
+	// Google account
+	if err := m.CreateUser(ctx, types.UserData{Email: "b@example.com", Identities: []types.LinkedIdentity{identity}}); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict for a taken identity, got %v", err)
+	}
+	other := types.NewLinkedIdentity("google", types.ProviderProfile{Subject: "g-456"})
+	if err := m.LinkIdentity(ctx, "a@example.com", other); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict for a second Google account, got %v", err)
+	}
+
+	if err := m.UnlinkIdentity(ctx, "a@example.com", "google"); err != nil {
+		t.Fatalf("UnlinkIdentity: %v", err)
+	}
+	if user, _ := m.GetUserByEmail(ctx, "a@example.com"); user.AuthType != "email" || len(user.Identities) != 0 {
+		t.Errorf("expected unlinked account to be 'email' only, got %+v", user)
+	}
+
+	// An OAuth-only user keeps their last identity
+	if err := m.CreateUser(ctx, types.UserData{Email: "c@example.com", Identities: []types.LinkedIdentity{other}, AuthType: "oauth"}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := m.UnlinkIdentity(ctx, "c@example.com", "google"); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict unlinking the last identity, got %v", err)
+	}
+}
+
+func TestOTPRecords(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	policy := types.OTPPolicy{Cooldown: time.Minute, Window: time.Hour, MaxSends: 3}
+	save := func() error {
+		return m.SaveOTPRecord(ctx, types.OTPRecord{Email: "a@example.com", Type: types.OTPTypeReset, OTPHash: "hash", ExpiresAt: now.Add(10 * time.Minute)}, policy)
+	}
+
+	if err := save(); err != nil {
+		t.Fatalf("SaveOTPRecord: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := m.ClaimOTPAttempt(ctx, "a@example.com", types.OTPTypeReset, 2); err != nil {
+			t.Fatalf("ClaimOTPAttempt %d: %v", i, err)
+		}
+	}
+	if _, err := m.ClaimOTPAttempt(ctx, "a@example.com", types.OTPTypeReset, 2); !errors.Is(err, storage.ErrExpired) {
+		t.Fatalf("expected ErrExpired once attempts are used up, got %v", err)
+	}
+
+	var retry *storage.RetryAfterError
+	if err := save(); !errors.As(err, &retry) || !errors.Is(err, storage.ErrRateLimited) || !retry.RetryAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("expected to wait out the cooldown, got %v", err)
+	}
+	windowStart := now
+	for i := 0; i < 2; i++ {
+		now = now.Add(2 * time.Minute)
+		if err := save(); err != nil {
+			t.Fatalf("SaveOTPRecord after cooldown: %v", err)
+		}
+	}
+	if _, err := m.ClaimOTPAttempt(ctx, "a@example.com", types.OTPTypeReset, 2); err != nil {
+		t.Fatalf("a new code should reset the attempts: %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if err := save(); !errors.As(err, &retry) || !retry.RetryAt.Equal(windowStart.Add(time.Hour)) {
+		t.Fatalf("expected to wait out the quota window, got %v", err)
+	}
+
+	if err := m.ConsumeOTPRecord(ctx, "a@example.com", types.OTPTypeReset); err != nil {
+		t.Fatalf("ConsumeOTPRecord: %v", err)
+	}
+	if err := m.ConsumeOTPRecord(ctx, "a@example.com", types.OTPTypeReset); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected a used code to be gone, got %v", err)
+	}
+
+	now = windowStart.Add(2 * time.Hour)
+	if _, err := m.GetOTPRecord(ctx, "a@example.com", types.OTPTypeReset); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected the record to be purged, got %v", err)
+	}
+	if err := save(); err != nil {
+		t.Fatalf("SaveOTPRecord after the window: %v", err)
+	}
+}
+
+func TestLoginThrottleBacksOff(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	policy := types.LockoutPolicy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: 3 * time.Minute, Window: time.Hour}
+
+	for i, want := range []time.Duration{0, 0, time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		throttle, err := m.RecordLoginFailure(ctx, "account:a@example.com", policy)
+		if err != nil {
+			t.Fatalf("RecordLoginFailure: %v", err)
+		}
+		var got time.Duration
+		if throttle.LockedUntil != nil {
+			got = throttle.LockedUntil.Sub(now)
+		}
+		if got != want {
+			t.Errorf("failure %d: expected a %v lock, got %v", i+1, want, got)
+		}
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err := m.GetLoginThrottle(ctx, "account:a@example.com"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected failures to be forgotten after the window, got %v", err)
+	}
+	if throttle, _ := m.RecordLoginFailure(ctx, "account:a@example.com", policy); throttle.Failures != 1 {
+		t.Errorf("expected the count to start over, got %d", throttle.Failures)
+	}
+}
+
+func TestShareLinkFlow(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	id, err := m.CreateRoute(ctx, types.Route{Name: "Trip", CreatorID: "owner@example.com"})
+	if err != nil {
+		t.Fatalf("CreateRoute: %v", err)
+	}
+	expiry := now.Add(time.Hour)
+	link, err := m.CreateShareLink(ctx, types.ShareLink{RouteID: id, Role: types.RoleContributor, ExpiresAt: &expiry})
+	if err != nil {
+		t.Fatalf("CreateShareLink: %v", err)
+	}
+	if _, err := m.RedeemShareLink(ctx, link.Token, "friend@example.com", "friend@example.com"); err != nil {
+		t.Fatalf("RedeemShareLink: %v", err)
+	}
+	perm, err := m.CheckUserRoutePermission(ctx, "friend@example.com", id)
+	if err != nil || perm != types.RoleContributor {
+		t.Fatalf("expected contributor permission, got %q, %v", perm, err)
+	}
+	shared, err := m.GetSharedRoutesForUser(ctx, "friend@example.com", types.RouteListOptions{})
+	if err != nil || len(shared.Routes) != 1 {
+		t.Fatalf("expected one shared route, got %d, %v", len(shared.Routes), err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := m.GetShareLinkByToken(ctx, link.Token); !errors.Is(err, storage.ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+	if _, err := m.GetShareLinkByToken(ctx, "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestShareLinkRedemptionsAreCounted(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	id, _ := m.CreateRoute(ctx, types.Route{CreatorID: "owner@example.com"})
+	link, _ := m.CreateShareLink(ctx, types.ShareLink{RouteID: id, Role: types.RoleViewer, MaxJoins: 3})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	joined := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			email := fmt.Sprintf("user%d@example.com", i)
+			if _, err := m.RedeemShareLink(ctx, link.Token, email, email); err == nil {
+				mu.Lock()
+				joined++
+				mu.Unlock()
+			} else if !errors.Is(err, storage.ErrExhausted) {
+				t.Errorf("RedeemShareLink: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if joined != 3 {
+		t.Fatalf("expected exactly 3 joins, got %d", joined)
+	}
+	route, _ := m.GetRouteById(ctx, id)
+	if len(route.SharedWith) != 3 {
+		t.Fatalf("expected 3 collaborators, got %d", len(route.SharedWith))
+	}
+}
+
+func TestShareLinkAttemptsAreClaimed(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	id, _ := m.CreateRoute(ctx, types.Route{CreatorID: "owner@example.com"})
+	link, _ := m.CreateShareLink(ctx, types.ShareLink{RouteID: id, Role: types.RoleViewer})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	claimed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.ClaimShareLinkAttempt(ctx, link.ID, 5, time.Minute); err == nil {
+				mu.Lock()
+				claimed++
+				mu.Unlock()
+			} else if !errors.Is(err, storage.ErrRateLimited) {
+				t.Errorf("ClaimShareLinkAttempt: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if claimed != 5 {
+		t.Fatalf("expected exactly 5 attempts before the lock, got %d", claimed)
+	}
+}
+
+func TestTwoFactorAttemptsAreClaimed(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	challenge := types.TwoFactorChallenge{ID: "challenge", Email: "user@example.com", ExpiresAt: time.Now().Add(time.Minute)}
+	if err := m.CreateTwoFactorChallenge(ctx, challenge); err != nil {
+		t.Fatalf("CreateTwoFactorChallenge: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	claimed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.ClaimTwoFactorAttempt(ctx, challenge.ID, 5); err == nil {
+				mu.Lock()
+				claimed++
+				mu.Unlock()
+			} else if !errors.Is(err, storage.ErrExpired) && !errors.Is(err, storage.ErrNotFound) {
+				t.Errorf("ClaimTwoFactorAttempt: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if claimed != 5 {
+		t.Fatalf("expected exactly 5 attempts, got %d", claimed)
+	}
+}
+
+func TestDeleteRouteDropsShares(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	id, _ := m.CreateRoute(ctx, types.Route{CreatorID: "owner@example.com"})
+	if err := m.AddUserToSharedRoute(ctx, id, "friend@example.com", "friend@example.com", types.RoleViewer); err != nil {
+		t.Fatalf("AddUserToSharedRoute: %v", err)
+	}
+	if err := m.DeleteRoute(ctx, id, 0); err != nil {
+		t.Fatalf("DeleteRoute: %v", err)
+	}
+	shared, err := m.GetSharedRoutesForUser(ctx, "friend@example.com", types.RouteListOptions{})
+	if err != nil || len(shared.Routes) != 0 {
+		t.Fatalf("expected no shared routes, got %d, %v", len(shared.Routes), err)
+	}
+	for _, share := range m.routeShares {
+		if share.RouteID == id {
+			t.Fatalf("expected the route's shares to be deleted, found %+v", share)
+		}
+	}
+}
+
+func TestReturnedRoutesAreCopies(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	id, _ := m.CreateRoute(ctx, types.Route{Photos: []types.Photo{{Filename: "a.jpg"}}})
+
+	route, _ := m.GetRouteById(ctx, id)
+	route.Photos[0].Filename = "mutated.jpg"
+
+	again, _ := m.GetRouteById(ctx, id)
+	if again.Photos[0].Filename != "a.jpg" {
+		t.Fatalf("stored route was mutated through returned copy")
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	id, _ := m.CreateRoute(ctx, types.Route{CreatorID: "owner@example.com"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			email := fmt.Sprintf("user%d@example.com", i)
+			_ = m.CreateUser(ctx, types.UserData{Email: email})
+			_ = m.AddUserToSharedRoute(ctx, id, email, email, types.RoleViewer)
+			_, _ = m.ListRoutes(ctx, types.RouteListOptions{})
+		}(i)
+	}
+	wg.Wait()
+
+	route, _ := m.GetRouteById(ctx, id)
+	if len(route.SharedWith) != 50 {
+		t.Fatalf("expected 50 collaborators, got %d", len(route.SharedWith))
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := New().ListRoutes(ctx, types.RouteListOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestListRoutesPagination(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	// Several routes share a timestamp so the ID tie-breaker is exercised.
+	for i := 0; i < 7; i++ {
+		route := types.Route{
+			Name:      fmt.Sprintf("route-%d", i),
+			CreatorID: "owner@example.com",
+			CreatedAt: int64(1000 + i/2),
+		}
+		if i%3 == 0 {
+			route.Photos = []types.Photo{{Filename: "p.jpg"}}
+		}
+		if _, err := m.CreateRoute(ctx, route); err != nil {
+			t.Fatalf("CreateRoute: %v", err)
+		}
+	}
+	m.CreateRoute(ctx, types.Route{Name: "other", CreatorID: "someone@example.com", CreatedAt: 999})
+
+	for _, sortAsc := range []bool{false, true} {
+		opts := types.RouteListOptions{Limit: 3, CreatorID: "owner@example.com", SortAsc: sortAsc}
+		seen := map[string]bool{}
+		var prev int64 = -1
+		pages := 0
+		for {
+			page, err := m.ListRoutes(ctx, opts)
+			if err != nil {
+				t.Fatalf("ListRoutes: %v", err)
+			}
+			pages++
+			for _, r := range page.Routes {
+				if seen[r.ID] {
+					t.Fatalf("route %s returned twice", r.ID)
+				}
+				seen[r.ID] = true
+				if prev != -1 && ((sortAsc && r.CreatedAt < prev) || (!sortAsc && r.CreatedAt > prev)) {
+					t.Fatalf("routes out of order (asc=%v)", sortAsc)
+				}
+				prev = r.CreatedAt
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			opts.Cursor = page.NextCursor
+		}
+		if len(seen) != 7 || pages != 3 {
+			t.Fatalf("asc=%v: expected 7 routes over 3 pages, got %d over %d", sortAsc, len(seen), pages)
+		}
+	}
+
+	hasPhotos := true
+	page, _ := m.ListRoutes(ctx, types.RouteListOptions{HasPhotos: &hasPhotos})
+	if len(page.Routes) != 3 {
+		t.Errorf("expected 3 routes with photos, got %d", len(page.Routes))
+	}
+	page, _ = m.ListRoutes(ctx, types.RouteListOptions{CreatedAfter: 1001, CreatedBefore: 1003})
+	if len(page.Routes) != 4 {
+		t.Errorf("expected 4 routes in date range, got %d", len(page.Routes))
+	}
+
+	first, _ := m.ListRoutes(ctx, types.RouteListOptions{Limit: 1, SortBy: "name"})
+	if _, err := m.ListRoutes(ctx, types.RouteListOptions{Cursor: first.NextCursor, SortBy: "updatedAt"}); !errors.Is(err, storage.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor when sort changes, got %v", err)
+	}
+}
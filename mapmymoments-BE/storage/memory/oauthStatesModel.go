@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+func (m *Memory) SaveOAuthState(ctx context.Context, state types.OAuthState) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.oauthStates[state.ID]; exists {
+		return storage.ErrConflict
+	}
+	m.oauthStates[state.ID] = state
+	return nil
+}
+
+func (m *Memory) ConsumeOAuthState(ctx context.Context, id string) (types.OAuthState, error) {
+	if err := ctx.Err(); err != nil {
+		return types.OAuthState{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, ok := m.oauthStates[id]
+	if !ok {
+		return types.OAuthState{}, storage.ErrNotFound
+	}
+	delete(m.oauthStates, id)
+	if !state.ExpiresAt.After(m.now()) {
+		return types.OAuthState{}, storage.ErrExpired
+	}
+	return state, nil
+}
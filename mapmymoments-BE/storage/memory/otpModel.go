@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+func otpKey(email, otpType string) string {
+	return email + "|" + otpType
+}
+
+func (m *Memory) SaveOTPRecord(ctx context.Context, record types.OTPRecord, policy types.OTPPolicy) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := otpKey(record.Email, record.Type)
+	var prev *types.OTPRecord
+	if r, ok := m.otpRecords[key]; ok {
+		prev = &r
+	}
+	if retryAt, ok := policy.NextSend(&record, prev, m.now()); !ok {
+		return &storage.RetryAfterError{RetryAt: retryAt}
+	}
+	m.otpRecords[key] = cloneOTPRecord(record)
+	return nil
+}
+
+// GetOTPRecord returns the record for email and otpType until it is purged,
+// mirroring the TTL index on the MongoDB collection
+func (m *Memory) GetOTPRecord(ctx context.Context, email, otpType string) (types.OTPRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return types.OTPRecord{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	record, ok := m.otpRecords[otpKey(email, otpType)]
+	if !ok || !record.PurgeAt.After(m.now()) {
+		return types.OTPRecord{}, storage.ErrNotFound
+	}
+	return cloneOTPRecord(record), nil
+}
+
+func (m *Memory) ClaimOTPAttempt(ctx context.Context, email, otpType string, maxAttempts int) (types.OTPRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return types.OTPRecord{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := otpKey(email, otpType)
+	record, ok := m.otpRecords[key]
+	if !ok || record.OTPHash == "" || !record.ExpiresAt.After(m.now()) {
+		return types.OTPRecord{}, storage.ErrNotFound
+	}
+	if record.Attempts >= maxAttempts {
+		return types.OTPRecord{}, storage.ErrExpired
+	}
+	record.Attempts++
+	m.otpRecords[key] = record
+	return cloneOTPRecord(record), nil
+}
+
+// ConsumeOTPRecord uses up the code but keeps the send counters until the
+// quota window is over, so deleting can't be used to get around it
+func (m *Memory) ConsumeOTPRecord(ctx context.Context, email, otpType string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := otpKey(email, otpType)
+	record, ok := m.otpRecords[key]
+	if !ok || record.OTPHash == "" || !record.ExpiresAt.After(m.now()) {
+		return storage.ErrNotFound
+	}
+	record.OTPHash = ""
+	record.SignupReq = nil
+	record.Password = ""
+	m.otpRecords[key] = record
+	return nil
+}
@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+func (m *Memory) SavePendingLink(ctx context.Context, link types.PendingLink) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pendingLinks[link.ID] = link
+	return nil
+}
+
+func (m *Memory) GetPendingLink(ctx context.Context, id string) (types.PendingLink, error) {
+	if err := ctx.Err(); err != nil {
+		return types.PendingLink{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link, err := m.pendingLinkLocked(id)
+	return link, err
+}
+
+func (m *Memory) RecordPendingLinkFailure(ctx context.Context, id string, maxFailures int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link, err := m.pendingLinkLocked(id)
+	if err != nil {
+		return err
+	}
+	link.Failures++
+	if link.Failures >= maxFailures {
+		delete(m.pendingLinks, id)
+		return storage.ErrExpired
+	}
+	m.pendingLinks[id] = link
+	return nil
+}
+
+func (m *Memory) DeletePendingLink(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.pendingLinks[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(m.pendingLinks, id)
+	return nil
+}
+
+// pendingLinkLocked treats expired links as gone, like the TTL index does
+func (m *Memory) pendingLinkLocked(id string) (types.PendingLink, error) {
+	link, ok := m.pendingLinks[id]
+	if !ok {
+		return types.PendingLink{}, storage.ErrNotFound
+	}
+	if !link.ExpiresAt.After(m.now()) {
+		delete(m.pendingLinks, id)
+		return types.PendingLink{}, storage.ErrExpired
+	}
+	return link, nil
+}
@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+func (m *Memory) CreateRefreshToken(ctx context.Context, token types.RefreshToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.refreshTokens[token.ID]; exists {
+		return storage.ErrConflict
+	}
+	m.refreshTokens[token.ID] = token
+	return nil
+}
+
+func (m *Memory) RotateRefreshToken(ctx context.Context, tokenId string, next types.RefreshToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.refreshTokens[tokenId]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	now := m.now()
+	switch {
+	case current.RevokedAt != nil, !current.ExpiresAt.After(now):
+		return storage.ErrExpired
+	case current.UsedAt != nil:
+		return storage.ErrConflict
+	}
+	current.UsedAt = &now
+	current.ReplacedBy = next.ID
+	m.refreshTokens[tokenId] = current
+	m.refreshTokens[next.ID] = next
+	return nil
+}
+
+// revokeFamilyLocked revokes every live refresh token in a family. Callers
+// must hold m.mu for writing.
+func (m *Memory) revokeFamilyLocked(familyId string) {
+	now := m.now()
+	for id, token := range m.refreshTokens {
+		if token.FamilyID == familyId && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			m.refreshTokens[id] = token
+		}
+	}
+}
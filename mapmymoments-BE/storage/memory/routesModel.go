@@ -0,0 +1,422 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (m *Memory) CreateRoute(ctx context.Context, r types.Route) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r.ID == "" {
+		r.ID = primitive.NewObjectID().Hex()
+	}
+	if _, ok := m.routes[r.ID]; ok {
+		return "", fmt.Errorf("route %s already exists: %w", r.ID, storage.ErrConflict)
+	}
+	if r.CreatedAt == 0 {
+		r.CreatedAt = m.now().UnixMilli()
+	}
+	if r.UpdatedAt == 0 {
+		r.UpdatedAt = r.CreatedAt
+	}
+	if r.Visibility == "" {
+		r.Visibility = types.VisibilityPrivate
+	}
+	r.Version = 1
+	m.routes[r.ID] = cloneRoute(r)
+	return r.ID, nil
+}
+
+func (m *Memory) GetRouteById(ctx context.Context, id string) (types.Route, error) {
+	if err := ctx.Err(); err != nil {
+		return types.Route{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	route, ok := m.routes[id]
+	if !ok {
+		return types.Route{}, storage.ErrNotFound
+	}
+	return cloneRoute(route), nil
+}
+
+func (m *Memory) ListRoutes(ctx context.Context, opts types.RouteListOptions) (types.RoutePage, error) {
+	if err := ctx.Err(); err != nil {
+		return types.RoutePage{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.listRoutesLocked(func(types.Route) bool { return true }, opts)
+}
+
+func (m *Memory) UpdateRoute(ctx context.Context, id string, r types.Route, expectedVersion int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.routes[id]
+	if !ok {
+		return 0, storage.ErrNotFound
+	}
+	if expectedVersion > 0 && existing.Version != expectedVersion {
+		return 0, storage.ErrVersionMismatch
+	}
+	// Fields managed by dedicated methods are carried over untouched
+	r.ID = id
+	r.CreatorID = existing.CreatorID
+	r.CreatedAt = existing.CreatedAt
+	r.Visibility = existing.Visibility
+	r.SharedWith = existing.SharedWith
+	r.PendingTransfer = existing.PendingTransfer
+	r.UpdatedAt = m.now().UnixMilli()
+	r.Version = existing.Version + 1
+	m.routes[id] = cloneRoute(r)
+	return r.Version, nil
+}
+
+func (m *Memory) DeleteRoute(ctx context.Context, id string, expectedVersion int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.routes[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if expectedVersion > 0 && existing.Version != expectedVersion {
+		return storage.ErrVersionMismatch
+	}
+	delete(m.routes, id)
+	m.deleteRouteSharesLocked(id)
+	m.deleteShareLinksLocked(id)
+	m.deleteInvitationsLocked(id)
+	m.deleteJoinRequestsLocked(id)
+	return nil
+}
+
+func (m *Memory) SetRouteVisibility(ctx context.Context, id, visibility string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	route, ok := m.routes[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	route.Visibility = visibility
+	route.UpdatedAt = m.now().UnixMilli()
+	route.Version++
+	m.routes[id] = route
+	return nil
+}
+
+func (m *Memory) AppendRoutePhotos(ctx context.Context, id string, photos []types.Photo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	route, ok := m.routes[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	route.Photos = append(append([]types.Photo(nil), route.Photos...), photos...)
+	route.UpdatedAt = m.now().UnixMilli()
+	route.Version++
+	m.routes[id] = route
+	return nil
+}
+
+func (m *Memory) AddUserToSharedRoute(ctx context.Context, routeId, userId, email, role string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	route, ok := m.routes[routeId]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if !hasCollaborator(route, userId) {
+		m.addCollaboratorLocked(route, userId, email, role)
+	}
+	return nil
+}
+
+// hasCollaborator reports whether userId is in route.SharedWith.
+func hasCollaborator(route types.Route, userId string) bool {
+	for _, user := range route.SharedWith {
+		if user.UserID == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteRouteSharesLocked drops the route_shares mirror rows for a route.
+// Callers must hold m.mu for writing.
+func (m *Memory) deleteRouteSharesLocked(routeId string) {
+	kept := m.routeShares[:0]
+	for _, share := range m.routeShares {
+		if share.RouteID != routeId {
+			kept = append(kept, share)
+		}
+	}
+	m.routeShares = kept
+}
+
+// addCollaboratorLocked appends a collaborator to the route and the
+// route_shares mirror. Callers must hold m.mu for writing.
+func (m *Memory) addCollaboratorLocked(route types.Route, userId, email, role string) {
+	now := m.now()
+	route.SharedWith = append(append([]types.SharedUser(nil), route.SharedWith...), types.SharedUser{
+		UserID:     userId,
+		Email:      email,
+		Permission: role,
+		SharedAt:   now,
+	})
+	route.UpdatedAt = now.UnixMilli()
+	route.Version++
+	m.routes[route.ID] = route
+	m.routeShares = append(m.routeShares, types.RouteShare{
+		UserID:     userId,
+		RouteID:    route.ID,
+		Permission: role,
+		SharedAt:   now,
+	})
+}
+
+func (m *Memory) UpdateCollaboratorRole(ctx context.Context, routeId, userId, role string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	route, ok := m.routes[routeId]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	found := false
+	shared := append([]types.SharedUser(nil), route.SharedWith...)
+	for i := range shared {
+		if shared[i].UserID == userId {
+			shared[i].Permission = role
+			found = true
+		}
+	}
+	if !found {
+		return storage.ErrNotFound
+	}
+	route.SharedWith = shared
+	route.UpdatedAt = m.now().UnixMilli()
+	route.Version++
+	m.routes[routeId] = route
+	for i := range m.routeShares {
+		if m.routeShares[i].RouteID == routeId && m.routeShares[i].UserID == userId {
+			m.routeShares[i].Permission = role
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RemoveCollaborator(ctx context.Context, routeId, userId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	route, ok := m.routes[routeId]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	shared := make([]types.SharedUser, 0, len(route.SharedWith))
+	for _, user := range route.SharedWith {
+		if user.UserID != userId {
+			shared = append(shared, user)
+		}
+	}
+	if len(shared) == len(route.SharedWith) {
+		return storage.ErrNotFound
+	}
+	route.SharedWith = shared
+	route.UpdatedAt = m.now().UnixMilli()
+	route.Version++
+	m.routes[routeId] = route
+
+	kept := m.routeShares[:0]
+	for _, share := range m.routeShares {
+		if share.RouteID != routeId || share.UserID != userId {
+			kept = append(kept, share)
+		}
+	}
+	m.routeShares = kept
+	return nil
+}
+
+func (m *Memory) GetSharedRoutesForUser(ctx context.Context, userId string, opts types.RouteListOptions) (types.RoutePage, error) {
+	if err := ctx.Err(); err != nil {
+		return types.RoutePage{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.listRoutesLocked(func(r types.Route) bool {
+		for _, user := range r.SharedWith {
+			if user.UserID == userId {
+				return true
+			}
+		}
+		return false
+	}, opts)
+}
+
+func (m *Memory) GetUsersByRouteId(ctx context.Context, routeId string) ([]types.UserData, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	route, ok := m.routes[routeId]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	var users []types.UserData
+	if creator, ok := m.users[route.CreatorID]; ok {
+		users = append(users, cloneUser(creator))
+	}
+	for _, shared := range route.SharedWith {
+		if user, ok := m.users[shared.Email]; ok {
+			users = append(users, cloneUser(user))
+		}
+	}
+	return users, nil
+}
+
+func (m *Memory) CheckUserRoutePermission(ctx context.Context, userId, routeId string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	route, ok := m.routes[routeId]
+	if !ok {
+		return "", storage.ErrNotFound
+	}
+	if route.CreatorID == userId {
+		return types.RoleOwner, nil
+	}
+	for _, shared := range route.SharedWith {
+		if shared.UserID == userId {
+			return types.NormalizeRole(shared.Permission), nil
+		}
+	}
+	return "", nil // No permission
+}
+
+func (m *Memory) RevokeRouteShare(ctx context.Context, routeId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	route, ok := m.routes[routeId]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	route.SharedWith = []types.SharedUser{}
+	route.UpdatedAt = m.now().UnixMilli()
+	route.Version++
+	m.routes[routeId] = route
+
+	m.deleteRouteSharesLocked(routeId)
+	m.deleteShareLinksLocked(routeId)
+	m.deleteInvitationsLocked(routeId)
+	m.deleteJoinRequestsLocked(routeId)
+	return nil
+}
+
+// listRoutesLocked applies the same filtering, ordering and cursor semantics
+// as the MongoDB implementation. Callers must hold m.mu.
+func (m *Memory) listRoutesLocked(keep func(types.Route) bool, opts types.RouteListOptions) (types.RoutePage, error) {
+	opts = storage.NormalizeListOptions(opts)
+	cursor, err := storage.DecodeRouteCursor(opts)
+	if err != nil {
+		return types.RoutePage{}, err
+	}
+
+	routes := []types.Route{}
+	for _, r := range m.routes {
+		if !keep(r) {
+			continue
+		}
+		if opts.CreatorID != "" && r.CreatorID != opts.CreatorID {
+			continue
+		}
+		if opts.Visibility != "" && r.Visibility != opts.Visibility {
+			continue
+		}
+		if opts.CreatedAfter != 0 && r.CreatedAt < opts.CreatedAfter {
+			continue
+		}
+		if opts.CreatedBefore != 0 && r.CreatedAt >= opts.CreatedBefore {
+			continue
+		}
+		if opts.HasPhotos != nil && (len(r.Photos) > 0) != *opts.HasPhotos {
+			continue
+		}
+		routes = append(routes, r)
+	}
+
+	// less reports whether a sorts before b in ascending order.
+	less := func(a, b types.Route) bool {
+		switch opts.SortBy {
+		case "updatedAt":
+			if a.UpdatedAt != b.UpdatedAt {
+				return a.UpdatedAt < b.UpdatedAt
+			}
+		case "name":
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+		default:
+			if a.CreatedAt != b.CreatedAt {
+				return a.CreatedAt < b.CreatedAt
+			}
+		}
+		return a.ID < b.ID
+	}
+	before := func(a, b types.Route) bool {
+		if opts.SortAsc {
+			return less(a, b)
+		}
+		return less(b, a)
+	}
+	sort.Slice(routes, func(i, j int) bool { return before(routes[i], routes[j]) })
+
+	if cursor != nil {
+		last := types.Route{ID: cursor.ID, Name: cursor.Str, CreatedAt: cursor.Num, UpdatedAt: cursor.Num}
+		start := sort.Search(len(routes), func(i int) bool { return before(last, routes[i]) })
+		routes = routes[start:]
+	}
+
+	page := types.RoutePage{Routes: []types.Route{}}
+	for i, r := range routes {
+		if i == opts.Limit {
+			page.NextCursor = storage.EncodeRouteCursor(opts, page.Routes[opts.Limit-1])
+			break
+		}
+		page.Routes = append(page.Routes, cloneRoute(r))
+	}
+	return page, nil
+}
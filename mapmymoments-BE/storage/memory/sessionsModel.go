@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+func (m *Memory) CreateSession(ctx context.Context, session types.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.sessions[session.ID]; exists {
+		return storage.ErrConflict
+	}
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *Memory) GetSession(ctx context.Context, sessionId string) (types.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return types.Session{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	session, ok := m.activeSessionLocked(sessionId)
+	if !ok {
+		return types.Session{}, storage.ErrNotFound
+	}
+	return session, nil
+}
+
+func (m *Memory) ListSessions(ctx context.Context, userId string) ([]types.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sessions := []types.Session{}
+	for id := range m.sessions {
+		if session, ok := m.activeSessionLocked(id); ok && session.UserID == userId {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastUsedAt.Equal(sessions[j].LastUsedAt) {
+			return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+		}
+		return sessions[i].ID < sessions[j].ID
+	})
+	return sessions, nil
+}
+
+func (m *Memory) TouchSession(ctx context.Context, sessionId, ip string, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.activeSessionLocked(sessionId)
+	if !ok {
+		return storage.ErrNotFound
+	}
+	session.LastUsedAt = m.now()
+	session.IP = ip
+	session.ExpiresAt = expiresAt
+	m.sessions[sessionId] = session
+	return nil
+}
+
+func (m *Memory) RevokeSession(ctx context.Context, userId, sessionId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.activeSessionLocked(sessionId)
+	if !ok || session.UserID != userId {
+		return storage.ErrNotFound
+	}
+	m.revokeSessionLocked(session)
+	return nil
+}
+
+func (m *Memory) RevokeOtherSessions(ctx context.Context, userId, keepSessionId string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	revoked := 0
+	for id := range m.sessions {
+		session, ok := m.activeSessionLocked(id)
+		if ok && session.UserID == userId && id != keepSessionId {
+			m.revokeSessionLocked(session)
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+// activeSessionLocked returns the session if it exists and is neither
+// revoked nor expired. Callers must hold m.mu.
+func (m *Memory) activeSessionLocked(sessionId string) (types.Session, bool) {
+	session, ok := m.sessions[sessionId]
+	if !ok || session.RevokedAt != nil || !session.ExpiresAt.After(m.now()) {
+		return types.Session{}, false
+	}
+	return session, true
+}
+
+// revokeSessionLocked ends a session and its refresh tokens. Callers must
+// hold m.mu for writing.
+func (m *Memory) revokeSessionLocked(session types.Session) {
+	now := m.now()
+	session.RevokedAt = &now
+	m.sessions[session.ID] = session
+	m.revokeFamilyLocked(session.ID)
+}
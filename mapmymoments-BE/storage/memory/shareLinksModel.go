@@ -0,0 +1,202 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (m *Memory) CreateShareLink(ctx context.Context, link types.ShareLink) (types.ShareLink, error) {
+	if err := ctx.Err(); err != nil {
+		return types.ShareLink{}, err
+	}
+	token, err := storage.NewShareToken()
+	if err != nil {
+		return types.ShareLink{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.routes[link.RouteID]; !ok {
+		return types.ShareLink{}, storage.ErrNotFound
+	}
+	link.ID = primitive.NewObjectID().Hex()
+	link.Token = token
+	link.JoinCount = 0
+	link.CreatedAt = m.now()
+	link.LastUsedAt = nil
+	m.shareLinks[link.ID] = cloneShareLink(link)
+	return link, nil
+}
+
+func (m *Memory) ListShareLinks(ctx context.Context, routeId string) ([]types.ShareLink, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.routes[routeId]; !ok {
+		return nil, storage.ErrNotFound
+	}
+	links := []types.ShareLink{}
+	for _, link := range m.shareLinks {
+		if link.RouteID == routeId {
+			links = append(links, cloneShareLink(link))
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if !links[i].CreatedAt.Equal(links[j].CreatedAt) {
+			return links[i].CreatedAt.Before(links[j].CreatedAt)
+		}
+		return links[i].ID < links[j].ID
+	})
+	return links, nil
+}
+
+func (m *Memory) RevokeShareLink(ctx context.Context, routeId, linkId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link, ok := m.shareLinks[linkId]
+	if !ok || link.RouteID != routeId {
+		return storage.ErrNotFound
+	}
+	delete(m.shareLinks, linkId)
+	m.cancelJoinRequestsLocked(linkId)
+	return nil
+}
+
+func (m *Memory) RotateShareLink(ctx context.Context, routeId, linkId string) (types.ShareLink, error) {
+	if err := ctx.Err(); err != nil {
+		return types.ShareLink{}, err
+	}
+	token, err := storage.NewShareToken()
+	if err != nil {
+		return types.ShareLink{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link, ok := m.shareLinks[linkId]
+	if !ok || link.RouteID != routeId {
+		return types.ShareLink{}, storage.ErrNotFound
+	}
+	link.Token = token
+	m.shareLinks[linkId] = link
+	m.cancelJoinRequestsLocked(linkId)
+	return cloneShareLink(link), nil
+}
+
+func (m *Memory) GetShareLinkByToken(ctx context.Context, token string) (types.ShareLink, error) {
+	if err := ctx.Err(); err != nil {
+		return types.ShareLink{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	link, ok := m.shareLinkByTokenLocked(token)
+	if !ok {
+		return types.ShareLink{}, storage.ErrNotFound
+	}
+	if err := storage.CheckShareLink(link, m.now()); err != nil {
+		return types.ShareLink{}, err
+	}
+	return cloneShareLink(link), nil
+}
+
+func (m *Memory) RedeemShareLink(ctx context.Context, token, userId, email string) (types.ShareLink, error) {
+	if err := ctx.Err(); err != nil {
+		return types.ShareLink{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link, ok := m.shareLinkByTokenLocked(token)
+	if !ok {
+		return types.ShareLink{}, storage.ErrNotFound
+	}
+	route, ok := m.routes[link.RouteID]
+	if !ok {
+		return types.ShareLink{}, storage.ErrNotFound
+	}
+	if route.CreatorID == userId || hasCollaborator(route, userId) {
+		return cloneShareLink(link), nil
+	}
+	now := m.now()
+	if err := storage.CheckShareLink(link, now); err != nil {
+		return types.ShareLink{}, err
+	}
+	if link.RequireApproval {
+		return types.ShareLink{}, storage.ErrApprovalRequired
+	}
+	link.JoinCount++
+	link.LastUsedAt = &now
+	m.shareLinks[link.ID] = link
+	m.addCollaboratorLocked(route, userId, email, link.Role)
+	return cloneShareLink(link), nil
+}
+
+// shareLinkByTokenLocked finds a link by token. Callers must hold m.mu.
+func (m *Memory) shareLinkByTokenLocked(token string) (types.ShareLink, bool) {
+	if token == "" {
+		return types.ShareLink{}, false
+	}
+	for _, link := range m.shareLinks {
+		if link.Token == token {
+			return link, true
+		}
+	}
+	return types.ShareLink{}, false
+}
+
+// deleteShareLinksLocked drops every link for a route. Callers must hold
+// m.mu for writing.
+func (m *Memory) deleteShareLinksLocked(routeId string) {
+	for id, link := range m.shareLinks {
+		if link.RouteID == routeId {
+			delete(m.shareLinks, id)
+		}
+	}
+}
+
+func (m *Memory) ClaimShareLinkAttempt(ctx context.Context, linkId string, maxFailures int, lockout time.Duration) (types.ShareLink, error) {
+	if err := ctx.Err(); err != nil {
+		return types.ShareLink{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link, ok := m.shareLinks[linkId]
+	if !ok {
+		return types.ShareLink{}, storage.ErrNotFound
+	}
+	now := m.now()
+	if link.LockedUntil != nil && link.LockedUntil.After(now) {
+		return types.ShareLink{}, &storage.RetryAfterError{RetryAt: *link.LockedUntil}
+	}
+	link.FailedAttempts++
+	if link.FailedAttempts >= maxFailures {
+		until := now.Add(lockout)
+		link.LockedUntil = &until
+		link.FailedAttempts = 0
+	}
+	m.shareLinks[linkId] = link
+	return cloneShareLink(link), nil
+}
+
+func (m *Memory) ResetShareLinkFailures(ctx context.Context, linkId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link, ok := m.shareLinks[linkId]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	link.FailedAttempts = 0
+	link.LockedUntil = nil
+	m.shareLinks[linkId] = link
+	return nil
+}
@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+func (m *Memory) OfferOwnershipTransfer(ctx context.Context, routeId string, transfer types.OwnershipTransfer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	route, ok := m.routes[routeId]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if route.CreatorID != transfer.From || !hasCollaborator(route, transfer.To) {
+		return storage.ErrConflict
+	}
+	m.setTransferLocked(route, &transfer)
+	return nil
+}
+
+func (m *Memory) AcceptOwnershipTransfer(ctx context.Context, routeId, userId string) (types.Route, error) {
+	if err := ctx.Err(); err != nil {
+		return types.Route{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	route, ok := m.routes[routeId]
+	if !ok || route.PendingTransfer == nil || route.PendingTransfer.To != userId {
+		return types.Route{}, storage.ErrNotFound
+	}
+	transfer := *route.PendingTransfer
+	now := m.now()
+	if !transfer.ExpiresAt.After(now) {
+		return types.Route{}, storage.ErrExpired
+	}
+	if route.CreatorID != transfer.From || !hasCollaborator(route, userId) {
+		return types.Route{}, storage.ErrConflict
+	}
+
+	shared := make([]types.SharedUser, 0, len(route.SharedWith)+1)
+	for _, user := range route.SharedWith {
+		if user.UserID != userId {
+			shared = append(shared, user)
+		}
+	}
+	kept := m.routeShares[:0]
+	for _, share := range m.routeShares {
+		if share.RouteID != routeId || share.UserID != userId {
+			kept = append(kept, share)
+		}
+	}
+	m.routeShares = kept
+	if transfer.KeepAccess {
+		shared = append(shared, types.SharedUser{
+			UserID:     transfer.From,
+			Email:      transfer.From,
+			Permission: types.RoleCoOwner,
+			SharedAt:   now,
+		})
+		m.routeShares = append(m.routeShares, types.RouteShare{
+			UserID:     transfer.From,
+			RouteID:    routeId,
+			Permission: types.RoleCoOwner,
+			SharedAt:   now,
+		})
+	}
+
+	route.CreatorID = userId
+	route.SharedWith = shared
+	route.PendingTransfer = nil
+	route.UpdatedAt = now.UnixMilli()
+	route.Version++
+	m.routes[routeId] = route
+	return cloneRoute(route), nil
+}
+
+func (m *Memory) DeclineOwnershipTransfer(ctx context.Context, routeId, userId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	route, ok := m.routes[routeId]
+	if !ok || route.PendingTransfer == nil || route.PendingTransfer.To != userId {
+		return storage.ErrNotFound
+	}
+	m.setTransferLocked(route, nil)
+	return nil
+}
+
+func (m *Memory) CancelOwnershipTransfer(ctx context.Context, routeId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	route, ok := m.routes[routeId]
+	if !ok || route.PendingTransfer == nil {
+		return storage.ErrNotFound
+	}
+	m.setTransferLocked(route, nil)
+	return nil
+}
+
+// setTransferLocked replaces the route's pending transfer. Callers must hold
+// m.mu for writing.
+func (m *Memory) setTransferLocked(route types.Route, transfer *types.OwnershipTransfer) {
+	route.PendingTransfer = transfer
+	route.UpdatedAt = m.now().UnixMilli()
+	route.Version++
+	m.routes[route.ID] = route
+}
@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+func (m *Memory) SetTwoFactor(ctx context.Context, email string, twoFactor *types.TwoFactor) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[email]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	user.TwoFactor = cloneTwoFactor(twoFactor)
+	m.users[email] = user
+	return nil
+}
+
+func (m *Memory) UseTOTPStep(ctx context.Context, email string, step int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[email]
+	if !ok || user.TwoFactor == nil {
+		return storage.ErrNotFound
+	}
+	if step <= user.TwoFactor.LastStep {
+		return storage.ErrConflict
+	}
+	user = cloneUser(user)
+	user.TwoFactor.LastStep = step
+	m.users[email] = user
+	return nil
+}
+
+func (m *Memory) UseRecoveryCode(ctx context.Context, email, codeHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[email]
+	if !ok || user.TwoFactor == nil {
+		return storage.ErrNotFound
+	}
+	for i, hash := range user.TwoFactor.RecoveryCodes {
+		if hash == codeHash {
+			user = cloneUser(user)
+			codes := user.TwoFactor.RecoveryCodes
+			user.TwoFactor.RecoveryCodes = append(codes[:i:i], codes[i+1:]...)
+			m.users[email] = user
+			return nil
+		}
+	}
+	return storage.ErrNotFound
+}
+
+func (m *Memory) CreateTwoFactorChallenge(ctx context.Context, challenge types.TwoFactorChallenge) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.twoFactorChallenges[challenge.ID] = challenge
+	return nil
+}
+
+func (m *Memory) ClaimTwoFactorAttempt(ctx context.Context, id string, maxAttempts int) (types.TwoFactorChallenge, error) {
+	if err := ctx.Err(); err != nil {
+		return types.TwoFactorChallenge{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	challenge, err := m.twoFactorChallengeLocked(id)
+	if err != nil {
+		return types.TwoFactorChallenge{}, err
+	}
+	if challenge.Attempts >= maxAttempts {
+		delete(m.twoFactorChallenges, id)
+		return types.TwoFactorChallenge{}, storage.ErrExpired
+	}
+	challenge.Attempts++
+	m.twoFactorChallenges[id] = challenge
+	return challenge, nil
+}
+
+func (m *Memory) DeleteTwoFactorChallenge(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.twoFactorChallenges[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(m.twoFactorChallenges, id)
+	return nil
+}
+
+func (m *Memory) twoFactorChallengeLocked(id string) (types.TwoFactorChallenge, error) {
+	challenge, ok := m.twoFactorChallenges[id]
+	if !ok {
+		return types.TwoFactorChallenge{}, storage.ErrNotFound
+	}
+	if !challenge.ExpiresAt.After(m.now()) {
+		delete(m.twoFactorChallenges, id)
+		return types.TwoFactorChallenge{}, storage.ErrExpired
+	}
+	return challenge, nil
+}
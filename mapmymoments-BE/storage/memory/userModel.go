@@ -0,0 +1,131 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (types.UserData, error) {
+	if err := ctx.Err(); err != nil {
+		return types.UserData{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.users[email]
+	if !ok {
+		return types.UserData{}, storage.ErrNotFound
+	}
+	return cloneUser(user), nil
+}
+
+func (m *Memory) CreateUser(ctx context.Context, user types.UserData) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[user.Email]; ok {
+		return fmt.Errorf("user with this email already exists: %w", storage.ErrConflict)
+	}
+	for _, identity := range user.Identities {
+		if _, ok := m.identityOwnerLocked(identity.Provider, identity.Subject); ok {
+			return fmt.Errorf("identity is linked to another user: %w", storage.ErrConflict)
+		}
+	}
+	m.users[user.Email] = cloneUser(user)
+	return nil
+}
+
+func (m *Memory) UpdateUserPassword(ctx context.Context, email, hashedPassword string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[email]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	user.Password = &hashedPassword
+	user.AuthType = types.AuthTypeFor(true, len(user.Identities))
+	m.users[email] = user
+	return nil
+}
+
+func (m *Memory) GetUserByIdentity(ctx context.Context, provider, subject string) (types.UserData, error) {
+	if err := ctx.Err(); err != nil {
+		return types.UserData{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if user, ok := m.identityOwnerLocked(provider, subject); ok {
+		return cloneUser(user), nil
+	}
+	return types.UserData{}, storage.ErrNotFound
+}
+
+func (m *Memory) LinkIdentity(ctx context.Context, email string, identity types.LinkedIdentity) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[email]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if owner, ok := m.identityOwnerLocked(identity.Provider, identity.Subject); ok {
+		if owner.Email == email {
+			return nil
+		}
+		return fmt.Errorf("identity is linked to another user: %w", storage.ErrConflict)
+	}
+	if _, ok := user.Identity(identity.Provider); ok {
+		return fmt.Errorf("another %s account is already linked: %w", identity.Provider, storage.ErrConflict)
+	}
+	user = cloneUser(user)
+	user.Identities = append(user.Identities, identity)
+	user.AuthType = types.AuthTypeFor(user.Password != nil, len(user.Identities))
+	m.users[email] = user
+	return nil
+}
+
+func (m *Memory) UnlinkIdentity(ctx context.Context, email, provider string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[email]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if _, ok := user.Identity(provider); !ok {
+		return storage.ErrNotFound
+	}
+	if user.Password == nil && len(user.Identities) == 1 {
+		return fmt.Errorf("cannot remove the last way to sign in: %w", storage.ErrConflict)
+	}
+	kept := []types.LinkedIdentity{}
+	for _, identity := range user.Identities {
+		if identity.Provider != provider {
+			kept = append(kept, identity)
+		}
+	}
+	user.Identities = kept
+	user.AuthType = types.AuthTypeFor(user.Password != nil, len(kept))
+	m.users[email] = user
+	return nil
+}
+
+func (m *Memory) identityOwnerLocked(provider, subject string) (types.UserData, bool) {
+	for _, user := range m.users {
+		if identity, ok := user.Identity(provider); ok && identity.Subject == subject {
+			return user, true
+		}
+	}
+	return types.UserData{}, false
+}
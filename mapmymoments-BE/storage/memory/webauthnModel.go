@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+)
+
+func (m *Memory) SaveWebAuthnSession(ctx context.Context, session types.WebAuthnSession) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.webauthnSessions[session.ID]; exists {
+		return storage.ErrConflict
+	}
+	m.webauthnSessions[session.ID] = session
+	return nil
+}
+
+func (m *Memory) ConsumeWebAuthnSession(ctx context.Context, id string) (types.WebAuthnSession, error) {
+	if err := ctx.Err(); err != nil {
+		return types.WebAuthnSession{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.webauthnSessions[id]
+	if !ok {
+		return types.WebAuthnSession{}, storage.ErrNotFound
+	}
+	delete(m.webauthnSessions, id)
+	if !session.ExpiresAt.After(m.now()) {
+		return types.WebAuthnSession{}, storage.ErrExpired
+	}
+	return session, nil
+}
+
+func (m *Memory) CreateWebAuthnCredential(ctx context.Context, credential types.WebAuthnCredential) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.webauthnCredentials[credential.ID]; exists {
+		return storage.ErrConflict
+	}
+	m.webauthnCredentials[credential.ID] = cloneWebAuthnCredential(credential)
+	return nil
+}
+
+func (m *Memory) GetWebAuthnCredential(ctx context.Context, id string) (types.WebAuthnCredential, error) {
+	if err := ctx.Err(); err != nil {
+		return types.WebAuthnCredential{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	credential, ok := m.webauthnCredentials[id]
+	if !ok {
+		return types.WebAuthnCredential{}, storage.ErrNotFound
+	}
+	return cloneWebAuthnCredential(credential), nil
+}
+
+func (m *Memory) ListWebAuthnCredentials(ctx context.Context, email string) ([]types.WebAuthnCredential, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	credentials := []types.WebAuthnCredential{}
+	for _, credential := range m.webauthnCredentials {
+		if credential.UserID == email {
+			credentials = append(credentials, cloneWebAuthnCredential(credential))
+		}
+	}
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].CreatedAt.Before(credentials[j].CreatedAt)
+	})
+	return credentials, nil
+}
+
+func (m *Memory) UpdateWebAuthnCredentialUse(ctx context.Context, id string, signCount uint32, usedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	credential, ok := m.webauthnCredentials[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if signCount <= credential.SignCount && (signCount != 0 || credential.SignCount != 0) {
+		return storage.ErrConflict
+	}
+	credential.SignCount = signCount
+	credential.LastUsedAt = &usedAt
+	m.webauthnCredentials[id] = credential
+	return nil
+}
+
+func (m *Memory) DeleteWebAuthnCredential(ctx context.Context, email, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	credential, ok := m.webauthnCredentials[id]
+	if !ok || credential.UserID != email {
+		return storage.ErrNotFound
+	}
+	delete(m.webauthnCredentials, id)
+	return nil
+}
@@ -0,0 +1,157 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const invitationsCollection = "invitations"
+
+func (m *MongoDB) CreateInvitation(ctx context.Context, inv types.Invitation) (types.Invitation, error) {
+	if _, err := m.GetRouteById(ctx, inv.RouteID); err != nil {
+		return types.Invitation{}, err
+	}
+	coll := m.database.Collection(invitationsCollection)
+	inv.Email = strings.ToLower(inv.Email)
+	now := time.Now()
+
+	// The TTL index removes expired invitations eventually; clear any the
+	// monitor hasn't reached yet so they don't block a fresh invite.
+	if _, err := coll.DeleteMany(ctx, bson.M{
+		"routeId":   inv.RouteID,
+		"email":     inv.Email,
+		"status":    types.InvitationPending,
+		"expiresAt": bson.M{"$lte": now},
+	}); err != nil {
+		return types.Invitation{}, err
+	}
+
+	inv.ID = primitive.NewObjectID().Hex()
+	inv.Status = types.InvitationPending
+	inv.CreatedAt = now
+	inv.RespondedAt = nil
+	if _, err := coll.InsertOne(ctx, inv); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return types.Invitation{}, storage.ErrConflict
+		}
+		return types.Invitation{}, err
+	}
+	return inv, nil
+}
+
+func (m *MongoDB) ListRouteInvitations(ctx context.Context, routeId string) ([]types.Invitation, error) {
+	if _, err := m.GetRouteById(ctx, routeId); err != nil {
+		return nil, err
+	}
+	return m.findPendingInvitations(ctx, bson.M{"routeId": routeId})
+}
+
+func (m *MongoDB) ListInvitationsForEmail(ctx context.Context, email string) ([]types.Invitation, error) {
+	return m.findPendingInvitations(ctx, bson.M{"email": strings.ToLower(email)})
+}
+
+func (m *MongoDB) DeleteInvitation(ctx context.Context, routeId, invitationId string) error {
+	res, err := m.database.Collection(invitationsCollection).DeleteOne(ctx, bson.M{"_id": invitationId, "routeId": routeId})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoDB) RespondToInvitation(ctx context.Context, invitationId, email string, accept bool) (types.Invitation, error) {
+	coll := m.database.Collection(invitationsCollection)
+	now := time.Now()
+	status := types.InvitationDeclined
+	if accept {
+		status = types.InvitationAccepted
+	}
+
+	// Claim the invitation first so two concurrent answers can't both win
+	var inv types.Invitation
+	err := coll.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":       invitationId,
+			"email":     strings.ToLower(email),
+			"status":    types.InvitationPending,
+			"expiresAt": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"status": status, "respondedAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&inv)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.Invitation{}, m.invitationMiss(ctx, invitationId, email)
+	}
+	if err != nil {
+		return types.Invitation{}, err
+	}
+	if !accept {
+		return inv, nil
+	}
+
+	route, err := m.GetRouteById(ctx, inv.RouteID)
+	if err == nil && route.CreatorID != email {
+		err = m.AddUserToSharedRoute(ctx, inv.RouteID, email, email, inv.Role)
+	}
+	if err != nil {
+		// Put the invitation back so the user can try again
+		if _, revertErr := coll.UpdateOne(ctx, bson.M{"_id": invitationId},
+			bson.M{"$set": bson.M{"status": types.InvitationPending}, "$unset": bson.M{"respondedAt": ""}},
+		); revertErr != nil {
+			fmt.Printf("Warning: Failed to restore invitation: %v\n", revertErr)
+		}
+		return types.Invitation{}, err
+	}
+	return inv, nil
+}
+
+// invitationMiss works out why RespondToInvitation matched nothing.
+func (m *MongoDB) invitationMiss(ctx context.Context, invitationId, email string) error {
+	var inv types.Invitation
+	err := m.database.Collection(invitationsCollection).FindOne(ctx,
+		bson.M{"_id": invitationId, "email": strings.ToLower(email)},
+	).Decode(&inv)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return storage.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if inv.Status != types.InvitationPending {
+		return storage.ErrConflict
+	}
+	return storage.ErrExpired
+}
+
+func (m *MongoDB) findPendingInvitations(ctx context.Context, filter bson.M) ([]types.Invitation, error) {
+	filter["status"] = types.InvitationPending
+	filter["expiresAt"] = bson.M{"$gt": time.Now()}
+	cur, err := m.database.Collection(invitationsCollection).Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	invitations := []types.Invitation{}
+	if err := cur.All(ctx, &invitations); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (m *MongoDB) deleteInvitations(ctx context.Context, routeId string) error {
+	_, err := m.database.Collection(invitationsCollection).DeleteMany(ctx, bson.M{"routeId": routeId})
+	return err
+}
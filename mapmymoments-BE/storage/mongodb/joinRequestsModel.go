@@ -0,0 +1,181 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const joinRequestsCollection = "join_requests"
+
+func (m *MongoDB) RequestToJoin(ctx context.Context, token, userId, email string) (types.JoinRequest, error) {
+	link, err := m.GetShareLinkByToken(ctx, token)
+	if err != nil {
+		return types.JoinRequest{}, err
+	}
+	route, err := m.GetRouteById(ctx, link.RouteID)
+	if err != nil {
+		return types.JoinRequest{}, err
+	}
+	req := types.JoinRequest{
+		ID:        primitive.NewObjectID().Hex(),
+		RouteID:   route.ID,
+		RouteName: route.Name,
+		LinkID:    link.ID,
+		UserID:    userId,
+		Email:     email,
+		Role:      link.Role,
+		Status:    types.JoinRequestPending,
+		CreatedAt: time.Now(),
+	}
+	coll := m.database.Collection(joinRequestsCollection)
+	_, err = coll.InsertOne(ctx, req)
+	if mongo.IsDuplicateKeyError(err) {
+		// Already waiting on an answer; hand back that request
+		var existing types.JoinRequest
+		err = coll.FindOne(ctx, bson.M{
+			"routeId": route.ID,
+			"userId":  userId,
+			"status":  types.JoinRequestPending,
+		}).Decode(&existing)
+		return existing, err
+	}
+	if err != nil {
+		return types.JoinRequest{}, err
+	}
+	return req, nil
+}
+
+func (m *MongoDB) ListJoinRequests(ctx context.Context, routeId string) ([]types.JoinRequest, error) {
+	if _, err := m.GetRouteById(ctx, routeId); err != nil {
+		return nil, err
+	}
+	return m.findJoinRequests(ctx, bson.M{"routeId": routeId, "status": types.JoinRequestPending}, 1)
+}
+
+func (m *MongoDB) ListJoinRequestsForUser(ctx context.Context, userId string) ([]types.JoinRequest, error) {
+	return m.findJoinRequests(ctx, bson.M{"userId": userId}, -1)
+}
+
+func (m *MongoDB) DecideJoinRequest(ctx context.Context, routeId, requestId, decidedBy string, approve bool) (types.JoinRequest, error) {
+	coll := m.database.Collection(joinRequestsCollection)
+	now := time.Now()
+	status := types.JoinRequestRejected
+	if approve {
+		status = types.JoinRequestApproved
+	}
+
+	// Claim the request first so concurrent decisions can't both apply
+	var req types.JoinRequest
+	err := coll.FindOneAndUpdate(ctx,
+		bson.M{"_id": requestId, "routeId": routeId, "status": types.JoinRequestPending},
+		bson.M{"$set": bson.M{"status": status, "decidedAt": now, "decidedBy": decidedBy}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&req)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		n, countErr := coll.CountDocuments(ctx, bson.M{"_id": requestId, "routeId": routeId})
+		if countErr != nil {
+			return types.JoinRequest{}, countErr
+		}
+		if n == 0 {
+			return types.JoinRequest{}, storage.ErrNotFound
+		}
+		return types.JoinRequest{}, storage.ErrConflict
+	}
+	if err != nil {
+		return types.JoinRequest{}, err
+	}
+	if !approve {
+		return req, nil
+	}
+
+	if err := m.approveJoinRequest(ctx, req, now); err != nil {
+		// Leave the request pending so it can be approved again, or rejected
+		if _, revertErr := coll.UpdateOne(ctx, bson.M{"_id": requestId},
+			bson.M{"$set": bson.M{"status": types.JoinRequestPending}, "$unset": bson.M{"decidedAt": "", "decidedBy": ""}},
+		); revertErr != nil {
+			fmt.Printf("Warning: Failed to restore join request: %v\n", revertErr)
+		}
+		return types.JoinRequest{}, err
+	}
+	return req, nil
+}
+
+// approveJoinRequest adds the requester with the link's role. Like
+// RedeemShareLink, the join is counted against the link in the same step
+// that checks it is still usable, and given back if nobody was added.
+func (m *MongoDB) approveJoinRequest(ctx context.Context, req types.JoinRequest, now time.Time) error {
+	permission, err := m.CheckUserRoutePermission(ctx, req.UserID, req.RouteID)
+	if err != nil || permission != "" {
+		return err
+	}
+
+	links := m.database.Collection(shareLinksCollection)
+	filter := usableShareLink(now)
+	filter["_id"] = req.LinkID
+	res, err := links.UpdateOne(ctx, filter,
+		bson.M{"$inc": bson.M{"joinCount": 1}, "$set": bson.M{"lastUsedAt": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		// Report why the link is no longer usable
+		var link types.ShareLink
+		err := links.FindOne(ctx, bson.M{"_id": req.LinkID}).Decode(&link)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return storage.ErrExpired
+		}
+		if err != nil {
+			return err
+		}
+		if err := storage.CheckShareLink(link, now); err != nil {
+			return err
+		}
+		return storage.ErrExhausted
+	}
+
+	added, err := m.addCollaborator(ctx, req.RouteID, req.UserID, req.Email, req.Role)
+	if err != nil || !added {
+		if _, decErr := links.UpdateOne(ctx, bson.M{"_id": req.LinkID}, bson.M{"$inc": bson.M{"joinCount": -1}}); decErr != nil {
+			fmt.Printf("Warning: Failed to release share link join: %v\n", decErr)
+		}
+	}
+	return err
+}
+
+// cancelJoinRequests cancels the pending requests filed through a link.
+func (m *MongoDB) cancelJoinRequests(ctx context.Context, linkId string) error {
+	_, err := m.database.Collection(joinRequestsCollection).UpdateMany(ctx,
+		bson.M{"linkId": linkId, "status": types.JoinRequestPending},
+		bson.M{"$set": bson.M{"status": types.JoinRequestCancelled, "decidedAt": time.Now()}},
+	)
+	return err
+}
+
+func (m *MongoDB) findJoinRequests(ctx context.Context, filter bson.M, order int) ([]types.JoinRequest, error) {
+	cur, err := m.database.Collection(joinRequestsCollection).Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: order}, {Key: "_id", Value: order}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	requests := []types.JoinRequest{}
+	if err := cur.All(ctx, &requests); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+func (m *MongoDB) deleteJoinRequests(ctx context.Context, routeId string) error {
+	_, err := m.database.Collection(joinRequestsCollection).DeleteMany(ctx, bson.M{"routeId": routeId})
+	return err
+}
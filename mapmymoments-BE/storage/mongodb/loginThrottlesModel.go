@@ -0,0 +1,99 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const loginThrottlesCollection = "login_throttles"
+
+func (m *MongoDB) RecordLoginFailure(ctx context.Context, key string, policy types.LockoutPolicy) (types.LoginThrottle, error) {
+	coll := m.database.Collection(loginThrottlesCollection)
+	now := time.Now()
+	// A pipeline update counts the failure and starts the count over after
+	// a quiet window in one step
+	recent := bson.M{"$gt": bson.A{"$lastFailureAt", now.Add(-policy.Window)}}
+	var throttle types.LoginThrottle
+	err := coll.FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"failures":      bson.M{"$cond": bson.A{recent, bson.M{"$add": bson.A{"$failures", 1}}, 1}},
+				"lastFailureAt": now,
+				"expiresAt":     now.Add(policy.Window),
+			}}},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&throttle)
+	if err != nil {
+		return types.LoginThrottle{}, err
+	}
+	delay := policy.Delay(throttle.Failures)
+	if delay == 0 {
+		return throttle, nil
+	}
+	// $max so a racing failure with a shorter delay can't shorten the lock
+	until := now.Add(delay)
+	if _, err := coll.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$max": bson.M{"lockedUntil": until}}); err != nil {
+		return types.LoginThrottle{}, err
+	}
+	if throttle.LockedUntil == nil || until.After(*throttle.LockedUntil) {
+		throttle.LockedUntil = &until
+	}
+	return throttle, nil
+}
+
+func (m *MongoDB) GetLoginThrottle(ctx context.Context, key string) (types.LoginThrottle, error) {
+	var throttle types.LoginThrottle
+	err := m.database.Collection(loginThrottlesCollection).FindOne(ctx, bson.M{
+		"_id":       key,
+		"expiresAt": bson.M{"$gt": time.Now()}, // the TTL monitor only runs once a minute
+	}).Decode(&throttle)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.LoginThrottle{}, storage.ErrNotFound
+	}
+	return throttle, err
+}
+
+func (m *MongoDB) ClearLoginThrottle(ctx context.Context, key string) error {
+	_, err := m.database.Collection(loginThrottlesCollection).DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+func (m *MongoDB) SetLoginUnlockToken(ctx context.Context, key, tokenHash string) error {
+	res, err := m.database.Collection(loginThrottlesCollection).UpdateOne(ctx,
+		bson.M{"_id": key, "expiresAt": bson.M{"$gt": time.Now()}},
+		bson.M{"$set": bson.M{"unlockTokenHash": tokenHash}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoDB) UnlockLogin(ctx context.Context, tokenHash string) error {
+	if tokenHash == "" {
+		return storage.ErrNotFound
+	}
+	res, err := m.database.Collection(loginThrottlesCollection).DeleteOne(ctx, bson.M{
+		"unlockTokenHash": tokenHash,
+		"expiresAt":       bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
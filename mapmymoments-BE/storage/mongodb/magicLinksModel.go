@@ -0,0 +1,39 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const magicLinksCollection = "magic_links"
+
+func (m *MongoDB) SaveMagicLink(ctx context.Context, link types.MagicLink) error {
+	_, err := m.database.Collection(magicLinksCollection).InsertOne(ctx, link)
+	if mongo.IsDuplicateKeyError(err) {
+		return storage.ErrConflict
+	}
+	return err
+}
+
+func (m *MongoDB) ConsumeMagicLink(ctx context.Context, id string) (types.MagicLink, error) {
+	var link types.MagicLink
+	// Deleting on read means a link signs in at most once
+	err := m.database.Collection(magicLinksCollection).FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&link)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.MagicLink{}, storage.ErrNotFound
+	}
+	if err != nil {
+		return types.MagicLink{}, err
+	}
+	// The TTL monitor only runs once a minute
+	if !link.ExpiresAt.After(time.Now()) {
+		return types.MagicLink{}, storage.ErrExpired
+	}
+	return link, nil
+}
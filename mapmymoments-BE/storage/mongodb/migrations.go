@@ -0,0 +1,581 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrSchemaTooNew is returned when the database has been migrated by a newer
+// build than this one. Running against it could corrupt data written in a
+// shape we don't understand, so startup is refused.
+var ErrSchemaTooNew = errors.New("database schema is newer than this build supports")
+
+// ErrSchemaBehind is returned at startup when migrations are pending and
+// automatic migration is disabled.
+var ErrSchemaBehind = errors.New("database schema has pending migrations")
+
+const migrationsCollection = "schema_migrations"
+
+// migration is a single ordered schema change. Up must be idempotent: two
+// instances starting at once may both run it before either records it.
+type migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+type migrationRecord struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+}
+
+// migrations must stay sorted by Version and must never be edited once
+// released; add a new entry instead.
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "TTL index on otp_records.expires_at",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("otp_records").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.M{"expires_at": 1},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			})
+			return err
+		},
+	},
+	{
+		Version:     2,
+		Description: "unique indexes on users.email and users.googleid",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.M{"email": 1}, Options: options.Index().SetUnique(true)},
+				{
+					Keys: bson.M{"googleid": 1},
+					Options: options.Index().SetUnique(true).
+						SetPartialFilterExpression(bson.M{"googleid": bson.M{"$type": "string"}}),
+				},
+			})
+			return err
+		},
+	},
+	{
+		Version:     3,
+		Description: "route listing, share token and collaborator indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("routes").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+				{Keys: bson.D{{Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}}},
+				{Keys: bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+				{Keys: bson.D{{Key: "creatorId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+				{Keys: bson.D{{Key: "sharedWith.userId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+				{
+					Keys: bson.M{"shareToken": 1},
+					Options: options.Index().SetUnique(true).
+						SetPartialFilterExpression(bson.M{"shareToken": bson.M{"$type": "string"}}),
+				},
+			})
+			if err != nil {
+				return err
+			}
+			_, err = db.Collection("route_shares").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "routeId", Value: 1}, {Key: "userId", Value: 1}}},
+				{Keys: bson.M{"userId": 1}},
+			})
+			return err
+		},
+	},
+	{
+		Version:     4,
+		Description: "normalise missing or null routes.sharedWith to an empty array",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("routes").UpdateMany(ctx,
+				bson.M{"sharedWith": nil}, // matches both null and missing
+				bson.M{"$set": bson.M{"sharedWith": bson.A{}}},
+			)
+			return err
+		},
+	},
+	{
+		Version:     5,
+		Description: "$jsonSchema validators for users and routes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			users := bson.M{
+				"bsonType": "object",
+				"required": bson.A{"email"},
+				"properties": bson.M{
+					"email":    bson.M{"bsonType": "string"},
+					"password": bson.M{"bsonType": bson.A{"string", "null"}},
+					"googleid": bson.M{"bsonType": bson.A{"string", "null"}},
+					"authtype": bson.M{"bsonType": "string"},
+				},
+			}
+			routes := bson.M{
+				"bsonType": "object",
+				"required": bson.A{"_id", "creatorId", "createdAt", "sharedWith"},
+				"properties": bson.M{
+					"_id":        bson.M{"bsonType": "string"},
+					"creatorId":  bson.M{"bsonType": "string"},
+					"createdAt":  bson.M{"bsonType": "long"},
+					"updatedAt":  bson.M{"bsonType": "long"},
+					"photos":     bson.M{"bsonType": bson.A{"array", "null"}},
+					"sharedWith": bson.M{"bsonType": "array"},
+				},
+			}
+			if err := setValidator(ctx, db, "users", users); err != nil {
+				return err
+			}
+			return setValidator(ctx, db, "routes", routes)
+		},
+	},
+	{
+		Version:     6,
+		Description: "backfill routes.version and normalise null routes.photos",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			coll := db.Collection("routes")
+			if _, err := coll.UpdateMany(ctx,
+				bson.M{"version": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"version": int64(1)}},
+			); err != nil {
+				return err
+			}
+			_, err := coll.UpdateMany(ctx,
+				bson.M{"photos": nil},
+				bson.M{"$set": bson.M{"photos": bson.A{}}},
+			)
+			return err
+		},
+	},
+	{
+		Version:     7,
+		Description: "replace routes.isPublic with routes.visibility",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			coll := db.Collection("routes")
+			if _, err := coll.UpdateMany(ctx,
+				bson.M{"visibility": bson.M{"$exists": false}, "isPublic": true},
+				bson.M{"$set": bson.M{"visibility": "public"}},
+			); err != nil {
+				return err
+			}
+			if _, err := coll.UpdateMany(ctx,
+				bson.M{"visibility": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"visibility": "private"}},
+			); err != nil {
+				return err
+			}
+			if _, err := coll.UpdateMany(ctx,
+				bson.M{"isPublic": bson.M{"$exists": true}},
+				bson.M{"$unset": bson.M{"isPublic": ""}},
+			); err != nil {
+				return err
+			}
+			_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "visibility", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}},
+			})
+			return err
+		},
+	},
+	{
+		Version:     8,
+		Description: "rename the legacy upload permission to the contributor role",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if _, err := db.Collection("routes").UpdateMany(ctx,
+				bson.M{"sharedWith.permission": "upload"},
+				bson.M{"$set": bson.M{"sharedWith.$[s].permission": "contributor"}},
+				options.Update().SetArrayFilters(options.ArrayFilters{
+					Filters: []interface{}{bson.M{"s.permission": "upload"}},
+				}),
+			); err != nil {
+				return err
+			}
+			if _, err := db.Collection("routes").UpdateMany(ctx,
+				bson.M{"shareToken": bson.M{"$type": "string"}, "shareRole": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"shareRole": "contributor"}},
+			); err != nil {
+				return err
+			}
+			_, err := db.Collection("route_shares").UpdateMany(ctx,
+				bson.M{"permission": "upload"},
+				bson.M{"$set": bson.M{"permission": "contributor"}},
+			)
+			return err
+		},
+	},
+	{
+		Version:     9,
+		Description: "move routes.shareToken into the share_links collection",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			links := db.Collection("share_links")
+			if _, err := links.Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.M{"token": 1}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.D{{Key: "routeId", Value: 1}, {Key: "createdAt", Value: 1}}},
+			}); err != nil {
+				return err
+			}
+
+			routes := db.Collection("routes")
+			cur, err := routes.Find(ctx, bson.M{"shareToken": bson.M{"$type": "string"}})
+			if err != nil {
+				return err
+			}
+			var legacy []struct {
+				ID               string     `bson:"_id"`
+				CreatorID        string     `bson:"creatorId"`
+				ShareToken       string     `bson:"shareToken"`
+				ShareTokenExpiry *time.Time `bson:"shareTokenExpiry"`
+				ShareRole        string     `bson:"shareRole"`
+			}
+			if err := cur.All(ctx, &legacy); err != nil {
+				return err
+			}
+			now := time.Now()
+			for _, r := range legacy {
+				role := r.ShareRole
+				if role == "" {
+					role = "contributor"
+				}
+				// Upsert on the token so a re-run doesn't duplicate links
+				if _, err := links.UpdateOne(ctx,
+					bson.M{"token": r.ShareToken},
+					bson.M{"$setOnInsert": bson.M{
+						"_id":       r.ID + "-legacy",
+						"routeId":   r.ID,
+						"label":     "Original link",
+						"role":      role,
+						"expiresAt": r.ShareTokenExpiry,
+						"maxJoins":  0,
+						"joinCount": 0,
+						"createdBy": r.CreatorID,
+						"createdAt": now,
+					}},
+					options.Update().SetUpsert(true),
+				); err != nil {
+					return err
+				}
+			}
+
+			if _, err := routes.UpdateMany(ctx,
+				bson.M{"$or": bson.A{
+					bson.M{"shareToken": bson.M{"$exists": true}},
+					bson.M{"shareTokenExpiry": bson.M{"$exists": true}},
+					bson.M{"shareRole": bson.M{"$exists": true}},
+				}},
+				bson.M{"$unset": bson.M{"shareToken": "", "shareTokenExpiry": "", "shareRole": ""}},
+			); err != nil {
+				return err
+			}
+			_, err = routes.Indexes().DropOne(ctx, "shareToken_1")
+			var cmdErr mongo.CommandError
+			if errors.As(err, &cmdErr) && cmdErr.Code == 27 { // IndexNotFound
+				return nil
+			}
+			return err
+		},
+	},
+	{
+		Version:     10,
+		Description: "invitation indexes with TTL expiry",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("invitations").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				// One open invitation per address and route
+				{
+					Keys: bson.D{{Key: "routeId", Value: 1}, {Key: "email", Value: 1}},
+					Options: options.Index().SetUnique(true).
+						SetPartialFilterExpression(bson.M{"status": "pending"}),
+				},
+				{Keys: bson.D{{Key: "email", Value: 1}, {Key: "status", Value: 1}, {Key: "createdAt", Value: 1}}},
+				{Keys: bson.M{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+			})
+			return err
+		},
+	},
+	{
+		Version:     11,
+		Description: "join request indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("join_requests").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				// One open request per user and route
+				{
+					Keys: bson.D{{Key: "routeId", Value: 1}, {Key: "userId", Value: 1}},
+					Options: options.Index().SetUnique(true).
+						SetPartialFilterExpression(bson.M{"status": "pending"}),
+				},
+				{Keys: bson.D{{Key: "routeId", Value: 1}, {Key: "status", Value: 1}, {Key: "createdAt", Value: 1}}},
+				{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+			})
+			return err
+		},
+	},
+	{
+		Version:     12,
+		Description: "refresh token indexes with TTL expiry",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("refresh_tokens").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.M{"familyId": 1}},
+				{Keys: bson.M{"userId": 1}},
+				{Keys: bson.M{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+			})
+			return err
+		},
+	},
+	{
+		Version:     13,
+		Description: "session indexes with TTL expiry",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("sessions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "lastUsedAt", Value: -1}}},
+				{Keys: bson.M{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+			})
+			return err
+		},
+	},
+	{
+		Version:     14,
+		Description: "TTL index on oauth_states.expiresAt",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("oauth_states").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.M{"expiresAt": 1},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			})
+			return err
+		},
+	},
+	{
+		Version:     15,
+		Description: "move users.googleid into linked identities",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			users := db.Collection("users")
+			_, err := users.UpdateMany(ctx,
+				bson.M{"googleid": bson.M{"$type": "string"}},
+				mongo.Pipeline{
+					{{Key: "$set", Value: bson.M{
+						"identities": bson.A{bson.M{
+							"key":      bson.M{"$concat": bson.A{"google:", "$googleid"}},
+							"provider": "google",
+							"subject":  "$googleid",
+							"email":    "$email",
+							"linkedAt": "$$NOW",
+						}},
+						"authtype": bson.M{"$cond": bson.A{
+							bson.M{"$eq": bson.A{"$authtype", "google"}}, "oauth", "$authtype",
+						}},
+					}}},
+					{{Key: "$unset", Value: "googleid"}},
+				},
+			)
+			if err != nil {
+				return err
+			}
+			_, err = users.Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.M{"identities.key": 1},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"identities.key": bson.M{"$exists": true}}),
+			})
+			if err != nil {
+				return err
+			}
+			// The old index is empty now; 27 is IndexNotFound from a rerun
+			_, err = users.Indexes().DropOne(ctx, "googleid_1")
+			var cmdErr mongo.CommandError
+			if errors.As(err, &cmdErr) && cmdErr.Code == 27 {
+				return nil
+			}
+			return err
+		},
+	},
+	{
+		Version:     16,
+		Description: "TTL index on pending_links.expiresAt",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("pending_links").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.M{"expiresAt": 1},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			})
+			return err
+		},
+	},
+	{
+		Version:     17,
+		Description: "TTL index on two_factor_challenges.expiresAt",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("two_factor_challenges").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.M{"expiresAt": 1},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			})
+			return err
+		},
+	},
+	{
+		Version:     18,
+		Description: "Index webauthn_credentials by user and expire webauthn_sessions",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("webauthn_credentials").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: 1}},
+			})
+			if err != nil {
+				return err
+			}
+			_, err = db.Collection("webauthn_sessions").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.M{"expiresAt": 1},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			})
+			return err
+		},
+	},
+	{
+		Version:     19,
+		Description: "One otp_records document per email and type, expiring at purge_at",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			otps := db.Collection("otp_records")
+			// Existing records hold plaintext codes and may be duplicated;
+			// they last minutes, so drop them rather than migrate them
+			if _, err := otps.DeleteMany(ctx, bson.M{"otp_hash": bson.M{"$exists": false}}); err != nil {
+				return err
+			}
+			_, err := otps.Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "email", Value: 1}, {Key: "type", Value: 1}},
+					Options: options.Index().SetUnique(true),
+				},
+				{
+					Keys:    bson.M{"purge_at": 1},
+					Options: options.Index().SetExpireAfterSeconds(0),
+				},
+			})
+			if err != nil {
+				return err
+			}
+			// Codes now outlive expires_at to keep the send quota
+			_, err = otps.Indexes().DropOne(ctx, "expires_at_1")
+			var cmdErr mongo.CommandError
+			if errors.As(err, &cmdErr) && cmdErr.Code == 27 { // IndexNotFound
+				return nil
+			}
+			return err
+		},
+	},
+	{
+		Version:     20,
+		Description: "Expire login_throttles and index them by unlock token",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("login_throttles").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.M{"expiresAt": 1},
+					Options: options.Index().SetExpireAfterSeconds(0),
+				},
+				{
+					Keys:    bson.M{"unlockTokenHash": 1},
+					Options: options.Index().SetSparse(true),
+				},
+			})
+			return err
+		},
+	},
+	{
+		Version:     21,
+		Description: "TTL index on magic_links.expiresAt",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("magic_links").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.M{"expiresAt": 1},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			})
+			return err
+		},
+	},
+}
+
+// LatestSchemaVersion is the version the database will be at once every
+// known migration has been applied.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the highest applied migration, or 0 for a fresh
+// database.
+func (m *MongoDB) SchemaVersion(ctx context.Context) (int, error) {
+	var rec migrationRecord
+	err := m.database.Collection(migrationsCollection).FindOne(ctx, bson.M{},
+		options.FindOne().SetSort(bson.M{"_id": -1}),
+	).Decode(&rec)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return rec.Version, nil
+}
+
+// Migrate applies every pending migration in order and records each one in
+// the schema_migrations collection. It refuses to touch a database whose
+// schema is newer than this build knows about.
+func (m *MongoDB) Migrate(ctx context.Context) error {
+	current, err := m.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if current > LatestSchemaVersion() {
+		return fmt.Errorf("%w: database at %d, build knows %d", ErrSchemaTooNew, current, LatestSchemaVersion())
+	}
+	coll := m.database.Collection(migrationsCollection)
+	for _, mig := range migrations {
+		if mig.Version <= current {
+			continue
+		}
+		slog.Info("Applying migration", slog.Int("version", mig.Version), slog.String("description", mig.Description))
+		if err := mig.Up(ctx, m.database); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", mig.Version, mig.Description, err)
+		}
+		_, err := coll.InsertOne(ctx, migrationRecord{
+			Version:     mig.Version,
+			Description: mig.Description,
+			AppliedAt:   time.Now(),
+		})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("record migration %d: %w", mig.Version, err)
+		}
+	}
+	return nil
+}
+
+// checkSchema verifies the database is at exactly the version this build
+// expects.
+func (m *MongoDB) checkSchema(ctx context.Context) error {
+	current, err := m.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	switch {
+	case current > LatestSchemaVersion():
+		return fmt.Errorf("%w: database at %d, build knows %d", ErrSchemaTooNew, current, LatestSchemaVersion())
+	case current < LatestSchemaVersion():
+		return fmt.Errorf("%w: database at %d, build needs %d; run cmd/migrate", ErrSchemaBehind, current, LatestSchemaVersion())
+	}
+	return nil
+}
+
+// setValidator attaches a $jsonSchema validator to an existing collection or
+// creates the collection with it. Validation is "moderate" so legacy
+// documents that predate the schema can still be updated.
+func setValidator(ctx context.Context, db *mongo.Database, name string, schema bson.M) error {
+	validator := bson.M{"$jsonSchema": schema}
+	err := db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: name},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: "moderate"},
+	}).Err()
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == 26 { // NamespaceNotFound
+		return db.CreateCollection(ctx, name, options.CreateCollection().
+			SetValidator(validator).
+			SetValidationLevel("moderate"))
+	}
+	return err
+}
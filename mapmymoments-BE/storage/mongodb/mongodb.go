@@ -7,6 +7,7 @@ import (
 
 	"github.com/atindraraut/crudgo/internal/config"
 	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -19,23 +20,74 @@ type MongoDB struct {
 	collection *mongo.Collection
 }
 
+// New connects to MongoDB and makes sure the schema is current. With
+// cfg.MongoAutoMigrate set, pending migrations are applied; otherwise startup
+// fails until cmd/migrate has been run.
 func New(cfg *config.Config) (*MongoDB, error) {
+	mdb, err := Connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	// Only ownership transfers need transactions; everything else works on
+	// a standalone server
+	if err := mdb.CheckTransactions(ctx); err != nil {
+		fmt.Printf("Warning: %v; accepting ownership transfers will fail\n", err)
+	}
+	if cfg.MongoAutoMigrate {
+		err = mdb.Migrate(ctx)
+	} else {
+		err = mdb.checkSchema(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare schema: %w", err)
+	}
+	return mdb, nil
+}
+
+// Connect opens a client without touching the schema. It is used by
+// cmd/migrate; servers should use New.
+func Connect(cfg *config.Config) (*MongoDB, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoURI))
 	if err != nil {
 		return nil, err
 	}
+	if err := client.Ping(ctx, nil); err != nil {
+		return nil, err
+	}
 	db := client.Database(cfg.MongoDatabase)
 	coll := db.Collection("students")
-	mdb := &MongoDB{client: client, database: db, collection: coll}
+	return &MongoDB{client: client, database: db, collection: coll}, nil
+}
+
+// ErrTransactionsUnsupported is returned when the server can't run
+// multi-document transactions, which accepting an ownership transfer relies
+// on. It wraps storage.ErrUnsupported. A standalone mongod can be turned
+// into a single-node replica set with --replSet and rs.initiate().
+var ErrTransactionsUnsupported = fmt.Errorf("%w: MongoDB must run as a replica set or sharded cluster to support transactions", storage.ErrUnsupported)
 
-	// Ensure OTP TTL index exists
-	if err := mdb.ensureOTPTTLIndex(); err != nil {
-		return nil, fmt.Errorf("failed to ensure OTP TTL index: %w", err)
+// CheckTransactions asks the server whether it is a replica set member or a
+// mongos, the deployments that support transactions.
+func (m *MongoDB) CheckTransactions(ctx context.Context) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
 	}
+	if err := m.database.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return fmt.Errorf("check deployment: %w", err)
+	}
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return ErrTransactionsUnsupported
+	}
+	return nil
+}
 
-	return mdb, nil
+// Close disconnects the underlying client.
+func (m *MongoDB) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
 }
 
 func (m *MongoDB) CreateStudent(name string, age int, email string) (int64, error) {
@@ -0,0 +1,39 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const oauthStatesCollection = "oauth_states"
+
+func (m *MongoDB) SaveOAuthState(ctx context.Context, state types.OAuthState) error {
+	_, err := m.database.Collection(oauthStatesCollection).InsertOne(ctx, state)
+	if mongo.IsDuplicateKeyError(err) {
+		return storage.ErrConflict
+	}
+	return err
+}
+
+func (m *MongoDB) ConsumeOAuthState(ctx context.Context, id string) (types.OAuthState, error) {
+	var state types.OAuthState
+	// Deleting on read means only one callback can use a state
+	err := m.database.Collection(oauthStatesCollection).FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&state)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.OAuthState{}, storage.ErrNotFound
+	}
+	if err != nil {
+		return types.OAuthState{}, err
+	}
+	// The TTL monitor only runs once a minute
+	if !state.ExpiresAt.After(time.Now()) {
+		return types.OAuthState{}, storage.ErrExpired
+	}
+	return state, nil
+}
@@ -2,45 +2,121 @@ package mongodb
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func (m *MongoDB) SaveOTPRecord(record types.OTPRecord) error {
-	ctx := context.Background()
-	coll := m.database.Collection("otp_records")
-	_, err := coll.InsertOne(ctx, record)
+const otpRecordsCollection = "otp_records"
+
+// SaveOTPRecord replaces the record for the email and type only if nobody
+// else has sent a code since we read it, so concurrent sends can't both
+// get under the cooldown
+func (m *MongoDB) SaveOTPRecord(ctx context.Context, record types.OTPRecord, policy types.OTPPolicy) error {
+	coll := m.database.Collection(otpRecordsCollection)
+	filter := bson.M{"email": record.Email, "type": record.Type}
+	var prev *types.OTPRecord
+	var existing types.OTPRecord
+	err := coll.FindOne(ctx, filter).Decode(&existing)
+	switch {
+	case err == nil:
+		prev = &existing
+		filter["last_sent_at"] = existing.LastSentAt
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		return err
+	}
+	now := time.Now()
+	if retryAt, ok := policy.NextSend(&record, prev, now); !ok {
+		return &storage.RetryAfterError{RetryAt: retryAt}
+	}
+
+	raced := false
+	if prev == nil {
+		_, err = coll.InsertOne(ctx, record)
+		raced = mongo.IsDuplicateKeyError(err)
+	} else {
+		var res *mongo.UpdateResult
+		res, err = coll.ReplaceOne(ctx, filter, record)
+		raced = err == nil && res.MatchedCount == 0
+	}
+	if raced {
+		return &storage.RetryAfterError{RetryAt: now.Add(policy.Cooldown)}
+	}
 	return err
 }
 
-func (m *MongoDB) GetOTPRecordByEmail(email string) (types.OTPRecord, error) {
-	ctx := context.Background()
-	coll := m.database.Collection("otp_records")
+func (m *MongoDB) GetOTPRecord(ctx context.Context, email, otpType string) (types.OTPRecord, error) {
 	var record types.OTPRecord
-	err := coll.FindOne(ctx, bson.M{"email": email}).Decode(&record)
-	if err == mongo.ErrNoDocuments {
-		return types.OTPRecord{}, nil
+	err := m.database.Collection(otpRecordsCollection).FindOne(ctx, bson.M{
+		"email":    email,
+		"type":     otpType,
+		"purge_at": bson.M{"$gt": time.Now()}, // the TTL monitor only runs once a minute
+	}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.OTPRecord{}, storage.ErrNotFound
 	}
 	return record, err
 }
 
-func (m *MongoDB) DeleteOTPRecordByEmail(email string) error {
-	ctx := context.Background()
-	coll := m.database.Collection("otp_records")
-	_, err := coll.DeleteOne(ctx, bson.M{"email": email})
-	return err
+func (m *MongoDB) ClaimOTPAttempt(ctx context.Context, email, otpType string, maxAttempts int) (types.OTPRecord, error) {
+	coll := m.database.Collection(otpRecordsCollection)
+	live := bson.M{
+		"email":      email,
+		"type":       otpType,
+		"otp_hash":   bson.M{"$ne": ""},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	filter := bson.M{"attempts": bson.M{"$lt": maxAttempts}}
+	for k, v := range live {
+		filter[k] = v
+	}
+	var record types.OTPRecord
+	err := coll.FindOneAndUpdate(ctx, filter,
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&record)
+	if err == nil {
+		return record, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return types.OTPRecord{}, err
+	}
+	// Tell a used-up code apart from a missing one
+	n, err := coll.CountDocuments(ctx, live)
+	if err != nil {
+		return types.OTPRecord{}, err
+	}
+	if n > 0 {
+		return types.OTPRecord{}, storage.ErrExpired
+	}
+	return types.OTPRecord{}, storage.ErrNotFound
 }
 
-func (m *MongoDB) ensureOTPTTLIndex() error {
-	ctx := context.Background()
-	coll := m.database.Collection("otp_records")
-	indexModel := mongo.IndexModel{
-		Keys:    bson.M{"expires_at": 1},
-		Options: options.Index().SetExpireAfterSeconds(0),
+// ConsumeOTPRecord clears the code but keeps the record, and so the send
+// counters, until purge_at
+func (m *MongoDB) ConsumeOTPRecord(ctx context.Context, email, otpType string) error {
+	res, err := m.database.Collection(otpRecordsCollection).UpdateOne(ctx,
+		bson.M{
+			"email":      email,
+			"type":       otpType,
+			"otp_hash":   bson.M{"$ne": ""},
+			"expires_at": bson.M{"$gt": time.Now()},
+		},
+		bson.M{
+			"$set":   bson.M{"otp_hash": ""},
+			"$unset": bson.M{"signup_req": "", "password": ""},
+		},
+	)
+	if err != nil {
+		return err
 	}
-	_, err := coll.Indexes().CreateOne(ctx, indexModel)
-	return err
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
 }
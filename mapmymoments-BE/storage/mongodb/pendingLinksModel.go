@@ -0,0 +1,71 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const pendingLinksCollection = "pending_links"
+
+func (m *MongoDB) SavePendingLink(ctx context.Context, link types.PendingLink) error {
+	_, err := m.database.Collection(pendingLinksCollection).ReplaceOne(ctx,
+		bson.M{"_id": link.ID}, link, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoDB) GetPendingLink(ctx context.Context, id string) (types.PendingLink, error) {
+	var link types.PendingLink
+	err := m.database.Collection(pendingLinksCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&link)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.PendingLink{}, storage.ErrNotFound
+	}
+	if err != nil {
+		return types.PendingLink{}, err
+	}
+	// The TTL monitor only runs once a minute
+	if !link.ExpiresAt.After(time.Now()) {
+		return types.PendingLink{}, storage.ErrExpired
+	}
+	return link, nil
+}
+
+func (m *MongoDB) RecordPendingLinkFailure(ctx context.Context, id string, maxFailures int) error {
+	coll := m.database.Collection(pendingLinksCollection)
+	var link types.PendingLink
+	err := coll.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "expiresAt": bson.M{"$gt": time.Now()}},
+		bson.M{"$inc": bson.M{"failures": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&link)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return storage.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if link.Failures >= maxFailures {
+		if _, err := coll.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+			return err
+		}
+		return storage.ErrExpired
+	}
+	return nil
+}
+
+func (m *MongoDB) DeletePendingLink(ctx context.Context, id string) error {
+	res, err := m.database.Collection(pendingLinksCollection).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
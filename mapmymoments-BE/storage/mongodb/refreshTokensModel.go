@@ -0,0 +1,60 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const refreshTokensCollection = "refresh_tokens"
+
+func (m *MongoDB) CreateRefreshToken(ctx context.Context, token types.RefreshToken) error {
+	_, err := m.database.Collection(refreshTokensCollection).InsertOne(ctx, token)
+	if mongo.IsDuplicateKeyError(err) {
+		return storage.ErrConflict
+	}
+	return err
+}
+
+func (m *MongoDB) RotateRefreshToken(ctx context.Context, tokenId string, next types.RefreshToken) error {
+	coll := m.database.Collection(refreshTokensCollection)
+	now := time.Now()
+	// Only one caller can move a token from unused to used
+	res, err := coll.UpdateOne(ctx,
+		bson.M{"_id": tokenId, "usedAt": nil, "revokedAt": nil, "expiresAt": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"usedAt": now, "replacedBy": next.ID}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		var current types.RefreshToken
+		err := coll.FindOne(ctx, bson.M{"_id": tokenId}).Decode(&current)
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			return storage.ErrNotFound
+		case err != nil:
+			return err
+		case current.RevokedAt != nil, !current.ExpiresAt.After(now):
+			return storage.ErrExpired
+		default:
+			return storage.ErrConflict
+		}
+	}
+	_, err = coll.InsertOne(ctx, next)
+	return err
+}
+
+// revokeFamilies revokes every live refresh token in the given families
+func (m *MongoDB) revokeFamilies(ctx context.Context, familyIds []string) error {
+	_, err := m.database.Collection(refreshTokensCollection).UpdateMany(ctx,
+		bson.M{"familyId": bson.M{"$in": familyIds}, "revokedAt": nil},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	return err
+}
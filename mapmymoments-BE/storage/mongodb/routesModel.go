@@ -7,19 +7,17 @@ import (
 	"time"
 
 	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const cloudfrontDomain = "https://your-cloudfront-domain.cloudfront.net"
 
-func (m *MongoDB) CreateRoute(route interface{}) (string, error) {
-	ctx := context.Background()
+func (m *MongoDB) CreateRoute(ctx context.Context, r types.Route) (string, error) {
 	coll := m.database.Collection("routes")
-	r, ok := route.(types.Route)
-	if !ok {
-		return "", errors.New("invalid route type")
-	}
 	if r.ID == "" {
 		r.ID = primitive.NewObjectID().Hex()
 	}
@@ -29,12 +27,18 @@ func (m *MongoDB) CreateRoute(route interface{}) (string, error) {
 	if r.UpdatedAt == 0 {
 		r.UpdatedAt = r.CreatedAt
 	}
+	r.Version = 1
+	if r.Photos == nil {
+		r.Photos = []types.Photo{}
+	}
 
 	// Initialize sharing fields for new routes
 	if r.SharedWith == nil {
 		r.SharedWith = []types.SharedUser{}
 	}
-	r.IsPublic = false // Default to private
+	if r.Visibility == "" {
+		r.Visibility = types.VisibilityPrivate
+	}
 
 	// Ensure `photos` field is included when creating a route
 	if len(r.Photos) > 0 {
@@ -47,359 +51,448 @@ func (m *MongoDB) CreateRoute(route interface{}) (string, error) {
 
 	_, err := coll.InsertOne(ctx, r)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return "", fmt.Errorf("route %s already exists: %w", r.ID, storage.ErrConflict)
+		}
 		return "", err
 	}
 	return r.ID, nil
 }
 
-func (m *MongoDB) GetRouteById(id string) (interface{}, error) {
-	ctx := context.Background()
+func (m *MongoDB) GetRouteById(ctx context.Context, id string) (types.Route, error) {
 	coll := m.database.Collection("routes")
 	var route types.Route
 	err := coll.FindOne(ctx, bson.M{"_id": id}).Decode(&route)
 	if err != nil {
-		if err.Error() == "mongo: no documents in result" {
-			return nil, nil
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return types.Route{}, storage.ErrNotFound
 		}
-		return nil, err
-	}
-	
-	// Handle legacy routes that don't have sharing fields
-	if route.SharedWith == nil {
-		route.SharedWith = []types.SharedUser{}
+		return types.Route{}, err
 	}
-	
+
 	return route, nil
 }
 
-func (m *MongoDB) GetAllRoutes() ([]interface{}, error) {
-	ctx := context.Background()
-	coll := m.database.Collection("routes")
-	cur, err := coll.Find(ctx, bson.M{})
-	if err != nil {
-		return nil, err
-	}
-	defer cur.Close(ctx)
-	var routes []interface{}
-	for cur.Next(ctx) {
-		var r types.Route
-		if err := cur.Decode(&r); err != nil {
-			return nil, err
-		}
-		
-		// Handle legacy routes that don't have sharing fields
-		if r.SharedWith == nil {
-			r.SharedWith = []types.SharedUser{}
-		}
-		
-		routes = append(routes, r)
-	}
-	return routes, nil
+func (m *MongoDB) ListRoutes(ctx context.Context, opts types.RouteListOptions) (types.RoutePage, error) {
+	return m.listRoutes(ctx, bson.M{}, opts)
 }
 
-func (m *MongoDB) UpdateRoute(id string, route interface{}) (string, error) {
-	ctx := context.Background()
+func (m *MongoDB) UpdateRoute(ctx context.Context, id string, r types.Route, expectedVersion int64) (int64, error) {
 	coll := m.database.Collection("routes")
-	r, ok := route.(types.Route)
-	if !ok {
-		return "", errors.New("invalid route type")
-	}
 	r.UpdatedAt = time.Now().UnixMilli()
 
 	// Initialize sharing fields if they don't exist
 	if r.SharedWith == nil {
 		r.SharedWith = []types.SharedUser{}
 	}
+	if r.Photos == nil {
+		r.Photos = []types.Photo{}
+	}
 
-	// Convert to bson.M and remove _id
+	// Convert to bson.M and remove fields managed by dedicated methods
 	updateDoc, err := bson.Marshal(r)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 	var updateMap bson.M
 	if err := bson.Unmarshal(updateDoc, &updateMap); err != nil {
-		return "", err
+		return 0, err
+	}
+	for _, key := range serverManagedRouteFields {
+		delete(updateMap, key)
 	}
-	delete(updateMap, "_id")
 
-	res, err := coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": updateMap})
-	if err != nil {
-		return "", err
+	filter := bson.M{"_id": id}
+	if expectedVersion > 0 {
+		filter["version"] = expectedVersion
+	}
+	var updated types.Route
+	err = coll.FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": updateMap, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"version": 1}),
+	).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, m.routeMissOrMismatch(ctx, id)
 	}
-	if res.MatchedCount == 0 {
-		return "", errors.New("route not found")
+	if err != nil {
+		return 0, err
 	}
-	return id, nil
+	return updated.Version, nil
 }
 
-func (m *MongoDB) DeleteRoute(id string) (string, error) {
-	ctx := context.Background()
+func (m *MongoDB) DeleteRoute(ctx context.Context, id string, expectedVersion int64) error {
 	coll := m.database.Collection("routes")
-	res, err := coll.DeleteOne(ctx, bson.M{"_id": id})
+	filter := bson.M{"_id": id}
+	if expectedVersion > 0 {
+		filter["version"] = expectedVersion
+	}
+	res, err := coll.DeleteOne(ctx, filter)
 	if err != nil {
-		return "", err
+		return err
 	}
 	if res.DeletedCount == 0 {
-		return "", errors.New("route not found")
+		return m.routeMissOrMismatch(ctx, id)
+	}
+	if err := m.deleteRouteShares(ctx, id); err != nil {
+		fmt.Printf("Warning: Failed to clean up route shares: %v\n", err)
+	}
+	if err := m.deleteShareLinks(ctx, id); err != nil {
+		fmt.Printf("Warning: Failed to clean up share links: %v\n", err)
+	}
+	if err := m.deleteInvitations(ctx, id); err != nil {
+		fmt.Printf("Warning: Failed to clean up invitations: %v\n", err)
 	}
-	return id, nil
+	if err := m.deleteJoinRequests(ctx, id); err != nil {
+		fmt.Printf("Warning: Failed to clean up join requests: %v\n", err)
+	}
+	return nil
 }
 
-// Route sharing methods
-func (m *MongoDB) GenerateRouteShareToken(routeId string, expiryHours *int) (string, error) {
-	ctx := context.Background()
+// deleteRouteShares drops the route_shares mirror rows for a route
+func (m *MongoDB) deleteRouteShares(ctx context.Context, routeId string) error {
+	_, err := m.database.Collection("route_shares").DeleteMany(ctx, bson.M{"routeId": routeId})
+	return err
+}
+
+// serverManagedRouteFields are never overwritten by UpdateRoute; they change
+// only through their own storage methods.
+var serverManagedRouteFields = []string{"_id", "version", "creatorId", "createdAt", "visibility", "sharedWith", "pendingTransfer"}
+
+func (m *MongoDB) SetRouteVisibility(ctx context.Context, id, visibility string) error {
 	coll := m.database.Collection("routes")
-	
-	// Generate a unique token
-	token := primitive.NewObjectID().Hex()
-	
-	// Calculate expiry time if provided
-	var expiryTime *time.Time
-	if expiryHours != nil {
-		expiry := time.Now().Add(time.Duration(*expiryHours) * time.Hour)
-		expiryTime = &expiry
-	}
-	
-	// Update the route with share token
-	update := bson.M{
-		"$set": bson.M{
-			"shareToken": token,
-			"shareTokenExpiry": expiryTime,
-			"updatedAt": time.Now().UnixMilli(),
-		},
-	}
-	
-	res, err := coll.UpdateOne(ctx, bson.M{"_id": routeId}, update)
+	res, err := coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"visibility": visibility, "updatedAt": time.Now().UnixMilli()},
+		"$inc": bson.M{"version": 1},
+	})
 	if err != nil {
-		return "", err
+		return err
 	}
 	if res.MatchedCount == 0 {
-		return "", errors.New("route not found")
+		return storage.ErrNotFound
 	}
-	
-	return token, nil
+	return nil
 }
 
-func (m *MongoDB) GetRouteByShareToken(token string) (interface{}, error) {
-	ctx := context.Background()
+// AppendRoutePhotos atomically pushes photos onto the route so concurrent
+// uploads by different collaborators can't overwrite each other.
+func (m *MongoDB) AppendRoutePhotos(ctx context.Context, id string, photos []types.Photo) error {
 	coll := m.database.Collection("routes")
-	
-	var route types.Route
-	filter := bson.M{"shareToken": token}
-	
-	// Check if token is not expired
-	filter["$or"] = []bson.M{
-		{"shareTokenExpiry": bson.M{"$exists": false}},
-		{"shareTokenExpiry": nil},
-		{"shareTokenExpiry": bson.M{"$gt": time.Now()}},
-	}
-	
-	err := coll.FindOne(ctx, filter).Decode(&route)
+	res, err := coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$push": bson.M{"photos": bson.M{"$each": photos}},
+		"$set":  bson.M{"updatedAt": time.Now().UnixMilli()},
+		"$inc":  bson.M{"version": 1},
+	})
 	if err != nil {
-		if err.Error() == "mongo: no documents in result" {
-			return nil, errors.New("share token not found or expired")
-		}
-		return nil, err
+		return err
 	}
-	
-	return route, nil
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
 }
 
-func (m *MongoDB) AddUserToSharedRoute(routeId, userId, email string) error {
-	ctx := context.Background()
-	coll := m.database.Collection("routes")
-	
-	// Check if user is already in the shared list
-	var route types.Route
-	err := coll.FindOne(ctx, bson.M{"_id": routeId}).Decode(&route)
+// routeMissOrMismatch explains why a conditional write on id matched
+// nothing: either the route is gone or its version moved on.
+func (m *MongoDB) routeMissOrMismatch(ctx context.Context, id string) error {
+	n, err := m.database.Collection("routes").CountDocuments(ctx, bson.M{"_id": id})
 	if err != nil {
 		return err
 	}
-	
-	// Initialize sharedWith array if it's null
-	if route.SharedWith == nil {
-		route.SharedWith = []types.SharedUser{}
+	if n == 0 {
+		return storage.ErrNotFound
+	}
+	return storage.ErrVersionMismatch
+}
+
+// Route sharing methods
+func (m *MongoDB) AddUserToSharedRoute(ctx context.Context, routeId, userId, email, role string) error {
+	added, err := m.addCollaborator(ctx, routeId, userId, email, role)
+	if err != nil {
+		return err
 	}
-	
-	// Check if user is already shared with this route
-	for _, user := range route.SharedWith {
-		if user.UserID == userId {
-			return nil // User already has access
+	if !added {
+		// Either the route is gone or the user already has access
+		if _, err := m.GetRouteById(ctx, routeId); err != nil {
+			return err
 		}
 	}
-	
-	// Add user to shared list
+	return nil
+}
+
+// addCollaborator pushes the user onto sharedWith unless they are already
+// there, in a single conditional update so concurrent joins can't add the
+// same person twice. added is false if nothing was changed.
+func (m *MongoDB) addCollaborator(ctx context.Context, routeId, userId, email, role string) (added bool, err error) {
+	coll := m.database.Collection("routes")
+	now := time.Now()
 	sharedUser := types.SharedUser{
 		UserID:     userId,
 		Email:      email,
-		Permission: "upload",
-		SharedAt:   time.Now(),
+		Permission: role,
+		SharedAt:   now,
 	}
-	
-	// First, ensure the sharedWith field exists as an empty array if it's null
-	// This handles the case where legacy routes have null sharedWith
-	initUpdate := bson.M{
-		"$set": bson.M{
-			"sharedWith": []types.SharedUser{},
+
+	res, err := coll.UpdateOne(ctx,
+		bson.M{"_id": routeId, "sharedWith.userId": bson.M{"$ne": userId}},
+		bson.M{
+			"$push": bson.M{"sharedWith": sharedUser},
+			"$set":  bson.M{"updatedAt": now.UnixMilli()},
+			"$inc":  bson.M{"version": 1},
 		},
-	}
-	
-	// Only update if sharedWith is null
-	_, err = coll.UpdateOne(ctx, bson.M{"_id": routeId, "sharedWith": nil}, initUpdate)
-	// Ignore error if no documents match (sharedWith is not null)
-	
-	// Now safely push the new user to the array
-	pushUpdate := bson.M{
-		"$addToSet": bson.M{"sharedWith": sharedUser},
-		"$set": bson.M{"updatedAt": time.Now().UnixMilli()},
-	}
-	
-	_, err = coll.UpdateOne(ctx, bson.M{"_id": routeId}, pushUpdate)
+	)
 	if err != nil {
-		return err
+		return false, err
+	}
+	if res.MatchedCount == 0 {
+		return false, nil
 	}
-	
+
 	// Also add to route_shares collection for easier querying
 	sharesColl := m.database.Collection("route_shares")
 	routeShare := types.RouteShare{
 		UserID:     userId,
 		RouteID:    routeId,
-		Permission: "upload",
-		SharedAt:   time.Now(),
+		Permission: role,
+		SharedAt:   now,
 	}
-	
-	_, err = sharesColl.InsertOne(ctx, routeShare)
-	if err != nil {
+
+	if _, err := sharesColl.InsertOne(ctx, routeShare); err != nil {
 		// Don't fail if this insert fails as the main route update succeeded
 		fmt.Printf("Warning: Failed to insert route share record: %v\n", err)
 	}
-	
-	return nil
+
+	return true, nil
 }
 
-func (m *MongoDB) GetSharedRoutesForUser(userId string) ([]interface{}, error) {
-	ctx := context.Background()
+func (m *MongoDB) UpdateCollaboratorRole(ctx context.Context, routeId, userId, role string) error {
 	coll := m.database.Collection("routes")
-	
-	// Find routes where user is in the sharedWith array
-	filter := bson.M{"sharedWith.userId": userId}
-	
-	cur, err := coll.Find(ctx, filter)
+	res, err := coll.UpdateOne(ctx,
+		bson.M{"_id": routeId, "sharedWith.userId": userId},
+		bson.M{
+			"$set": bson.M{"sharedWith.$.permission": role, "updatedAt": time.Now().UnixMilli()},
+			"$inc": bson.M{"version": 1},
+		},
+	)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer cur.Close(ctx)
-	
-	var routes []interface{}
-	for cur.Next(ctx) {
-		var route types.Route
-		if err := cur.Decode(&route); err != nil {
-			return nil, err
-		}
-		
-		// Handle legacy routes that don't have sharing fields
-		if route.SharedWith == nil {
-			route.SharedWith = []types.SharedUser{}
-		}
-		
-		routes = append(routes, route)
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
 	}
-	
-	return routes, nil
+
+	sharesColl := m.database.Collection("route_shares")
+	if _, err := sharesColl.UpdateMany(ctx,
+		bson.M{"routeId": routeId, "userId": userId},
+		bson.M{"$set": bson.M{"permission": role}},
+	); err != nil {
+		fmt.Printf("Warning: Failed to update route share record: %v\n", err)
+	}
+	return nil
 }
 
-func (m *MongoDB) GetUsersByRouteId(routeId string) ([]types.UserData, error) {
-	ctx := context.Background()
+func (m *MongoDB) RemoveCollaborator(ctx context.Context, routeId, userId string) error {
+	// route_shares goes first: if the route update then fails the caller can
+	// simply retry, and routes.sharedWith stays the source of truth.
+	sharesColl := m.database.Collection("route_shares")
+	if _, err := sharesColl.DeleteMany(ctx, bson.M{"routeId": routeId, "userId": userId}); err != nil {
+		return err
+	}
+
 	coll := m.database.Collection("routes")
-	
-	var route types.Route
-	err := coll.FindOne(ctx, bson.M{"_id": routeId}).Decode(&route)
+	res, err := coll.UpdateOne(ctx,
+		bson.M{"_id": routeId, "sharedWith.userId": userId},
+		bson.M{
+			"$pull": bson.M{"sharedWith": bson.M{"userId": userId}},
+			"$set":  bson.M{"updatedAt": time.Now().UnixMilli()},
+			"$inc":  bson.M{"version": 1},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoDB) GetSharedRoutesForUser(ctx context.Context, userId string, opts types.RouteListOptions) (types.RoutePage, error) {
+	// Find routes where user is in the sharedWith array
+	return m.listRoutes(ctx, bson.M{"sharedWith.userId": userId}, opts)
+}
+
+func (m *MongoDB) GetUsersByRouteId(ctx context.Context, routeId string) ([]types.UserData, error) {
+	route, err := m.GetRouteById(ctx, routeId)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	var users []types.UserData
 	usersColl := m.database.Collection("users")
-	
+
 	// Get creator
 	var creator types.UserData
 	err = usersColl.FindOne(ctx, bson.M{"email": route.CreatorID}).Decode(&creator)
 	if err == nil {
 		users = append(users, creator)
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
 	}
-	
+
 	// Get shared users
 	for _, sharedUser := range route.SharedWith {
 		var user types.UserData
 		err = usersColl.FindOne(ctx, bson.M{"email": sharedUser.Email}).Decode(&user)
 		if err == nil {
 			users = append(users, user)
+		} else if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
 		}
 	}
-	
+
 	return users, nil
 }
 
-func (m *MongoDB) CheckUserRoutePermission(userId, routeId string) (string, error) {
-	ctx := context.Background()
-	coll := m.database.Collection("routes")
-	
-	var route types.Route
-	err := coll.FindOne(ctx, bson.M{"_id": routeId}).Decode(&route)
+func (m *MongoDB) CheckUserRoutePermission(ctx context.Context, userId, routeId string) (string, error) {
+	route, err := m.GetRouteById(ctx, routeId)
 	if err != nil {
-		if err.Error() == "mongo: no documents in result" {
-			return "", nil // Route not found
-		}
 		return "", err
 	}
-	
+
 	// Check if user is creator
 	if route.CreatorID == userId {
-		return "owner", nil
-	}
-	
-	// Handle legacy routes that don't have sharing fields
-	if route.SharedWith == nil {
-		return "", nil // No permission for legacy routes
+		return types.RoleOwner, nil
 	}
-	
+
 	// Check if user is in shared list
 	for _, sharedUser := range route.SharedWith {
 		if sharedUser.UserID == userId {
-			return sharedUser.Permission, nil
+			return types.NormalizeRole(sharedUser.Permission), nil
 		}
 	}
-	
+
 	return "", nil // No permission
 }
 
-func (m *MongoDB) RevokeRouteShare(routeId string) error {
-	ctx := context.Background()
+func (m *MongoDB) RevokeRouteShare(ctx context.Context, routeId string) error {
 	coll := m.database.Collection("routes")
-	
-	// Remove share token and clear shared users
+
+	// Clear shared users; the links themselves live in share_links
 	update := bson.M{
-		"$unset": bson.M{
-			"shareToken": "",
-			"shareTokenExpiry": "",
-		},
 		"$set": bson.M{
 			"sharedWith": []types.SharedUser{},
-			"updatedAt": time.Now().UnixMilli(),
+			"updatedAt":  time.Now().UnixMilli(),
 		},
+		"$inc": bson.M{"version": 1},
 	}
-	
-	_, err := coll.UpdateOne(ctx, bson.M{"_id": routeId}, update)
+
+	res, err := coll.UpdateOne(ctx, bson.M{"_id": routeId}, update)
 	if err != nil {
 		return err
 	}
-	
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+
 	// Clean up route_shares collection
-	sharesColl := m.database.Collection("route_shares")
-	_, err = sharesColl.DeleteMany(ctx, bson.M{"routeId": routeId})
-	if err != nil {
+	if err := m.deleteRouteShares(ctx, routeId); err != nil {
 		fmt.Printf("Warning: Failed to clean up route shares: %v\n", err)
 	}
-	
-	return nil
+
+	if err := m.deleteShareLinks(ctx, routeId); err != nil {
+		return err
+	}
+	if err := m.deleteInvitations(ctx, routeId); err != nil {
+		return err
+	}
+	return m.deleteJoinRequests(ctx, routeId)
+}
+
+// decodeRoutes drains cur into a slice.
+func decodeRoutes(ctx context.Context, cur *mongo.Cursor) ([]types.Route, error) {
+	defer cur.Close(ctx)
+	routes := []types.Route{}
+	for cur.Next(ctx) {
+		var r types.Route
+		if err := cur.Decode(&r); err != nil {
+			return nil, err
+		}
+		routes = append(routes, r)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// listRoutes runs a paginated query over routes matching base. Filtering,
+// sorting and the cursor position are all pushed down to MongoDB; one extra
+// document is fetched to tell whether another page exists.
+func (m *MongoDB) listRoutes(ctx context.Context, base bson.M, opts types.RouteListOptions) (types.RoutePage, error) {
+	opts = storage.NormalizeListOptions(opts)
+	cursor, err := storage.DecodeRouteCursor(opts)
+	if err != nil {
+		return types.RoutePage{}, err
+	}
+
+	and := []bson.M{base}
+	if opts.CreatorID != "" {
+		and = append(and, bson.M{"creatorId": opts.CreatorID})
+	}
+	if opts.Visibility != "" {
+		and = append(and, bson.M{"visibility": opts.Visibility})
+	}
+	if opts.CreatedAfter != 0 || opts.CreatedBefore != 0 {
+		created := bson.M{}
+		if opts.CreatedAfter != 0 {
+			created["$gte"] = opts.CreatedAfter
+		}
+		if opts.CreatedBefore != 0 {
+			created["$lt"] = opts.CreatedBefore
+		}
+		and = append(and, bson.M{"createdAt": created})
+	}
+	if opts.HasPhotos != nil {
+		if *opts.HasPhotos {
+			and = append(and, bson.M{"photos.0": bson.M{"$exists": true}})
+		} else {
+			and = append(and, bson.M{"photos.0": bson.M{"$exists": false}})
+		}
+	}
+
+	direction := -1
+	cmp := "$lt"
+	if opts.SortAsc {
+		direction = 1
+		cmp = "$gt"
+	}
+	if cursor != nil {
+		var last interface{} = cursor.Num
+		if opts.SortBy == "name" {
+			last = cursor.Str
+		}
+		and = append(and, bson.M{"$or": []bson.M{
+			{opts.SortBy: bson.M{cmp: last}},
+			{opts.SortBy: last, "_id": bson.M{cmp: cursor.ID}},
+		}})
+	}
+
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: opts.SortBy, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(int64(opts.Limit + 1))
+	cur, err := m.database.Collection("routes").Find(ctx, bson.M{"$and": and}, findOpts)
+	if err != nil {
+		return types.RoutePage{}, err
+	}
+	routes, err := decodeRoutes(ctx, cur)
+	if err != nil {
+		return types.RoutePage{}, err
+	}
+
+	page := types.RoutePage{Routes: routes}
+	if len(routes) > opts.Limit {
+		page.Routes = routes[:opts.Limit]
+		page.NextCursor = storage.EncodeRouteCursor(opts, page.Routes[opts.Limit-1])
+	}
+	return page, nil
 }
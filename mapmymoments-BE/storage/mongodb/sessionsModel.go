@@ -0,0 +1,112 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const sessionsCollection = "sessions"
+
+// activeSessionFilter matches sessions that are neither revoked nor expired
+func activeSessionFilter(filter bson.M) bson.M {
+	filter["revokedAt"] = nil
+	filter["expiresAt"] = bson.M{"$gt": time.Now()}
+	return filter
+}
+
+func (m *MongoDB) CreateSession(ctx context.Context, session types.Session) error {
+	_, err := m.database.Collection(sessionsCollection).InsertOne(ctx, session)
+	if mongo.IsDuplicateKeyError(err) {
+		return storage.ErrConflict
+	}
+	return err
+}
+
+func (m *MongoDB) GetSession(ctx context.Context, sessionId string) (types.Session, error) {
+	var session types.Session
+	err := m.database.Collection(sessionsCollection).FindOne(ctx, activeSessionFilter(bson.M{"_id": sessionId})).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.Session{}, storage.ErrNotFound
+	}
+	return session, err
+}
+
+func (m *MongoDB) ListSessions(ctx context.Context, userId string) ([]types.Session, error) {
+	cur, err := m.database.Collection(sessionsCollection).Find(ctx, activeSessionFilter(bson.M{"userId": userId}),
+		options.Find().SetSort(bson.D{{Key: "lastUsedAt", Value: -1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	sessions := []types.Session{}
+	if err := cur.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (m *MongoDB) TouchSession(ctx context.Context, sessionId, ip string, expiresAt time.Time) error {
+	res, err := m.database.Collection(sessionsCollection).UpdateOne(ctx, activeSessionFilter(bson.M{"_id": sessionId}),
+		bson.M{"$set": bson.M{"lastUsedAt": time.Now(), "ip": ip, "expiresAt": expiresAt}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoDB) RevokeSession(ctx context.Context, userId, sessionId string) error {
+	res, err := m.database.Collection(sessionsCollection).UpdateOne(ctx,
+		activeSessionFilter(bson.M{"_id": sessionId, "userId": userId}),
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return m.revokeFamilies(ctx, []string{sessionId})
+}
+
+func (m *MongoDB) RevokeOtherSessions(ctx context.Context, userId, keepSessionId string) (int, error) {
+	coll := m.database.Collection(sessionsCollection)
+	filter := activeSessionFilter(bson.M{"userId": userId, "_id": bson.M{"$ne": keepSessionId}})
+	cur, err := coll.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var sessions []types.Session
+	if err := cur.All(ctx, &sessions); err != nil {
+		return 0, err
+	}
+	if len(sessions) == 0 {
+		return 0, nil
+	}
+	ids := make([]string, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.ID
+	}
+	// Revoke the tokens first so a failure part-way never leaves a session
+	// that looks ended but can still refresh
+	if err := m.revokeFamilies(ctx, ids); err != nil {
+		return 0, err
+	}
+	res, err := coll.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "revokedAt": nil},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
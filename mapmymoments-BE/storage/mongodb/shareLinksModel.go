@@ -0,0 +1,237 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const shareLinksCollection = "share_links"
+
+func (m *MongoDB) CreateShareLink(ctx context.Context, link types.ShareLink) (types.ShareLink, error) {
+	if _, err := m.GetRouteById(ctx, link.RouteID); err != nil {
+		return types.ShareLink{}, err
+	}
+	token, err := storage.NewShareToken()
+	if err != nil {
+		return types.ShareLink{}, err
+	}
+	link.ID = primitive.NewObjectID().Hex()
+	link.Token = token
+	link.JoinCount = 0
+	link.CreatedAt = time.Now()
+	link.LastUsedAt = nil
+	if _, err := m.database.Collection(shareLinksCollection).InsertOne(ctx, link); err != nil {
+		return types.ShareLink{}, err
+	}
+	return link, nil
+}
+
+func (m *MongoDB) ListShareLinks(ctx context.Context, routeId string) ([]types.ShareLink, error) {
+	if _, err := m.GetRouteById(ctx, routeId); err != nil {
+		return nil, err
+	}
+	cur, err := m.database.Collection(shareLinksCollection).Find(ctx,
+		bson.M{"routeId": routeId},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	links := []types.ShareLink{}
+	if err := cur.All(ctx, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+func (m *MongoDB) RevokeShareLink(ctx context.Context, routeId, linkId string) error {
+	res, err := m.database.Collection(shareLinksCollection).DeleteOne(ctx, bson.M{"_id": linkId, "routeId": routeId})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return m.cancelJoinRequests(ctx, linkId)
+}
+
+func (m *MongoDB) RotateShareLink(ctx context.Context, routeId, linkId string) (types.ShareLink, error) {
+	token, err := storage.NewShareToken()
+	if err != nil {
+		return types.ShareLink{}, err
+	}
+	var link types.ShareLink
+	err = m.database.Collection(shareLinksCollection).FindOneAndUpdate(ctx,
+		bson.M{"_id": linkId, "routeId": routeId},
+		bson.M{"$set": bson.M{"token": token}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&link)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.ShareLink{}, storage.ErrNotFound
+	}
+	if err != nil {
+		return types.ShareLink{}, err
+	}
+	return link, m.cancelJoinRequests(ctx, linkId)
+}
+
+func (m *MongoDB) GetShareLinkByToken(ctx context.Context, token string) (types.ShareLink, error) {
+	link, err := m.findShareLink(ctx, token)
+	if err != nil {
+		return types.ShareLink{}, err
+	}
+	if err := storage.CheckShareLink(link, time.Now()); err != nil {
+		return types.ShareLink{}, err
+	}
+	return link, nil
+}
+
+func (m *MongoDB) RedeemShareLink(ctx context.Context, token, userId, email string) (types.ShareLink, error) {
+	link, err := m.findShareLink(ctx, token)
+	if err != nil {
+		return types.ShareLink{}, err
+	}
+	permission, err := m.CheckUserRoutePermission(ctx, userId, link.RouteID)
+	if err != nil {
+		return types.ShareLink{}, err
+	}
+	if permission != "" {
+		return link, nil
+	}
+	if err := storage.CheckShareLink(link, time.Now()); err != nil {
+		return types.ShareLink{}, err
+	}
+	if link.RequireApproval {
+		return types.ShareLink{}, storage.ErrApprovalRequired
+	}
+
+	// Count the join only if the link is still usable at this instant; the
+	// filter makes the check and the increment a single atomic step.
+	coll := m.database.Collection(shareLinksCollection)
+	now := time.Now()
+	filter := usableShareLink(now)
+	filter["_id"] = link.ID
+	filter["token"] = token
+	err = coll.FindOneAndUpdate(ctx, filter,
+		bson.M{"$inc": bson.M{"joinCount": 1}, "$set": bson.M{"lastUsedAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&link)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// Lost a race: report why the link is no longer usable
+		if _, err := m.GetShareLinkByToken(ctx, token); err != nil {
+			return types.ShareLink{}, err
+		}
+		return types.ShareLink{}, storage.ErrExhausted
+	}
+	if err != nil {
+		return types.ShareLink{}, err
+	}
+
+	added, err := m.addCollaborator(ctx, link.RouteID, userId, email, link.Role)
+	if err != nil || !added {
+		// Give the join back: the write failed or a concurrent request
+		// already added this user
+		if _, decErr := coll.UpdateOne(ctx, bson.M{"_id": link.ID}, bson.M{"$inc": bson.M{"joinCount": -1}}); decErr != nil {
+			fmt.Printf("Warning: Failed to release share link join: %v\n", decErr)
+		}
+		if err != nil {
+			return types.ShareLink{}, err
+		}
+	}
+	return link, nil
+}
+
+// usableShareLink matches links that haven't expired or run out of joins,
+// mirroring storage.CheckShareLink.
+func usableShareLink(now time.Time) bson.M {
+	return bson.M{"$and": bson.A{
+		bson.M{"$or": bson.A{bson.M{"expiresAt": nil}, bson.M{"expiresAt": bson.M{"$gt": now}}}},
+		bson.M{"$or": bson.A{
+			bson.M{"maxJoins": bson.M{"$lte": 0}},
+			bson.M{"$expr": bson.M{"$lt": bson.A{"$joinCount", "$maxJoins"}}},
+		}},
+	}}
+}
+
+func (m *MongoDB) findShareLink(ctx context.Context, token string) (types.ShareLink, error) {
+	var link types.ShareLink
+	err := m.database.Collection(shareLinksCollection).FindOne(ctx, bson.M{"token": token}).Decode(&link)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.ShareLink{}, storage.ErrNotFound
+	}
+	return link, err
+}
+
+func (m *MongoDB) deleteShareLinks(ctx context.Context, routeId string) error {
+	_, err := m.database.Collection(shareLinksCollection).DeleteMany(ctx, bson.M{"routeId": routeId})
+	return err
+}
+
+func (m *MongoDB) ClaimShareLinkAttempt(ctx context.Context, linkId string, maxFailures int, lockout time.Duration) (types.ShareLink, error) {
+	// A pipeline update keeps the lock check, the increment and the lock
+	// decision atomic
+	coll := m.database.Collection(shareLinksCollection)
+	now := time.Now()
+	lockedUntil := now.Add(lockout)
+	tripped := bson.M{"$gte": bson.A{"$failedAttempts", maxFailures}}
+	var link types.ShareLink
+	err := coll.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id": linkId,
+			"$or": bson.A{
+				bson.M{"lockedUntil": nil},
+				bson.M{"lockedUntil": bson.M{"$lte": now}},
+			},
+		},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"failedAttempts": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failedAttempts", 0}}, 1}}}}},
+			{{Key: "$set", Value: bson.M{
+				"lockedUntil":    bson.M{"$cond": bson.A{tripped, lockedUntil, "$lockedUntil"}},
+				"failedAttempts": bson.M{"$cond": bson.A{tripped, 0, "$failedAttempts"}},
+			}}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&link)
+	if err == nil {
+		return link, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return types.ShareLink{}, err
+	}
+	// Tell a locked link apart from a missing one
+	err = coll.FindOne(ctx, bson.M{"_id": linkId}).Decode(&link)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.ShareLink{}, storage.ErrNotFound
+	}
+	if err != nil {
+		return types.ShareLink{}, err
+	}
+	if link.LockedUntil != nil && link.LockedUntil.After(now) {
+		return types.ShareLink{}, &storage.RetryAfterError{RetryAt: *link.LockedUntil}
+	}
+	// The lock ran out in the meantime
+	return m.ClaimShareLinkAttempt(ctx, linkId, maxFailures, lockout)
+}
+
+func (m *MongoDB) ResetShareLinkFailures(ctx context.Context, linkId string) error {
+	res, err := m.database.Collection(shareLinksCollection).UpdateOne(ctx,
+		bson.M{"_id": linkId},
+		bson.M{"$set": bson.M{"failedAttempts": 0}, "$unset": bson.M{"lockedUntil": ""}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
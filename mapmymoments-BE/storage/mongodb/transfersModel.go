@@ -0,0 +1,160 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (m *MongoDB) OfferOwnershipTransfer(ctx context.Context, routeId string, transfer types.OwnershipTransfer) error {
+	res, err := m.database.Collection("routes").UpdateOne(ctx,
+		bson.M{"_id": routeId, "creatorId": transfer.From, "sharedWith.userId": transfer.To},
+		bson.M{
+			"$set": bson.M{"pendingTransfer": transfer, "updatedAt": time.Now().UnixMilli()},
+			"$inc": bson.M{"version": 1},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if _, err := m.GetRouteById(ctx, routeId); err != nil {
+			return err
+		}
+		return storage.ErrConflict
+	}
+	return nil
+}
+
+// AcceptOwnershipTransfer runs in a transaction so routes and route_shares
+// never disagree about who owns the route. Transactions need MongoDB running
+// as a replica set; on a standalone server this returns
+// ErrTransactionsUnsupported.
+func (m *MongoDB) AcceptOwnershipTransfer(ctx context.Context, routeId, userId string) (types.Route, error) {
+	session, err := m.client.StartSession()
+	if err != nil {
+		return types.Route{}, err
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return m.swapOwner(sc, routeId, userId)
+	})
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == 20 { // IllegalOperation: not a replica set
+		return types.Route{}, fmt.Errorf("%w: %v", ErrTransactionsUnsupported, err)
+	}
+	if err != nil {
+		return types.Route{}, err
+	}
+	return result.(types.Route), nil
+}
+
+func (m *MongoDB) swapOwner(ctx mongo.SessionContext, routeId, userId string) (types.Route, error) {
+	routes := m.database.Collection("routes")
+	var route types.Route
+	err := routes.FindOne(ctx, bson.M{"_id": routeId}).Decode(&route)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.Route{}, storage.ErrNotFound
+	}
+	if err != nil {
+		return types.Route{}, err
+	}
+	transfer := route.PendingTransfer
+	if transfer == nil || transfer.To != userId {
+		return types.Route{}, storage.ErrNotFound
+	}
+	now := time.Now()
+	if !transfer.ExpiresAt.After(now) {
+		return types.Route{}, storage.ErrExpired
+	}
+
+	shared := make([]types.SharedUser, 0, len(route.SharedWith)+1)
+	found := false
+	for _, user := range route.SharedWith {
+		if user.UserID == userId {
+			found = true
+			continue
+		}
+		shared = append(shared, user)
+	}
+	if route.CreatorID != transfer.From || !found {
+		return types.Route{}, storage.ErrConflict
+	}
+	if transfer.KeepAccess {
+		shared = append(shared, types.SharedUser{
+			UserID:     transfer.From,
+			Email:      transfer.From,
+			Permission: types.RoleCoOwner,
+			SharedAt:   now,
+		})
+	}
+
+	// The version filter turns a concurrent write into a conflict rather
+	// than a lost update
+	res, err := routes.UpdateOne(ctx,
+		bson.M{"_id": routeId, "version": route.Version},
+		bson.M{
+			"$set":   bson.M{"creatorId": userId, "sharedWith": shared, "updatedAt": now.UnixMilli()},
+			"$unset": bson.M{"pendingTransfer": ""},
+			"$inc":   bson.M{"version": 1},
+		},
+	)
+	if err != nil {
+		return types.Route{}, err
+	}
+	if res.MatchedCount == 0 {
+		return types.Route{}, storage.ErrConflict
+	}
+
+	shares := m.database.Collection("route_shares")
+	if _, err := shares.DeleteMany(ctx, bson.M{"routeId": routeId, "userId": bson.M{"$in": bson.A{userId, transfer.From}}}); err != nil {
+		return types.Route{}, err
+	}
+	if transfer.KeepAccess {
+		if _, err := shares.InsertOne(ctx, types.RouteShare{
+			UserID:     transfer.From,
+			RouteID:    routeId,
+			Permission: types.RoleCoOwner,
+			SharedAt:   now,
+		}); err != nil {
+			return types.Route{}, err
+		}
+	}
+
+	route.CreatorID = userId
+	route.SharedWith = shared
+	route.PendingTransfer = nil
+	route.UpdatedAt = now.UnixMilli()
+	route.Version++
+	return route, nil
+}
+
+func (m *MongoDB) DeclineOwnershipTransfer(ctx context.Context, routeId, userId string) error {
+	return m.clearTransfer(ctx, bson.M{"_id": routeId, "pendingTransfer.to": userId})
+}
+
+func (m *MongoDB) CancelOwnershipTransfer(ctx context.Context, routeId string) error {
+	return m.clearTransfer(ctx, bson.M{"_id": routeId, "pendingTransfer": bson.M{"$exists": true}})
+}
+
+func (m *MongoDB) clearTransfer(ctx context.Context, filter bson.M) error {
+	res, err := m.database.Collection("routes").UpdateOne(ctx, filter, bson.M{
+		"$unset": bson.M{"pendingTransfer": ""},
+		"$set":   bson.M{"updatedAt": time.Now().UnixMilli()},
+		"$inc":   bson.M{"version": 1},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const twoFactorChallengesCollection = "two_factor_challenges"
+
+func (m *MongoDB) SetTwoFactor(ctx context.Context, email string, twoFactor *types.TwoFactor) error {
+	update := bson.M{"$unset": bson.M{"twofactor": ""}}
+	if twoFactor != nil {
+		update = bson.M{"$set": bson.M{"twofactor": twoFactor}}
+	}
+	res, err := m.database.Collection("users").UpdateOne(ctx, bson.M{"email": email}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoDB) UseTOTPStep(ctx context.Context, email string, step int64) error {
+	coll := m.database.Collection("users")
+	res, err := coll.UpdateOne(ctx,
+		bson.M{"email": email, "twofactor.lastStep": bson.M{"$lt": step}},
+		bson.M{"$set": bson.M{"twofactor.lastStep": step}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 1 {
+		return nil
+	}
+	n, err := coll.CountDocuments(ctx, bson.M{"email": email, "twofactor": bson.M{"$type": "object"}})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.ErrNotFound
+	}
+	return storage.ErrConflict
+}
+
+func (m *MongoDB) UseRecoveryCode(ctx context.Context, email, codeHash string) error {
+	res, err := m.database.Collection("users").UpdateOne(ctx,
+		bson.M{"email": email, "twofactor.recoveryCodes": codeHash},
+		bson.M{"$pull": bson.M{"twofactor.recoveryCodes": codeHash}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoDB) CreateTwoFactorChallenge(ctx context.Context, challenge types.TwoFactorChallenge) error {
+	_, err := m.database.Collection(twoFactorChallengesCollection).InsertOne(ctx, challenge)
+	return err
+}
+
+// ClaimTwoFactorAttempt only matches a live challenge with attempts left,
+// so concurrent guesses can't get past maxAttempts between them
+func (m *MongoDB) ClaimTwoFactorAttempt(ctx context.Context, id string, maxAttempts int) (types.TwoFactorChallenge, error) {
+	coll := m.database.Collection(twoFactorChallengesCollection)
+	var challenge types.TwoFactorChallenge
+	err := coll.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "expiresAt": bson.M{"$gt": time.Now()}, "attempts": bson.M{"$lt": maxAttempts}},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&challenge)
+	if err == nil {
+		return challenge, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return types.TwoFactorChallenge{}, err
+	}
+	// Missing, or expired or out of attempts and no longer any use
+	res, err := coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return types.TwoFactorChallenge{}, err
+	}
+	if res.DeletedCount == 0 {
+		return types.TwoFactorChallenge{}, storage.ErrNotFound
+	}
+	return types.TwoFactorChallenge{}, storage.ErrExpired
+}
+
+func (m *MongoDB) DeleteTwoFactorChallenge(ctx context.Context, id string) error {
+	res, err := m.database.Collection(twoFactorChallengesCollection).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
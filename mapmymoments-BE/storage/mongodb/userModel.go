@@ -3,126 +3,152 @@ package mongodb
 import (
 	context "context"
 	"errors"
+	"fmt"
 
 	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func (m *MongoDB) GetUserByEmail(email string) (types.UserData, error) {
-	//write the implementation to get user by email
+func (m *MongoDB) GetUserByEmail(ctx context.Context, email string) (types.UserData, error) {
 	var user types.UserData
-	ctx := context.Background()
 	coll := m.database.Collection("users")
 	err := coll.FindOne(ctx, bson.M{"email": email}).Decode(&user)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return types.UserData{}, nil // User not found
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return types.UserData{}, storage.ErrNotFound
 		}
-		return types.UserData{}, err // Other error
+		return types.UserData{}, err
 	}
 	return user, nil
 }
 
-func (m *MongoDB) CreateUser(user types.UserData) (int64, error) {
-	ctx := context.Background()
+func (m *MongoDB) CreateUser(ctx context.Context, user types.UserData) error {
 	coll := m.database.Collection("users")
 
 	// Check if user already exists by email
 	var existing types.UserData
 	err := coll.FindOne(ctx, bson.M{"email": user.Email}).Decode(&existing)
 	if err == nil {
-		return 0, errors.New("user with this email already exists")
+		return fmt.Errorf("user with this email already exists: %w", storage.ErrConflict)
 	}
-	if err != mongo.ErrNoDocuments {
-		return 0, err
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
 	}
 
-	res, err := coll.InsertOne(ctx, user)
-	if err != nil {
+	if _, err := coll.InsertOne(ctx, user); err != nil {
 		if mongo.IsDuplicateKeyError(err) {
-			return 0, errors.New("email already exists")
+			return fmt.Errorf("email already exists: %w", storage.ErrConflict)
 		}
-		return 0, err
-	}
-	id, ok := res.InsertedID.(primitive.ObjectID)
-	if !ok {
-		return 0, errors.New("failed to get inserted ID")
+		return err
 	}
-	return int64(id.Timestamp().Unix()), nil // Not a real int64 ID, but for interface compatibility
+	return nil
 }
 
-func (m *MongoDB) UpdateUserPassword(email, hashedPassword string) error {
-	ctx := context.Background()
+func (m *MongoDB) UpdateUserPassword(ctx context.Context, email, hashedPassword string) error {
 	coll := m.database.Collection("users")
-	update := bson.M{"$set": bson.M{"password": hashedPassword}}
-	_, err := coll.UpdateOne(ctx, bson.M{"email": email}, update)
-	return err
+	res, err := coll.UpdateOne(ctx, bson.M{"email": email}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"password": hashedPassword}}},
+		{{Key: "$set", Value: bson.M{"authtype": authTypeExpr}}},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
 }
 
-func (m *MongoDB) GetUserByGoogleID(googleID string) (types.UserData, error) {
+func (m *MongoDB) GetUserByIdentity(ctx context.Context, provider, subject string) (types.UserData, error) {
 	var user types.UserData
-	ctx := context.Background()
 	coll := m.database.Collection("users")
-	err := coll.FindOne(ctx, bson.M{"googleid": googleID}).Decode(&user)
+	err := coll.FindOne(ctx, bson.M{"identities.key": types.IdentityKey(provider, subject)}).Decode(&user)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return types.UserData{}, nil // User not found
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return types.UserData{}, storage.ErrNotFound
 		}
-		return types.UserData{}, err // Other error
+		return types.UserData{}, err
 	}
 	return user, nil
 }
 
-func (m *MongoDB) CreateOrUpdateGoogleUser(user types.UserData) (int64, error) {
-	ctx := context.Background()
-	coll := m.database.Collection("users")
+// authTypeExpr recomputes authtype from the document itself, matching
+// types.AuthTypeFor, for use in update pipelines
+var authTypeExpr = bson.M{"$switch": bson.M{
+	"branches": bson.A{
+		bson.M{"case": bson.M{"$eq": bson.A{bson.M{"$size": "$identities"}, 0}}, "then": types.AuthTypeEmail},
+		bson.M{"case": bson.M{"$ne": bson.A{bson.M{"$type": "$password"}, "string"}}, "then": types.AuthTypeOAuth},
+	},
+	"default": types.AuthTypeBoth,
+}}
 
-	// Check if user exists by email
-	var existing types.UserData
-	err := coll.FindOne(ctx, bson.M{"email": user.Email}).Decode(&existing)
-	
-	if err == nil {
-		// User exists, update with Google ID and auth type
-		update := bson.M{
-			"$set": bson.M{
-				"googleid": user.GoogleID,
-				"authtype": "both",
-				"firstname": user.FirstName,
-				"lastname": user.LastName,
-			},
-		}
-		_, err := coll.UpdateOne(ctx, bson.M{"email": user.Email}, update)
-		if err != nil {
-			return 0, err
-		}
-		return int64(primitive.NewObjectID().Timestamp().Unix()), nil
-	} else if err != mongo.ErrNoDocuments {
-		return 0, err
+func (m *MongoDB) LinkIdentity(ctx context.Context, email string, identity types.LinkedIdentity) error {
+	coll := m.database.Collection("users")
+	// Only link if the user has nothing at this provider yet; the unique
+	// index on identities stops two users sharing one identity
+	res, err := coll.UpdateOne(ctx,
+		bson.M{"email": email, "identities.provider": bson.M{"$ne": identity.Provider}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"identities": bson.M{"$concatArrays": bson.A{
+				bson.M{"$ifNull": bson.A{"$identities", bson.A{}}},
+				bson.A{bson.M{"$literal": identity}},
+			}}}}},
+			{{Key: "$set", Value: bson.M{"authtype": authTypeExpr}}},
+		},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("identity is linked to another user: %w", storage.ErrConflict)
 	}
-
-	// User doesn't exist, create new OAuth user
-	res, err := coll.InsertOne(ctx, user)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	id, ok := res.InsertedID.(primitive.ObjectID)
-	if !ok {
-		return 0, errors.New("failed to get inserted ID")
+	if res.MatchedCount == 0 {
+		user, err := m.GetUserByEmail(ctx, email)
+		if err != nil {
+			return err
+		}
+		if linked, _ := user.Identity(identity.Provider); linked.Subject == identity.Subject {
+			return nil
+		}
+		return fmt.Errorf("another %s account is already linked: %w", identity.Provider, storage.ErrConflict)
 	}
-	return int64(id.Timestamp().Unix()), nil
+	return nil
 }
 
-func (m *MongoDB) UnlinkGoogleAccount(email string) error {
-	ctx := context.Background()
+func (m *MongoDB) UnlinkIdentity(ctx context.Context, email, provider string) error {
 	coll := m.database.Collection("users")
-	
-	update := bson.M{
-		"$unset": bson.M{"googleid": ""},
-		"$set":   bson.M{"authtype": "email"},
+	// Keep at least one way to sign in: a password or another identity
+	res, err := coll.UpdateOne(ctx,
+		bson.M{
+			"email":               email,
+			"identities.provider": provider,
+			"$or": bson.A{
+				bson.M{"password": bson.M{"$type": "string"}},
+				bson.M{"identities.1": bson.M{"$exists": true}},
+			},
+		},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"identities": bson.M{"$filter": bson.M{
+				"input": "$identities",
+				"cond":  bson.M{"$ne": bson.A{"$$this.provider", provider}},
+			}}}}},
+			{{Key: "$set", Value: bson.M{"authtype": authTypeExpr}}},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		user, err := m.GetUserByEmail(ctx, email)
+		if err != nil {
+			return err
+		}
+		if _, ok := user.Identity(provider); !ok {
+			return storage.ErrNotFound
+		}
+		return fmt.Errorf("cannot remove the last way to sign in: %w", storage.ErrConflict)
 	}
-	
-	_, err := coll.UpdateOne(ctx, bson.M{"email": email}, update)
-	return err
-}
\ No newline at end of file
+	return nil
+}
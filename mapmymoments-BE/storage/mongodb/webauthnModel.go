@@ -0,0 +1,110 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+	"github.com/atindraraut/crudgo/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	webauthnSessionsCollection    = "webauthn_sessions"
+	webauthnCredentialsCollection = "webauthn_credentials"
+)
+
+func (m *MongoDB) SaveWebAuthnSession(ctx context.Context, session types.WebAuthnSession) error {
+	_, err := m.database.Collection(webauthnSessionsCollection).InsertOne(ctx, session)
+	if mongo.IsDuplicateKeyError(err) {
+		return storage.ErrConflict
+	}
+	return err
+}
+
+func (m *MongoDB) ConsumeWebAuthnSession(ctx context.Context, id string) (types.WebAuthnSession, error) {
+	var session types.WebAuthnSession
+	err := m.database.Collection(webauthnSessionsCollection).FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.WebAuthnSession{}, storage.ErrNotFound
+	}
+	if err != nil {
+		return types.WebAuthnSession{}, err
+	}
+	if !session.ExpiresAt.After(time.Now()) {
+		return types.WebAuthnSession{}, storage.ErrExpired
+	}
+	return session, nil
+}
+
+func (m *MongoDB) CreateWebAuthnCredential(ctx context.Context, credential types.WebAuthnCredential) error {
+	_, err := m.database.Collection(webauthnCredentialsCollection).InsertOne(ctx, credential)
+	if mongo.IsDuplicateKeyError(err) {
+		return storage.ErrConflict
+	}
+	return err
+}
+
+func (m *MongoDB) GetWebAuthnCredential(ctx context.Context, id string) (types.WebAuthnCredential, error) {
+	var credential types.WebAuthnCredential
+	err := m.database.Collection(webauthnCredentialsCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&credential)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return types.WebAuthnCredential{}, storage.ErrNotFound
+	}
+	return credential, err
+}
+
+func (m *MongoDB) ListWebAuthnCredentials(ctx context.Context, email string) ([]types.WebAuthnCredential, error) {
+	cursor, err := m.database.Collection(webauthnCredentialsCollection).Find(ctx,
+		bson.M{"userId": email},
+		options.Find().SetSort(bson.M{"createdAt": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	credentials := []types.WebAuthnCredential{}
+	if err := cursor.All(ctx, &credentials); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+func (m *MongoDB) UpdateWebAuthnCredentialUse(ctx context.Context, id string, signCount uint32, usedAt time.Time) error {
+	coll := m.database.Collection(webauthnCredentialsCollection)
+	// The counter must go up, unless the authenticator doesn't keep one
+	filter := bson.M{"_id": id, "signCount": bson.M{"$lt": signCount}}
+	if signCount == 0 {
+		filter["signCount"] = 0
+	}
+	res, err := coll.UpdateOne(ctx, filter,
+		bson.M{"$set": bson.M{"signCount": signCount, "lastUsedAt": usedAt}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 1 {
+		return nil
+	}
+	n, err := coll.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.ErrNotFound
+	}
+	return storage.ErrConflict
+}
+
+func (m *MongoDB) DeleteWebAuthnCredential(ctx context.Context, email, id string) error {
+	res, err := m.database.Collection(webauthnCredentialsCollection).DeleteOne(ctx, bson.M{"_id": id, "userId": email})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+)
+
+// ErrExhausted is returned when a share link has already been redeemed as
+// many times as its MaxJoins allows.
+var ErrExhausted = errors.New("share link has reached its join limit")
+
+// ErrApprovalRequired is returned by RedeemShareLink when the link only
+// accepts join requests and the user isn't a member yet.
+var ErrApprovalRequired = errors.New("share link requires approval to join")
+
+// NewShareToken returns a random, URL-safe share token. Tokens are bearer
+// secrets, so they come from crypto/rand rather than an ObjectID.
+func NewShareToken() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CheckShareLink reports why link can't be redeemed at now, or nil if it can.
+func CheckShareLink(link types.ShareLink, now time.Time) error {
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(now) {
+		return ErrExpired
+	}
+	if link.MaxJoins > 0 && link.JoinCount >= link.MaxJoins {
+		return ErrExhausted
+	}
+	return nil
+}
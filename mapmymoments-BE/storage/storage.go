@@ -1,30 +1,217 @@
 package storage
 
-import "github.com/atindraraut/crudgo/internal/types"
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/atindraraut/crudgo/internal/types"
+)
+
+// Sentinel errors returned by Storage implementations. Callers should compare
+// with errors.Is so implementations are free to wrap them with more context.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+	ErrExpired  = errors.New("expired")
+	// ErrVersionMismatch is returned by conditional writes when the stored
+	// version differs from the one the caller expected.
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrRateLimited is returned when an action has to wait. It comes
+	// wrapped in a *RetryAfterError saying until when.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrUnsupported is returned when the backend's deployment can't do
+	// what was asked, such as a transaction on a standalone MongoDB.
+	ErrUnsupported = errors.New("not supported by this deployment")
+)
+
+// RetryAfterError is an ErrRateLimited that knows when to try again
+type RetryAfterError struct {
+	RetryAt time.Time
+}
+
+func (e *RetryAfterError) Error() string {
+	return "rate limited until " + e.RetryAt.Format(time.RFC3339)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return ErrRateLimited
+}
 
 type Storage interface {
-	GetUserByEmail(email string) (types.UserData, error)
-	CreateUser(user types.UserData) (int64, error)
-	GetOTPRecordByEmail(email string) (types.OTPRecord, error)
-	SaveOTPRecord(record types.OTPRecord) error
-	DeleteOTPRecordByEmail(email string) error
+	GetUserByEmail(ctx context.Context, email string) (types.UserData, error)
+	CreateUser(ctx context.Context, user types.UserData) error
+	// OTPs. There is one record per email and type. SaveOTPRecord replaces
+	// the code, returning a *RetryAfterError if policy doesn't allow
+	// another send yet. ClaimOTPAttempt counts a guess at the code before
+	// returning it, so at most maxAttempts guesses are ever checked; it
+	// returns ErrNotFound if there is no unexpired code and ErrExpired once
+	// the attempts are used up. GetOTPRecord returns the record even if its
+	// code has expired, for resending. ConsumeOTPRecord uses up the code,
+	// returning ErrNotFound if it was already used.
+	SaveOTPRecord(ctx context.Context, record types.OTPRecord, policy types.OTPPolicy) error
+	GetOTPRecord(ctx context.Context, email, otpType string) (types.OTPRecord, error)
+	ClaimOTPAttempt(ctx context.Context, email, otpType string, maxAttempts int) (types.OTPRecord, error)
+	ConsumeOTPRecord(ctx context.Context, email, otpType string) error
+	// Login throttling, per account and per client. RecordLoginFailure
+	// counts a failed sign-in, starting over if the last was more than
+	// policy.Window ago, and locks the key for policy.Delay of the count.
+	// GetLoginThrottle returns ErrNotFound for keys without recent
+	// failures. SetLoginUnlockToken returns ErrNotFound if there is nothing
+	// to unlock, and UnlockLogin returns it for unknown tokens.
+	RecordLoginFailure(ctx context.Context, key string, policy types.LockoutPolicy) (types.LoginThrottle, error)
+	GetLoginThrottle(ctx context.Context, key string) (types.LoginThrottle, error)
+	ClearLoginThrottle(ctx context.Context, key string) error
+	SetLoginUnlockToken(ctx context.Context, key, tokenHash string) error
+	UnlockLogin(ctx context.Context, tokenHash string) error
 	// Route CRUD
-	CreateRoute(route interface{}) (string, error)
-	GetRouteById(id string) (interface{}, error)
-	GetAllRoutes() ([]interface{}, error)
-	UpdateRoute(id string, route interface{}) (string, error)
-	DeleteRoute(id string) (string, error)
-	UpdateUserPassword(email, hashedPassword string) error
-	// OAuth methods
-	GetUserByGoogleID(googleID string) (types.UserData, error)
-	CreateOrUpdateGoogleUser(user types.UserData) (int64, error)
-	UnlinkGoogleAccount(email string) error
+	CreateRoute(ctx context.Context, route types.Route) (string, error)
+	GetRouteById(ctx context.Context, id string) (types.Route, error)
+	ListRoutes(ctx context.Context, opts types.RouteListOptions) (types.RoutePage, error)
+	// UpdateRoute replaces the route if its version equals expectedVersion
+	// (0 skips the check) and returns the new version.
+	UpdateRoute(ctx context.Context, id string, route types.Route, expectedVersion int64) (int64, error)
+	DeleteRoute(ctx context.Context, id string, expectedVersion int64) error
+	AppendRoutePhotos(ctx context.Context, id string, photos []types.Photo) error
+	SetRouteVisibility(ctx context.Context, id, visibility string) error
+	// UpdateUserPassword sets or replaces the password, updating AuthType
+	UpdateUserPassword(ctx context.Context, email, hashedPassword string) error
+	// Linked identities. LinkIdentity returns ErrConflict if the identity
+	// belongs to another user or the user already has one at that
+	// provider. UnlinkIdentity returns ErrConflict rather than remove the
+	// last way to sign in. Both keep AuthType up to date.
+	GetUserByIdentity(ctx context.Context, provider, subject string) (types.UserData, error)
+	LinkIdentity(ctx context.Context, email string, identity types.LinkedIdentity) error
+	UnlinkIdentity(ctx context.Context, email, provider string) error
+	// OAuth login state. ConsumeOAuthState deletes the state as it reads
+	// it, so a replayed callback gets ErrNotFound; expired states give
+	// ErrExpired.
+	SaveOAuthState(ctx context.Context, state types.OAuthState) error
+	ConsumeOAuthState(ctx context.Context, id string) (types.OAuthState, error)
+	// Magic links. ConsumeMagicLink works like ConsumeOAuthState.
+	SaveMagicLink(ctx context.Context, link types.MagicLink) error
+	ConsumeMagicLink(ctx context.Context, id string) (types.MagicLink, error)
+	// Pending links. SavePendingLink creates or replaces the link.
+	// RecordPendingLinkFailure counts a failed proof and deletes the link
+	// once maxFailures is reached, returning ErrExpired then.
+	// DeletePendingLink returns ErrNotFound if the link is already gone, so
+	// only one caller can complete it.
+	SavePendingLink(ctx context.Context, link types.PendingLink) error
+	GetPendingLink(ctx context.Context, id string) (types.PendingLink, error)
+	RecordPendingLinkFailure(ctx context.Context, id string, maxFailures int) error
+	DeletePendingLink(ctx context.Context, id string) error
+	// Two-factor authentication. SetTwoFactor replaces the user's
+	// authenticator; nil removes it. UseTOTPStep records a code's time step,
+	// returning ErrConflict if that step or a later one was already used.
+	// UseRecoveryCode removes the code with the given hash, returning
+	// ErrNotFound if the user has no such code.
+	SetTwoFactor(ctx context.Context, email string, twoFactor *types.TwoFactor) error
+	UseTOTPStep(ctx context.Context, email string, step int64) error
+	UseRecoveryCode(ctx context.Context, email, codeHash string) error
+	// Two-factor challenges. ClaimTwoFactorAttempt counts a guess before
+	// it is checked, like ClaimOTPAttempt, returning ErrNotFound if the
+	// challenge is gone and ErrExpired once it has expired or used up
+	// maxAttempts. DeleteTwoFactorChallenge works like DeletePendingLink.
+	CreateTwoFactorChallenge(ctx context.Context, challenge types.TwoFactorChallenge) error
+	ClaimTwoFactorAttempt(ctx context.Context, id string, maxAttempts int) (types.TwoFactorChallenge, error)
+	DeleteTwoFactorChallenge(ctx context.Context, id string) error
+	// Passkeys. ConsumeWebAuthnSession works like ConsumeOAuthState.
+	// CreateWebAuthnCredential returns ErrConflict if the credential is
+	// already registered. UpdateWebAuthnCredentialUse records a sign in,
+	// returning ErrConflict if the signature counter didn't go up (a sign
+	// of a cloned authenticator). DeleteWebAuthnCredential returns
+	// ErrNotFound unless the user owns the credential.
+	SaveWebAuthnSession(ctx context.Context, session types.WebAuthnSession) error
+	ConsumeWebAuthnSession(ctx context.Context, id string) (types.WebAuthnSession, error)
+	CreateWebAuthnCredential(ctx context.Context, credential types.WebAuthnCredential) error
+	GetWebAuthnCredential(ctx context.Context, id string) (types.WebAuthnCredential, error)
+	ListWebAuthnCredentials(ctx context.Context, email string) ([]types.WebAuthnCredential, error)
+	UpdateWebAuthnCredentialUse(ctx context.Context, id string, signCount uint32, usedAt time.Time) error
+	DeleteWebAuthnCredential(ctx context.Context, email, id string) error
+	// Refresh tokens. RotateRefreshToken marks the token used and stores
+	// its successor in one step. It returns ErrConflict if the token was
+	// already used (a replay), ErrExpired if it is expired or revoked and
+	// ErrNotFound for unknown tokens.
+	CreateRefreshToken(ctx context.Context, token types.RefreshToken) error
+	RotateRefreshToken(ctx context.Context, tokenId string, next types.RefreshToken) error
+	// Sessions. GetSession and ListSessions leave out revoked and expired
+	// sessions. Revoking a session also revokes its refresh tokens;
+	// RevokeOtherSessions returns how many sessions it ended.
+	CreateSession(ctx context.Context, session types.Session) error
+	GetSession(ctx context.Context, sessionId string) (types.Session, error)
+	ListSessions(ctx context.Context, userId string) ([]types.Session, error)
+	TouchSession(ctx context.Context, sessionId, ip string, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, userId, sessionId string) error
+	RevokeOtherSessions(ctx context.Context, userId, keepSessionId string) (int, error)
 	// Route sharing methods
-	GenerateRouteShareToken(routeId string, expiryHours *int) (string, error)
-	GetRouteByShareToken(token string) (interface{}, error)
-	AddUserToSharedRoute(routeId, userId, email string) error
-	GetSharedRoutesForUser(userId string) ([]interface{}, error)
-	GetUsersByRouteId(routeId string) ([]types.UserData, error)
-	CheckUserRoutePermission(userId, routeId string) (string, error) // returns permission level or empty string
-	RevokeRouteShare(routeId string) error
+	// Share links. CreateShareLink fills in the ID, token and creation time.
+	CreateShareLink(ctx context.Context, link types.ShareLink) (types.ShareLink, error)
+	ListShareLinks(ctx context.Context, routeId string) ([]types.ShareLink, error)
+	RevokeShareLink(ctx context.Context, routeId, linkId string) error
+	// RotateShareLink gives the link a fresh token, keeping everything else.
+	// Both cancel the link's pending join requests.
+	RotateShareLink(ctx context.Context, routeId, linkId string) (types.ShareLink, error)
+	// GetShareLinkByToken returns ErrExpired or ErrExhausted for links that
+	// can no longer be redeemed.
+	GetShareLinkByToken(ctx context.Context, token string) (types.ShareLink, error)
+	// RedeemShareLink adds the user to the link's route with the link's role,
+	// counting the join atomically against MaxJoins. The owner and existing
+	// collaborators get the link back without using up a join, even if it
+	// has since expired or been exhausted. Links that require approval
+	// return ErrApprovalRequired for everyone else.
+	RedeemShareLink(ctx context.Context, token, userId, email string) (types.ShareLink, error)
+	// ClaimShareLinkAttempt counts a passphrase guess before it is checked,
+	// so concurrent guesses can't slip past the lock. The claim that brings
+	// the count to maxFailures locks the link for lockout and restarts the
+	// count; while locked it returns a *RetryAfterError. A correct guess
+	// should be followed by ResetShareLinkFailures.
+	ClaimShareLinkAttempt(ctx context.Context, linkId string, maxFailures int, lockout time.Duration) (types.ShareLink, error)
+	ResetShareLinkFailures(ctx context.Context, linkId string) error
+	// AddUserToSharedRoute is a no-op for users who already collaborate.
+	AddUserToSharedRoute(ctx context.Context, routeId, userId, email, role string) error
+	// UpdateCollaboratorRole returns ErrNotFound if userId isn't a
+	// collaborator on the route.
+	UpdateCollaboratorRole(ctx context.Context, routeId, userId, role string) error
+	// RemoveCollaborator returns ErrNotFound if userId isn't a collaborator
+	// on the route.
+	RemoveCollaborator(ctx context.Context, routeId, userId string) error
+	GetSharedRoutesForUser(ctx context.Context, userId string, opts types.RouteListOptions) (types.RoutePage, error)
+	GetUsersByRouteId(ctx context.Context, routeId string) ([]types.UserData, error)
+	CheckUserRoutePermission(ctx context.Context, userId, routeId string) (string, error) // returns a Role* constant or empty string
+	// Invitations. CreateInvitation fills in the ID, status and creation
+	// time and returns ErrConflict if the address already has a pending
+	// invitation to the route. Listings leave out expired invitations.
+	CreateInvitation(ctx context.Context, inv types.Invitation) (types.Invitation, error)
+	ListRouteInvitations(ctx context.Context, routeId string) ([]types.Invitation, error)
+	ListInvitationsForEmail(ctx context.Context, email string) ([]types.Invitation, error)
+	DeleteInvitation(ctx context.Context, routeId, invitationId string) error
+	// RespondToInvitation accepts or declines a pending invitation addressed
+	// to email; accepting adds them to the route with the invited role. It
+	// returns ErrExpired for stale invitations and ErrConflict if the
+	// invitation was already answered.
+	RespondToInvitation(ctx context.Context, invitationId, email string, accept bool) (types.Invitation, error)
+	// Join requests. RequestToJoin files a pending request through a link
+	// that requires approval, or returns the user's existing pending one.
+	// DecideJoinRequest approves (adding the requester with the link's
+	// role) or rejects it, and returns ErrConflict if it was already decided.
+	// Approval counts against the link like RedeemShareLink and returns
+	// ErrExpired or ErrExhausted, leaving the request pending, if the link
+	// can no longer be used.
+	RequestToJoin(ctx context.Context, token, userId, email string) (types.JoinRequest, error)
+	ListJoinRequests(ctx context.Context, routeId string) ([]types.JoinRequest, error)
+	ListJoinRequestsForUser(ctx context.Context, userId string) ([]types.JoinRequest, error)
+	DecideJoinRequest(ctx context.Context, routeId, requestId, decidedBy string, approve bool) (types.JoinRequest, error)
+	// Ownership transfer. AcceptOwnershipTransfer makes userId the creator
+	// and drops them from the collaborators, keeping the previous owner on
+	// as a co-owner if the offer says so, in routes and route_shares
+	// together. It returns ErrNotFound if nothing is on offer to userId and
+	// ErrExpired for stale offers, or ErrUnsupported if the backend can't
+	// make both changes at once. Declining and cancelling clear the offer.
+	OfferOwnershipTransfer(ctx context.Context, routeId string, transfer types.OwnershipTransfer) error
+	AcceptOwnershipTransfer(ctx context.Context, routeId, userId string) (types.Route, error)
+	DeclineOwnershipTransfer(ctx context.Context, routeId, userId string) error
+	CancelOwnershipTransfer(ctx context.Context, routeId string) error
+	// RevokeRouteShare deletes every share link and evicts every
+	// collaborator.
+	RevokeRouteShare(ctx context.Context, routeId string) error
 }
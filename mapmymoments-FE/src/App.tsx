@@ -17,6 +17,9 @@ import RequestReset from './pages/RequestReset';
 import ResetPassword from './pages/ResetPassword';
 import { OAuthCallback } from './pages/OAuthCallback';
 import JoinSharedRoute from './pages/JoinSharedRoute';
+import Invitations from './pages/Invitations';
+import UnlockAccount from './pages/UnlockAccount';
+import MagicLink from './pages/MagicLink';
 
 const queryClient = new QueryClient();
 
@@ -49,6 +52,9 @@ const App = () => {
               <Route path="/reset-password" element={<ResetPassword />} />
               <Route path="/oauth/callback" element={<OAuthCallback />} />
               <Route path="/shared-routes/:token" element={<Suspense fallback={<MapLoader />}><JoinSharedRoute /></Suspense>} />
+              <Route path="/invitations" element={<Invitations />} />
+              <Route path="/unlock-account" element={<UnlockAccount />} />
+              <Route path="/magic-link" element={<MagicLink />} />
               {/* ADD ALL CUSTOM ROUTES ABOVE THE CATCH-ALL "*" ROUTE */}
               <Route path="*" element={<NotFound />} />
             </Routes>
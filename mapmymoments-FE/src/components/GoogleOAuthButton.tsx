@@ -11,12 +11,16 @@ interface GoogleOAuthButtonProps {
     last_name: string;
   }) => void;
   onError: (error: string) => void;
+  // Called instead of onSuccess when the account has two-factor
+  // authentication; finish with verifyTwoFactor
+  onTwoFactorRequired?: (challengeToken: string) => void;
   disabled?: boolean;
 }
 
 export const GoogleOAuthButton: React.FC<GoogleOAuthButtonProps> = ({
   onSuccess,
   onError,
+  onTwoFactorRequired,
   disabled = false
 }) => {
   const [isLoading, setIsLoading] = useState(false);
@@ -67,6 +71,15 @@ export const GoogleOAuthButton: React.FC<GoogleOAuthButtonProps> = ({
               body: JSON.stringify({ code, state: returnedState }),
             });
             const tokenResponse = await response.json();
+            if (!response.ok) {
+              // e.g. the login took too long and its state expired
+              onError(tokenResponse.error || 'Failed to exchange OAuth code');
+              return;
+            }
+            if (tokenResponse.two_factor_required) {
+              onTwoFactorRequired?.(tokenResponse.challenge_token);
+              return;
+            }
             
             // Store tokens in localStorage
             localStorage.setItem('access_token', tokenResponse.access_token);
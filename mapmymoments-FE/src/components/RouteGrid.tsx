@@ -1,4 +1,4 @@
-import React, { useEffect, useState } from 'react';
+import React, { useCallback, useEffect, useRef, useState } from 'react';
 import { getRoutes } from '@/lib/api';
 import type { RouteData } from '@/lib/api';
 import MapLoader from '@/components/MapLoader';
@@ -12,13 +12,17 @@ const RouteGrid: React.FC<RouteGridProps> = ({ onSelectRoute }) => {
   const [routes, setRoutes] = useState<RouteData[]>([]);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
+  const [nextCursor, setNextCursor] = useState<string | undefined>();
+  const [loadingMore, setLoadingMore] = useState(false);
+  const sentinelRef = useRef<HTMLDivElement | null>(null);
   const navigate = useNavigate();
 
   useEffect(() => {
     setLoading(true);
     getRoutes().then(res => {
-      if (res.success && Array.isArray(res.data)) {
-        setRoutes(res.data);
+      if (res.success && res.data) {
+        setRoutes(res.data.routes);
+        setNextCursor(res.data.nextCursor);
         setError(null);
       } else {
         setError(res.error || 'Failed to fetch routes');
@@ -27,6 +31,33 @@ const RouteGrid: React.FC<RouteGridProps> = ({ onSelectRoute }) => {
     });
   }, []);
 
+  const loadMore = useCallback(() => {
+    if (!nextCursor || loadingMore) return;
+    setLoadingMore(true);
+    getRoutes(nextCursor).then(res => {
+      if (res.success && res.data) {
+        const page = res.data;
+        setRoutes(prev => [...prev, ...page.routes]);
+        setNextCursor(page.nextCursor);
+      } else {
+        // Stop paging rather than retrying in a loop; the loaded routes stay visible
+        setNextCursor(undefined);
+      }
+      setLoadingMore(false);
+    });
+  }, [nextCursor, loadingMore]);
+
+  // Infinite scroll: fetch the next page once the sentinel below the grid is visible
+  useEffect(() => {
+    const sentinel = sentinelRef.current;
+    if (!sentinel || !nextCursor) return;
+    const observer = new IntersectionObserver(entries => {
+      if (entries[0].isIntersecting) loadMore();
+    }, { rootMargin: '200px' });
+    observer.observe(sentinel);
+    return () => observer.disconnect();
+  }, [nextCursor, loadMore]);
+
   const handleRouteClick = (routeId: string) => {
     navigate(`/route/${routeId}`);
   };
@@ -173,6 +204,11 @@ const RouteGrid: React.FC<RouteGridProps> = ({ onSelectRoute }) => {
             );
           })}
         </div>
+        {nextCursor && (
+          <div ref={sentinelRef} className="flex justify-center py-6">
+            {loadingMore && <span className="text-xs text-gray-500">Loading more routes…</span>}
+          </div>
+        )}
       </div>
     </div>
   );
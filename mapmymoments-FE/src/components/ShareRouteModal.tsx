@@ -5,9 +5,10 @@ import { Input } from "@/components/ui/input";
 import { Label } from "@/components/ui/label";
 import { Dialog, DialogContent, DialogHeader, DialogTitle, DialogFooter } from "@/components/ui/dialog";
 import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from "@/components/ui/select";
+import { Switch } from "@/components/ui/switch";
 import { Copy, Check, Share2, Clock } from "lucide-react";
 import { toast } from "sonner";
-import { shareRoute, revokeRouteShare } from '@/lib/api';
+import { shareRoute, revokeRouteShare, CollaboratorRole } from '@/lib/api';
 
 interface ShareRouteModalProps {
   isOpen: boolean;
@@ -27,12 +28,15 @@ const ShareRouteModal = ({ isOpen, onClose, routeId, routeName }: ShareRouteModa
   const [isLoading, setIsLoading] = useState(false);
   const [isCopied, setIsCopied] = useState(false);
   const [expiryHours, setExpiryHours] = useState<string>("");
+  const [role, setRole] = useState<CollaboratorRole>("contributor");
+  const [passphrase, setPassphrase] = useState("");
+  const [requireApproval, setRequireApproval] = useState(false);
 
   const generateShareLink = async () => {
     setIsLoading(true);
     try {
       const expiryValue = expiryHours && expiryHours !== "never" ? parseInt(expiryHours) : undefined;
-      const response = await shareRoute(routeId, expiryValue);
+      const response = await shareRoute(routeId, expiryValue, role, passphrase, requireApproval);
       
       if (response.success && response.data) {
         // Construct the share URL on the frontend using current domain
@@ -122,6 +126,41 @@ const ShareRouteModal = ({ isOpen, onClose, routeId, routeName }: ShareRouteModa
                   </SelectContent>
                 </Select>
               </div>
+
+              <div className="space-y-2">
+                <Label htmlFor="role">People who join can</Label>
+                <Select value={role} onValueChange={(value) => setRole(value as CollaboratorRole)}>
+                  <SelectTrigger>
+                    <SelectValue />
+                  </SelectTrigger>
+                  <SelectContent>
+                    <SelectItem value="viewer">View only</SelectItem>
+                    <SelectItem value="contributor">Upload photos</SelectItem>
+                    <SelectItem value="editor">Edit the route</SelectItem>
+                    <SelectItem value="co-owner">Manage sharing (co-owner)</SelectItem>
+                  </SelectContent>
+                </Select>
+              </div>
+
+              <div className="space-y-2">
+                <Label htmlFor="passphrase">Passphrase (Optional)</Label>
+                <Input
+                  id="passphrase"
+                  type="password"
+                  value={passphrase}
+                  onChange={(e) => setPassphrase(e.target.value)}
+                  placeholder="Required to open the link"
+                />
+              </div>
+
+              <div className="flex items-center justify-between">
+                <Label htmlFor="requireApproval">Approve people before they join</Label>
+                <Switch
+                  id="requireApproval"
+                  checked={requireApproval}
+                  onCheckedChange={setRequireApproval}
+                />
+              </div>
               
               <Button 
                 onClick={generateShareLink} 
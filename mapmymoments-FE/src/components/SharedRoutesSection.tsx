@@ -21,6 +21,8 @@ interface SharedRouteData extends RouteData {
 const SharedRoutesSection = () => {
   const [sharedRoutes, setSharedRoutes] = useState<SharedRouteData[]>([]);
   const [isLoading, setIsLoading] = useState(true);
+  const [nextCursor, setNextCursor] = useState<string | undefined>();
+  const [isLoadingMore, setIsLoadingMore] = useState(false);
   const navigate = useNavigate();
 
   useEffect(() => {
@@ -32,7 +34,8 @@ const SharedRoutesSection = () => {
     try {
       const response = await getSharedRoutesForUser();
       if (response.success && response.data) {
-        setSharedRoutes(response.data as SharedRouteData[]);
+        setSharedRoutes(response.data.routes as SharedRouteData[]);
+        setNextCursor(response.data.nextCursor);
       } else {
         toast.error(response.error || 'Failed to load shared routes');
       }
@@ -44,6 +47,26 @@ const SharedRoutesSection = () => {
     }
   };
 
+  const loadMoreSharedRoutes = async () => {
+    if (!nextCursor) return;
+    setIsLoadingMore(true);
+    try {
+      const response = await getSharedRoutesForUser(nextCursor);
+      if (response.success && response.data) {
+        const page = response.data;
+        setSharedRoutes(prev => [...prev, ...(page.routes as SharedRouteData[])]);
+        setNextCursor(page.nextCursor);
+      } else {
+        toast.error(response.error || 'Failed to load shared routes');
+      }
+    } catch (error) {
+      toast.error('Failed to load shared routes');
+      console.error('Error fetching shared routes:', error);
+    } finally {
+      setIsLoadingMore(false);
+    }
+  };
+
   const handleViewRoute = (routeId: string) => {
     navigate(`/route/${routeId}`);
   };
@@ -81,7 +104,7 @@ const SharedRoutesSection = () => {
           Shared Routes
         </CardTitle>
         <CardDescription>
-          Routes that have been shared with you ({sharedRoutes.length})
+          Routes that have been shared with you ({sharedRoutes.length}{nextCursor ? '+' : ''})
         </CardDescription>
       </CardHeader>
       <CardContent>
@@ -152,6 +175,18 @@ const SharedRoutesSection = () => {
                 </div>
               </div>
             ))}
+            {nextCursor && (
+              <div className="flex justify-center">
+                <Button
+                  onClick={loadMoreSharedRoutes}
+                  variant="outline"
+                  size="sm"
+                  disabled={isLoadingMore}
+                >
+                  {isLoadingMore ? 'Loading…' : 'Load more'}
+                </Button>
+              </div>
+            )}
           </div>
         )}
       </CardContent>
@@ -122,13 +122,26 @@ export async function saveRoute(routeData: RouteData): Promise<ApiResponse<{ id:
 }
 
 /**
- * Get a list of routes from the backend
+ * One page of a route listing. nextCursor is absent on the last page.
+ */
+export interface RoutePage {
+  routes: RouteData[];
+  nextCursor?: string;
+}
+
+function pageQuery(cursor?: string): string {
+  return cursor ? `?cursor=${encodeURIComponent(cursor)}` : '';
+}
+
+/**
+ * Get the current user's routes from the backend
  * 
- * @returns An array of routes
+ * @param cursor - nextCursor from the previous page, omitted for the first page
+ * @returns A page of routes
  */
-export async function getRoutes(): Promise<ApiResponse<RouteData[]>> {
+export async function getRoutes(cursor?: string): Promise<ApiResponse<RoutePage>> {
   try {
-    const response = await apiFetch('/api/routes', {
+    const response = await apiFetch(`/api/my-routes${pageQuery(cursor)}`, {
       method: 'GET',
     });
 
@@ -143,7 +156,7 @@ export async function getRoutes(): Promise<ApiResponse<RouteData[]>> {
 
     return {
       success: true,
-      data: data,
+      data: { routes: data.routes ?? [], nextCursor: data.nextCursor },
     };
   } catch (error) {
     console.error('Error fetching routes:', error);
@@ -347,6 +360,16 @@ export interface UserAuthInfo {
   auth_type: string;
   has_password: boolean;
   has_google: boolean;
+  identities: LinkedIdentity[];
+  two_factor_enabled: boolean;
+}
+
+export type IdentityProviderName = 'google' | 'github' | 'microsoft' | 'apple';
+
+export interface LinkedIdentity {
+  provider: IdentityProviderName;
+  email: string;
+  linkedAt: string;
 }
 
 /**
@@ -367,31 +390,307 @@ export async function getUserAuthInfo(): Promise<UserAuthInfo> {
 }
 
 /**
- * Unlink Google account from current user
+ * Get the sign-in providers the backend is configured for
+ */
+export async function getIdentityProviders(): Promise<IdentityProviderName[]> {
+  const response = await apiFetch('/user/oauth/providers', {
+    method: 'GET',
+  });
+
+  if (!response.ok) {
+    throw new Error('Failed to get sign-in providers');
+  }
+
+  const data = await response.json();
+  return data.providers;
+}
+
+/**
+ * Unlink a provider account (Google, GitHub, ...) from current user
  * 
  * @returns Success message
  */
-export async function unlinkGoogleAccount(): Promise<{ message: string }> {
-  const response = await apiFetch('/user/unlink-google', {
-    method: 'POST',
+export async function unlinkIdentity(provider: IdentityProviderName): Promise<{ message: string }> {
+  const response = await apiFetch(`/user/identities/${provider}`, {
+    method: 'DELETE',
   });
 
   if (!response.ok) {
     const errorData = await response.json();
-    throw new Error(errorData.message || 'Failed to unlink Google account');
+    throw new Error(errorData.error || 'Failed to unlink account');
   }
 
   return response.json();
 }
 
+/**
+ * Start linking a provider account to the current user. Finish with
+ * linkIdentity once the provider redirects back with a code.
+ */
+export async function getIdentityLinkUrl(provider: IdentityProviderName): Promise<ApiResponse<GoogleOAuthUrlResponse>> {
+  return apiJsonRequest<GoogleOAuthUrlResponse>(`/user/identities/${provider}/url`, 'GET', 'Failed to start linking');
+}
+
+export async function linkIdentity(provider: IdentityProviderName, code: string, state: string): Promise<ApiResponse<LinkedIdentity>> {
+  return apiJsonRequest<LinkedIdentity>(`/user/identities/${provider}`, 'POST', 'Failed to link account', { code, state });
+}
+
+/**
+ * Returned with a 409 by the OAuth callback when the provider's verified
+ * email already has an account. Prove it is yours with sendLinkOtp and
+ * confirmLink to link the provider and sign in. email_verification_required
+ * means the provider didn't verify the email of a new account; confirming
+ * the emailed code creates it.
+ */
+export interface OAuthLinkRequired {
+  code: 'link_required' | 'email_verification_required';
+  error: string;
+  link_token: string;
+  provider: IdentityProviderName;
+  email: string;
+  methods: Array<'password' | 'otp'>;
+}
+
+export async function sendLinkOtp(linkToken: string): Promise<ApiResponse<{ message: string }>> {
+  return apiJsonRequest('/user/oauth/link/send-otp', 'POST', 'Failed to send code', { link_token: linkToken });
+}
+
+export async function confirmLink(linkToken: string, proof: { password: string } | { otp: string }): Promise<ApiResponse<AuthTokenResponse>> {
+  return apiJsonRequest<AuthTokenResponse>('/user/oauth/link/confirm', 'POST', 'Failed to link account', { link_token: linkToken, ...proof });
+}
+
+/**
+ * Sends a new signup or password reset code. Codes can be resent once a
+ * minute and five times an hour; the error says when a signup code can't
+ * be sent yet.
+ */
+export async function resendOtp(email: string, type: 'signup' | 'reset'): Promise<ApiResponse<{ message: string }>> {
+  return apiJsonRequest('/user/resend-otp', 'POST', 'Failed to resend code', { email, type });
+}
+
+/** Lifts a sign-in lockout with the token from the lockout email */
+export async function unlockAccount(token: string): Promise<ApiResponse<{ message: string }>> {
+  return apiJsonRequest('/user/unlock', 'POST', 'Failed to unlock account', { token });
+}
+
+// Passwords
+
+/** Changes the password and signs out every other session */
+export async function changePassword(currentPassword: string, newPassword: string): Promise<ApiResponse<{ message: string; revoked: number }>> {
+  return apiJsonRequest('/user/change-password', 'POST', 'Failed to change password', { current_password: currentPassword, new_password: newPassword });
+}
+
+/**
+ * Gives an account that signs in only through providers a password. Fails
+ * with "please sign in again" unless the session signed in in the last
+ * five minutes.
+ */
+export async function setPassword(password: string): Promise<ApiResponse<{ message: string; auth_type: string }>> {
+  return apiJsonRequest('/user/set-password', 'POST', 'Failed to set password', { password });
+}
+
+// Magic link sign-in. The nonce ties a link to the browser that asked for
+// it, so it is kept in localStorage where the tab opened from the email
+// can find it.
+const MAGIC_LINK_NONCE_KEY = 'magic_link_nonce';
+
+export async function requestMagicLink(email: string): Promise<ApiResponse<{ message: string }>> {
+  const result = await apiJsonRequest<{ message: string; nonce: string }>('/user/magic-link', 'POST', 'Failed to send sign-in link', { email });
+  if (result.success && result.data) {
+    localStorage.setItem(MAGIC_LINK_NONCE_KEY, result.data.nonce);
+  }
+  return result;
+}
+
+/** Signs in with a magic link's token; responds like login */
+export async function verifyMagicLink(token: string): Promise<ApiResponse<AuthTokenResponse | TwoFactorChallenge>> {
+  const nonce = localStorage.getItem(MAGIC_LINK_NONCE_KEY);
+  if (!nonce) {
+    return { success: false, error: 'Open the sign-in link in the browser you requested it from' };
+  }
+  const result = await apiJsonRequest<AuthTokenResponse | TwoFactorChallenge>('/user/magic-link/verify', 'POST', 'Failed to sign in', { token, nonce });
+  localStorage.removeItem(MAGIC_LINK_NONCE_KEY);
+  return result;
+}
+
+// Two-factor authentication API types and functions
+
+/**
+ * Returned by login and the OAuth callback, in place of tokens, when the
+ * account has two-factor authentication
+ */
+export interface TwoFactorChallenge {
+  two_factor_required: true;
+  challenge_token: string;
+  expires_at: string;
+}
+
+export interface TwoFactorSetup {
+  secret: string;
+  otpauth_uri: string;
+}
+
+export interface RecoveryCodes {
+  recovery_codes: string[];
+}
+
+/** A TOTP code or a recovery code, for signing in or re-authenticating */
+export type SecondFactor = { code: string } | { recovery_code: string };
+
+export async function verifyTwoFactor(challengeToken: string, factor: SecondFactor): Promise<ApiResponse<AuthTokenResponse>> {
+  return apiJsonRequest<AuthTokenResponse>('/user/2fa/verify', 'POST', 'Failed to verify code', { challenge_token: challengeToken, ...factor });
+}
+
+export async function startTwoFactorSetup(): Promise<ApiResponse<TwoFactorSetup>> {
+  return apiJsonRequest<TwoFactorSetup>('/user/2fa/setup', 'POST', 'Failed to start two-factor setup');
+}
+
+export async function confirmTwoFactor(code: string): Promise<ApiResponse<RecoveryCodes>> {
+  return apiJsonRequest<RecoveryCodes>('/user/2fa/confirm', 'POST', 'Failed to enable two-factor authentication', { code });
+}
+
+export async function disableTwoFactor(password: string, factor: SecondFactor): Promise<ApiResponse<{ message: string }>> {
+  return apiJsonRequest('/user/2fa/disable', 'POST', 'Failed to disable two-factor authentication', { password, ...factor });
+}
+
+export async function regenerateRecoveryCodes(password: string, factor: SecondFactor): Promise<ApiResponse<RecoveryCodes>> {
+  return apiJsonRequest<RecoveryCodes>('/user/2fa/recovery-codes', 'POST', 'Failed to regenerate recovery codes', { password, ...factor });
+}
+
+// Passkey (WebAuthn) API types and functions
+
+export interface Passkey {
+  id: string;
+  nickname: string;
+  transports: string[];
+  synced: boolean;
+  createdAt: string;
+  lastUsedAt?: string;
+}
+
+interface WebAuthnBegin {
+  session_id: string;
+  // eslint-disable-next-line @typescript-eslint/no-explicit-any
+  options: { publicKey: any };
+}
+
+const fromBase64Url = (value: string): ArrayBuffer => {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+  const binary = atob(base64.padEnd(base64.length + (4 - base64.length % 4) % 4, '='));
+  return Uint8Array.from(binary, c => c.charCodeAt(0)).buffer;
+};
+
+const toBase64Url = (buffer: ArrayBuffer): string =>
+  btoa(String.fromCharCode(...new Uint8Array(buffer))).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+
+/**
+ * Register a passkey for the current user on this device
+ */
+export async function registerPasskey(nickname?: string): Promise<ApiResponse<Passkey>> {
+  const begin = await apiJsonRequest<WebAuthnBegin>('/user/webauthn/register/begin', 'POST', 'Failed to start passkey registration');
+  if (!begin.success || !begin.data) return { success: false, error: begin.error };
+  const { publicKey } = begin.data.options;
+  try {
+    const credential = await navigator.credentials.create({
+      publicKey: {
+        ...publicKey,
+        challenge: fromBase64Url(publicKey.challenge),
+        user: { ...publicKey.user, id: fromBase64Url(publicKey.user.id) },
+        excludeCredentials: (publicKey.excludeCredentials ?? []).map((c: { id: string }) => ({ ...c, id: fromBase64Url(c.id) })),
+      },
+    }) as PublicKeyCredential;
+    const response = credential.response as AuthenticatorAttestationResponse;
+    return apiJsonRequest<Passkey>('/user/webauthn/register/finish', 'POST', 'Failed to register passkey', {
+      session_id: begin.data.session_id,
+      nickname,
+      credential: {
+        id: credential.id,
+        rawId: toBase64Url(credential.rawId),
+        type: credential.type,
+        response: {
+          clientDataJSON: toBase64Url(response.clientDataJSON),
+          attestationObject: toBase64Url(response.attestationObject),
+          transports: response.getTransports?.() ?? [],
+        },
+      },
+    });
+  } catch (error) {
+    return { success: false, error: error instanceof Error ? error.message : 'Passkey registration was cancelled' };
+  }
+}
+
+/**
+ * Sign in with a passkey. The browser asks which one to use, so no email
+ * is needed.
+ */
+export async function signInWithPasskey(): Promise<ApiResponse<AuthTokenResponse>> {
+  const begin = await apiJsonRequest<WebAuthnBegin>('/user/webauthn/login/begin', 'POST', 'Failed to start passkey sign in');
+  if (!begin.success || !begin.data) return { success: false, error: begin.error };
+  const { publicKey } = begin.data.options;
+  try {
+    const credential = await navigator.credentials.get({
+      publicKey: { ...publicKey, challenge: fromBase64Url(publicKey.challenge) },
+    }) as PublicKeyCredential;
+    const response = credential.response as AuthenticatorAssertionResponse;
+    return apiJsonRequest<AuthTokenResponse>('/user/webauthn/login/finish', 'POST', 'Passkey sign in failed', {
+      session_id: begin.data.session_id,
+      credential: {
+        id: credential.id,
+        rawId: toBase64Url(credential.rawId),
+        type: credential.type,
+        response: {
+          clientDataJSON: toBase64Url(response.clientDataJSON),
+          authenticatorData: toBase64Url(response.authenticatorData),
+          signature: toBase64Url(response.signature),
+          userHandle: response.userHandle ? toBase64Url(response.userHandle) : undefined,
+        },
+      },
+    });
+  } catch (error) {
+    return { success: false, error: error instanceof Error ? error.message : 'Passkey sign in was cancelled' };
+  }
+}
+
+export async function getPasskeys(): Promise<ApiResponse<{ credentials: Passkey[] }>> {
+  return apiJsonRequest('/user/webauthn/credentials', 'GET', 'Failed to get passkeys');
+}
+
+export async function deletePasskey(id: string): Promise<ApiResponse<{ message: string }>> {
+  return apiJsonRequest(`/user/webauthn/credentials/${id}`, 'DELETE', 'Failed to delete passkey');
+}
+
 // Route sharing API types and functions
+export type CollaboratorRole = 'viewer' | 'contributor' | 'editor' | 'co-owner';
+
 export interface ShareRouteRequest {
   expiryHours?: number;
+  role?: CollaboratorRole;
+  label?: string;
+  maxJoins?: number;
+  passphrase?: string;
+  requireApproval?: boolean;
+}
+
+export interface ShareLink {
+  id: string;
+  routeId: string;
+  token: string;
+  label?: string;
+  role: CollaboratorRole;
+  expiresAt?: string;
+  maxJoins?: number;
+  joinCount: number;
+  createdBy: string;
+  createdAt: string;
+  lastUsedAt?: string;
+  protected: boolean;
+  requireApproval: boolean;
 }
 
 export interface ShareRouteResponse {
   shareToken: string;
   shareUrl: string;
+  role: CollaboratorRole;
   expiresAt?: string;
 }
 
@@ -407,17 +706,22 @@ export interface SharedUser {
  * 
  * @param routeId - The ID of the route to share
  * @param expiryHours - Optional expiry time in hours
+ * @param role - Role granted to people who join through the link
+ * @param passphrase - Optional passphrase people must enter to open the link
  * @returns Share token and URL
  */
-export async function shareRoute(routeId: string, expiryHours?: number): Promise<ApiResponse<ShareRouteResponse>> {
+export async function shareRoute(routeId: string, expiryHours?: number, role: CollaboratorRole = 'contributor', passphrase?: string, requireApproval = false): Promise<ApiResponse<ShareRouteResponse>> {
   try {
-    const response = await apiFetch(`/api/routes/${routeId}/share`, {
+    const response = await apiFetch(`/api/routes/${routeId}/share-links`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
       },
       body: JSON.stringify({
         expiryHours: expiryHours || null,
+        role,
+        passphrase: passphrase || undefined,
+        requireApproval,
       }),
     });
 
@@ -430,9 +734,15 @@ export async function shareRoute(routeId: string, expiryHours?: number): Promise
       };
     }
 
+    const link = data as ShareLink;
     return {
       success: true,
-      data: data,
+      data: {
+        shareToken: link.token,
+        shareUrl: '',
+        role: link.role,
+        expiresAt: link.expiresAt,
+      },
       message: 'Route shared successfully',
     };
   } catch (error) {
@@ -513,9 +823,11 @@ export async function revokeRouteShare(routeId: string): Promise<ApiResponse<{ m
  * @param token - The share token
  * @returns Route data
  */
-export async function getSharedRoute(token: string): Promise<ApiResponse<RouteData>> {
+export async function getSharedRoute(token: string, grant?: string): Promise<ApiResponse<RouteData>> {
   try {
-    const response = await fetch(`${import.meta.env.VITE_API_BASE_URL || 'http://localhost:8080'}/api/shared-routes/${token}`);
+    const response = await fetch(`${import.meta.env.VITE_API_BASE_URL || 'http://localhost:8080'}/api/shared-routes/${token}`, {
+      headers: grant ? { 'X-Share-Grant': grant } : {},
+    });
     const data = await response.json();
     
     if (!response.ok) {
@@ -537,16 +849,59 @@ export async function getSharedRoute(token: string): Promise<ApiResponse<RouteDa
   }
 }
 
+// Error returned for protected share links opened without an access grant
+export const SHARE_PASSPHRASE_REQUIRED = 'this share link needs a passphrase';
+
+// Error returned when previewing a private route; the link can still be joined
+export const SHARE_ROUTE_PRIVATE = 'this route is private; join it to see the details';
+
+/**
+ * Exchange a protected share link's passphrase for a short-lived access grant
+ *
+ * @param token - The share token
+ * @param passphrase - The passphrase set by the route owner
+ * @returns The grant to send with getSharedRoute and joinSharedRoute
+ */
+export async function unlockSharedRoute(token: string, passphrase: string): Promise<ApiResponse<{ grant: string; expiresAt: string }>> {
+  try {
+    const response = await fetch(`${API_BASE_URL}/api/shared-routes/${token}/unlock`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ passphrase }),
+    });
+    const data = await response.json();
+
+    if (!response.ok) {
+      return {
+        success: false,
+        error: data.error || 'Failed to unlock shared route',
+      };
+    }
+
+    return {
+      success: true,
+      data: data,
+    };
+  } catch (error) {
+    return {
+      success: false,
+      error: error instanceof Error ? error.message : 'Unknown error occurred',
+    };
+  }
+}
+
 /**
  * Join a shared route
  * 
  * @param token - The share token
+ * @param grant - Access grant for passphrase-protected links
  * @returns Success message and route data
  */
-export async function joinSharedRoute(token: string): Promise<ApiResponse<any>> {
+export async function joinSharedRoute(token: string, grant?: string): Promise<ApiResponse<any>> {
   try {
     const response = await apiFetch(`/api/shared-routes/${token}/join`, {
       method: 'POST',
+      headers: grant ? { 'X-Share-Grant': grant } : {},
     });
 
     const data = await response.json();
@@ -561,7 +916,8 @@ export async function joinSharedRoute(token: string): Promise<ApiResponse<any>>
     return {
       success: true,
       data: data,
-      message: 'Successfully joined shared route',
+      // 202 means the link needs approval and a join request was filed
+      message: response.status === 202 ? 'Join request sent' : 'Successfully joined shared route',
     };
   } catch (error) {
     return {
@@ -574,11 +930,12 @@ export async function joinSharedRoute(token: string): Promise<ApiResponse<any>>
 /**
  * Get routes shared with the current user
  * 
- * @returns Array of shared routes
+ * @param cursor - nextCursor from the previous page, omitted for the first page
+ * @returns A page of shared routes
  */
-export async function getSharedRoutesForUser(): Promise<ApiResponse<RouteData[]>> {
+export async function getSharedRoutesForUser(cursor?: string): Promise<ApiResponse<RoutePage>> {
   try {
-    const response = await apiFetch('/api/my-shared-routes');
+    const response = await apiFetch(`/api/my-shared-routes${pageQuery(cursor)}`);
     const data = await response.json();
     
     if (!response.ok) {
@@ -588,6 +945,87 @@ export async function getSharedRoutesForUser(): Promise<ApiResponse<RouteData[]>
       };
     }
 
+    return {
+      success: true,
+      data: { routes: data.routes ?? [], nextCursor: data.nextCursor },
+    };
+  } catch (error) {
+    return {
+      success: false,
+      error: error instanceof Error ? error.message : 'Unknown error occurred',
+    };
+  }
+}
+
+export interface RouteInvitation {
+  id: string;
+  routeId: string;
+  routeName: string;
+  email: string;
+  role: CollaboratorRole;
+  invitedBy: string;
+  status: 'pending' | 'accepted' | 'declined';
+  createdAt: string;
+  expiresAt: string;
+}
+
+/**
+ * Invite someone by email to collaborate on a route
+ *
+ * @param routeId - The ID of the route
+ * @param email - Address to invite; they don't need an account yet
+ * @param role - Role granted when they accept
+ * @returns The pending invitation
+ */
+export async function inviteCollaborator(routeId: string, email: string, role?: CollaboratorRole): Promise<ApiResponse<RouteInvitation>> {
+  return apiJsonRequest(`/api/routes/${routeId}/invitations`, 'POST', 'Failed to send invitation', { email, role });
+}
+
+/**
+ * List pending invitations for a route
+ */
+export async function getRouteInvitations(routeId: string): Promise<ApiResponse<{ invitations: RouteInvitation[] }>> {
+  return apiJsonRequest(`/api/routes/${routeId}/invitations`, 'GET', 'Failed to get invitations');
+}
+
+/**
+ * Cancel a pending invitation
+ */
+export async function cancelInvitation(routeId: string, invitationId: string): Promise<ApiResponse<{ message: string }>> {
+  return apiJsonRequest(`/api/routes/${routeId}/invitations/${invitationId}`, 'DELETE', 'Failed to cancel invitation');
+}
+
+/**
+ * List pending invitations addressed to the current user
+ */
+export async function getMyInvitations(): Promise<ApiResponse<{ invitations: RouteInvitation[] }>> {
+  return apiJsonRequest('/api/invitations', 'GET', 'Failed to get invitations');
+}
+
+/**
+ * Accept or decline an invitation addressed to the current user
+ */
+export async function respondToInvitation(invitationId: string, accept: boolean): Promise<ApiResponse<RouteInvitation>> {
+  const action = accept ? 'accept' : 'decline';
+  return apiJsonRequest(`/api/invitations/${invitationId}/${action}`, 'POST', `Failed to ${action} invitation`);
+}
+
+async function apiJsonRequest<T>(path: string, method: string, fallbackError: string, body?: unknown): Promise<ApiResponse<T>> {
+  try {
+    const response = await apiFetch(path, {
+      method,
+      headers: body ? { 'Content-Type': 'application/json' } : undefined,
+      body: body ? JSON.stringify(body) : undefined,
+    });
+    const data = await response.json();
+
+    if (!response.ok) {
+      return {
+        success: false,
+        error: data.error || fallbackError,
+      };
+    }
+
     return {
       success: true,
       data: data,
@@ -599,3 +1037,115 @@ export async function getSharedRoutesForUser(): Promise<ApiResponse<RouteData[]>
     };
   }
 }
+
+export interface JoinRequest {
+  id: string;
+  routeId: string;
+  routeName: string;
+  linkId: string;
+  userId: string;
+  email: string;
+  role: CollaboratorRole;
+  status: 'pending' | 'approved' | 'rejected' | 'cancelled';
+  createdAt: string;
+  decidedAt?: string;
+  decidedBy?: string;
+}
+
+/**
+ * List pending join requests for a route
+ */
+export async function getJoinRequests(routeId: string): Promise<ApiResponse<{ requests: JoinRequest[] }>> {
+  return apiJsonRequest(`/api/routes/${routeId}/join-requests`, 'GET', 'Failed to get join requests');
+}
+
+/**
+ * Approve or reject a pending join request
+ */
+export async function decideJoinRequest(routeId: string, requestId: string, approve: boolean): Promise<ApiResponse<JoinRequest>> {
+  const action = approve ? 'approve' : 'reject';
+  return apiJsonRequest(`/api/routes/${routeId}/join-requests/${requestId}/${action}`, 'POST', `Failed to ${action} join request`);
+}
+
+/**
+ * List the current user's join requests, newest first
+ */
+export async function getMyJoinRequests(): Promise<ApiResponse<{ requests: JoinRequest[] }>> {
+  return apiJsonRequest('/api/my-join-requests', 'GET', 'Failed to get join requests');
+}
+
+/**
+ * Offer ownership of a route to one of its collaborators
+ *
+ * @param routeId - The ID of the route
+ * @param userId - The collaborator who should become the owner
+ * @param keepAccess - Stay on as a co-owner once they accept
+ */
+export async function offerOwnershipTransfer(routeId: string, userId: string, keepAccess = true): Promise<ApiResponse<{ message: string }>> {
+  return apiJsonRequest(`/api/routes/${routeId}/transfer`, 'POST', 'Failed to offer ownership', { userId, keepAccess });
+}
+
+/**
+ * Withdraw a pending ownership offer
+ */
+export async function cancelOwnershipTransfer(routeId: string): Promise<ApiResponse<{ message: string }>> {
+  return apiJsonRequest(`/api/routes/${routeId}/transfer`, 'DELETE', 'Failed to cancel transfer');
+}
+
+/**
+ * Accept or decline ownership offered to the current user
+ */
+export async function respondToOwnershipTransfer(routeId: string, accept: boolean): Promise<ApiResponse<{ message: string }>> {
+  const action = accept ? 'accept' : 'decline';
+  return apiJsonRequest(`/api/routes/${routeId}/transfer/${action}`, 'POST', `Failed to ${action} ownership`);
+}
+
+/**
+ * End the current login on the server by revoking its refresh token
+ *
+ * @param refreshToken - The refresh token for this login
+ */
+export async function logout(refreshToken: string | null): Promise<void> {
+  if (!refreshToken) return;
+  try {
+    await fetch(`${API_BASE_URL}/user/logout`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refresh_token: refreshToken }),
+    });
+  } catch {
+    // Nothing to do; the token expires on its own
+  }
+}
+
+export interface UserSession {
+  id: string;
+  deviceLabel: string;
+  userAgent: string;
+  ip: string;
+  createdAt: string;
+  lastUsedAt: string;
+  expiresAt: string;
+  current: boolean;
+}
+
+/**
+ * List the devices the current user is signed in on
+ */
+export async function getSessions(): Promise<ApiResponse<{ sessions: UserSession[] }>> {
+  return apiJsonRequest('/user/sessions', 'GET', 'Failed to get sessions');
+}
+
+/**
+ * Sign out one session, e.g. a lost phone
+ */
+export async function revokeSession(sessionId: string): Promise<ApiResponse<{ message: string }>> {
+  return apiJsonRequest(`/user/sessions/${sessionId}`, 'DELETE', 'Failed to sign out session');
+}
+
+/**
+ * Sign out every session except this one
+ */
+export async function revokeOtherSessions(): Promise<ApiResponse<{ message: string; revoked: number }>> {
+  return apiJsonRequest('/user/sessions/revoke-others', 'POST', 'Failed to sign out other sessions');
+}
@@ -17,7 +17,7 @@ import { useRouteActions } from '@/hooks/useRouteActions';
 import RouteGrid from '@/components/RouteGrid';
 import { LinkGoogleAccount } from '@/components/LinkGoogleAccount';
 import { UnlinkGoogleConfirm } from '@/components/UnlinkGoogleConfirm';
-import { getUserAuthInfo, unlinkGoogleAccount, UserAuthInfo } from '@/lib/api';
+import { getUserAuthInfo, unlinkIdentity, logout, UserAuthInfo } from '@/lib/api';
 import { useToast } from '@/hooks/use-toast';
 
 interface RoutePoint {
@@ -53,6 +53,8 @@ const Application = () => {
   });
 
   const handleLogout = () => {
+    // Revoke the refresh token server-side; the local sign-out doesn't wait on it
+    logout(localStorage.getItem('refresh_token'));
     localStorage.removeItem('access_token');
     localStorage.removeItem('refresh_token');
     localStorage.removeItem('email');
@@ -106,7 +108,7 @@ const Application = () => {
   const handleUnlinkConfirm = async () => {
     setIsUnlinking(true);
     try {
-      await unlinkGoogleAccount();
+      await unlinkIdentity('google');
       // Refresh auth info
       const updatedInfo = await getUserAuthInfo();
       setAuthInfo(updatedInfo);
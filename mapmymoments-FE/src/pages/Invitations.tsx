@@ -0,0 +1,82 @@
+import { useEffect, useState } from 'react';
+import { useNavigate } from 'react-router-dom';
+import { Button } from "@/components/ui/button";
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card";
+import { Badge } from "@/components/ui/badge";
+import { toast } from "sonner";
+import { getMyInvitations, respondToInvitation, RouteInvitation } from '@/lib/api';
+
+const Invitations = () => {
+  const navigate = useNavigate();
+  const [invitations, setInvitations] = useState<RouteInvitation[]>([]);
+  const [isLoading, setIsLoading] = useState(true);
+  const [busyId, setBusyId] = useState<string | null>(null);
+
+  useEffect(() => {
+    if (!localStorage.getItem('access_token')) {
+      navigate('/login');
+      return;
+    }
+    getMyInvitations().then((result) => {
+      if (result.success && result.data) {
+        setInvitations(result.data.invitations);
+      } else {
+        toast.error(result.error || 'Failed to load invitations');
+      }
+      setIsLoading(false);
+    });
+  }, []);
+
+  const handleRespond = async (invitation: RouteInvitation, accept: boolean) => {
+    setBusyId(invitation.id);
+    const result = await respondToInvitation(invitation.id, accept);
+    setBusyId(null);
+    if (!result.success) {
+      toast.error(result.error || 'Failed to respond to invitation');
+      return;
+    }
+    setInvitations((current) => current.filter((i) => i.id !== invitation.id));
+    if (accept) {
+      toast.success(`You joined ${invitation.routeName}`);
+      navigate(`/route/${invitation.routeId}`);
+    }
+  };
+
+  return (
+    <div className="min-h-screen bg-gray-50 flex items-start justify-center p-4 pt-16">
+      <Card className="w-full max-w-lg">
+        <CardHeader>
+          <CardTitle>Invitations</CardTitle>
+          <CardDescription>Routes other people have invited you to.</CardDescription>
+        </CardHeader>
+        <CardContent className="space-y-3">
+          {isLoading && <p className="text-sm text-gray-500">Loading…</p>}
+          {!isLoading && invitations.length === 0 && (
+            <p className="text-sm text-gray-500">You have no pending invitations.</p>
+          )}
+          {invitations.map((invitation) => (
+            <div key={invitation.id} className="border rounded-lg p-3 flex items-center justify-between gap-3">
+              <div>
+                <p className="font-medium">{invitation.routeName}</p>
+                <p className="text-xs text-gray-500">
+                  From {invitation.invitedBy} · expires {new Date(invitation.expiresAt).toLocaleDateString()}
+                </p>
+                <Badge variant="secondary" className="mt-1">{invitation.role}</Badge>
+              </div>
+              <div className="flex gap-2">
+                <Button size="sm" variant="outline" disabled={busyId === invitation.id} onClick={() => handleRespond(invitation, false)}>
+                  Decline
+                </Button>
+                <Button size="sm" disabled={busyId === invitation.id} onClick={() => handleRespond(invitation, true)}>
+                  Accept
+                </Button>
+              </div>
+            </div>
+          ))}
+        </CardContent>
+      </Card>
+    </div>
+  );
+};
+
+export default Invitations;
@@ -3,10 +3,11 @@ import { useParams, useNavigate } from 'react-router-dom';
 import { Button } from "@/components/ui/button";
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card";
 import { Badge } from "@/components/ui/badge";
+import { Input } from "@/components/ui/input";
 import { Skeleton } from "@/components/ui/skeleton";
-import { MapPin, Users, Calendar, Share2, AlertCircle } from 'lucide-react';
+import { MapPin, Users, Calendar, Share2, AlertCircle, Lock } from 'lucide-react';
 import { toast } from "sonner";
-import { getSharedRoute, joinSharedRoute } from '@/lib/api';
+import { getSharedRoute, joinSharedRoute, unlockSharedRoute, SHARE_PASSPHRASE_REQUIRED, SHARE_ROUTE_PRIVATE } from '@/lib/api';
 
 interface RouteData {
   _id: string;
@@ -28,11 +29,7 @@ interface RouteData {
     cloudfrontUrl: string;
   }>;
   createdAt: number;
-  sharedWith?: Array<{
-    email: string;
-    permission: string;
-    sharedAt: string;
-  }>;
+  collaboratorCount: number;
 }
 
 const JoinSharedRoute = () => {
@@ -43,6 +40,14 @@ const JoinSharedRoute = () => {
   const [isJoining, setIsJoining] = useState(false);
   const [error, setError] = useState<string | null>(null);
   const [isAuthenticated, setIsAuthenticated] = useState(false);
+  const [needsPassphrase, setNeedsPassphrase] = useState(false);
+  // Private routes can be joined through a link but aren't previewed
+  const [isPrivate, setIsPrivate] = useState(false);
+  const [passphrase, setPassphrase] = useState('');
+  const [isUnlocking, setIsUnlocking] = useState(false);
+  // Grants are short-lived, so keep them for this tab only
+  const grantKey = `shareGrant:${token}`;
+  const [grant, setGrant] = useState<string | undefined>(() => sessionStorage.getItem(`shareGrant:${token}`) || undefined);
 
   useEffect(() => {
     // Check if user is authenticated
@@ -54,17 +59,25 @@ const JoinSharedRoute = () => {
     }
   }, [token]);
 
-  const fetchRouteByToken = async () => {
+  const fetchRouteByToken = async (currentGrant = grant) => {
     if (!token) return;
     
     setIsLoading(true);
     setError(null);
     
     try {
-      const response = await getSharedRoute(token);
+      const response = await getSharedRoute(token, currentGrant);
       
       if (response.success && response.data) {
+        setNeedsPassphrase(false);
         setRoute(response.data);
+      } else if (response.error === SHARE_ROUTE_PRIVATE) {
+        setNeedsPassphrase(false);
+        setIsPrivate(true);
+      } else if (response.error === SHARE_PASSPHRASE_REQUIRED) {
+        sessionStorage.removeItem(grantKey);
+        setGrant(undefined);
+        setNeedsPassphrase(true);
       } else {
         throw new Error(response.error || 'Failed to load shared route');
       }
@@ -81,12 +94,14 @@ const JoinSharedRoute = () => {
     setIsJoining(true);
     
     try {
-      const response = await joinSharedRoute(token);
+      const response = await joinSharedRoute(token, grant);
       
-      if (response.success) {
+      if (response.success && response.data?.status === 'pending') {
+        toast.success("Request sent! You'll get access once the owner approves it.");
+      } else if (response.success) {
         toast.success('Successfully joined the shared route!');
         // Navigate to the route details page
-        navigate(`/route/${route?._id}`);
+        navigate(`/route/${response.data?.route?._id ?? route?._id}`);
       } else {
         throw new Error(response.error || 'Failed to join route');
       }
@@ -97,6 +112,29 @@ const JoinSharedRoute = () => {
     }
   };
 
+  const unlockRoute = async () => {
+    if (!token || !passphrase) return;
+    
+    setIsUnlocking(true);
+    
+    try {
+      const response = await unlockSharedRoute(token, passphrase);
+      
+      if (response.success && response.data) {
+        sessionStorage.setItem(grantKey, response.data.grant);
+        setGrant(response.data.grant);
+        setPassphrase('');
+        await fetchRouteByToken(response.data.grant);
+      } else {
+        throw new Error(response.error || 'Failed to unlock route');
+      }
+    } catch (error) {
+      toast.error(error instanceof Error ? error.message : 'Failed to unlock route');
+    } finally {
+      setIsUnlocking(false);
+    }
+  };
+
   const handleLogin = () => {
     // Store the current URL to redirect back after login
     localStorage.setItem('redirectAfterLogin', window.location.pathname);
@@ -142,7 +180,35 @@ const JoinSharedRoute = () => {
     );
   }
 
-  if (!route) {
+  if (needsPassphrase) {
+    return (
+      <div className="min-h-screen bg-gradient-to-br from-blue-50 to-indigo-100 flex items-center justify-center p-4">
+        <Card className="w-full max-w-md">
+          <CardHeader>
+            <CardTitle className="flex items-center gap-2">
+              <Lock className="h-5 w-5 text-blue-600" />
+              This route is protected
+            </CardTitle>
+            <CardDescription>Enter the passphrase the owner shared with you</CardDescription>
+          </CardHeader>
+          <CardContent className="space-y-3">
+            <Input
+              type="password"
+              value={passphrase}
+              onChange={(e) => setPassphrase(e.target.value)}
+              onKeyDown={(e) => e.key === 'Enter' && unlockRoute()}
+              placeholder="Passphrase"
+            />
+            <Button onClick={unlockRoute} disabled={isUnlocking || !passphrase} className="w-full">
+              {isUnlocking ? 'Unlocking...' : 'Unlock'}
+            </Button>
+          </CardContent>
+        </Card>
+      </div>
+    );
+  }
+
+  if (!route && !isPrivate) {
     return null;
   }
 
@@ -161,6 +227,12 @@ const JoinSharedRoute = () => {
         
         <CardContent className="space-y-6">
           {/* Route Info */}
+          {!route ? (
+            <div className="flex items-center gap-2 rounded-lg border p-3 text-sm text-muted-foreground">
+              <Lock className="h-4 w-4" />
+              This route is private. Join it to see the details.
+            </div>
+          ) : (
           <div className="space-y-4">
             <div>
               <h3 className="font-semibold text-lg">{route.name}</h3>
@@ -205,7 +277,7 @@ const JoinSharedRoute = () => {
             <div className="flex items-center gap-4 text-sm">
               <div className="flex items-center gap-1">
                 <Users className="h-4 w-4" />
-                <span>{(route.sharedWith?.length || 0) + 1} member{(route.sharedWith?.length || 0) > 0 ? 's' : ''}</span>
+                <span>{route.collaboratorCount + 1} member{route.collaboratorCount > 0 ? 's' : ''}</span>
               </div>
               <div className="flex items-center gap-1">
                 <MapPin className="h-4 w-4" />
@@ -213,6 +285,7 @@ const JoinSharedRoute = () => {
               </div>
             </div>
           </div>
+          )}
 
           {/* Permissions Info */}
           <div className="rounded-lg bg-blue-50 p-3 border border-blue-200">
@@ -0,0 +1,52 @@
+import { useEffect, useState } from 'react';
+import { Link, useNavigate, useSearchParams } from 'react-router-dom';
+import { verifyMagicLink } from '@/lib/api';
+
+const MagicLink = () => {
+  const [searchParams] = useSearchParams();
+  const [error, setError] = useState('');
+  const navigate = useNavigate();
+
+  useEffect(() => {
+    const token = searchParams.get('token');
+    if (!token) {
+      setError('This sign-in link is incomplete.');
+      return;
+    }
+    verifyMagicLink(token).then(result => {
+      if (!result.success || !result.data) {
+        setError(result.error || 'Failed to sign in.');
+        return;
+      }
+      if ('two_factor_required' in result.data) {
+        navigate('/login', { state: { challengeToken: result.data.challenge_token } });
+        return;
+      }
+      localStorage.setItem('access_token', result.data.access_token);
+      localStorage.setItem('refresh_token', result.data.refresh_token);
+      localStorage.setItem('email', result.data.email);
+      localStorage.setItem('first_name', result.data.first_name);
+      localStorage.setItem('last_name', result.data.last_name);
+      navigate('/app');
+    });
+  }, [searchParams, navigate]);
+
+  return (
+    <div className="min-h-screen flex flex-col bg-cover bg-center" style={{ backgroundImage: 'url(https://images.unsplash.com/photo-1500673922987-e212871fec22?ixlib=rb-1.2.1&auto=format&fit=crop&w=1950&q=80)' }}>
+      <div className="absolute inset-0 hero-gradient z-0"></div>
+      <div className="relative z-10">
+        <div className="container mx-auto px-4 py-8 flex flex-col items-center justify-center min-h-screen">
+          <div className="w-full max-w-md bg-white/90 backdrop-blur-md rounded-lg shadow-lg p-8">
+            <h2 className="text-2xl font-bold text-center text-primary mb-6">Signing In</h2>
+            {error ? <div className="mb-4 text-red-600 text-center">{error}</div> : <div className="mb-4 text-center">Signing you in...</div>}
+            <p className="mt-6 text-center text-sm text-foreground/80">
+              <Link to="/login" className="text-primary hover:underline">Back to Login</Link>
+            </p>
+          </div>
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default MagicLink;
@@ -18,6 +18,9 @@ interface Waypoint {
   address: string;
 }
 
+// Collaborator roles allowed to upload photos ("upload" predates roles)
+const UPLOAD_ROLES = ['upload', 'contributor', 'editor', 'co-owner'];
+
 interface RouteData {
   _id: string;
   name: string;
@@ -270,11 +273,11 @@ const RouteDetails: React.FC = () => {
       const userIsCreator = route.creatorId === email;
       setIsCreator(userIsCreator);
       
-      // Check if user can upload photos (creator or shared user with upload permission)
+      // Check if user can upload photos (creator or a collaborator above viewer)
       let canUpload = userIsCreator;
       if (!userIsCreator && route.sharedWith) {
         const sharedUser = route.sharedWith.find(user => user.email === email);
-        canUpload = sharedUser?.permission === 'upload';
+        canUpload = !!sharedUser && UPLOAD_ROLES.includes(sharedUser.permission);
       }
       setCanUploadPhotos(canUpload);
     }
@@ -1,7 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import { Button } from "@/components/ui/button";
 import { Link, useNavigate } from 'react-router-dom';
-import { apiFetch } from "@/lib/api";
+import { apiFetch, resendOtp } from "@/lib/api";
 
 const SignUp = () => {
   const [form, setForm] = useState({
@@ -93,6 +93,14 @@ const SignUp = () => {
     }
   };
 
+  const handleResendOtp = async () => {
+    setError('');
+    const result = await resendOtp(emailForOtp, 'signup');
+    if (!result.success) {
+      setError(result.error || 'Failed to resend code');
+    }
+  };
+
   return (
     <div className="min-h-screen flex flex-col bg-cover bg-center" style={{ backgroundImage: 'url("https://images.unsplash.com/photo-1500673922987-e212871fec22?ixlib=rb-1.2.1&auto=format&fit=crop&w=1950&q=80")' }}>
       <div className="absolute inset-0 hero-gradient z-0"></div>
@@ -132,6 +140,7 @@ const SignUp = () => {
                   <input type="text" value={otp} onChange={e => setOtp(e.target.value)} className="w-full border rounded px-3 py-2 focus:outline-none focus:ring-2 focus:ring-primary" required />
                 </div>
                 <Button className="w-full bg-primary text-white hover:bg-primary/90 py-2 text-lg rounded" disabled={loading}>{loading ? 'Verifying...' : 'Verify OTP'}</Button>
+                <button type="button" onClick={handleResendOtp} className="w-full text-sm text-primary hover:underline">Resend code</button>
               </form>
             )}
             {step === 'signup' && (
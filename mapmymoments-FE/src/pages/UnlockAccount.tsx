@@ -0,0 +1,45 @@
+import { useEffect, useState } from 'react';
+import { Link, useSearchParams } from 'react-router-dom';
+import { unlockAccount } from '@/lib/api';
+
+const UnlockAccount = () => {
+  const [searchParams] = useSearchParams();
+  const [message, setMessage] = useState('');
+  const [error, setError] = useState('');
+
+  useEffect(() => {
+    const token = searchParams.get('token');
+    if (!token) {
+      setError('This unlock link is incomplete.');
+      return;
+    }
+    unlockAccount(token).then(result => {
+      if (result.success) {
+        setMessage(result.data?.message || 'Your account is unlocked.');
+      } else {
+        setError(result.error || 'Failed to unlock account.');
+      }
+    });
+  }, [searchParams]);
+
+  return (
+    <div className="min-h-screen flex flex-col bg-cover bg-center" style={{ backgroundImage: 'url(https://images.unsplash.com/photo-1500673922987-e212871fec22?ixlib=rb-1.2.1&auto=format&fit=crop&w=1950&q=80)' }}>
+      <div className="absolute inset-0 hero-gradient z-0"></div>
+      <div className="relative z-10">
+        <div className="container mx-auto px-4 py-8 flex flex-col items-center justify-center min-h-screen">
+          <div className="w-full max-w-md bg-white/90 backdrop-blur-md rounded-lg shadow-lg p-8">
+            <h2 className="text-2xl font-bold text-center text-primary mb-6">Unlock Account</h2>
+            {!message && !error && <div className="mb-4 text-center">Unlocking...</div>}
+            {message && <div className="mb-4 text-green-600 text-center">{message}</div>}
+            {error && <div className="mb-4 text-red-600 text-center">{error}</div>}
+            <p className="mt-6 text-center text-sm text-foreground/80">
+              <Link to="/login" className="text-primary hover:underline">Back to Login</Link>
+            </p>
+          </div>
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default UnlockAccount;